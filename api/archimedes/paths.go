@@ -22,6 +22,7 @@ const (
 	RedirectPath           = "/services/%s/redirect"
 	RedirectedPath         = "/services/%s/redirected"
 	SetResolvingAnswerPath = "/services/asnwer"
+	ConfigPath             = "/config"
 )
 
 func GetServicesPath() string {
@@ -55,3 +56,7 @@ func GetRedirectPath(serviceId string) string {
 func GetRedirectedPath(serviceId string) string {
 	return PrefixPath + fmt.Sprintf(RedirectedPath, serviceId)
 }
+
+func GetConfigPath() string {
+	return PrefixPath + ConfigPath
+}
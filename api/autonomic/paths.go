@@ -20,6 +20,7 @@ const (
 	MyLocationPath       = "/location"
 	LoadPath             = "/load/%s"
 	ExplorePath          = "/explored/%s/%s"
+	ConfigPath           = "/config"
 )
 
 func GetServicesPath() string {
@@ -61,3 +62,7 @@ func GetGetLoadForServicePath(serviceId string) string {
 func GetExploredPath(serviceId, childId string) string {
 	return PrefixPath + fmt.Sprintf(ExplorePath, serviceId, childId)
 }
+
+func GetConfigPath() string {
+	return PrefixPath + ConfigPath
+}
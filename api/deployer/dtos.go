@@ -1,15 +1,155 @@
 package deployer
 
 import (
+	"time"
+
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
 )
 
+// HierarchyEntryDTO is the state of a deployment in a node. NumInstances, Load and the statuses are only filled
+// in by the hierarchy table route, with the instances running in the node, the load the autonomic module sees
+// and what the failure detector of the node thinks of the parent and children.
 type HierarchyEntryDTO struct {
-	Parent      *utils.Node
-	Grandparent *utils.Node
-	Children    map[string]*utils.Node
+	Parent         *utils.Node
+	Grandparent    *utils.Node
+	Children       map[string]*utils.Node
+	Static         bool
+	IsOrphan       bool
+	Unhealthy      bool
+	LinkOnly       bool
+	Owner          string
+	NumInstances   int
+	Load           float64
+	Version        uint64
+	ParentStatus   string            `json:",omitempty"`
+	ChildrenStatus map[string]string `json:",omitempty"`
+}
+
+// Statuses of the parents and children of a node, as seen by its failure detector
+const (
+	NodeAlive     = "ALIVE"
+	NodeSuspected = "SUSPECTED"
+	NodeDead      = "DEAD"
+)
+
+// TopologyNodeDTO is a node of the tree of a deployment with the subtree below it. Children that did not reply
+// in time are unreachable and have no subtree.
+type TopologyNodeDTO struct {
+	Node        *utils.Node
+	Location    *publicUtils.Location
+	Instances   []string
+	Load        float64
 	Static      bool
 	IsOrphan    bool
+	LinkOnly    bool
+	Unreachable bool
+	Children    []*TopologyNodeDTO
+}
+
+// Types of the events of the hierarchy of a deployment
+const (
+	EventExtended     = "EXTENDED"
+	EventShortened    = "SHORTENED"
+	EventMigrated     = "MIGRATED"
+	EventOrphaned     = "ORPHANED"
+	EventReparented   = "REPARENTED"
+	EventFallback     = "FALLBACK"
+	EventDeadChild    = "DEAD_CHILD"
+	EventRootTakeover = "ROOT_TAKEOVER"
+	// EventInstanceFailed is an instance of the deployment that failed to start in the node
+	EventInstanceFailed = "INSTANCE_FAILED"
+)
+
+// EventDTO is a change in the hierarchy of a deployment, seen by the Origin node. Node is the other node
+// involved, e.g. the child the deployment was extended to or the new parent.
+type EventDTO struct {
+	Type         string
+	DeploymentId string
+	Origin       string
+	Node         *utils.Node
+	Timestamp    time.Time
+	Details      map[string]string `json:",omitempty"`
+}
+
+// ReplicatedRootDTO is the hierarchy entry of a deployment in its root, replicated by the leader of the root
+// replicas to the others so any of them can take over the deployment
+type ReplicatedRootDTO struct {
+	Static              bool
+	DeploymentYAMLBytes []byte
+	Owner               string
+	Children            map[string]*utils.Node
+}
+
+// RootLeaderDTO is the replica of the root currently leading, empty if there is none yet
+type RootLeaderDTO struct {
+	LeaderId string
+	Term     uint64
+}
+
+// FallbackDTO is a candidate fallback node. Live fallbacks with higher priority are picked first.
+type FallbackDTO struct {
+	Id          string
+	Priority    int
+	Alive       bool
+	LastChecked time.Time
+}
+
+// HeartbeatDTO is the periodic message between two neighbours, nodes that are parent and child in some
+// deployment. Besides telling the receiver the sender is alive, it summarizes the deployments they share.
+type HeartbeatDTO struct {
+	Deployments map[string]*DeploymentSummaryDTO
+}
+
+// DeploymentSummaryDTO has the version of the hierarchy entry of a deployment in a node, bumped on every change
+// to it, and the health of the instances of the deployment running there
+type DeploymentSummaryDTO struct {
+	Version      uint64
+	Instances    int
+	CrashLooping int
+}
+
+// ControlFrameDTO is a message sent to a neighbour over the long-lived control stream between both nodes. Only
+// the field matching the type is set.
+type ControlFrameDTO struct {
+	Type         string
+	Heartbeat    *HeartbeatDTO `json:",omitempty"`
+	Alternatives []*utils.Node `json:",omitempty"`
+}
+
+// Control frame types
+const (
+	FrameHeartbeat    = "HEARTBEAT"
+	FrameAlternatives = "ALTERNATIVES"
+)
+
+// NeighbourDTO is the last heartbeat received from a neighbour
+type NeighbourDTO struct {
+	Id            string
+	LastHeartbeat time.Time
+	Deployments   map[string]*DeploymentSummaryDTO
+}
+
+// EventsDeploymentQueryParam filters the event stream by deployment
+const EventsDeploymentQueryParam = "deployment"
+
+// TopologyTimeoutQueryParam has the milliseconds a node has to reply with its subtree of the topology
+const TopologyTimeoutQueryParam = "timeout"
+
+// InstanceQueryParam selects the instance of the deployment to get the logs from or exec into. Logs can go
+// without it, in which case any instance is used.
+const InstanceQueryParam = "instance"
+
+// MigratedQueryParam tells a node deleting a deployment that it migrated away, so archimedes keeps redirecting
+// its clients to the node that took over instead of forgetting the deployment
+const MigratedQueryParam = "migrated"
+
+// InstanceHealthDTO tells whether an instance is crash looping, or failed to start at all, e.g. because its image
+// could not be pulled
+type InstanceHealthDTO struct {
+	CrashLooping bool
+	Failed       bool
+	Reason       string `json:",omitempty"`
 }
 
 type (
@@ -19,6 +159,10 @@ type (
 		DeploymentId        string
 		Static              bool
 		DeploymentYAMLBytes []byte
+		MigratingFrom       *utils.Node
+		// Owner is the user that registered the deployment. It is only kept when registered by an admin, such
+		// as another node extending or migrating the deployment, otherwise the requesting user owns it.
+		Owner string
 	}
 
 	DeploymentYAML struct {
@@ -28,20 +172,52 @@ type (
 			Template    struct {
 				Spec struct {
 					Containers []struct {
-						Image string
-						Env   []struct {
-							Name  string
-							Value string
+						Image           string
+						ImagePullPolicy string `yaml:"imagePullPolicy"`
+						Env             []struct {
+							Name      string
+							Value     string
+							ValueFrom *struct {
+								SecretKeyRef *SecretKeyRefYAML `yaml:"secretKeyRef"`
+							} `yaml:"valueFrom"`
 						}
 						Ports []struct {
 							ContainerPort string `yaml:"containerPort"`
 						}
+						VolumeMounts []struct {
+							Name      string
+							MountPath string `yaml:"mountPath"`
+						} `yaml:"volumeMounts"`
 					}
+					Volumes []struct {
+						Name          string
+						ReclaimPolicy string `yaml:"reclaimPolicy"`
+					}
+					// ConfigMaps are mounted in every container and can be updated without redeploying
+					ConfigMaps []struct {
+						Name         string
+						MountPath    string `yaml:"mountPath"`
+						ReloadSignal string `yaml:"reloadSignal"`
+						Data         map[string]string
+					} `yaml:"configMaps"`
+					RestartPolicy    string `yaml:"restartPolicy"`
+					ImagePullSecrets []struct {
+						Name string
+					} `yaml:"imagePullSecrets"`
 				}
 			}
 		}
 	}
 
+	// SecretKeyRefYAML references a key of a secret in the secrets store of the root of the deployment
+	SecretKeyRefYAML struct {
+		Name string
+		Key  string
+	}
+
+	// SecretDTO has the values of a secret by key
+	SecretDTO = map[string]string
+
 	MigrateDTO struct {
 		Origin string
 		Target string
@@ -21,7 +21,10 @@ const (
 	DeadChildPath             = "/deployments/%s/deadchild/%s"
 	IAmYourParentPath         = "/deployments/%s/parent"
 	HierarchyTablePath        = "/table"
-	ParentAlivePath           = "/parent/%s/up"
+	HeartbeatPath             = "/heartbeat/%s"
+	NeighboursPath            = "/neighbours"
+	ControlStreamPath         = "/stream/%s"
+	ProbePath                 = "/probe/%s"
 	DeploymentChildPath       = "/deployments/%s/child/%s"
 	MigrateDeploymentPath     = "/deployments/%s/migrate"
 	ExtendServiceToPath       = "/deployments/%s/extend/%s"
@@ -37,10 +40,27 @@ const (
 	HasDeploymentPath         = "/deployments/%s/has"
 	TerminalLocationPath      = "/deployments/%s/terminal"
 	SetExploringPath          = "/deployments/%s/exploring/%s"
+	PrePullImagePath          = "/images"
+	DeploymentLogsPath        = "/deployments/%s/logs"
+	DeploymentExecPath        = "/deployments/%s/exec"
+	DeploymentSecretsPath     = "/deployments/%s/secrets"
+	DeploymentConfigMapPath   = "/deployments/%s/configmaps/%s"
+	DeploymentTopologyPath    = "/deployments/%s/topology"
+	DeploymentEventsPath      = "/deployments/%s/events"
+	EventsPath                = "/events"
+	RootVotePath              = "/root/vote"
+	RootAppendPath            = "/root/append"
+	RootLeaderPath            = "/root/leader"
+	FallbacksPath             = "/fallbacks"
+	FallbackNodePath          = "/fallbacks/%s"
+	SecretPath                = "/secrets/%s"
+	ConfigPath                = "/config"
 
 	// scheduler
-	DeploymentInstanceAlivePath = "/deployments/%s/%s/alive"
-	DeploymentInstancePath      = "/deployments/%s/%s"
+	InstancesPath                = "/instances"
+	DeploymentInstanceAlivePath  = "/deployments/%s/%s/alive"
+	DeploymentInstancePath       = "/deployments/%s/%s"
+	DeploymentInstanceHealthPath = "/deployments/%s/%s/health"
 )
 
 func GetDeploymentsPath() string {
@@ -63,8 +83,20 @@ func GetAddNodePath() string {
 	return PrefixPath + AddNodePath
 }
 
-func GetParentAlivePath(parentId string) string {
-	return PrefixPath + fmt.Sprintf(ParentAlivePath, parentId)
+func GetHeartbeatPath(senderId string) string {
+	return PrefixPath + fmt.Sprintf(HeartbeatPath, senderId)
+}
+
+func GetNeighboursPath() string {
+	return PrefixPath + NeighboursPath
+}
+
+func GetControlStreamPath(senderId string) string {
+	return PrefixPath + fmt.Sprintf(ControlStreamPath, senderId)
+}
+
+func GetProbePath(nodeId string) string {
+	return PrefixPath + fmt.Sprintf(ProbePath, nodeId)
 }
 
 func GetDeadChildPath(serviceId, deadChildId string) string {
@@ -75,6 +107,10 @@ func GetServiceInstancePath(serviceId, instanceId string) string {
 	return PrefixPath + fmt.Sprintf(DeploymentInstancePath, serviceId, instanceId)
 }
 
+func GetServiceInstanceHealthPath(serviceId, instanceId string) string {
+	return PrefixPath + fmt.Sprintf(DeploymentInstanceHealthPath, serviceId, instanceId)
+}
+
 func GetHierarchyTablePath() string {
 	return PrefixPath + HierarchyTablePath
 }
@@ -87,6 +123,10 @@ func GetWhoAreYouPath() string {
 	return PrefixPath + WhoAreYouPath
 }
 
+func GetInstancesPath() string {
+	return PrefixPath + InstancesPath
+}
+
 func GetServiceInstanceAlivePath(serviceId, instanceId string) string {
 	return PrefixPath + fmt.Sprintf(DeploymentInstanceAlivePath, serviceId, instanceId)
 }
@@ -150,3 +190,63 @@ func GetTerminalLocationPath(deploymentId string) string {
 func GetSetExploringPath(deploymentId, childId string) string {
 	return PrefixPath + fmt.Sprintf(SetExploringPath, deploymentId, childId)
 }
+
+func GetPrePullImagePath() string {
+	return PrefixPath + PrePullImagePath
+}
+
+func GetDeploymentLogsPath(deploymentId string) string {
+	return PrefixPath + fmt.Sprintf(DeploymentLogsPath, deploymentId)
+}
+
+func GetDeploymentExecPath(deploymentId string) string {
+	return PrefixPath + fmt.Sprintf(DeploymentExecPath, deploymentId)
+}
+
+func GetDeploymentSecretsPath(deploymentId string) string {
+	return PrefixPath + fmt.Sprintf(DeploymentSecretsPath, deploymentId)
+}
+
+func GetSecretPath(secretName string) string {
+	return PrefixPath + fmt.Sprintf(SecretPath, secretName)
+}
+
+func GetDeploymentConfigMapPath(deploymentId, configMapName string) string {
+	return PrefixPath + fmt.Sprintf(DeploymentConfigMapPath, deploymentId, configMapName)
+}
+
+func GetDeploymentTopologyPath(deploymentId string) string {
+	return PrefixPath + fmt.Sprintf(DeploymentTopologyPath, deploymentId)
+}
+
+func GetDeploymentEventsPath(deploymentId string) string {
+	return PrefixPath + fmt.Sprintf(DeploymentEventsPath, deploymentId)
+}
+
+func GetEventsPath() string {
+	return PrefixPath + EventsPath
+}
+
+func GetRootVotePath() string {
+	return PrefixPath + RootVotePath
+}
+
+func GetRootAppendPath() string {
+	return PrefixPath + RootAppendPath
+}
+
+func GetRootLeaderPath() string {
+	return PrefixPath + RootLeaderPath
+}
+
+func GetFallbacksPath() string {
+	return PrefixPath + FallbacksPath
+}
+
+func GetFallbackNodePath(nodeId string) string {
+	return PrefixPath + fmt.Sprintf(FallbackNodePath, nodeId)
+}
+
+func GetConfigPath() string {
+	return PrefixPath + ConfigPath
+}
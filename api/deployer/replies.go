@@ -10,4 +10,18 @@ type (
 	ResolveUpTheTreeResponseBody          = archimedes.ResolvedDTO
 	RedirectClientDownTheTreeResponseBody = string
 	GetFallbackResponseBody               = string
+	GetInstancesResponseBody              = map[string]string
+	GetDeploymentSecretsResponseBody      = map[string]SecretDTO
+	GetTopologyResponseBody               = TopologyNodeDTO
+	RootVoteResponseBody                  = struct {
+		Term        uint64
+		VoteGranted bool
+	}
+	AppendRootsResponseBody = struct {
+		Term    uint64
+		Success bool
+	}
+	GetRootLeaderResponseBody = RootLeaderDTO
+	GetFallbacksResponseBody  = []*FallbackDTO
+	GetNeighboursResponseBody = map[string]*NeighbourDTO
 )
@@ -2,6 +2,7 @@ package deployer
 
 import (
 	"github.com/bruno-anjos/cloud-edge-deployment/api/archimedes"
+	"github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
 	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
 )
@@ -39,4 +40,30 @@ type (
 		Child    string
 		Location *publicUtils.Location
 	}
+	InstanceHealthRequestBody = InstanceHealthDTO
+	PrePullImageRequestBody   = scheduler.ImageDTO
+	// SetSecretRequestBody has the values of the secret and the users whose deployments may reference it
+	SetSecretRequestBody = struct {
+		Values SecretDTO
+		Users  []string
+	}
+	// UpdateConfigMapRequestBody has the new files of the config map by name
+	UpdateConfigMapRequestBody = map[string]string
+	ForwardEventRequestBody    = EventDTO
+	HeartbeatRequestBody       = HeartbeatDTO
+	SetFallbackRequestBody     = struct {
+		Priority int
+	}
+	RootVoteRequestBody = struct {
+		Term        uint64
+		CandidateId string
+		LastTerm    uint64
+		Version     uint64
+	}
+	AppendRootsRequestBody = struct {
+		Term     uint64
+		LeaderId string
+		Version  uint64
+		Roots    map[string]*ReplicatedRootDTO
+	}
 )
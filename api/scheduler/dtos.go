@@ -1,13 +1,150 @@
 package scheduler
 
 import (
+	"net/url"
+	"strconv"
+	"time"
+
 	"github.com/docker/go-connections/nat"
+	"github.com/pkg/errors"
 )
 
 type ContainerInstanceDTO struct {
-	ServiceName string `json:"service_name"`
-	ImageName   string `json:"image_name"`
-	Ports       nat.PortSet
-	Static      bool
-	EnvVars     []string
+	ServiceName   string `json:"service_name"`
+	Image         *ImageDTO
+	Ports         nat.PortSet
+	Static        bool
+	EnvVars       []string
+	Volumes       []*VolumeDTO
+	Snapshot      *SnapshotDTO
+	RestartPolicy string
+	ConfigMaps    []*ConfigMapDTO
+}
+
+// Image pull policies, applied when starting an instance or pre-pulling its image
+const (
+	ImagePullAlways       = "Always"
+	ImagePullIfNotPresent = "IfNotPresent"
+	ImagePullNever        = "Never"
+)
+
+// ImageDTO holds an image with its pull policy and the names of the registry credentials, configured in each
+// scheduler, it may be pulled with
+type ImageDTO struct {
+	Name        string
+	PullPolicy  string
+	PullSecrets []string
+}
+
+// Restart policies, applied when an instance container exits
+const (
+	RestartAlways    = "Always"
+	RestartOnFailure = "OnFailure"
+	RestartNever     = "Never"
+)
+
+// Volume reclaim policies, applied to the volumes left on a node when the deployment is deleted
+const (
+	VolumeReclaimRetain = "Retain"
+	VolumeReclaimDelete = "Delete"
+)
+
+type VolumeDTO struct {
+	Name          string
+	MountPath     string
+	ReclaimPolicy string
+}
+
+// ConfigMapDTO has the files, by name, mounted in a directory of the instances of a deployment. When it is
+// updated, the files change in place and, if set, the reload signal is sent to the running instances.
+type ConfigMapDTO struct {
+	Name         string
+	MountPath    string
+	ReloadSignal string
+	Data         map[string]string
+}
+
+type InstanceStatsDTO struct {
+	CPUPercentage float64
+	MemoryUsage   uint64
+	MemoryLimit   uint64
+}
+
+// SnapshotDTO points to the instance whose volumes should be copied into a new instance before it starts
+type SnapshotDTO struct {
+	SchedulerAddr string
+	InstanceId    string
 }
+
+// Query parameters of log requests
+const (
+	LogsFollowQueryParam = "follow"
+	LogsTailQueryParam   = "tail"
+	LogsSinceQueryParam  = "since"
+
+	LogsTailAll = "all"
+)
+
+// LogsOptionsDTO selects the logs of an instance. Tail is a number of lines or all, and Since is either a
+// timestamp (RFC 3339 or unix) or a duration relative to now, such as 10m.
+type LogsOptionsDTO struct {
+	Follow bool
+	Tail   string
+	Since  string
+}
+
+func (o *LogsOptionsDTO) ToQuery() url.Values {
+	query := url.Values{}
+	if o.Follow {
+		query.Set(LogsFollowQueryParam, strconv.FormatBool(o.Follow))
+	}
+	if o.Tail != "" {
+		query.Set(LogsTailQueryParam, o.Tail)
+	}
+	if o.Since != "" {
+		query.Set(LogsSinceQueryParam, o.Since)
+	}
+
+	return query
+}
+
+func LogsOptionsFromQuery(query url.Values) (*LogsOptionsDTO, error) {
+	options := &LogsOptionsDTO{
+		Tail:  query.Get(LogsTailQueryParam),
+		Since: query.Get(LogsSinceQueryParam),
+	}
+
+	if follow := query.Get(LogsFollowQueryParam); follow != "" {
+		var err error
+		options.Follow, err = strconv.ParseBool(follow)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid follow")
+		}
+	}
+
+	if options.Tail != "" && options.Tail != LogsTailAll {
+		lines, err := strconv.Atoi(options.Tail)
+		if err != nil || lines < 0 {
+			return nil, errors.Errorf("invalid tail %s", options.Tail)
+		}
+	}
+
+	if options.Since != "" {
+		_, timestampErr := time.Parse(time.RFC3339, options.Since)
+		_, unixErr := strconv.ParseInt(options.Since, 10, 64)
+		_, durationErr := time.ParseDuration(options.Since)
+		if timestampErr != nil && unixErr != nil && durationErr != nil {
+			return nil, errors.Errorf("invalid since %s", options.Since)
+		}
+	}
+
+	return options, nil
+}
+
+// Exec requests take the command as repeated query parameters, stream stdin in the request body and the
+// output in the response body, which has the exit code in a trailer once the command exits. They need a full
+// duplex stream, so they are done over HTTP/2.
+const (
+	ExecCmdQueryParam   = "cmd"
+	ExecExitCodeTrailer = "Exec-Exit-Code"
+)
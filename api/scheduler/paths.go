@@ -8,8 +8,16 @@ import (
 const (
 	PrefixPath = "/scheduler"
 
-	InstancesPath = "/instances"
-	InstancePath  = "/instances/%s"
+	InstancesPath           = "/instances"
+	InstancePath            = "/instances/%s"
+	InstanceVolumePath      = "/instances/%s/volumes/%s"
+	InstanceStatsPath       = "/instances/%s/stats"
+	InstanceLogsPath        = "/instances/%s/logs"
+	InstanceExecPath        = "/instances/%s/exec"
+	DeploymentPath          = "/deployments/%s"
+	DeploymentConfigMapPath = "/deployments/%s/configmaps/%s"
+	ImagesPath              = "/images"
+	ConfigPath              = "/config"
 )
 
 func GetInstancesPath() string {
@@ -19,3 +27,35 @@ func GetInstancesPath() string {
 func GetInstancePath(instanceId string) string {
 	return PrefixPath + fmt.Sprintf(InstancePath, instanceId)
 }
+
+func GetInstanceVolumePath(instanceId, volumeName string) string {
+	return PrefixPath + fmt.Sprintf(InstanceVolumePath, instanceId, volumeName)
+}
+
+func GetInstanceStatsPath(instanceId string) string {
+	return PrefixPath + fmt.Sprintf(InstanceStatsPath, instanceId)
+}
+
+func GetInstanceLogsPath(instanceId string) string {
+	return PrefixPath + fmt.Sprintf(InstanceLogsPath, instanceId)
+}
+
+func GetDeploymentPath(deploymentId string) string {
+	return PrefixPath + fmt.Sprintf(DeploymentPath, deploymentId)
+}
+
+func GetImagesPath() string {
+	return PrefixPath + ImagesPath
+}
+
+func GetInstanceExecPath(instanceId string) string {
+	return PrefixPath + fmt.Sprintf(InstanceExecPath, instanceId)
+}
+
+func GetDeploymentConfigMapPath(deploymentId, configMapName string) string {
+	return PrefixPath + fmt.Sprintf(DeploymentConfigMapPath, deploymentId, configMapName)
+}
+
+func GetConfigPath() string {
+	return PrefixPath + ConfigPath
+}
@@ -0,0 +1,5 @@
+package scheduler
+
+type (
+	GetInstanceStatsResponseBody = InstanceStatsDTO
+)
@@ -1,5 +1,7 @@
 package scheduler
 
 type (
-	StartInstanceRequestBody = ContainerInstanceDTO
+	StartInstanceRequestBody   = ContainerInstanceDTO
+	PullImageRequestBody       = ImageDTO
+	UpdateConfigMapRequestBody = ConfigMapDTO
 )
@@ -2,21 +2,46 @@ package main
 
 import (
 	"flag"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
 	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	credentialsFlagName = "credentials"
+	jsonFlagName        = "json"
 )
 
 var (
-	deployerClient = deployer.NewDeployerClient(utils.LocalhostAddr + ":" + strconv.Itoa(deployer.Port))
+	deployerAddr = utils.LocalhostAddr + ":" + strconv.Itoa(deployer.Port)
+	// transport and deployerClient are only set once the credentials are loaded
+	transport      *utils.Transport
+	deployerClient *deployer.Client
+
+	defaultCredentialsFilename = filepath.Join(".cloud-edge-deployment", "credentials.yaml")
+
+	jsonFlag = &cli.BoolFlag{
+		Name:  jsonFlagName,
+		Usage: "print as JSON",
+	}
 )
 
+type credentials struct {
+	Token string
+}
+
 func main() {
 	debug := flag.Bool("d", false, "add debug logs")
 	flag.Parse()
@@ -26,6 +51,17 @@ func main() {
 	}
 
 	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name: credentialsFlagName,
+				Usage: "YAML file with the token to authenticate with, defaults to ~/" +
+					defaultCredentialsFilename,
+			},
+		},
+		Before: func(c *cli.Context) error {
+			loadCredentials(c.String(credentialsFlagName))
+			return nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:    "add",
@@ -83,6 +119,209 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:  "logs",
+				Usage: "print the logs of an instance of a deployment",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "follow",
+						Aliases: []string{"f"},
+						Usage:   "follow the logs",
+					},
+					&cli.StringFlag{
+						Name:  "tail",
+						Usage: "number of lines to show from the end of the logs, or all",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "show logs since a timestamp or a relative duration, such as 10m",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 && c.Args().Len() != 2 {
+						log.Fatal("logs: deployment_name [instance_id]")
+					}
+
+					printLogs(c.Args().First(), c.Args().Get(1), &scheduler.LogsOptionsDTO{
+						Follow: c.Bool("follow"),
+						Tail:   c.String("tail"),
+						Since:  c.String("since"),
+					})
+
+					return nil
+				},
+			},
+			{
+				Name:      "exec",
+				Usage:     "run a command in an instance of a deployment",
+				ArgsUsage: "deployment_name instance_id -- cmd [args...]",
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() < 3 {
+						log.Fatal("exec: deployment_name instance_id -- cmd [args...]")
+					}
+
+					execInInstance(c.Args().First(), c.Args().Get(1), c.Args().Slice()[2:])
+
+					return nil
+				},
+			},
+			{
+				Name:    "list",
+				Aliases: []string{"ls"},
+				Usage:   "list the deployments in the node",
+				Flags:   []cli.Flag{jsonFlag},
+				Action: func(c *cli.Context) error {
+					listDeployments(c.Bool(jsonFlagName))
+
+					return nil
+				},
+			},
+			{
+				Name:  "describe",
+				Usage: "show the state of a deployment in the node",
+				Flags: []cli.Flag{jsonFlag},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						log.Fatal("describe: deployment_name")
+					}
+
+					describeDeployment(c.Args().First(), c.Bool(jsonFlagName))
+
+					return nil
+				},
+			},
+			{
+				Name:  "tree",
+				Usage: "show the whole tree of a deployment, with the instances in each node",
+				Flags: []cli.Flag{jsonFlag},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						log.Fatal("tree: deployment_name")
+					}
+
+					printTree(c.Args().First(), c.Bool(jsonFlagName))
+
+					return nil
+				},
+			},
+			{
+				Name:  "neighbours",
+				Usage: "show the last heartbeat of each parent and child of the node",
+				Flags: []cli.Flag{jsonFlag},
+				Action: func(c *cli.Context) error {
+					listNeighbours(c.Bool(jsonFlagName))
+
+					return nil
+				},
+			},
+			{
+				Name:      "events",
+				Usage:     "follow the hierarchy events seen by the deployer, optionally of a single deployment",
+				ArgsUsage: "[deployment_name]",
+				Flags:     []cli.Flag{jsonFlag},
+				Action: func(c *cli.Context) error {
+					followEvents(c.Args().First(), c.Bool(jsonFlagName))
+
+					return nil
+				},
+			},
+			{
+				Name:      "configmap",
+				Usage:     "replace the files of a config map of a deployment, named after the given files",
+				ArgsUsage: "deployment_name config_map_name file [file...]",
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() < 3 {
+						log.Fatal("configmap: deployment_name config_map_name file [file...]")
+					}
+
+					updateConfigMap(c.Args().First(), c.Args().Get(1), c.Args().Slice()[2:])
+
+					return nil
+				},
+			},
+			{
+				Name:  "secret",
+				Usage: "manage the secrets deployments reference in their environment variables",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "set",
+						Usage:     "create or replace a secret",
+						ArgsUsage: "secret_name key=value [key=value...]",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "user",
+								Usage: "user whose deployments may reference the secret, besides admins",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() < 2 {
+								log.Fatal("secret set: secret_name key=value [key=value...]")
+							}
+
+							setSecret(c.Args().First(), c.Args().Slice()[1:], c.StringSlice("user"))
+
+							return nil
+						},
+					},
+					{
+						Name:  "del",
+						Usage: "delete a secret",
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() != 1 {
+								log.Fatal("secret del: secret_name")
+							}
+
+							deleteSecret(c.Args().First())
+
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "fallback",
+				Usage: "manage the nodes orphan deployments fall back to",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Usage:   "list the fallbacks in the order they are picked in",
+						Flags:   []cli.Flag{jsonFlag},
+						Action: func(c *cli.Context) error {
+							listFallbacks(c.Bool(jsonFlagName))
+
+							return nil
+						},
+					},
+					{
+						Name:      "set",
+						Usage:     "add a fallback or change its priority",
+						ArgsUsage: "node_id [priority]",
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() < 1 || c.Args().Len() > 2 {
+								log.Fatal("fallback set: node_id [priority]")
+							}
+
+							setFallback(c.Args().First(), c.Args().Get(1))
+
+							return nil
+						},
+					},
+					{
+						Name:  "del",
+						Usage: "delete a fallback",
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() != 1 {
+								log.Fatal("fallback del: node_id")
+							}
+
+							deleteFallback(c.Args().First())
+
+							return nil
+						},
+					},
+				},
+			},
 		},
 	}
 
@@ -92,6 +331,54 @@ func main() {
 	}
 }
 
+// loadCredentials makes the transport and the client of the deployer, with the token their requests authenticate
+// with. A token in the environment takes precedence over the credentials file, which is optional unless given
+// explicitly.
+func loadCredentials(filename string) {
+	security, err := utils.LoadSecurityFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if security.AuthToken == "" {
+		security.AuthToken = readCredentialsToken(filename)
+	}
+
+	transport = utils.NewTransport(nil, security)
+	deployerClient = &deployer.Client{
+		GenericClient: transport.NewGenericClient(deployerAddr),
+	}
+}
+
+// readCredentialsToken returns the token in the credentials file, if there is one
+func readCredentialsToken(filename string) string {
+
+	explicit := filename != ""
+	if !explicit {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+
+		filename = filepath.Join(home, defaultCredentialsFilename)
+	}
+
+	fileBytes, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) && !explicit {
+		return ""
+	} else if err != nil {
+		log.Fatal("error reading credentials file: ", err)
+	}
+
+	var creds credentials
+	err = yaml.Unmarshal(fileBytes, &creds)
+	if err != nil {
+		log.Fatal("error parsing credentials file: ", err)
+	}
+
+	return creds.Token
+}
+
 func addNode(addr string) {
 	status := deployerClient.AddNode(addr)
 	if status != http.StatusOK {
@@ -105,7 +392,7 @@ func addDeployment(serviceId, filename string, static bool) {
 		log.Fatal("error reading file: ", err)
 	}
 
-	status := deployerClient.RegisterService(serviceId, static, fileBytes, nil, nil)
+	status := deployerClient.RegisterService(serviceId, static, fileBytes, nil, nil, "")
 	if status != http.StatusOK {
 		log.Fatalf("got status %d from deployer", status)
 	}
@@ -117,3 +404,103 @@ func deleteDeployment(serviceId string) {
 		log.Fatalf("got status %d from deployer", status)
 	}
 }
+
+func updateConfigMap(deploymentId, configMapName string, filenames []string) {
+	data := map[string]string{}
+	for _, filename := range filenames {
+		fileBytes, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Fatal("error reading file: ", err)
+		}
+
+		data[filepath.Base(filename)] = string(fileBytes)
+	}
+
+	status := deployerClient.UpdateConfigMap(deploymentId, configMapName, data)
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+}
+
+func setSecret(secretName string, keyValues, users []string) {
+	secret := api.SecretDTO{}
+	for _, keyValue := range keyValues {
+		splitIdx := strings.Index(keyValue, "=")
+		if splitIdx <= 0 {
+			log.Fatalf("invalid key=value %q", keyValue)
+		}
+
+		secret[keyValue[:splitIdx]] = keyValue[splitIdx+1:]
+	}
+
+	status := deployerClient.SetSecret(secretName, secret, users)
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+}
+
+func deleteSecret(secretName string) {
+	status := deployerClient.DeleteSecret(secretName)
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+}
+
+func setFallback(nodeId, priorityString string) {
+	priority := 0
+	if priorityString != "" {
+		var err error
+		priority, err = strconv.Atoi(priorityString)
+		if err != nil {
+			log.Fatalf("invalid priority %q", priorityString)
+		}
+	}
+
+	status := deployerClient.SetFallback(nodeId, priority)
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+}
+
+func deleteFallback(nodeId string) {
+	status := deployerClient.DeleteFallback(nodeId)
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+}
+
+func printLogs(deploymentId, instanceId string, options *scheduler.LogsOptionsDTO) {
+	logs, status := deployerClient.GetDeploymentLogs(deploymentId, instanceId, options)
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+
+	defer func() {
+		_ = logs.Close()
+	}()
+
+	_, err := io.Copy(os.Stdout, logs)
+	if err != nil {
+		log.Fatal("error reading logs: ", err)
+	}
+}
+
+func execInInstance(deploymentId, instanceId string, cmd []string) {
+	resp, status := deployerClient.Exec(deploymentId, instanceId, cmd, os.Stdin)
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+
+	_, err := io.Copy(os.Stdout, resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		log.Fatal("error reading exec output: ", err)
+	}
+
+	exitCode, err := strconv.Atoi(resp.Trailer.Get(scheduler.ExecExitCodeTrailer))
+	if err != nil {
+		log.Fatal("exec ended without an exit code")
+	}
+
+	os.Exit(exitCode)
+}
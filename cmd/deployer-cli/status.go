@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	log "github.com/sirupsen/logrus"
+)
+
+// treeNode is a node of a deployment tree, as rendered by the tree command
+type treeNode struct {
+	Node         *utils.Node
+	NumInstances int
+	Load         float64
+	Static       bool
+	IsOrphan     bool
+	LinkOnly     bool
+	Unhealthy    bool
+	Unreachable  bool `json:",omitempty"`
+	Children     []*treeNode
+}
+
+func getLocalHierarchyTable() map[string]*api.HierarchyEntryDTO {
+	table, status := deployerClient.GetHierarchyTable()
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+
+	return table
+}
+
+func printJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(value)
+	if err != nil {
+		log.Fatal("error encoding JSON: ", err)
+	}
+}
+
+func nodeToString(node *utils.Node) string {
+	if node == nil {
+		return "-"
+	}
+
+	return node.Id
+}
+
+func flagsToString(static, isOrphan, linkOnly, unhealthy bool) string {
+	var flags []string
+	if static {
+		flags = append(flags, "static")
+	}
+	if isOrphan {
+		flags = append(flags, "orphan")
+	}
+	if linkOnly {
+		flags = append(flags, "link-only")
+	}
+	if unhealthy {
+		flags = append(flags, "unhealthy")
+	}
+
+	return strings.Join(flags, ",")
+}
+
+func entryFlags(entry *api.HierarchyEntryDTO) string {
+	flags := flagsToString(entry.Static, entry.IsOrphan, entry.LinkOnly, entry.Unhealthy)
+	if flags == "" {
+		return "-"
+	}
+
+	return flags
+}
+
+func listDeployments(asJSON bool) {
+	table := getLocalHierarchyTable()
+
+	if asJSON {
+		printJSON(table)
+		return
+	}
+
+	deploymentIds := make([]string, 0, len(table))
+	for deploymentId := range table {
+		deploymentIds = append(deploymentIds, deploymentId)
+	}
+	sort.Strings(deploymentIds)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "DEPLOYMENT\tPARENT\tCHILDREN\tINSTANCES\tLOAD\tFLAGS")
+
+	for _, deploymentId := range deploymentIds {
+		entry := table[deploymentId]
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%.2f\t%s\n", deploymentId, nodeToString(entry.Parent),
+			len(entry.Children), entry.NumInstances, entry.Load, entryFlags(entry))
+	}
+
+	err := writer.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func describeDeployment(deploymentId string, asJSON bool) {
+	entry, ok := getLocalHierarchyTable()[deploymentId]
+	if !ok {
+		log.Fatalf("deployment %s is not in this node", deploymentId)
+	}
+
+	if asJSON {
+		printJSON(entry)
+		return
+	}
+
+	childIds := make([]string, 0, len(entry.Children))
+	for childId := range entry.Children {
+		childIds = append(childIds, childId)
+	}
+	sort.Strings(childIds)
+
+	for i, childId := range childIds {
+		if childStatus, ok := entry.ChildrenStatus[childId]; ok {
+			childIds[i] = fmt.Sprintf("%s (%s)", childId, childStatus)
+		}
+	}
+
+	children := "-"
+	if len(childIds) > 0 {
+		children = strings.Join(childIds, ", ")
+	}
+
+	parent := nodeToString(entry.Parent)
+	if entry.ParentStatus != "" {
+		parent = fmt.Sprintf("%s (%s)", parent, entry.ParentStatus)
+	}
+
+	owner := entry.Owner
+	if owner == "" {
+		owner = "-"
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(writer, "Deployment:\t%s\n", deploymentId)
+	_, _ = fmt.Fprintf(writer, "Owner:\t%s\n", owner)
+	_, _ = fmt.Fprintf(writer, "Parent:\t%s\n", parent)
+	_, _ = fmt.Fprintf(writer, "Grandparent:\t%s\n", nodeToString(entry.Grandparent))
+	_, _ = fmt.Fprintf(writer, "Children:\t%s\n", children)
+	_, _ = fmt.Fprintf(writer, "Static:\t%t\n", entry.Static)
+	_, _ = fmt.Fprintf(writer, "Orphan:\t%t\n", entry.IsOrphan)
+	_, _ = fmt.Fprintf(writer, "Link only:\t%t\n", entry.LinkOnly)
+	_, _ = fmt.Fprintf(writer, "Unhealthy:\t%t\n", entry.Unhealthy)
+	_, _ = fmt.Fprintf(writer, "Instances:\t%d\n", entry.NumInstances)
+	_, _ = fmt.Fprintf(writer, "Load:\t%.2f\n", entry.Load)
+
+	err := writer.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func listFallbacks(asJSON bool) {
+	fallbacks, status := deployerClient.GetFallbacks()
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+
+	if asJSON {
+		printJSON(fallbacks)
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "NODE\tPRIORITY\tALIVE\tLAST CHECKED")
+
+	for _, fallback := range fallbacks {
+		lastChecked := "-"
+		if !fallback.LastChecked.IsZero() {
+			lastChecked = fallback.LastChecked.Format("15:04:05")
+		}
+
+		_, _ = fmt.Fprintf(writer, "%s\t%d\t%t\t%s\n", fallback.Id, fallback.Priority, fallback.Alive, lastChecked)
+	}
+
+	err := writer.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func listNeighbours(asJSON bool) {
+	neighbours, status := deployerClient.GetNeighbours()
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+
+	if asJSON {
+		printJSON(neighbours)
+		return
+	}
+
+	neighbourIds := make([]string, 0, len(neighbours))
+	for neighbourId := range neighbours {
+		neighbourIds = append(neighbourIds, neighbourId)
+	}
+	sort.Strings(neighbourIds)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "NODE\tLAST HEARTBEAT\tDEPLOYMENT\tVERSION\tINSTANCES\tCRASH LOOPING")
+
+	for _, neighbourId := range neighbourIds {
+		neighbour := neighbours[neighbourId]
+		lastHeartbeat := neighbour.LastHeartbeat.Format("15:04:05")
+
+		if len(neighbour.Deployments) == 0 {
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t-\t-\t-\t-\n", neighbourId, lastHeartbeat)
+			continue
+		}
+
+		deploymentIds := make([]string, 0, len(neighbour.Deployments))
+		for deploymentId := range neighbour.Deployments {
+			deploymentIds = append(deploymentIds, deploymentId)
+		}
+		sort.Strings(deploymentIds)
+
+		for _, deploymentId := range deploymentIds {
+			summary := neighbour.Deployments[deploymentId]
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%d\t%d\n", neighbourId, lastHeartbeat, deploymentId,
+				summary.Version, summary.Instances, summary.CrashLooping)
+		}
+	}
+
+	err := writer.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// printTree finds the root of the deployment by going up the parents from this node and then walks the
+// hierarchy tables of every node down the tree
+func printTree(deploymentId string, asJSON bool) {
+	entry, ok := getLocalHierarchyTable()[deploymentId]
+	if !ok {
+		log.Fatalf("deployment %s is not in this node", deploymentId)
+	}
+
+	localId, status := deployerClient.WhoAreYou()
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+
+	root := utils.NewNode(localId, utils.LocalhostAddr)
+	visited := map[string]struct{}{}
+	for entry.Parent != nil {
+		if _, ok = visited[entry.Parent.Id]; ok {
+			log.Fatalf("found a cycle going up the tree of %s at %s", deploymentId, entry.Parent.Id)
+		}
+		visited[entry.Parent.Id] = struct{}{}
+
+		root = entry.Parent
+
+		var table map[string]*api.HierarchyEntryDTO
+		table, status = getNodeHierarchyTable(root)
+		if status != http.StatusOK {
+			log.Fatalf("got status %d from %s going up the tree", status, root.Id)
+		}
+
+		entry, ok = table[deploymentId]
+		if !ok {
+			log.Fatalf("deployment %s is not in %s going up the tree", deploymentId, root.Id)
+		}
+	}
+
+	tree := walkTree(deploymentId, root, entry, map[string]struct{}{})
+
+	if asJSON {
+		printJSON(tree)
+		return
+	}
+
+	fmt.Println(treeNodeToString(tree))
+	printTreeChildren(tree, "")
+}
+
+func getNodeHierarchyTable(node *utils.Node) (map[string]*api.HierarchyEntryDTO, int) {
+	// remote nodes are asked with the credentials of the local one
+	depClient := &deployer.Client{
+		GenericClient: transport.NewGenericClient(node.Addr + ":" + strconv.Itoa(deployer.Port)),
+	}
+	return depClient.GetHierarchyTable()
+}
+
+// walkTree builds the tree below the node with the given entry
+func walkTree(deploymentId string, node *utils.Node, entry *api.HierarchyEntryDTO,
+	visited map[string]struct{}) *treeNode {
+	visited[node.Id] = struct{}{}
+
+	tNode := &treeNode{
+		Node:         node,
+		NumInstances: entry.NumInstances,
+		Load:         entry.Load,
+		Static:       entry.Static,
+		IsOrphan:     entry.IsOrphan,
+		LinkOnly:     entry.LinkOnly,
+		Unhealthy:    entry.Unhealthy,
+	}
+
+	childIds := make([]string, 0, len(entry.Children))
+	for childId := range entry.Children {
+		childIds = append(childIds, childId)
+	}
+	sort.Strings(childIds)
+
+	for _, childId := range childIds {
+		child := entry.Children[childId]
+		if _, ok := visited[child.Id]; ok {
+			continue
+		}
+
+		table, status := getNodeHierarchyTable(child)
+		childEntry, ok := table[deploymentId]
+		if status != http.StatusOK || !ok {
+			visited[child.Id] = struct{}{}
+			tNode.Children = append(tNode.Children, &treeNode{Node: child, Unreachable: true})
+			continue
+		}
+
+		tNode.Children = append(tNode.Children, walkTree(deploymentId, child, childEntry, visited))
+	}
+
+	return tNode
+}
+
+func treeNodeToString(tNode *treeNode) string {
+	if tNode.Unreachable {
+		return tNode.Node.Id + " (unreachable)"
+	}
+
+	result := fmt.Sprintf("%s (%d instances, load %.2f)", tNode.Node.Id, tNode.NumInstances, tNode.Load)
+	if flags := flagsToString(tNode.Static, tNode.IsOrphan, tNode.LinkOnly, tNode.Unhealthy); flags != "" {
+		result += " [" + flags + "]"
+	}
+
+	return result
+}
+
+func printTreeChildren(tNode *treeNode, prefix string) {
+	for i, child := range tNode.Children {
+		connector, childPrefix := "├── ", "│   "
+		if i == len(tNode.Children)-1 {
+			connector, childPrefix = "└── ", "    "
+		}
+
+		fmt.Println(prefix + connector + treeNodeToString(child))
+		printTreeChildren(child, prefix+childPrefix)
+	}
+}
+
+// followEvents prints the events the deployer streams, one per line, until the stream ends
+func followEvents(deploymentId string, asJSON bool) {
+	events, status := deployerClient.StreamEvents(deploymentId)
+	if status != http.StatusOK {
+		log.Fatalf("got status %d from deployer", status)
+	}
+
+	defer func() {
+		_ = events.Close()
+	}()
+
+	for {
+		event, err := events.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			log.Fatal(err)
+		}
+
+		if asJSON {
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Fatal("error encoding JSON: ", err)
+			}
+
+			fmt.Println(string(data))
+			continue
+		}
+
+		details := make([]string, 0, len(event.Details))
+		for key, value := range event.Details {
+			details = append(details, key+"="+value)
+		}
+		sort.Strings(details)
+
+		fmt.Printf("%s %-10s %s at %s node %s %s\n", event.Timestamp.Format("15:04:05.000"), event.Type,
+			event.DeploymentId, event.Origin, nodeToString(event.Node), strings.Join(details, " "))
+	}
+}
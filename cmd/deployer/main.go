@@ -1,16 +1,12 @@
 package main
 
 import (
-	deployer2 "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
 	internal "github.com/bruno-anjos/cloud-edge-deployment/internal/deployer"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
-)
-
-const (
-	serviceName = "DEPLOYER"
 )
 
 func main() {
-	utils.StartServer(serviceName, deployer.DefaultHostPort, deployer.Port, deployer2.PrefixPath, internal.Routes)
+	conf := config.Get()
+	utils.RunUntilSignaled(internal.NewServer(internal.WithConfig(conf)), conf.Server.Debug)
 }
@@ -7,19 +7,11 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"os"
-	"strconv"
-	"sync"
 	"sync/atomic"
 
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
-	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
-
 	api "github.com/bruno-anjos/cloud-edge-deployment/api/archimedes"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/archimedes"
 	"github.com/docker/go-connections/nat"
-	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -34,42 +26,7 @@ type (
 	redirectionsMapValue = *redirectedConfig
 )
 
-const (
-	maxHops = 2
-)
-
-var (
-	messagesReceived sync.Map
-	sTable           *servicesTable
-	redirectionsMap  sync.Map
-	archimedesId     string
-	resolvingInTree  sync.Map
-	resolvedInTree   sync.Map
-	waitingChannels  sync.Map
-	hostname         string
-)
-
-func init() {
-	messagesReceived = sync.Map{}
-
-	sTable = newServicesTable()
-	redirectionsMap = sync.Map{}
-	resolvingInTree = sync.Map{}
-	resolvedInTree = sync.Map{}
-	waitingChannels = sync.Map{}
-
-	var err error
-	hostname, err = os.Hostname()
-	if err != nil {
-		panic(err)
-	}
-
-	archimedesId = uuid.New().String()
-
-	log.Infof("ARCHIMEDES ID: %s", archimedesId)
-}
-
-func registerServiceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) registerServiceHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("handling request in registerService handler")
 
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
@@ -89,15 +46,15 @@ func registerServiceHandler(w http.ResponseWriter, r *http.Request) {
 		Ports: serviceDTO.Ports,
 	}
 
-	_, ok := sTable.getService(serviceId)
+	_, ok := s.sTable.getService(serviceId)
 	if ok {
 		w.WriteHeader(http.StatusConflict)
 		return
 	}
 
 	newTableEntry := &api.ServicesTableEntryDTO{
-		Host:         archimedesId,
-		HostAddr:     archimedes.DefaultHostPort,
+		Host:         s.archimedesId,
+		HostAddr:     s.config.Archimedes.HostPort(),
 		Service:      service,
 		Instances:    map[string]*api.Instance{},
 		NumberOfHops: 0,
@@ -105,35 +62,35 @@ func registerServiceHandler(w http.ResponseWriter, r *http.Request) {
 		Version:      0,
 	}
 
-	sTable.addService(serviceId, newTableEntry)
-	sendServicesTable()
+	s.sTable.addService(serviceId, newTableEntry)
+	s.sendServicesTable()
 
 	log.Debugf("added service %s", serviceId)
 }
 
-func deleteServiceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) deleteServiceHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("handling request in deleteService handler")
 
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 
-	_, ok := sTable.getService(serviceId)
+	_, ok := s.sTable.getService(serviceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	sTable.deleteService(serviceId)
-	redirectionsMap.Delete(serviceId)
+	s.sTable.deleteService(serviceId)
+	s.redirectionsMap.Delete(serviceId)
 
 	log.Debugf("deleted service %s", serviceId)
 }
 
-func registerServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) registerServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("handling request in registerServiceInstance handler")
 
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 
-	_, ok := sTable.getService(serviceId)
+	_, ok := s.sTable.getService(serviceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -150,7 +107,7 @@ func registerServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 
 	instanceDTO := req
 
-	ok = sTable.serviceHasInstance(serviceId, instanceId)
+	ok = s.sTable.serviceHasInstance(serviceId, instanceId)
 	if ok {
 		w.WriteHeader(http.StatusConflict)
 		return
@@ -176,64 +133,64 @@ func registerServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 		Local:           instanceDTO.Local,
 	}
 
-	sTable.addInstance(serviceId, instanceId, instance)
-	sendServicesTable()
+	s.sTable.addInstance(serviceId, instanceId, instance)
+	s.sendServicesTable()
 	log.Debugf("added instance %s to service %s", instanceId, serviceId)
 }
 
-func deleteServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) deleteServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("handling request in deleteServiceInstance handler")
 
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
-	_, ok := sTable.getService(serviceId)
+	_, ok := s.sTable.getService(serviceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
 	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
-	instance, ok := sTable.getServiceInstance(serviceId, instanceId)
+	instance, ok := s.sTable.getServiceInstance(serviceId, instanceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	sTable.deleteInstance(instance.ServiceId, instanceId)
+	s.sTable.deleteInstance(instance.ServiceId, instanceId)
 
 	log.Debugf("deleted instance %s from service %s", instanceId, serviceId)
 }
 
-func getAllServicesHandler(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) getAllServicesHandler(w http.ResponseWriter, _ *http.Request) {
 	log.Debug("handling request in getAllServices handler")
 
 	var resp api.GetAllServicesResponseBody
-	resp = sTable.getAllServices()
+	resp = s.sTable.getAllServices()
 	utils.SendJSONReplyOK(w, resp)
 }
 
-func getAllServiceInstancesHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getAllServiceInstancesHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("handling request in getAllServiceInstances handler")
 
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 
-	_, ok := sTable.getService(serviceId)
+	_, ok := s.sTable.getService(serviceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
 	var resp api.GetServiceResponseBody
-	resp = sTable.getAllServiceInstances(serviceId)
+	resp = s.sTable.getAllServiceInstances(serviceId)
 	utils.SendJSONReplyOK(w, resp)
 }
 
-func getServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("handling request in getServiceInstance handler")
 
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
 
-	instance, ok := sTable.getServiceInstance(serviceId, instanceId)
+	instance, ok := s.sTable.getServiceInstance(serviceId, instanceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -245,10 +202,10 @@ func getServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 	utils.SendJSONReplyOK(w, resp)
 }
 
-func getInstanceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getInstanceHandler(w http.ResponseWriter, r *http.Request) {
 	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
 
-	instance, ok := sTable.getInstance(instanceId)
+	instance, ok := s.sTable.getInstance(instanceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -259,16 +216,16 @@ func getInstanceHandler(w http.ResponseWriter, r *http.Request) {
 	utils.SendJSONReplyOK(w, resp)
 }
 
-func whoAreYouHandler(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) whoAreYouHandler(w http.ResponseWriter, _ *http.Request) {
 	log.Debug("handling whoAreYou request")
 	var resp api.WhoAreYouResponseBody
-	resp = archimedesId
+	resp = s.archimedesId
 	utils.SendJSONReplyOK(w, resp)
 }
 
-func getServicesTableHandler(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) getServicesTableHandler(w http.ResponseWriter, _ *http.Request) {
 	var resp api.GetServicesTableResponseBody
-	discoverMsg := sTable.toDiscoverMsg()
+	discoverMsg := s.sTable.toDiscoverMsg()
 	if discoverMsg != nil {
 		resp = *discoverMsg
 	}
@@ -276,7 +233,7 @@ func getServicesTableHandler(w http.ResponseWriter, _ *http.Request) {
 	utils.SendJSONReplyOK(w, resp)
 }
 
-func resolveHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) resolveHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debugf("handling resolve request")
 
 	var reqBody api.ResolveRequestBody
@@ -286,13 +243,12 @@ func resolveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	redirect, targetUrl := checkForRedirections(reqBody.ToResolve.Host)
+	redirect, targetUrl := s.checkForRedirections(reqBody.ToResolve.Host)
 	if redirect {
 		http.Redirect(w, r, targetUrl.String(), http.StatusPermanentRedirect)
 	}
 
-	deplClient := deployer.NewDeployerClient(publicUtils.DeployerServiceName + ":" + strconv.Itoa(deployer.Port))
-	redirectTo, status := deplClient.RedirectDownTheTree(reqBody.DeploymentId, reqBody.Location)
+	redirectTo, status := s.deployerClient.RedirectDownTheTree(reqBody.DeploymentId, reqBody.Location)
 	switch status {
 	case http.StatusNoContent:
 		break
@@ -300,7 +256,7 @@ func resolveHandler(w http.ResponseWriter, r *http.Request) {
 		log.Debugf("redirecting client from %+v", reqBody.Location)
 		targetUrl = url.URL{
 			Scheme: "http",
-			Host:   redirectTo + ":" + strconv.Itoa(archimedes.Port),
+			Host:   s.config.Archimedes.Addr(redirectTo),
 			Path:   api.GetResolvePath(),
 		}
 		http.Redirect(w, r, targetUrl.String(), http.StatusPermanentRedirect)
@@ -310,20 +266,23 @@ func resolveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resolved, found := resolveLocally(reqBody.ToResolve)
+	resolved, found := s.resolveLocally(reqBody.ToResolve)
 	if !found {
-		// TODO Redirect to fallback
 		var fallback string
-		fallback, status = deplClient.GetFallback()
-		if status != http.StatusOK {
-			log.Errorf("got status %d while asking for fallback from deployer", fallback)
+		fallback, status = s.deployerClient.GetFallback()
+		if status == http.StatusNotFound {
+			log.Errorf("no fallback to redirect %s to", reqBody.ToResolve.Host)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if status != http.StatusOK {
+			log.Errorf("got status %d while asking for fallback from deployer", status)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
 		fallbackURL := url.URL{
 			Scheme: "http",
-			Host:   fallback + ":" + strconv.Itoa(archimedes.Port),
+			Host:   s.config.Archimedes.Addr(fallback),
 			Path:   api.GetResolvePath(),
 		}
 		http.Redirect(w, r, fallbackURL.String(), http.StatusPermanentRedirect)
@@ -336,14 +295,14 @@ func resolveHandler(w http.ResponseWriter, r *http.Request) {
 	utils.SendJSONReplyOK(w, resp)
 }
 
-func resolveInTree(id, deploymentId string, toResolve *api.ToResolveDTO) (resolved *api.ResolvedDTO) {
+func (s *Server) resolveInTree(id, deploymentId string, toResolve *api.ToResolveDTO) (resolved *api.ResolvedDTO) {
 	log.Debugf("resolving (%s) %s up the tree", deploymentId, toResolve.Host)
 
-	_, ok := resolvingInTree.Load(id)
+	_, ok := s.resolvingInTree.Load(id)
 	if ok {
 		log.Debugf("already resolving (%s) %s", deploymentId, toResolve.Host)
 		// If there is already a resolution for this given id ocurring
-		value, cOk := waitingChannels.Load(id)
+		value, cOk := s.waitingChannels.Load(id)
 		if !cOk {
 			panic(fmt.Sprintf("there should be a waiting channel for %s", id))
 		}
@@ -352,7 +311,7 @@ func resolveInTree(id, deploymentId string, toResolve *api.ToResolveDTO) (resolv
 		waitChan := value.(chan struct{})
 		<-waitChan
 
-		value, ok = resolvedInTree.Load(id)
+		value, ok = s.resolvedInTree.Load(id)
 		if !ok {
 			panic(fmt.Sprintf("value for %s was supposed to be in map", id))
 		}
@@ -368,7 +327,7 @@ func resolveInTree(id, deploymentId string, toResolve *api.ToResolveDTO) (resolv
 		return
 	}
 
-	value, ok := resolvedInTree.Load(id)
+	value, ok := s.resolvedInTree.Load(id)
 	if ok {
 		// there was no resolution occurring and the value had been resolved before
 		resolved = value.(*api.ResolvedDTO)
@@ -377,17 +336,16 @@ func resolveInTree(id, deploymentId string, toResolve *api.ToResolveDTO) (resolv
 
 	// there was no resolution occurring and it had'nt been resolved before
 	waitChan := make(chan struct{})
-	waitingChannels.Store(id, waitChan)
-	resolvingInTree.Store(id, nil)
-	deplClient := deployer.NewDeployerClient(publicUtils.DeployerServiceName + ":" + strconv.Itoa(deployer.Port))
-	status := deplClient.StartResolveUpTheTree(deploymentId, toResolve)
+	s.waitingChannels.Store(id, waitChan)
+	s.resolvingInTree.Store(id, nil)
+	status := s.deployerClient.StartResolveUpTheTree(deploymentId, toResolve)
 	if status != http.StatusOK {
 		log.Debugf("got %d while attempting to start resolving (%s) %s", status, deploymentId, toResolve.Host)
 		return nil
 	}
 	<-waitChan
 
-	value, ok = resolvingInTree.Load(id)
+	value, ok = s.resolvingInTree.Load(id)
 	if !ok {
 		panic(fmt.Sprintf("value for %s was supposed to be in map", id))
 	}
@@ -403,7 +361,7 @@ func resolveInTree(id, deploymentId string, toResolve *api.ToResolveDTO) (resolv
 	return
 }
 
-func setResolutionAnswerHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) setResolutionAnswerHandler(w http.ResponseWriter, r *http.Request) {
 	var reqBody api.SetResolutionAnswerRequestBody
 	err := json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
@@ -413,20 +371,20 @@ func setResolutionAnswerHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugf("got answer %s for %s", reqBody.Resolved.Host, reqBody.Id)
 
-	value, ok := waitingChannels.Load(reqBody.Id)
+	value, ok := s.waitingChannels.Load(reqBody.Id)
 	if !ok {
 		log.Debugf("got answer for resolution of %s, but i wasnt waiting", reqBody.Id)
 		return
 	}
 
 	waitChan := value.(chan struct{})
-	resolvedInTree.Store(reqBody.Id, &reqBody.Resolved)
-	resolvingInTree.Delete(reqBody.Id)
-	waitingChannels.Delete(reqBody.Id)
+	s.resolvedInTree.Store(reqBody.Id, &reqBody.Resolved)
+	s.resolvingInTree.Delete(reqBody.Id)
+	s.waitingChannels.Delete(reqBody.Id)
 	close(waitChan)
 }
 
-func resolveLocallyHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) resolveLocallyHandler(w http.ResponseWriter, r *http.Request) {
 	var req api.ResolveLocallyRequestBody
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
@@ -434,7 +392,7 @@ func resolveLocallyHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	toResolve := &req
-	resolved, found := resolveLocally(toResolve)
+	resolved, found := s.resolveLocally(toResolve)
 	if !found {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -443,10 +401,10 @@ func resolveLocallyHandler(w http.ResponseWriter, r *http.Request) {
 	utils.SendJSONReplyOK(w, resolved)
 }
 
-func checkForRedirections(hostToResolve string) (redirect bool, targetUrl url.URL) {
+func (s *Server) checkForRedirections(hostToResolve string) (redirect bool, targetUrl url.URL) {
 	redirect = false
 
-	value, ok := redirectionsMap.Load(hostToResolve)
+	value, ok := s.redirectionsMap.Load(hostToResolve)
 	if ok {
 		redirectConfig := value.(redirectionsMapValue)
 		if !redirectConfig.Done {
@@ -454,7 +412,7 @@ func checkForRedirections(hostToResolve string) (redirect bool, targetUrl url.UR
 				redirectConfig.Goal)
 			redirect, targetUrl = true, url.URL{
 				Scheme: "http",
-				Host:   redirectConfig.Target + ":" + strconv.Itoa(archimedes.Port),
+				Host:   s.config.Archimedes.Addr(redirectConfig.Target),
 				Path:   api.GetResolvePath(),
 			}
 			if reachedGoal {
@@ -467,21 +425,21 @@ func checkForRedirections(hostToResolve string) (redirect bool, targetUrl url.UR
 	return
 }
 
-func resolveLocally(toResolve *api.ToResolveDTO) (resolved *api.ResolvedDTO, found bool) {
+func (s *Server) resolveLocally(toResolve *api.ToResolveDTO) (resolved *api.ResolvedDTO, found bool) {
 	found = false
 
-	service, sOk := sTable.getService(toResolve.Host)
+	service, sOk := s.sTable.getService(toResolve.Host)
 	if !sOk {
-		instance, iOk := sTable.getInstance(toResolve.Host)
+		instance, iOk := s.sTable.getInstance(toResolve.Host)
 		if !iOk {
 			return
 		}
 
-		resolved, found = resolveInstance(toResolve.Port, instance)
+		resolved, found = s.resolveInstance(toResolve.Port, instance)
 		return
 	}
 
-	instances := sTable.getAllServiceInstances(service.Id)
+	instances := s.sTable.getAllServiceInstances(service.Id)
 
 	if len(instances) == 0 {
 		log.Debugf("no instances for service %s", service.Id)
@@ -498,7 +456,7 @@ func resolveLocally(toResolve *api.ToResolveDTO) (resolved *api.ResolvedDTO, fou
 		}
 	}
 
-	resolved, found = resolveInstance(toResolve.Port, randInstance)
+	resolved, found = s.resolveInstance(toResolve.Port, randInstance)
 	if found {
 		log.Debugf("resolved %s:%s to %s:%s", toResolve.Host, toResolve.Port.Port(), resolved.Host, resolved.Port)
 	}
@@ -506,7 +464,7 @@ func resolveLocally(toResolve *api.ToResolveDTO) (resolved *api.ResolvedDTO, fou
 	return
 }
 
-func discoverHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) discoverHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("handling request in discoverService handler")
 
 	req := api.DiscoverRequestBody{}
@@ -519,7 +477,7 @@ func discoverHandler(w http.ResponseWriter, r *http.Request) {
 
 	discoverMsg := req
 
-	_, ok := messagesReceived.Load(discoverMsg.MessageId)
+	_, ok := s.messagesReceived.Load(discoverMsg.MessageId)
 	if ok {
 		log.Debugf("repeated message %s, ignoring...", discoverMsg.MessageId)
 		return
@@ -534,15 +492,15 @@ func discoverHandler(w http.ResponseWriter, r *http.Request) {
 
 	preprocessMessage(remoteAddr, &discoverMsg)
 
-	sTable.updateTableWithDiscoverMessage(discoverMsg.NeighborSent, &discoverMsg)
+	s.sTable.updateTableWithDiscoverMessage(discoverMsg.NeighborSent, &discoverMsg)
 
-	messagesReceived.Store(discoverMsg.MessageId, struct{}{})
+	s.messagesReceived.Store(discoverMsg.MessageId, struct{}{})
 
-	postprocessMessage(&discoverMsg)
-	broadcastMsgWithHorizon(&discoverMsg, maxHops)
+	s.postprocessMessage(&discoverMsg)
+	broadcastMsgWithHorizon(&discoverMsg, s.maxHops)
 }
 
-func redirectHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) redirectHandler(w http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 
 	var req api.RedirectRequestBody
@@ -560,18 +518,18 @@ func redirectHandler(w http.ResponseWriter, r *http.Request) {
 		Done:    false,
 	}
 
-	redirectionsMap.Store(serviceId, redirectConfig)
+	s.redirectionsMap.Store(serviceId, redirectConfig)
 }
 
-func removeRedirectionHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) removeRedirectionHandler(_ http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
-	redirectionsMap.Delete(serviceId)
+	s.redirectionsMap.Delete(serviceId)
 }
 
-func getRedirectedHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getRedirectedHandler(w http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 
-	value, ok := redirectionsMap.Load(serviceId)
+	value, ok := s.redirectionsMap.Load(serviceId)
 	if !ok {
 		log.Debugf("service %s is not being redirected", serviceId)
 		w.WriteHeader(http.StatusNotFound)
@@ -594,11 +552,11 @@ func preprocessMessage(remoteAddr string, discoverMsg *api.DiscoverMsg) {
 	}
 }
 
-func postprocessMessage(discoverMsg *api.DiscoverMsg) {
+func (s *Server) postprocessMessage(discoverMsg *api.DiscoverMsg) {
 	var servicesToDelete []string
 
 	for serviceId, entry := range discoverMsg.Entries {
-		if entry.NumberOfHops > maxHops {
+		if entry.NumberOfHops > s.maxHops {
 			servicesToDelete = append(servicesToDelete, serviceId)
 		}
 	}
@@ -608,23 +566,23 @@ func postprocessMessage(discoverMsg *api.DiscoverMsg) {
 	}
 }
 
-func sendServicesTable() {
-	discoverMsg := sTable.toChangedDiscoverMsg()
+func (s *Server) sendServicesTable() {
+	discoverMsg := s.sTable.toChangedDiscoverMsg()
 	if discoverMsg == nil {
 		return
 	}
 
-	broadcastMsgWithHorizon(discoverMsg, maxHops)
+	broadcastMsgWithHorizon(discoverMsg, s.maxHops)
 }
 
-func resolveInstance(originalPort nat.Port, instance *api.Instance) (*api.ResolvedDTO, bool) {
+func (s *Server) resolveInstance(originalPort nat.Port, instance *api.Instance) (*api.ResolvedDTO, bool) {
 	portNatResolved, ok := instance.PortTranslation[originalPort]
 	if !ok {
 		return nil, false
 	}
 
 	return &api.ResolvedDTO{
-		Host: hostname,
+		Host: s.hostname,
 		Port: portNatResolved[0].HostPort,
 	}, true
 }
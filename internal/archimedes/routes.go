@@ -27,6 +27,7 @@ const (
 	getRedirectedName           = "GET_REDIRECTED"
 	resolveLocallyName          = "RESOLVE_LOCALLY"
 	setResolvingAnswerName      = "SET_RESOLVE_ANSWER"
+	getConfigName               = "GET_CONFIG"
 )
 
 // Path variables
@@ -52,125 +53,136 @@ var (
 	redirectRoute           = fmt.Sprintf(archimedes.RedirectPath, _serviceIdPathVarFormatted)
 	redirectedRoute         = fmt.Sprintf(archimedes.RedirectedPath, _serviceIdPathVarFormatted)
 	setResolvingAnswerRoute = fmt.Sprintf(archimedes.SetResolvingAnswerPath)
+	configRoute             = archimedes.ConfigPath
 )
 
-var Routes = []utils.Route{
-	{
-		Name:        setResolvingAnswerName,
-		Method:      http.MethodPost,
-		Pattern:     setResolvingAnswerRoute,
-		HandlerFunc: setResolutionAnswerHandler,
-	},
-
-	{
-		Name:        resolveLocallyName,
-		Method:      http.MethodPost,
-		Pattern:     resolveLocallyRoute,
-		HandlerFunc: resolveLocallyHandler,
-	},
-
-	{
-		Name:        getRedirectedName,
-		Method:      http.MethodGet,
-		Pattern:     redirectedRoute,
-		HandlerFunc: getRedirectedHandler,
-	},
-
-	{
-		Name:        redirectName,
-		Method:      http.MethodPost,
-		Pattern:     redirectRoute,
-		HandlerFunc: redirectHandler,
-	},
-
-	{
-		Name:        removeRedirectName,
-		Method:      http.MethodDelete,
-		Pattern:     redirectRoute,
-		HandlerFunc: removeRedirectionHandler,
-	},
-
-	{
-		Name:        registerServiceName,
-		Method:      http.MethodPost,
-		Pattern:     serviceRoute,
-		HandlerFunc: registerServiceHandler,
-	},
-
-	{
-		Name:        deleteServiceName,
-		Method:      http.MethodDelete,
-		Pattern:     serviceRoute,
-		HandlerFunc: deleteServiceHandler,
-	},
-
-	{
-		Name:        registerServiceInstanceName,
-		Method:      http.MethodPost,
-		Pattern:     serviceInstanceRoute,
-		HandlerFunc: registerServiceInstanceHandler,
-	},
-
-	{
-		Name:        deleteServiceInstanceName,
-		Method:      http.MethodDelete,
-		Pattern:     serviceInstanceRoute,
-		HandlerFunc: deleteServiceInstanceHandler,
-	},
-
-	{
-		Name:        getAllServicesName,
-		Method:      http.MethodGet,
-		Pattern:     servicesRoute,
-		HandlerFunc: getAllServicesHandler,
-	},
-
-	{
-		Name:        getAllServiceInstancesName,
-		Method:      http.MethodGet,
-		Pattern:     serviceRoute,
-		HandlerFunc: getAllServiceInstancesHandler,
-	},
-
-	{
-		Name:        getInstanceName,
-		Method:      http.MethodGet,
-		Pattern:     instanceRoute,
-		HandlerFunc: getInstanceHandler,
-	},
-
-	{
-		Name:        getServiceInstanceName,
-		Method:      http.MethodGet,
-		Pattern:     serviceInstanceRoute,
-		HandlerFunc: getServiceInstanceHandler,
-	},
-
-	{
-		Name:        discoverName,
-		Method:      http.MethodPost,
-		Pattern:     discoverRoute,
-		HandlerFunc: discoverHandler,
-	},
-
-	{
-		Name:        whoAreYouName,
-		Method:      http.MethodGet,
-		Pattern:     whoAreYouRoute,
-		HandlerFunc: whoAreYouHandler,
-	},
-
-	{
-		Name:        getTableName,
-		Method:      http.MethodGet,
-		Pattern:     tableRoute,
-		HandlerFunc: getServicesTableHandler,
-	},
-
-	{
-		Name:        resolveName,
-		Method:      http.MethodPost,
-		Pattern:     resolveRoute,
-		HandlerFunc: resolveHandler,
-	},
+func (s *Server) routes() []utils.Route {
+	return []utils.Route{
+		{
+			Name:        setResolvingAnswerName,
+			Method:      http.MethodPost,
+			Pattern:     setResolvingAnswerRoute,
+			HandlerFunc: s.setResolutionAnswerHandler,
+		},
+
+		{
+			Name:        resolveLocallyName,
+			Method:      http.MethodPost,
+			Pattern:     resolveLocallyRoute,
+			HandlerFunc: s.resolveLocallyHandler,
+		},
+
+		{
+			Name:        getRedirectedName,
+			Method:      http.MethodGet,
+			Pattern:     redirectedRoute,
+			HandlerFunc: s.getRedirectedHandler,
+		},
+
+		{
+			Name:        redirectName,
+			Method:      http.MethodPost,
+			Pattern:     redirectRoute,
+			HandlerFunc: s.redirectHandler,
+		},
+
+		{
+			Name:        removeRedirectName,
+			Method:      http.MethodDelete,
+			Pattern:     redirectRoute,
+			HandlerFunc: s.removeRedirectionHandler,
+		},
+
+		{
+			Name:        registerServiceName,
+			Method:      http.MethodPost,
+			Pattern:     serviceRoute,
+			HandlerFunc: s.registerServiceHandler,
+		},
+
+		{
+			Name:        deleteServiceName,
+			Method:      http.MethodDelete,
+			Pattern:     serviceRoute,
+			HandlerFunc: s.deleteServiceHandler,
+		},
+
+		{
+			Name:        registerServiceInstanceName,
+			Method:      http.MethodPost,
+			Pattern:     serviceInstanceRoute,
+			HandlerFunc: s.registerServiceInstanceHandler,
+		},
+
+		{
+			Name:        deleteServiceInstanceName,
+			Method:      http.MethodDelete,
+			Pattern:     serviceInstanceRoute,
+			HandlerFunc: s.deleteServiceInstanceHandler,
+		},
+
+		{
+			Name:        getAllServicesName,
+			Method:      http.MethodGet,
+			Pattern:     servicesRoute,
+			HandlerFunc: s.getAllServicesHandler,
+		},
+
+		{
+			Name:        getAllServiceInstancesName,
+			Method:      http.MethodGet,
+			Pattern:     serviceRoute,
+			HandlerFunc: s.getAllServiceInstancesHandler,
+		},
+
+		{
+			Name:        getInstanceName,
+			Method:      http.MethodGet,
+			Pattern:     instanceRoute,
+			HandlerFunc: s.getInstanceHandler,
+		},
+
+		{
+			Name:        getServiceInstanceName,
+			Method:      http.MethodGet,
+			Pattern:     serviceInstanceRoute,
+			HandlerFunc: s.getServiceInstanceHandler,
+		},
+
+		{
+			Name:        discoverName,
+			Method:      http.MethodPost,
+			Pattern:     discoverRoute,
+			HandlerFunc: s.discoverHandler,
+		},
+
+		{
+			Name:        whoAreYouName,
+			Method:      http.MethodGet,
+			Pattern:     whoAreYouRoute,
+			HandlerFunc: s.whoAreYouHandler,
+		},
+
+		{
+			Name:        getTableName,
+			Method:      http.MethodGet,
+			Pattern:     tableRoute,
+			HandlerFunc: s.getServicesTableHandler,
+		},
+
+		{
+			Name:        resolveName,
+			Method:      http.MethodPost,
+			Pattern:     resolveRoute,
+			HandlerFunc: s.resolveHandler,
+			Public:      true,
+		},
+
+		{
+			Name:        getConfigName,
+			Method:      http.MethodGet,
+			Pattern:     configRoute,
+			HandlerFunc: s.config.Handler,
+		},
+	}
 }
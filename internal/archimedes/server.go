@@ -0,0 +1,132 @@
+package archimedes
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/archimedes"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	serviceName = "ARCHIMEDES"
+)
+
+type (
+	// Server is the archimedes of a node, which resolves services to their instances. Every piece of state lives
+	// in it, so several can run in the same process.
+	Server struct {
+		*utils.Server
+
+		config    *config.Config
+		transport *utils.Transport
+		listener  net.Listener
+
+		hostname     string
+		archimedesId string
+		maxHops      int
+
+		messagesReceived sync.Map
+		sTable           *servicesTable
+		redirectionsMap  sync.Map
+		resolvingInTree  sync.Map
+		resolvedInTree   sync.Map
+		waitingChannels  sync.Map
+
+		deployerClient *deployer.Client
+	}
+
+	Option func(s *Server)
+)
+
+// WithConfig sets the configuration of archimedes, instead of the one of the process
+func WithConfig(conf *config.Config) Option {
+	return func(s *Server) {
+		s.config = conf
+	}
+}
+
+// WithTransport sets the transport the clients of archimedes do their requests with
+func WithTransport(transport *utils.Transport) Option {
+	return func(s *Server) {
+		s.transport = transport
+	}
+}
+
+// WithListener makes archimedes serve on the listener, instead of listening on the configured port
+func WithListener(listener net.Listener) Option {
+	return func(s *Server) {
+		s.listener = listener
+	}
+}
+
+// WithHostname sets the hostname of the node, which instances are resolved to, instead of the one of the machine
+func WithHostname(hostname string) Option {
+	return func(s *Server) {
+		s.hostname = hostname
+	}
+}
+
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		archimedesId: uuid.New().String(),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.config == nil {
+		s.config = config.Get()
+	}
+
+	security, err := s.config.Server.Security()
+	if err != nil {
+		panic(err)
+	}
+
+	if s.transport == nil {
+		s.transport = utils.NewTransport(nil, security)
+	}
+
+	if s.hostname == "" {
+		s.hostname, err = os.Hostname()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	s.maxHops = s.config.Archimedes.MaxHops
+	s.sTable = newServicesTable(s.archimedesId, s.maxHops)
+	s.deployerClient = deployer.NewClientPool(s.transport).Get(s.config.Deployer.HostPort())
+	s.Server = utils.NewServer(serviceName, api.PrefixPath, s.routes(), security.TLS)
+
+	log.Infof("ARCHIMEDES ID: %s", s.archimedesId)
+
+	return s
+}
+
+func (s *Server) Start() error {
+	if s.listener == nil {
+		var err error
+		s.listener, err = utils.Listen(s.config.Server.ListenAddr, s.config.Archimedes.Port)
+		if err != nil {
+			return errors.Wrap(err, "error listening")
+		}
+	}
+
+	s.Serve(s.listener)
+
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.Shutdown(ctx)
+}
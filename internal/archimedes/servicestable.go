@@ -88,6 +88,8 @@ func (se *servicesTableEntry) toDTO() *api.ServicesTableEntryDTO {
 
 type (
 	servicesTable struct {
+		archimedesId         string
+		maxHops              int
 		addLock              sync.Mutex
 		servicesMap          sync.Map
 		instancesMap         sync.Map
@@ -104,8 +106,10 @@ type (
 	typeNeighborsServicesMapValue = *sync.Map
 )
 
-func newServicesTable() *servicesTable {
+func newServicesTable(archimedesId string, maxHops int) *servicesTable {
 	return &servicesTable{
+		archimedesId:         archimedesId,
+		maxHops:              maxHops,
 		addLock:              sync.Mutex{},
 		servicesMap:          sync.Map{},
 		instancesMap:         sync.Map{},
@@ -116,7 +120,9 @@ func newServicesTable() *servicesTable {
 func (st *servicesTable) updateService(serviceId string, newEntry *api.ServicesTableEntryDTO) bool {
 	value, ok := st.servicesMap.Load(serviceId)
 	if !ok {
-		log.Fatalf("service %s doesnt exist", serviceId)
+		// the service may have been deleted meanwhile
+		log.Warnf("service %s doesnt exist", serviceId)
+		return false
 	}
 
 	entry := value.(typeServicesTableMapValue)
@@ -157,7 +163,7 @@ func (st *servicesTable) updateService(serviceId string, newEntry *api.ServicesT
 	entry.Instances = newInstancesMap
 	entry.NumberOfHops = newEntry.NumberOfHops
 	entry.Version = newEntry.Version
-	entry.MaxHops = maxHops
+	entry.MaxHops = st.maxHops
 
 	log.Debugf("updated service %s table entry to: %+v", serviceId, entry)
 	log.Debugf("with instances %+v", newEntry.Instances)
@@ -198,7 +204,7 @@ func (st *servicesTable) addService(serviceId string, newEntry *api.ServicesTabl
 	newTableEntry.Instances = newInstancesMap
 	newTableEntry.NumberOfHops = newEntry.NumberOfHops
 	newTableEntry.Version = newEntry.Version
-	newTableEntry.MaxHops = maxHops
+	newTableEntry.MaxHops = st.maxHops
 
 	servicesMap := &sync.Map{}
 	servicesMap.Store(serviceId, struct{}{})
@@ -381,7 +387,7 @@ func (st *servicesTable) updateTableWithDiscoverMessage(neighbor string,
 	for serviceId, entry := range discoverMsg.Entries {
 		log.Debugf("%s has service %s", neighbor, serviceId)
 
-		if entry.Host == archimedesId {
+		if entry.Host == st.archimedesId {
 			continue
 		}
 
@@ -411,7 +417,7 @@ func (st *servicesTable) toChangedDiscoverMsg() *api.DiscoverMsg {
 
 		entry.EntryLock.RLock()
 
-		if entry.NumberOfHops+1 > maxHops {
+		if entry.NumberOfHops+1 > st.maxHops {
 			return true
 		}
 
@@ -431,8 +437,8 @@ func (st *servicesTable) toChangedDiscoverMsg() *api.DiscoverMsg {
 
 	return &api.DiscoverMsg{
 		MessageId:    uuid.New(),
-		Origin:       archimedesId,
-		NeighborSent: archimedesId,
+		Origin:       st.archimedesId,
+		NeighborSent: st.archimedesId,
 		Entries:      entries,
 	}
 }
@@ -456,8 +462,8 @@ func (st *servicesTable) toDiscoverMsg() *api.DiscoverMsg {
 
 	return &api.DiscoverMsg{
 		MessageId:    uuid.New(),
-		Origin:       archimedesId,
-		NeighborSent: archimedesId,
+		Origin:       st.archimedesId,
+		NeighborSent: st.archimedesId,
 		Entries:      entries,
 	}
 }
@@ -471,7 +477,7 @@ func (st *servicesTable) deleteNeighborServices(neighborId string) {
 	services := value.(typeNeighborsServicesMapValue)
 	services.Range(func(key, _ interface{}) bool {
 		serviceId := key.(typeNeighborsServicesMapKey)
-		sTable.deleteService(serviceId)
+		st.deleteService(serviceId)
 		return true
 	})
 }
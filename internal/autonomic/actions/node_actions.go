@@ -2,7 +2,6 @@ package actions
 
 import (
 	"net/http"
-	"strconv"
 
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
 	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
@@ -43,17 +42,11 @@ func NewAddServiceAction(serviceId, target string, exploreChan chan struct{}) *A
 	}
 }
 
+// Execute extends the deployment to the target, which the caller checked does not have it yet
 func (m *AddServiceAction) Execute(client utils.Client) {
 	log.Debugf("executing %s to %s", m.ActionId, m.GetTarget())
 	deployerClient := client.(*deployer.Client)
 
-	targetClient := deployer.NewDeployerClient(m.GetTarget() + ":" + strconv.Itoa(deployer.Port))
-	has, _ := targetClient.HasService(m.GetServiceId())
-	if has {
-		log.Debugf("%s already has service %s", m.GetTarget(), m.GetServiceId())
-		return
-	}
-
 	status := deployerClient.ExtendDeploymentTo(m.GetServiceId(), m.GetTarget())
 	if status != http.StatusOK {
 		log.Errorf("got status code %d while extending deployment", status)
@@ -80,17 +73,11 @@ func NewExploreAction(serviceId, target string) *ExploreAction {
 	}
 }
 
+// Execute extends the deployment to the target, which the caller checked does not have it yet
 func (m *ExploreAction) Execute(client utils.Client) {
 	log.Debugf("executing %s to %s", m.ActionId, m.GetTarget())
 	deployerClient := client.(*deployer.Client)
 
-	targetClient := deployer.NewDeployerClient(m.GetTarget() + ":" + strconv.Itoa(deployer.Port))
-	has, _ := targetClient.HasService(m.GetServiceId())
-	if has {
-		log.Debugf("%s already has service %s", m.GetTarget(), m.GetServiceId())
-		return
-	}
-
 	status := deployerClient.ExtendDeploymentTo(m.GetServiceId(), m.GetTarget())
 	if status != http.StatusOK {
 		log.Errorf("got status code %d while extending deployment", status)
@@ -111,7 +98,7 @@ func (m *MigrateAction) Execute(client utils.Client) {
 	log.Debugf("executing %s from %s to %s", MigrateServiceId, m.GetOrigin(), m.GetTarget())
 	deployerClient := client.(*deployer.Client)
 	status := deployerClient.MigrateDeployment(m.GetServiceId(), m.GetOrigin(), m.GetTarget())
-	if status == http.StatusOK {
-		log.Errorf("got status code %d while extending deployment", status)
+	if status != http.StatusOK {
+		log.Errorf("got status code %d while migrating deployment", status)
 	}
 }
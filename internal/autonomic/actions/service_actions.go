@@ -26,8 +26,9 @@ func (r *RedirectAction) GetAmount() int {
 	return r.Args[raAmountIndex].(int)
 }
 
+// Execute redirects the clients in the archimedes of the origin, so the client passed has to be the one of the
+// archimedes of the origin
 func (r *RedirectAction) Execute(client utils.Client) {
-	assertedClient := client.(*archimedes.Client)
-	assertedClient.SetHostPort(r.GetOrigin())
-	assertedClient.Redirect(r.GetServiceId(), r.GetTarget(), r.GetAmount())
+	originClient := client.(*archimedes.Client)
+	originClient.Redirect(r.GetServiceId(), r.GetTarget(), r.GetAmount())
 }
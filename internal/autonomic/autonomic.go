@@ -8,6 +8,7 @@ import (
 
 	"github.com/bruno-anjos/cloud-edge-deployment/api/autonomic"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/environment"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/goals"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/goals/service_goals"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/metrics"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/strategies"
@@ -26,10 +27,6 @@ type (
 	servicesMapValue = *service
 )
 
-const (
-	defaultInterval = 30 * time.Second
-)
-
 type service struct {
 	ServiceId   string
 	Strategy    strategies.Strategy
@@ -39,8 +36,8 @@ type service struct {
 	Environment *environment.Environment
 }
 
-func newService(serviceId, strategyId string, suspected *sync.Map,
-	env *environment.Environment) (*service, error) {
+func newService(serviceId, strategyId string, suspected *sync.Map, env *environment.Environment,
+	node *goals.Node) (*service, error) {
 	s := &service{
 		Children:    &sync.Map{},
 		ParentId:    "",
@@ -53,10 +50,10 @@ func newService(serviceId, strategyId string, suspected *sync.Map,
 	switch strategyId {
 	case strategies.StrategyLoadBalanceId:
 		strategy = strategies.NewDefaultLoadBalanceStrategy(serviceId, s.Children, s.Suspected, &(s.ParentId),
-			env)
+			env, node)
 	case strategies.StrategyIdealLatencyId:
 		strategy = strategies.NewDefaultIdealLatencyStrategy(serviceId, s.Children, s.Suspected, &(s.ParentId),
-			env)
+			env, node)
 	default:
 		return nil, errors.Errorf("invalid strategy: %s", strategyId)
 	}
@@ -134,27 +131,30 @@ type (
 		env       *environment.Environment
 		suspected *sync.Map
 
-		deployerClient   *deployer.Client
-		archimedesClient *archimedes.Client
-		exploring        sync.Map
+		node              *goals.Node
+		deployerClient    *deployer.Client
+		archimedesClients *archimedes.ClientPool
+		exploring         sync.Map
 	}
 
 	exploringMapValue = chan struct{}
 )
 
-func newSystem() *system {
+func newSystem(node *goals.Node, archimedesClients *archimedes.ClientPool,
+	initialMetrics map[string]interface{}) *system {
 	return &system{
-		services:         &sync.Map{},
-		env:              environment.NewEnvironment(),
-		suspected:        &sync.Map{},
-		deployerClient:   deployer.NewDeployerClient(deployer.DefaultHostPort),
-		archimedesClient: archimedes.NewArchimedesClient(archimedes.DefaultHostPort),
-		exploring:        sync.Map{},
+		services:          &sync.Map{},
+		env:               environment.NewEnvironment(initialMetrics),
+		suspected:         &sync.Map{},
+		node:              node,
+		deployerClient:    node.DeployerClients.Get(node.Config.Deployer.HostPort()),
+		archimedesClients: archimedesClients,
+		exploring:         sync.Map{},
 	}
 }
 
 func (a *system) addService(serviceId, strategyId string) error {
-	s, err := newService(serviceId, strategyId, a.suspected, a.env)
+	s, err := newService(serviceId, strategyId, a.suspected, a.env, a.node)
 	if err != nil {
 		panic(err)
 	}
@@ -311,38 +311,51 @@ func (a *system) getMyLocation() *utils.Location {
 	return &location
 }
 
-func (a *system) start() {
-	go func() {
-		timer := time.NewTimer(defaultInterval)
+// run evaluates the services every interval until stopped
+func (a *system) run(stopped <-chan struct{}) {
+	timer := time.NewTimer(a.node.Config.Autonomic.Interval)
+	defer timer.Stop()
 
-		for {
-			<-timer.C
-			a.services.Range(func(key, value interface{}) bool {
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-timer.C:
+		}
 
-				serviceId := key.(string)
-				s := value.(servicesMapValue)
+		a.services.Range(func(key, value interface{}) bool {
 
-				log.Debugf("evaluating service %s", serviceId)
+			serviceId := key.(string)
+			s := value.(servicesMapValue)
 
-				action := s.generateAction()
-				if action == nil {
-					return true
-				}
+			log.Debugf("evaluating service %s", serviceId)
 
-				log.Debugf("generated action of type %s for service %s", action.GetActionId(), serviceId)
-				a.performAction(action)
+			action := s.generateAction()
+			if action == nil {
 				return true
-			})
-			timer.Reset(defaultInterval)
-		}
-	}()
+			}
+
+			log.Debugf("generated action of type %s for service %s", action.GetActionId(), serviceId)
+			a.performAction(action)
+			return true
+		})
+		timer.Reset(a.node.Config.Autonomic.Interval)
+	}
 }
 
 func (a *system) performAction(action actions.Action) {
 	switch assertedAction := action.(type) {
 	case *actions.RedirectAction:
-		assertedAction.Execute(a.archimedesClient)
+		originAddr := a.node.Config.Archimedes.Addr(assertedAction.GetOrigin())
+		assertedAction.Execute(a.archimedesClients.Get(originAddr))
 	case *actions.AddServiceAction:
+		targetClient := a.node.DeployerClients.Get(a.node.Config.Deployer.Addr(assertedAction.GetTarget()))
+		has, _ := targetClient.HasService(assertedAction.GetServiceId())
+		if has {
+			log.Debugf("%s already has service %s", assertedAction.GetTarget(), assertedAction.GetServiceId())
+			return
+		}
+
 		if assertedAction.ExploreChan != nil {
 			id := assertedAction.GetServiceId() + "_" + assertedAction.GetTarget()
 			a.exploring.Store(id, assertedAction.ExploreChan)
@@ -3,7 +3,6 @@ package environment
 import (
 	"encoding/json"
 	"io/ioutil"
-	"os"
 	"sync"
 
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/constraints"
@@ -21,24 +20,25 @@ const (
 	metricsFileExtension = ".met"
 )
 
-func NewEnvironment() *Environment {
+// NewEnvironment returns an environment tracking the initial metrics
+func NewEnvironment(initialMetrics map[string]interface{}) *Environment {
 	env := &Environment{
 		trackedMetrics: &sync.Map{},
 		metrics:        &sync.Map{},
 		constraints:    []constraints.Constraint{},
 	}
 
-	env.loadSimFile()
+	for metricId, metricValue := range initialMetrics {
+		log.Debugf("loaded metric %s with value %v", metricId, metricValue)
+		env.TrackMetric(metricId)
+		env.SetMetric(metricId, metricValue)
+	}
 
 	return env
 }
 
-func (e *Environment) loadSimFile() {
-	hostname, err := os.Hostname()
-	if err != nil {
-		panic(err)
-	}
-
+// LoadSimMetrics loads the metrics of the node with the hostname from its simulation file
+func LoadSimMetrics(hostname string) map[string]interface{} {
 	data, err := ioutil.ReadFile(metricsFolder + hostname + metricsFileExtension)
 	if err != nil {
 		panic(err)
@@ -50,11 +50,7 @@ func (e *Environment) loadSimFile() {
 		panic(err)
 	}
 
-	for metricId, metricValue := range metrics {
-		log.Debugf("loaded metric %s with value %v", metricId, metricValue)
-		e.TrackMetric(metricId)
-		e.SetMetric(metricId, metricValue)
-	}
+	return metrics
 }
 
 func (e *Environment) TrackMetric(metricId string) {
@@ -0,0 +1,16 @@
+package goals
+
+import (
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/archimedes"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/autonomic"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+)
+
+// Node has the configuration of the node the goals optimize and the clients they reach it and the other nodes with
+type Node struct {
+	Config           *config.Config
+	ArchimedesClient *archimedes.Client
+	AutonomicClients *autonomic.ClientPool
+	DeployerClients  *deployer.ClientPool
+}
@@ -15,8 +15,6 @@ import (
 )
 
 const (
-	processingThreshold = 0.8
-
 	maximumDistancePercentage   = 1.4
 	equivalenDistancePercentage = 0.8
 	loadToAddServiceThreshold   = 0.7
@@ -60,10 +58,11 @@ type idealLatency struct {
 	parentId        *string
 	exploring       sync.Map
 	blacklist       sync.Map
+	node            *goals.Node
 }
 
 func NewIdealLatency(serviceId string, serviceChildren, suspected *sync.Map,
-	parentId *string, env *environment.Environment) *idealLatency {
+	parentId *string, env *environment.Environment, node *goals.Node) *idealLatency {
 	dependencies := []string{
 		metrics.GetProcessingTimePerServiceMetricId(serviceId),
 		metrics.GetClientLatencyPerServiceMetricId(serviceId),
@@ -80,6 +79,7 @@ func NewIdealLatency(serviceId string, serviceChildren, suspected *sync.Map,
 		environment:     env,
 		dependencies:    dependencies,
 		parentId:        parentId,
+		node:            node,
 	}
 
 	return goal
@@ -371,7 +371,7 @@ func (i *idealLatency) checkProcessingTime() bool {
 		latency := value.(float64)
 
 		processingTimePart := float32(processingTime) / float32(latency)
-		if processingTimePart > processingThreshold {
+		if float64(processingTimePart) > i.node.Config.Autonomic.ProcessingThreshold {
 			log.Debugf("most of the client latency is due to processing time (%f)", processingTimePart)
 			return true
 		}
@@ -3,28 +3,22 @@ package service_goals
 import (
 	"net/http"
 	"sort"
-	"strconv"
 	"sync"
 
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/actions"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/environment"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/goals"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/metrics"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/autonomic"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
 	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
 	"github.com/mitchellh/mapstructure"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	maximumLoad        = 0.7
 	equivalentLoadDiff = 0.20
 
 	lbNumArgs = 2
 
-	defaultGroupSize = 0.10
-
 	loadBalanceGoalId = "GOAL_LOAD_BALANCE"
 )
 
@@ -32,33 +26,33 @@ const (
 	lbActionTypeArgIndex = iota
 )
 
-var (
-	migrationGroupSize = defaultGroupSize
-)
-
 type LoadBalance struct {
-	serviceId       string
-	serviceChildren *sync.Map
-	suspected       *sync.Map
-	environment     *environment.Environment
-	dependencies    []string
-	parentId        *string
+	serviceId          string
+	serviceChildren    *sync.Map
+	suspected          *sync.Map
+	environment        *environment.Environment
+	dependencies       []string
+	parentId           *string
+	migrationGroupSize float64
+	node               *goals.Node
 }
 
 func NewLoadBalance(serviceId string, children, suspected *sync.Map, parentId *string,
-	env *environment.Environment) *LoadBalance {
+	env *environment.Environment, node *goals.Node) *LoadBalance {
 	dependencies := []string{
 		metrics.GetAggLoadPerServiceInChildrenMetricId(serviceId),
 		metrics.GetLoadPerServiceInChildrenMetricId(serviceId),
 	}
 
 	return &LoadBalance{
-		serviceId:       serviceId,
-		serviceChildren: children,
-		suspected:       suspected,
-		environment:     env,
-		dependencies:    dependencies,
-		parentId:        parentId,
+		serviceId:          serviceId,
+		serviceChildren:    children,
+		suspected:          suspected,
+		environment:        env,
+		dependencies:       dependencies,
+		parentId:           parentId,
+		migrationGroupSize: node.Config.Autonomic.MigrationGroupSize,
+		node:               node,
 	}
 }
 
@@ -86,7 +80,7 @@ func (l *LoadBalance) Optimize(optDomain goals.Domain) (isAlreadyMax bool, optRa
 	overloaded := false
 	for childId, value := range sortingCriteria {
 		load := value.(float64)
-		if load > maximumLoad {
+		if load > l.node.Config.Autonomic.MaximumLoad {
 			log.Debugf("%s is overloaded (%f)", childId, load)
 			overloaded = true
 			break
@@ -140,8 +134,6 @@ func (l *LoadBalance) GenerateDomain(_ interface{}) (domain goals.Domain, info m
 
 	myself := value.(string)
 	info = map[string]interface{}{}
-	autoClient := autonomic.NewAutonomicClient("")
-
 	for nodeId := range locationsInVicinity {
 		_, okS := l.suspected.Load(nodeId)
 		if okS || nodeId == myself || nodeId == *l.parentId {
@@ -149,7 +141,7 @@ func (l *LoadBalance) GenerateDomain(_ interface{}) (domain goals.Domain, info m
 			continue
 		}
 		domain = append(domain, nodeId)
-		autoClient.SetHostPort(nodeId + ":" + strconv.Itoa(autonomic.Port))
+		autoClient := l.node.AutonomicClients.Get(l.node.Config.Autonomic.Addr(nodeId))
 		load, status := autoClient.GetLoadForService(l.serviceId)
 		if status != http.StatusOK || numChildren == 0 {
 			info[nodeId] = 0.
@@ -214,7 +206,7 @@ func (l *LoadBalance) Cutoff(candidates goals.Domain, candidatesCriteria map[str
 		loadDiff)
 
 	for _, candidate := range candidates {
-		if candidatesCriteria[candidate].(float64) <= maximumLoad {
+		if candidatesCriteria[candidate].(float64) <= l.node.Config.Autonomic.MaximumLoad {
 			cutoff = append(cutoff, candidate)
 		}
 	}
@@ -242,15 +234,15 @@ func (l *LoadBalance) GetDependencies() (metrics []string) {
 }
 
 func (l *LoadBalance) IncreaseMigrationGroupSize() {
-	migrationGroupSize *= 2
+	l.migrationGroupSize *= 2
 }
 
 func (l *LoadBalance) DecreaseMigrationGroupSize() {
-	migrationGroupSize /= 2.0
+	l.migrationGroupSize /= 2.0
 }
 
 func (l *LoadBalance) ResetMigrationGroupSize() {
-	migrationGroupSize = defaultGroupSize
+	l.migrationGroupSize = l.node.Config.Autonomic.MigrationGroupSize
 }
 
 func (l *LoadBalance) GetId() string {
@@ -269,7 +261,7 @@ func (l *LoadBalance) getHighLoads() map[string]float64 {
 		}
 
 		load := value.(float64)
-		if load > maximumLoad {
+		if load > l.node.Config.Autonomic.MaximumLoad {
 			highLoads[childId] = load
 		}
 
@@ -308,11 +300,10 @@ func (l *LoadBalance) getAlternativeForHighLoad(highLoads map[string]float64, ca
 func (l *LoadBalance) handleOverload(candidates goals.Range) (actionArgs []interface{}, newOptRange goals.Range) {
 	actionArgs = make([]interface{}, lbNumArgs, lbNumArgs)
 	actionArgs[lbActionTypeArgIndex] = actions.AddServiceId
-	deplClient := deployer.NewDeployerClient("")
 	for _, candidate := range candidates {
 		_, okC := l.serviceChildren.Load(candidate)
 		if !okC {
-			deplClient.SetHostPort(candidate + ":" + strconv.Itoa(deployer.Port))
+			deplClient := l.node.DeployerClients.Get(l.node.Config.Deployer.Addr(candidate))
 			hasService, _ := deplClient.HasService(l.serviceId)
 			if hasService {
 				continue
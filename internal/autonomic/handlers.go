@@ -9,19 +9,7 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-var (
-	autonomicSystem *system
-)
-
-func init() {
-	log.SetLevel(log.DebugLevel)
-	autonomicSystem = newSystem()
-	autonomicSystem.start()
-
-	log.SetLevel(log.InfoLevel)
-}
-
-func addServiceHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) addServiceHandler(_ http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 
 	var serviceConfig api.AddServiceRequestBody
@@ -30,7 +18,7 @@ func addServiceHandler(_ http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	err = autonomicSystem.addService(serviceId, serviceConfig.StrategyId)
+	err = s.autonomicSystem.addService(serviceId, serviceConfig.StrategyId)
 	if err != nil {
 		panic(err)
 	}
@@ -38,60 +26,60 @@ func addServiceHandler(_ http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func removeServiceHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) removeServiceHandler(_ http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
-	autonomicSystem.removeService(serviceId)
+	s.autonomicSystem.removeService(serviceId)
 }
 
-func getAllServicesHandler(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) getAllServicesHandler(w http.ResponseWriter, _ *http.Request) {
 	resp := api.GetAllServicesResponseBody{}
-	services := autonomicSystem.getServices()
-	for serviceId, s := range services {
-		resp[serviceId] = s.toDTO()
+	services := s.autonomicSystem.getServices()
+	for serviceId, svc := range services {
+		resp[serviceId] = svc.toDTO()
 	}
 
 	utils.SendJSONReplyOK(w, resp)
 }
 
-func addServiceChildHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) addServiceChildHandler(_ http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 	childId := utils.ExtractPathVar(r, childIdPathVar)
 
-	autonomicSystem.addServiceChild(serviceId, childId)
+	s.autonomicSystem.addServiceChild(serviceId, childId)
 }
 
-func removeServiceChildHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) removeServiceChildHandler(_ http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 	childId := utils.ExtractPathVar(r, childIdPathVar)
 
-	autonomicSystem.removeServiceChild(serviceId, childId)
+	s.autonomicSystem.removeServiceChild(serviceId, childId)
 }
 
-func setServiceParentHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) setServiceParentHandler(_ http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 	parentId := utils.ExtractPathVar(r, parentIdPathVar)
 
-	autonomicSystem.setServiceParent(serviceId, parentId)
+	s.autonomicSystem.setServiceParent(serviceId, parentId)
 }
 
-func isNodeInVicinityHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) isNodeInVicinityHandler(w http.ResponseWriter, r *http.Request) {
 	nodeId := utils.ExtractPathVar(r, nodeIdPathVar)
 
-	if !autonomicSystem.isNodeInVicinity(nodeId) {
+	if !s.autonomicSystem.isNodeInVicinity(nodeId) {
 		w.WriteHeader(http.StatusNotFound)
 	}
 
 	return
 }
 
-func closestNodeToHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) closestNodeToHandler(w http.ResponseWriter, r *http.Request) {
 	var reqBody api.ClosestNodeRequestBody
 	err := json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
 		panic(err)
 	}
 
-	closest := autonomicSystem.closestNodeTo(reqBody.Location, reqBody.ToExclude)
+	closest := s.autonomicSystem.closestNodeTo(reqBody.Location, reqBody.ToExclude)
 	if closest == "" {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -100,8 +88,8 @@ func closestNodeToHandler(w http.ResponseWriter, r *http.Request) {
 	utils.SendJSONReplyOK(w, closest)
 }
 
-func getVicinityHandler(w http.ResponseWriter, _ *http.Request) {
-	vicinity := autonomicSystem.getVicinity()
+func (s *Server) getVicinityHandler(w http.ResponseWriter, _ *http.Request) {
+	vicinity := s.autonomicSystem.getVicinity()
 	if vicinity == nil {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -113,8 +101,8 @@ func getVicinityHandler(w http.ResponseWriter, _ *http.Request) {
 	utils.SendJSONReplyOK(w, respBody)
 }
 
-func getMyLocationHandler(w http.ResponseWriter, _ *http.Request) {
-	location := autonomicSystem.getMyLocation()
+func (s *Server) getMyLocationHandler(w http.ResponseWriter, _ *http.Request) {
+	location := s.autonomicSystem.getMyLocation()
 	if location == nil {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -126,9 +114,9 @@ func getMyLocationHandler(w http.ResponseWriter, _ *http.Request) {
 	utils.SendJSONReplyOK(w, respBody)
 }
 
-func getLoadForServiceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getLoadForServiceHandler(w http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
-	load, ok := autonomicSystem.getLoad(serviceId)
+	load, ok := s.autonomicSystem.getLoad(serviceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -139,17 +127,17 @@ func getLoadForServiceHandler(w http.ResponseWriter, r *http.Request) {
 	utils.SendJSONReplyOK(w, load)
 }
 
-func setExploreSuccessfullyHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) setExploreSuccessfullyHandler(w http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, serviceIdPathVar)
 	childId := utils.ExtractPathVar(r, childIdPathVar)
 
-	_, ok := autonomicSystem.services.Load(serviceId)
+	_, ok := s.autonomicSystem.services.Load(serviceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	ok = autonomicSystem.setExploreSuccess(serviceId, childId)
+	ok = s.autonomicSystem.setExploreSuccess(serviceId, childId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
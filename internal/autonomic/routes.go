@@ -22,6 +22,7 @@ const (
 	getMyLocationName        = "GET_MY_LOCATION"
 	getLoadName              = "GET_LOAD"
 	exploredSuccessfullyName = "EXPLORED_SUCCESSFULLY"
+	getConfigName            = "GET_CONFIG"
 )
 
 // Path variables
@@ -48,90 +49,100 @@ var (
 	getMyLocationRoute        = autonomic.MyLocationPath
 	getLoadRoute              = fmt.Sprintf(autonomic.LoadPath, _serviceIdPathVarFormatted)
 	exploredSuccessfullyRoute = fmt.Sprintf(autonomic.ExplorePath, _serviceIdPathVarFormatted, _childIdPathVarFormatted)
+	configRoute               = autonomic.ConfigPath
 )
 
-var Routes = []utils.Route{
-	{
-		Name:        exploredSuccessfullyName,
-		Method:      http.MethodPost,
-		Pattern:     exploredSuccessfullyRoute,
-		HandlerFunc: setExploreSuccessfullyHandler,
-	},
-
-	{
-		Name:        getLoadName,
-		Method:      http.MethodGet,
-		Pattern:     getLoadRoute,
-		HandlerFunc: getLoadForServiceHandler,
-	},
-
-	{
-		Name:        getMyLocationName,
-		Method:      http.MethodGet,
-		Pattern:     getMyLocationRoute,
-		HandlerFunc: getMyLocationHandler,
-	},
-
-	{
-		Name:        getVicinityName,
-		Method:      http.MethodGet,
-		Pattern:     getVicinityRoute,
-		HandlerFunc: getVicinityHandler,
-	},
-
-	{
-		Name:        closestNodeName,
-		Method:      http.MethodGet,
-		Pattern:     closestNodeRoute,
-		HandlerFunc: closestNodeToHandler,
-	},
-
-	{
-		Name:        isNodeInVicinityName,
-		Method:      http.MethodGet,
-		Pattern:     isNodeInVicinityRoute,
-		HandlerFunc: isNodeInVicinityHandler,
-	},
-
-	{
-		Name:        setServiceParentName,
-		Method:      http.MethodPost,
-		Pattern:     serviceParentRoute,
-		HandlerFunc: setServiceParentHandler,
-	},
-
-	{
-		Name:        addServiceChildName,
-		Method:      http.MethodPost,
-		Pattern:     serviceChildRoute,
-		HandlerFunc: addServiceChildHandler,
-	},
-
-	{
-		Name:        removeServiceChildName,
-		Method:      http.MethodDelete,
-		Pattern:     serviceChildRoute,
-		HandlerFunc: removeServiceChildHandler,
-	},
-
-	{
-		Name:        registerServiceName,
-		Method:      http.MethodPost,
-		Pattern:     serviceRoute,
-		HandlerFunc: addServiceHandler,
-	},
-
-	{
-		Name:        deleteServiceName,
-		Method:      http.MethodDelete,
-		Pattern:     serviceRoute,
-		HandlerFunc: removeServiceHandler,
-	},
-
-	{
-		Name:        getAllServicesName,
-		Method:      http.MethodGet,
-		Pattern:     servicesRoute,
-		HandlerFunc: getAllServicesHandler,
-	},
+func (s *Server) routes() []utils.Route {
+	return []utils.Route{
+		{
+			Name:        exploredSuccessfullyName,
+			Method:      http.MethodPost,
+			Pattern:     exploredSuccessfullyRoute,
+			HandlerFunc: s.setExploreSuccessfullyHandler,
+		},
+
+		{
+			Name:        getLoadName,
+			Method:      http.MethodGet,
+			Pattern:     getLoadRoute,
+			HandlerFunc: s.getLoadForServiceHandler,
+		},
+
+		{
+			Name:        getMyLocationName,
+			Method:      http.MethodGet,
+			Pattern:     getMyLocationRoute,
+			HandlerFunc: s.getMyLocationHandler,
+		},
+
+		{
+			Name:        getVicinityName,
+			Method:      http.MethodGet,
+			Pattern:     getVicinityRoute,
+			HandlerFunc: s.getVicinityHandler,
+		},
+
+		{
+			Name:        closestNodeName,
+			Method:      http.MethodGet,
+			Pattern:     closestNodeRoute,
+			HandlerFunc: s.closestNodeToHandler,
+		},
+
+		{
+			Name:        isNodeInVicinityName,
+			Method:      http.MethodGet,
+			Pattern:     isNodeInVicinityRoute,
+			HandlerFunc: s.isNodeInVicinityHandler,
+		},
+
+		{
+			Name:        setServiceParentName,
+			Method:      http.MethodPost,
+			Pattern:     serviceParentRoute,
+			HandlerFunc: s.setServiceParentHandler,
+		},
+
+		{
+			Name:        addServiceChildName,
+			Method:      http.MethodPost,
+			Pattern:     serviceChildRoute,
+			HandlerFunc: s.addServiceChildHandler,
+		},
+
+		{
+			Name:        removeServiceChildName,
+			Method:      http.MethodDelete,
+			Pattern:     serviceChildRoute,
+			HandlerFunc: s.removeServiceChildHandler,
+		},
+
+		{
+			Name:        registerServiceName,
+			Method:      http.MethodPost,
+			Pattern:     serviceRoute,
+			HandlerFunc: s.addServiceHandler,
+		},
+
+		{
+			Name:        deleteServiceName,
+			Method:      http.MethodDelete,
+			Pattern:     serviceRoute,
+			HandlerFunc: s.removeServiceHandler,
+		},
+
+		{
+			Name:        getAllServicesName,
+			Method:      http.MethodGet,
+			Pattern:     servicesRoute,
+			HandlerFunc: s.getAllServicesHandler,
+		},
+
+		{
+			Name:        getConfigName,
+			Method:      http.MethodGet,
+			Pattern:     configRoute,
+			HandlerFunc: s.config.Handler,
+		},
+	}
 }
@@ -0,0 +1,149 @@
+package autonomic
+
+import (
+	"context"
+	"net"
+	"os"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/autonomic"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/environment"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/goals"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/archimedes"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/autonomic"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	"github.com/pkg/errors"
+)
+
+const (
+	serviceName = "AUTONOMIC"
+)
+
+type (
+	// Server is the autonomic system of a node, which optimizes the deployments in it. Every piece of state lives
+	// in it, so several can run in the same process.
+	Server struct {
+		*utils.Server
+
+		config         *config.Config
+		transport      *utils.Transport
+		listener       net.Listener
+		hostname       string
+		initialMetrics map[string]interface{}
+
+		autonomicSystem *system
+	}
+
+	Option func(s *Server)
+)
+
+// WithConfig sets the configuration of the autonomic system, instead of the one of the process
+func WithConfig(conf *config.Config) Option {
+	return func(s *Server) {
+		s.config = conf
+	}
+}
+
+// WithTransport sets the transport the clients of the autonomic system do their requests with
+func WithTransport(transport *utils.Transport) Option {
+	return func(s *Server) {
+		s.transport = transport
+	}
+}
+
+// WithListener makes the autonomic system serve on the listener, instead of listening on the configured port
+func WithListener(listener net.Listener) Option {
+	return func(s *Server) {
+		s.listener = listener
+	}
+}
+
+// WithHostname sets the hostname of the node, whose metrics file is loaded, instead of the one of the machine
+func WithHostname(hostname string) Option {
+	return func(s *Server) {
+		s.hostname = hostname
+	}
+}
+
+// WithMetrics sets the initial metrics of the node, instead of loading them from its metrics file
+func WithMetrics(initialMetrics map[string]interface{}) Option {
+	return func(s *Server) {
+		s.initialMetrics = initialMetrics
+	}
+}
+
+func NewServer(opts ...Option) *Server {
+	s := &Server{}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.config == nil {
+		s.config = config.Get()
+	}
+
+	security, err := s.config.Server.Security()
+	if err != nil {
+		panic(err)
+	}
+
+	if s.transport == nil {
+		s.transport = utils.NewTransport(nil, security)
+	}
+
+	if s.initialMetrics == nil {
+		if s.hostname == "" {
+			s.hostname, err = os.Hostname()
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		s.initialMetrics = environment.LoadSimMetrics(s.hostname)
+	}
+
+	archimedesClients := archimedes.NewClientPool(s.transport)
+	node := &goals.Node{
+		Config:           s.config,
+		ArchimedesClient: archimedesClients.Get(s.config.Archimedes.HostPort()),
+		AutonomicClients: autonomic.NewClientPool(s.transport),
+		DeployerClients:  deployer.NewClientPool(s.transport),
+	}
+
+	s.autonomicSystem = newSystem(node, archimedesClients, s.initialMetrics)
+	s.Server = utils.NewServer(serviceName, api.PrefixPath, s.routes(), security.TLS)
+
+	return s
+}
+
+// Start starts serving and evaluating the services every interval
+func (s *Server) Start() error {
+	if s.listener == nil {
+		var err error
+		s.listener, err = utils.Listen(s.config.Server.ListenAddr, s.config.Autonomic.Port)
+		if err != nil {
+			return errors.Wrap(err, "error listening")
+		}
+	}
+
+	s.Go(func() {
+		s.autonomicSystem.run(s.Stopped())
+	})
+
+	s.Serve(s.listener)
+
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.Shutdown(ctx)
+}
+
+// SetMetric sets the value of the metric, tracking it if it was not tracked yet. It stands in for the layer
+// monitoring the node, e.g. when it is simulated.
+func (s *Server) SetMetric(metricId string, value interface{}) {
+	s.autonomicSystem.env.TrackMetric(metricId)
+	s.autonomicSystem.env.SetMetric(metricId, value)
+}
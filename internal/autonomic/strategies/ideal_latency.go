@@ -30,18 +30,18 @@ type idealLatencyStrategy struct {
 }
 
 func NewDefaultIdealLatencyStrategy(serviceId string, serviceChildren, suspected *sync.Map, parentId *string,
-	env *environment.Environment) *idealLatencyStrategy {
-	lbGoal := service_goals.NewLoadBalance(serviceId, serviceChildren, suspected, parentId, env)
+	env *environment.Environment, node *goals.Node) *idealLatencyStrategy {
+	lbGoal := service_goals.NewLoadBalance(serviceId, serviceChildren, suspected, parentId, env, node)
 
 	defaultGoals := []goals.Goal{
-		service_goals.NewIdealLatency(serviceId, serviceChildren, suspected, parentId, env),
+		service_goals.NewIdealLatency(serviceId, serviceChildren, suspected, parentId, env, node),
 		lbGoal,
 	}
 
 	return &idealLatencyStrategy{
 		basicStrategy: newBasicStrategy(StrategyIdealLatencyId, defaultGoals),
 		redirected:    0,
-		archClient:    archimedes.NewArchimedesClient(archimedes.DefaultHostPort),
+		archClient:    node.ArchimedesClient,
 		serviceId:     serviceId,
 		env:           env,
 		lbGoal:        lbGoal,
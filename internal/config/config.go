@@ -0,0 +1,296 @@
+package config
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/archimedes"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/autonomic"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/scheduler"
+	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// Failure detectors
+const (
+	PhiAccrualDetectorName = "phi"
+	SwimDetectorName       = "swim"
+)
+
+type (
+	// Config is the configuration of every daemon, each using the server section and its own. Values come from the
+	// defaults, overridden by the configuration file, then by the environment variable in the env tag of each
+	// field and then by the flags, named after the yaml path of the field unless the flag tag says otherwise.
+	Config struct {
+		Server     ServerConfig     `yaml:"server"`
+		Deployer   DeployerConfig   `yaml:"deployer"`
+		Archimedes ArchimedesConfig `yaml:"archimedes"`
+		Autonomic  AutonomicConfig  `yaml:"autonomic"`
+		Scheduler  SchedulerConfig  `yaml:"scheduler"`
+	}
+
+	ServerConfig struct {
+		Debug      bool   `yaml:"debug" env:"DEBUG" flag:"d" usage:"add debug logs"`
+		ListenAddr string `yaml:"listenAddr" env:"LISTEN_ADDR" flag:"l" usage:"address to listen on"`
+		// TLSCertFile, TLSKeyFile and TLSCAFile configure mutual TLS, which is disabled without them. The
+		// certificate common name is the node id.
+		TLSCertFile string `yaml:"tlsCertFile" env:"TLS_CERT_FILE"`
+		TLSKeyFile  string `yaml:"tlsKeyFile" env:"TLS_KEY_FILE"`
+		TLSCAFile   string `yaml:"tlsCAFile" env:"TLS_CA_FILE"`
+		// AuthToken is the node token, which the requests of the node carry. The local scheduler accepts it for
+		// exec, and the schedulers of other nodes for volume snapshots, so migrating stateful deployments without
+		// TLS needs the same token in every node.
+		AuthToken string `yaml:"authToken" env:"AUTH_TOKEN"`
+	}
+
+	DeployerConfig struct {
+		Port                     int           `yaml:"port" env:"DEPLOYER_PORT"`
+		SendAlternativesInterval time.Duration `yaml:"sendAlternativesInterval" env:"SEND_ALTERNATIVES_INTERVAL"`
+		ExtendAttemptInterval    time.Duration `yaml:"extendAttemptInterval" env:"EXTEND_ATTEMPT_INTERVAL"`
+		WaitForNewParentTimeout  time.Duration `yaml:"waitForNewParentTimeout" env:"WAIT_FOR_NEW_PARENT_TIMEOUT"`
+		MaxHopsToLookFor         int           `yaml:"maxHopsToLookFor" env:"MAX_HOPS_TO_LOOK_FOR"`
+		FallbacksFile            string        `yaml:"fallbacksFile" env:"FALLBACKS_FILE"`
+		// MigrationTimeout is how long the target of a migration waits for its instances before giving up, leaving
+		// the origin serving
+		MigrationTimeout time.Duration `yaml:"migrationTimeout" env:"MIGRATION_TIMEOUT"`
+		// AuthTokensFile is the YAML file with the tokens accepted by the deployer, as a list of entries with
+		// token, user and role. Without it every request is treated as coming from an admin.
+		AuthTokensFile string `yaml:"authTokensFile" env:"AUTH_TOKENS_FILE"`
+		// SecretsKeyFile has a base64 encoded 32 byte key, e.g. from openssl rand -base64 32, and without it the
+		// secrets store is disabled. Only the nodes deployments are registered in, which are the roots of their
+		// trees, need it.
+		SecretsKeyFile string `yaml:"secretsKeyFile" env:"SECRETS_KEY_FILE"`
+		SecretsFile    string `yaml:"secretsFile" env:"SECRETS_FILE"`
+		// EventsForwardUp makes every event published in the node be forwarded to the parent of its deployment,
+		// so the root of a deployment sees the events of the whole tree
+		EventsForwardUp bool `yaml:"eventsForwardUp" env:"EVENTS_FORWARD_UP"`
+		// RootReplicas has the ids of the nodes replicating the roots of deployments, separated by commas.
+		// Without them, the root of a deployment is the node it was registered in and its orphans go to the
+		// fallback node. Replicas keep their term, vote and replicated roots in the replication file.
+		RootReplicas        string                `yaml:"rootReplicas" env:"ROOT_REPLICAS"`
+		RootReplicationFile string                `yaml:"rootReplicationFile" env:"ROOT_REPLICATION_FILE"`
+		FailureDetector     FailureDetectorConfig `yaml:"failureDetector"`
+	}
+
+	// FailureDetectorConfig configures the failure detector used for both parents and children. The SWIM
+	// timeouts default to multiples of the heartbeat interval.
+	FailureDetectorConfig struct {
+		Detector             string        `yaml:"detector" env:"FAILURE_DETECTOR"`
+		HeartbeatInterval    time.Duration `yaml:"heartbeatInterval" env:"HEARTBEAT_INTERVAL"`
+		CheckInterval        time.Duration `yaml:"checkInterval" env:"FAILURE_CHECK_INTERVAL"`
+		PhiSuspectThreshold  float64       `yaml:"phiSuspectThreshold" env:"PHI_SUSPECT_THRESHOLD"`
+		PhiDeadThreshold     float64       `yaml:"phiDeadThreshold" env:"PHI_DEAD_THRESHOLD"`
+		SwimProbeTimeout     time.Duration `yaml:"swimProbeTimeout" env:"SWIM_PROBE_TIMEOUT"`
+		SwimPingTimeout      time.Duration `yaml:"swimPingTimeout" env:"SWIM_PING_TIMEOUT"`
+		SwimSuspicionTimeout time.Duration `yaml:"swimSuspicionTimeout" env:"SWIM_SUSPICION_TIMEOUT"`
+		SwimIndirectProbes   int           `yaml:"swimIndirectProbes" env:"SWIM_INDIRECT_PROBES"`
+	}
+
+	ArchimedesConfig struct {
+		Port    int `yaml:"port" env:"ARCHIMEDES_PORT"`
+		MaxHops int `yaml:"maxHops" env:"ARCHIMEDES_MAX_HOPS"`
+	}
+
+	AutonomicConfig struct {
+		Port     int           `yaml:"port" env:"AUTONOMIC_PORT"`
+		Interval time.Duration `yaml:"interval" env:"AUTONOMIC_INTERVAL"`
+		// MaximumLoad is the load above which a deployment is extended to balance it
+		MaximumLoad float64 `yaml:"maximumLoad" env:"MAXIMUM_LOAD"`
+		// ProcessingThreshold is the part of the latency spent processing above which the ideal latency goal
+		// extends the deployment instead of moving it closer to the clients
+		ProcessingThreshold float64 `yaml:"processingThreshold" env:"PROCESSING_THRESHOLD"`
+		MigrationGroupSize  float64 `yaml:"migrationGroupSize" env:"MIGRATION_GROUP_SIZE"`
+	}
+
+	SchedulerConfig struct {
+		Port    int    `yaml:"port" env:"SCHEDULER_PORT"`
+		Runtime string `yaml:"runtime" env:"SCHEDULER_RUNTIME" flag:"runtime" usage:"container runtime to run instances with (docker, containerd or fake)"`
+		// RegistryCredentials is the JSON file with the registry credentials referenced by imagePullSecrets
+		RegistryCredentials string `yaml:"registryCredentials" env:"REGISTRY_CREDENTIALS" flag:"registry-credentials" usage:"JSON file with the registry credentials referenced by imagePullSecrets"`
+	}
+)
+
+func newDefaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddr: utils.LocalhostAddr,
+		},
+		Deployer: DeployerConfig{
+			Port:                     deployer.Port,
+			SendAlternativesInterval: 30 * time.Second,
+			ExtendAttemptInterval:    5 * time.Second,
+			WaitForNewParentTimeout:  60 * time.Second,
+			MaxHopsToLookFor:         5,
+			MigrationTimeout:         5 * time.Minute,
+			FallbacksFile:            "fallback.txt",
+			SecretsFile:              "secrets.enc",
+			RootReplicationFile:      "root_replication.json",
+			FailureDetector: FailureDetectorConfig{
+				Detector:            PhiAccrualDetectorName,
+				HeartbeatInterval:   10 * time.Second,
+				CheckInterval:       1 * time.Second,
+				PhiSuspectThreshold: 3,
+				PhiDeadThreshold:    8,
+				SwimPingTimeout:     2 * time.Second,
+				SwimIndirectProbes:  3,
+			},
+		},
+		Archimedes: ArchimedesConfig{
+			Port:    archimedes.Port,
+			MaxHops: 2,
+		},
+		Autonomic: AutonomicConfig{
+			Port:                autonomic.Port,
+			Interval:            30 * time.Second,
+			MaximumLoad:         0.7,
+			ProcessingThreshold: 0.8,
+			MigrationGroupSize:  0.10,
+		},
+		Scheduler: SchedulerConfig{
+			Port:    scheduler.Port,
+			Runtime: "docker",
+		},
+	}
+}
+
+// complete fills in the values that default to others
+func (c *Config) complete() {
+	fd := &c.Deployer.FailureDetector
+	if fd.SwimProbeTimeout == 0 {
+		fd.SwimProbeTimeout = 2 * fd.HeartbeatInterval
+	}
+
+	if fd.SwimSuspicionTimeout == 0 {
+		fd.SwimSuspicionTimeout = 3 * fd.HeartbeatInterval
+	}
+}
+
+func (c *Config) validate() error {
+	ports := map[string]int{
+		"deployer.port":   c.Deployer.Port,
+		"archimedes.port": c.Archimedes.Port,
+		"autonomic.port":  c.Autonomic.Port,
+		"scheduler.port":  c.Scheduler.Port,
+	}
+	for name, port := range ports {
+		if port <= 0 || port > 65535 {
+			return errors.Errorf("invalid %s %d", name, port)
+		}
+	}
+
+	durations := map[string]time.Duration{
+		"deployer.sendAlternativesInterval":             c.Deployer.SendAlternativesInterval,
+		"deployer.extendAttemptInterval":                c.Deployer.ExtendAttemptInterval,
+		"deployer.waitForNewParentTimeout":              c.Deployer.WaitForNewParentTimeout,
+		"deployer.migrationTimeout":                     c.Deployer.MigrationTimeout,
+		"deployer.failureDetector.heartbeatInterval":    c.Deployer.FailureDetector.HeartbeatInterval,
+		"deployer.failureDetector.checkInterval":        c.Deployer.FailureDetector.CheckInterval,
+		"deployer.failureDetector.swimProbeTimeout":     c.Deployer.FailureDetector.SwimProbeTimeout,
+		"deployer.failureDetector.swimPingTimeout":      c.Deployer.FailureDetector.SwimPingTimeout,
+		"deployer.failureDetector.swimSuspicionTimeout": c.Deployer.FailureDetector.SwimSuspicionTimeout,
+		"autonomic.interval":                            c.Autonomic.Interval,
+	}
+	for name, duration := range durations {
+		if duration <= 0 {
+			return errors.Errorf("%s must be positive, got %s", name, duration)
+		}
+	}
+
+	fd := c.Deployer.FailureDetector
+	switch fd.Detector {
+	case PhiAccrualDetectorName, SwimDetectorName:
+	default:
+		return errors.Errorf("unknown failure detector %q", fd.Detector)
+	}
+
+	if fd.PhiSuspectThreshold < 0 || fd.PhiSuspectThreshold > fd.PhiDeadThreshold {
+		return errors.Errorf("phi thresholds must be 0 <= suspect (%f) <= dead (%f)", fd.PhiSuspectThreshold,
+			fd.PhiDeadThreshold)
+	}
+
+	if fd.SwimIndirectProbes < 0 {
+		return errors.Errorf("invalid number of indirect probes %d", fd.SwimIndirectProbes)
+	}
+
+	tlsFiles := 0
+	for _, filename := range []string{c.Server.TLSCertFile, c.Server.TLSKeyFile, c.Server.TLSCAFile} {
+		if filename != "" {
+			tlsFiles++
+		}
+	}
+	if tlsFiles != 0 && tlsFiles != 3 {
+		return errors.New("TLS needs the certificate, the key and the CA bundle")
+	}
+
+	if c.Deployer.MaxHopsToLookFor < 1 || c.Archimedes.MaxHops < 1 {
+		return errors.New("the maximum hops must be at least 1")
+	}
+
+	fractions := map[string]float64{
+		"autonomic.maximumLoad":         c.Autonomic.MaximumLoad,
+		"autonomic.processingThreshold": c.Autonomic.ProcessingThreshold,
+		"autonomic.migrationGroupSize":  c.Autonomic.MigrationGroupSize,
+	}
+	for name, fraction := range fractions {
+		if fraction <= 0 || fraction > 1 {
+			return errors.Errorf("%s must be in ]0, 1], got %f", name, fraction)
+		}
+	}
+
+	return nil
+}
+
+// Security loads what the daemons of the node authenticate with
+func (c *ServerConfig) Security() (*utils.Security, error) {
+	tlsConfig, err := utils.LoadTLS(c.TLSCertFile, c.TLSKeyFile, c.TLSCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &utils.Security{
+		AuthToken: c.AuthToken,
+		TLS:       tlsConfig,
+	}, nil
+}
+
+// HostPort returns the address of the deployer in the node
+func (c *DeployerConfig) HostPort() string {
+	return c.Addr(publicUtils.DeployerServiceName)
+}
+
+// Addr returns the address of the deployer in the node with the address given
+func (c *DeployerConfig) Addr(nodeAddr string) string {
+	return nodeAddr + ":" + strconv.Itoa(c.Port)
+}
+
+// HostPort returns the address of archimedes in the node
+func (c *ArchimedesConfig) HostPort() string {
+	return c.Addr(publicUtils.ArchimedesServiceName)
+}
+
+// Addr returns the address of archimedes in the node with the address given
+func (c *ArchimedesConfig) Addr(nodeAddr string) string {
+	return nodeAddr + ":" + strconv.Itoa(c.Port)
+}
+
+// HostPort returns the address of the autonomic in the node
+func (c *AutonomicConfig) HostPort() string {
+	return c.Addr(publicUtils.AutonomicServiceName)
+}
+
+// Addr returns the address of the autonomic in the node with the address given
+func (c *AutonomicConfig) Addr(nodeAddr string) string {
+	return nodeAddr + ":" + strconv.Itoa(c.Port)
+}
+
+// HostPort returns the address of the scheduler in the node
+func (c *SchedulerConfig) HostPort() string {
+	return c.Addr(publicUtils.SchedulerServiceName)
+}
+
+// Addr returns the address of the scheduler in the node with the address given
+func (c *SchedulerConfig) Addr(nodeAddr string) string {
+	return nodeAddr + ":" + strconv.Itoa(c.Port)
+}
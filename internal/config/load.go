@@ -0,0 +1,238 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFileEnvVarName = "CONFIG_FILE"
+	configFileFlagName   = "config"
+
+	redacted = "<redacted>"
+)
+
+var (
+	loaded   *Config
+	loadOnce sync.Once
+
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// Get returns the configuration of the daemon, loading it from the file, the environment and the command line
+// the first time. It panics if the configuration is invalid, so daemons fail at startup instead of running with
+// values they would trip on later.
+func Get() *Config {
+	loadOnce.Do(func() {
+		var err error
+		loaded, err = Load(os.Args[1:])
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		} else if err != nil {
+			panic(err)
+		}
+
+		log.Debugf("config: %+v", loaded.redact())
+	})
+
+	return loaded
+}
+
+// Default returns the default configuration, without looking at the file, the environment or the arguments, e.g.
+// for daemons embedded in other programs
+func Default() *Config {
+	config := newDefaultConfig()
+	config.complete()
+
+	return config
+}
+
+// Load builds the configuration from the defaults, the configuration file, the environment and the arguments
+func Load(args []string) (*Config, error) {
+	config := newDefaultConfig()
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	configFilename := flags.String(configFileFlagName, os.Getenv(configFileEnvVarName), "YAML configuration file")
+	setters := map[string]func(string) error{}
+	registerFlags(flags, reflect.ValueOf(config).Elem(), "", setters)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if *configFilename != "" {
+		var fileBytes []byte
+		fileBytes, err = ioutil.ReadFile(*configFilename)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading config file")
+		}
+
+		err = yaml.Unmarshal(fileBytes, config)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing config file")
+		}
+	}
+
+	err = loadEnv(reflect.ValueOf(config).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	// flags given explicitly win over everything else
+	flags.Visit(func(f *flag.Flag) {
+		if setter, ok := setters[f.Name]; ok && err == nil {
+			err = setter(f.Value.String())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	config.complete()
+
+	err = config.validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	return config, nil
+}
+
+// registerFlags adds a flag for each field, which only records the value so it can be applied after the file and
+// the environment
+func registerFlags(flags *flag.FlagSet, value reflect.Value, prefix string, setters map[string]func(string) error) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		fieldValue := value.Field(i)
+		path := prefix + field.Tag.Get("yaml")
+
+		if fieldValue.Kind() == reflect.Struct {
+			registerFlags(flags, fieldValue, path+".", setters)
+			continue
+		}
+
+		name := field.Tag.Get("flag")
+		if name == "" {
+			name = path
+		}
+
+		usage := field.Tag.Get("usage")
+		if usage == "" {
+			usage = "sets " + path
+		}
+
+		if fieldValue.Kind() == reflect.Bool {
+			flags.Bool(name, fieldValue.Bool(), usage)
+		} else {
+			flags.String(name, formatValue(fieldValue), usage)
+		}
+
+		setters[name] = func(raw string) error {
+			return setValue(fieldValue, raw, "flag -"+name)
+		}
+	}
+}
+
+func loadEnv(value reflect.Value) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		fieldValue := value.Field(i)
+
+		if fieldValue.Kind() == reflect.Struct {
+			err := loadEnv(fieldValue)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		envVarName := field.Tag.Get("env")
+		raw, ok := os.LookupEnv(envVarName)
+		if envVarName == "" || !ok || raw == "" {
+			continue
+		}
+
+		err := setValue(fieldValue, raw, envVarName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setValue(value reflect.Value, raw, source string) error {
+	var err error
+
+	switch {
+	case value.Type() == durationType:
+		var duration time.Duration
+		duration, err = time.ParseDuration(raw)
+		value.SetInt(int64(duration))
+	case value.Kind() == reflect.Int:
+		var number int
+		number, err = strconv.Atoi(raw)
+		value.SetInt(int64(number))
+	case value.Kind() == reflect.Float64:
+		var number float64
+		number, err = strconv.ParseFloat(raw, 64)
+		value.SetFloat(number)
+	case value.Kind() == reflect.Bool:
+		var boolean bool
+		boolean, err = strconv.ParseBool(raw)
+		value.SetBool(boolean)
+	case value.Kind() == reflect.String:
+		value.SetString(raw)
+	default:
+		err = errors.Errorf("unsupported type %s", value.Type())
+	}
+
+	if err != nil {
+		return errors.Errorf("invalid %s %q", source, raw)
+	}
+
+	return nil
+}
+
+func formatValue(value reflect.Value) string {
+	if value.Type() == durationType {
+		return time.Duration(value.Int()).String()
+	}
+
+	return fmt.Sprint(value.Interface())
+}
+
+// Handler replies with the effective configuration of the daemon, in YAML so it can be used as a configuration
+// file as is, except for the auth token, which is redacted
+func (c *Config) Handler(w http.ResponseWriter, _ *http.Request) {
+	configBytes, err := yaml.Marshal(c.redact())
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(configBytes)
+}
+
+// redact returns a copy of the configuration without the auth token, so it can be shown
+func (c *Config) redact() *Config {
+	redactedConfig := *c
+	if redactedConfig.Server.AuthToken != "" {
+		redactedConfig.Server.AuthToken = redacted
+	}
+
+	return &redactedConfig
+}
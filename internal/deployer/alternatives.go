@@ -3,82 +3,120 @@ package deployer
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 	"time"
 
 	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
 	log "github.com/sirupsen/logrus"
 )
 
-func setAlternativesHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) setAlternativesHandler(w http.ResponseWriter, r *http.Request) {
 	deployerId := utils.ExtractPathVar(r, nodeIdPathVar)
 
+	if !s.security.TLS.IsRequestFrom(r, deployerId) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
 	reqBody := api.AlternativesRequestBody{}
 	err := json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
 		panic(err)
 	}
 
-	nodeAlternativesLock.Lock()
-	defer nodeAlternativesLock.Unlock()
+	s.setAlternatives(deployerId, reqBody)
+}
+
+func (s *Server) setAlternatives(deployerId string, alternatives []*utils.Node) {
+	s.nodeAlternativesLock.Lock()
+	defer s.nodeAlternativesLock.Unlock()
 
-	nodeAlternatives[deployerId] = reqBody
+	s.nodeAlternatives[deployerId] = alternatives
 }
 
-func simulateAlternatives() {
-	go loadAlternativesPeriodically()
+func (s *Server) simulateAlternatives() {
+	s.Go(s.loadAlternativesPeriodically)
 }
 
-func loadAlternativesPeriodically() {
+func (s *Server) loadAlternativesPeriodically() {
 	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
 
 	for {
-		<-ticker.C
+		select {
+		case <-s.Stopped():
+			return
+		case <-ticker.C:
+		}
 
-		vicinity, status := hTable.autonomicClient.GetVicinity()
+		vicinity, status := s.hTable.autonomicClient.GetVicinity()
 		if status != http.StatusOK {
 			continue
 		}
 
 		for neighbor := range vicinity {
-			onNodeUp(neighbor)
+			s.onNodeUp(neighbor)
 		}
 	}
 }
 
-func sendAlternativesPeriodically() {
+func (s *Server) sendAlternativesPeriodically() {
 	for {
 		// TODO not perfect
-		<-timer.C
-		sendAlternatives()
-		if !timer.Stop() {
-			<-timer.C
+		select {
+		case <-s.Stopped():
+			return
+		case <-s.timer.C:
 		}
-		timer.Reset(sendAlternativesTimeout * time.Second)
+
+		s.sendAlternatives()
+		s.timer.Reset(s.deployerConfig.SendAlternativesInterval)
 	}
 }
 
-func sendAlternatives() {
+// resetAlternativesTimer delays the next round of alternatives, after they were just sent
+func (s *Server) resetAlternativesTimer() {
+	if !s.timer.Stop() {
+		// the loop sending alternatives may have taken the tick already, so this must not wait for it
+		select {
+		case <-s.timer.C:
+		default:
+		}
+	}
+	s.timer.Reset(s.deployerConfig.SendAlternativesInterval)
+}
+
+func (s *Server) sendAlternatives() {
 	log.Debug("sending alternatives")
 	var alternatives []*utils.Node
-	myAlternatives.Range(func(key, value interface{}) bool {
+	s.myAlternatives.Range(func(key, value interface{}) bool {
 		neighbor := value.(typeMyAlternativesMapValue)
 		alternatives = append(alternatives, neighbor)
 		return true
 	})
 
-	children.Range(func(key, value interface{}) bool {
+	s.children.Range(func(key, value interface{}) bool {
 		neighbor := value.(typeChildrenMapValue)
-		sendAlternativesTo(neighbor, alternatives)
+		s.sendAlternativesTo(neighbor, alternatives)
 		return true
 	})
 }
 
-func sendAlternativesTo(neighbor *utils.Node, alternatives []*utils.Node) {
-	depClient := deployer.NewDeployerClient(neighbor.Addr + ":" + strconv.Itoa(deployer.Port))
-	status := depClient.SendAlternatives(myself.Id, alternatives)
+func (s *Server) sendAlternativesTo(neighbor *utils.Node, alternatives []*utils.Node) {
+	if s.transport.IsCircuitOpen(s.addPortToAddr(neighbor.Addr)) {
+		log.Debugf("not sending alternatives to unreachable %s", neighbor.Id)
+		return
+	}
+
+	frame := &api.ControlFrameDTO{
+		Type:         api.FrameAlternatives,
+		Alternatives: alternatives,
+	}
+	if s.sendControlFrame(neighbor.Id, frame) {
+		return
+	}
+
+	status := s.getDeployerClient(neighbor.Addr).SendAlternatives(s.myself.Id, alternatives)
 	if status != http.StatusOK {
 		log.Errorf("got status %d while sending alternatives to %s", status, neighbor.Addr)
 	}
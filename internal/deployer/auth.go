@@ -0,0 +1,165 @@
+package deployer
+
+import (
+	"context"
+	"crypto/subtle"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Roles a token can have. Each role can do everything the previous ones can.
+const (
+	roleViewer   = "viewer"
+	roleOperator = "operator"
+	roleAdmin    = "admin"
+)
+
+type (
+	authToken struct {
+		Token string
+		User  string
+		Role  string
+	}
+
+	principal struct {
+		User string
+		Role string
+	}
+
+	principalContextKey struct{}
+)
+
+var (
+	roleRanks = map[string]int{
+		roleViewer:   0,
+		roleOperator: 1,
+		roleAdmin:    2,
+	}
+)
+
+func (s *Server) loadAuthTokens(filename string) {
+	if filename == "" {
+		log.Warn("no auth tokens file, requests will not be authenticated")
+		return
+	}
+
+	fileBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		panic(errors.Wrap(err, "error reading auth tokens file"))
+	}
+
+	err = yaml.Unmarshal(fileBytes, &s.authTokens)
+	if err != nil {
+		panic(errors.Wrap(err, "error parsing auth tokens file"))
+	}
+
+	for _, token := range s.authTokens {
+		if _, ok := roleRanks[token.Role]; !ok || token.Token == "" || token.User == "" {
+			panic(errors.Errorf("invalid auth token entry for user %q with role %q", token.User, token.Role))
+		}
+	}
+
+	s.authEnabled = true
+
+	log.Infof("loaded %d auth tokens", len(s.authTokens))
+}
+
+// getRequestPrincipal authenticates the request. Other nodes present a verified client certificate when using
+// TLS or a node token, which should have the admin role, when not.
+func (s *Server) getRequestPrincipal(r *http.Request) (*principal, bool) {
+	if !s.authEnabled {
+		return &principal{Role: roleAdmin}, true
+	}
+
+	if id, ok := utils.GetRequestIdentity(r); ok {
+		return &principal{User: id, Role: roleAdmin}, true
+	}
+
+	requestToken := []byte(utils.GetBearerToken(r))
+	if len(requestToken) == 0 {
+		return nil, false
+	}
+
+	for _, token := range s.authTokens {
+		if subtle.ConstantTimeCompare(requestToken, []byte(token.Token)) == 1 {
+			return &principal{User: token.User, Role: token.Role}, true
+		}
+	}
+
+	return nil, false
+}
+
+// isAdmin checks if the user has a token with the admin role
+func (s *Server) isAdmin(user string) bool {
+	for _, token := range s.authTokens {
+		if token.User == user && token.Role == roleAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *principal) hasRole(role string) bool {
+	return roleRanks[p.Role] >= roleRanks[role]
+}
+
+// canManage checks if the principal can change a deployment. Admins can change every deployment, operators
+// only the ones they own.
+func (p *principal) canManage(hTable *hierarchyTable, deploymentId string) bool {
+	if p.hasRole(roleAdmin) {
+		return true
+	}
+
+	owner, ok := hTable.getOwner(deploymentId)
+
+	// deployments that do not exist are left for the handler to reply not found
+	return !ok || (p.hasRole(roleOperator) && owner == p.User)
+}
+
+func principalFromContext(r *http.Request) *principal {
+	return r.Context().Value(principalContextKey{}).(*principal)
+}
+
+// authorize only lets requests with at least the role through, replying unauthorized to requests without valid
+// credentials and forbidden to the others
+func (s *Server) authorize(role string, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.getRequestPrincipal(r)
+		if !ok {
+			log.Debugf("refused unauthenticated %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if !p.hasRole(role) {
+			log.Debugf("refused %s %s to %s with role %s", r.Method, r.URL.Path, p.User, p.Role)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		handlerFunc(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, p)))
+	}
+}
+
+// authorizeOwner is authorize for routes changing the deployment in the path, which also need the principal
+// to be able to manage it
+func (s *Server) authorizeOwner(role string, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return s.authorize(role, func(w http.ResponseWriter, r *http.Request) {
+		p := principalFromContext(r)
+		deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+
+		if !p.canManage(s.hTable, deploymentId) {
+			log.Debugf("refused %s %s to %s, that does not own %s", r.Method, r.URL.Path, p.User, deploymentId)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		handlerFunc(w, r)
+	})
+}
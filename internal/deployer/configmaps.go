@@ -0,0 +1,224 @@
+package deployer
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	schedulerApi "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// configMapsYAMLToDTOs returns the config maps of the deployment, or why they are invalid if they are
+func configMapsYAMLToDTOs(deploymentYAML *api.DeploymentYAML) ([]*schedulerApi.ConfigMapDTO, error) {
+	var configMaps []*schedulerApi.ConfigMapDTO
+	names := map[string]struct{}{}
+
+	for _, configMap := range deploymentYAML.Spec.Template.Spec.ConfigMaps {
+		if configMap.Name == "" || !path.IsAbs(configMap.MountPath) {
+			return nil, errors.Errorf("config map %s needs a name and an absolute mount path", configMap.Name)
+		} else if _, ok := names[configMap.Name]; ok {
+			return nil, errors.Errorf("config map %s is declared more than once", configMap.Name)
+		}
+
+		for filename := range configMap.Data {
+			if !isValidConfigMapFilename(filename) {
+				return nil, errors.Errorf("invalid file %s in config map %s", filename, configMap.Name)
+			}
+		}
+
+		names[configMap.Name] = struct{}{}
+		configMaps = append(configMaps, &schedulerApi.ConfigMapDTO{
+			Name:         configMap.Name,
+			MountPath:    configMap.MountPath,
+			ReloadSignal: configMap.ReloadSignal,
+			Data:         configMap.Data,
+		})
+	}
+
+	return configMaps, nil
+}
+
+// isValidConfigMapFilename only accepts files directly in the config map directory
+func isValidConfigMapFilename(filename string) bool {
+	return filename != "" && filename != "." && filename != ".." && !strings.Contains(filename, "/")
+}
+
+// updateConfigMapHandler replaces the files of a config map, in the deployment kept in this node, in the local
+// instances and, through the same request, down the hierarchy. Instances see the files change in place and
+// get the reload signal if the config map has one, so the deployment is not redeployed.
+func (s *Server) updateConfigMapHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+	configMapName := utils.ExtractPathVar(r, configMapNamePathVar)
+
+	var reqBody api.UpdateConfigMapRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	configMap, status := s.updateConfigMap(deploymentId, configMapName, reqBody)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	log.Debugf("updated config map %s of deployment %s", configMapName, deploymentId)
+
+	status = s.schedulerClient.UpdateConfigMap(deploymentId, configMap)
+	if status != http.StatusOK {
+		log.Errorf("got status %d updating config map %s of %s in scheduler", status, configMapName, deploymentId)
+		w.WriteHeader(status)
+		return
+	}
+
+	for childId, child := range s.hTable.getChildren(deploymentId) {
+		go func(childId string, child *utils.Node) {
+			depClient := s.getDeployerClient(child.Addr)
+			childStatus := depClient.UpdateConfigMap(deploymentId, configMapName, reqBody)
+			if childStatus != http.StatusOK {
+				log.Errorf("got status %d propagating config map %s of %s to %s", childStatus, configMapName,
+					deploymentId, childId)
+			}
+		}(childId, child)
+	}
+}
+
+// updateConfigMap changes the config map data in the deployment YAML of the hierarchy table, so children the
+// deployment is extended to and instances started later get the new files
+func (s *Server) updateConfigMap(deploymentId, configMapName string, data map[string]string) (*schedulerApi.ConfigMapDTO,
+	int) {
+	for filename := range data {
+		if !isValidConfigMapFilename(filename) {
+			return nil, http.StatusBadRequest
+		}
+	}
+
+	s.configMapsLock.Lock()
+	defer s.configMapsLock.Unlock()
+
+	dto, ok := s.hTable.deploymentToDTO(deploymentId)
+	if !ok {
+		return nil, http.StatusNotFound
+	}
+
+	deploymentYAMLBytes, ok, err := setConfigMapData(dto.DeploymentYAMLBytes, configMapName, data)
+	if err != nil {
+		log.Errorf("error updating config map %s of %s: %s", configMapName, deploymentId, err)
+		return nil, http.StatusInternalServerError
+	} else if !ok {
+		return nil, http.StatusNotFound
+	}
+
+	var deploymentYAML api.DeploymentYAML
+	err = yaml.Unmarshal(deploymentYAMLBytes, &deploymentYAML)
+	if err != nil {
+		panic(err)
+	}
+
+	configMaps, err := configMapsYAMLToDTOs(&deploymentYAML)
+	if err != nil {
+		log.Errorf("invalid config maps in %s: %s", deploymentId, err)
+		return nil, http.StatusBadRequest
+	}
+
+	s.hTable.setDeploymentYAMLBytes(deploymentId, deploymentYAMLBytes)
+
+	for _, configMap := range configMaps {
+		if configMap.Name == configMapName {
+			return configMap, http.StatusOK
+		}
+	}
+
+	return nil, http.StatusNotFound
+}
+
+// setConfigMapData replaces the data of the config map in the YAML, keeping everything else as it was
+func setConfigMapData(deploymentYAMLBytes []byte, configMapName string, data map[string]string) ([]byte, bool,
+	error) {
+	var root yaml.Node
+	err := yaml.Unmarshal(deploymentYAMLBytes, &root)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil, false, errors.New("deployment YAML is empty")
+	}
+
+	node := root.Content[0]
+	for _, key := range []string{"spec", "template", "spec", "configMaps"} {
+		node = getYAMLMappingValue(node, key)
+		if node == nil {
+			return nil, false, nil
+		}
+	}
+
+	if node.Kind != yaml.SequenceNode {
+		return nil, false, nil
+	}
+
+	for _, configMapNode := range node.Content {
+		nameNode := getYAMLMappingValue(configMapNode, "name")
+		if nameNode == nil || nameNode.Value != configMapName {
+			continue
+		}
+
+		dataNode := dataToYAMLNode(data)
+		if existing := getYAMLMappingValue(configMapNode, "data"); existing != nil {
+			*existing = *dataNode
+		} else {
+			configMapNode.Content = append(configMapNode.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "data"}, dataNode)
+		}
+
+		var updated []byte
+		updated, err = yaml.Marshal(&root)
+
+		return updated, true, err
+	}
+
+	return nil, false, nil
+}
+
+func getYAMLMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func dataToYAMLNode(data map[string]string) *yaml.Node {
+	filenames := make([]string, 0, len(data))
+	for filename := range data {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	dataNode := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, filename := range filenames {
+		valueNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: data[filename]}
+		if strings.Contains(data[filename], "\n") {
+			valueNode.Style = yaml.LiteralStyle
+		}
+
+		dataNode.Content = append(dataNode.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: filename}, valueNode)
+	}
+
+	return dataNode
+}
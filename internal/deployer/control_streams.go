@@ -0,0 +1,121 @@
+package deployer
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	controlFrameTimeout      = 5 * time.Second
+	controlStreamOpenTimeout = 5 * time.Second
+)
+
+func (s *Server) getDeployerClient(nodeAddr string) *deployer.Client {
+	return s.deployerClients.Get(s.addPortToAddr(nodeAddr))
+}
+
+// sendControlFrame sends the frame over the control stream to the neighbour, opening one if needed. It returns
+// whether the frame was sent, so callers can fall back to a plain request to a neighbour that does not take it.
+func (s *Server) sendControlFrame(neighbourId string, frame *api.ControlFrameDTO) bool {
+	stream := s.getControlStream(neighbourId)
+	if stream == nil {
+		return false
+	}
+
+	err := stream.Send(frame, controlFrameTimeout)
+	if err != nil {
+		log.Debugf("control stream to %s broke: %s", neighbourId, err)
+		s.controlStreams.Delete(neighbourId)
+		stream.Close()
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) getControlStream(neighbourId string) *deployer.ControlStream {
+	value, ok := s.controlStreams.Load(neighbourId)
+	if ok {
+		return value.(*deployer.ControlStream)
+	}
+
+	lock, _ := s.controlStreamLocks.LoadOrStore(neighbourId, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	value, ok = s.controlStreams.Load(neighbourId)
+	if ok {
+		return value.(*deployer.ControlStream)
+	}
+
+	stream, status := s.getDeployerClient(neighbourId).OpenControlStream(s.myself.Id, controlStreamOpenTimeout)
+	if status != http.StatusOK {
+		log.Debugf("got status %d opening control stream to %s", status, neighbourId)
+		return nil
+	}
+
+	log.Debugf("opened control stream to %s", neighbourId)
+	s.controlStreams.Store(neighbourId, stream)
+
+	return stream
+}
+
+// closeControlStream closes the control stream to a neighbour that is gone
+func (s *Server) closeControlStream(neighbourId string) {
+	value, ok := s.controlStreams.Load(neighbourId)
+	if !ok {
+		return
+	}
+
+	s.controlStreams.Delete(neighbourId)
+	value.(*deployer.ControlStream).Close()
+}
+
+// controlStreamHandler handles the frames a neighbour sends over its control stream until it closes it
+func (s *Server) controlStreamHandler(w http.ResponseWriter, r *http.Request) {
+	senderId := utils.ExtractPathVar(r, nodeIdPathVar)
+
+	if !s.security.TLS.IsRequestFrom(r, senderId) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	log.Debugf("%s opened a control stream", senderId)
+
+	decoder := json.NewDecoder(r.Body)
+	for {
+		var frame api.ControlFrameDTO
+		err := decoder.Decode(&frame)
+		if err != nil {
+			log.Debugf("control stream from %s closed: %s", senderId, err)
+			return
+		}
+
+		switch frame.Type {
+		case api.FrameHeartbeat:
+			if frame.Heartbeat != nil {
+				s.handleHeartbeat(senderId, frame.Heartbeat)
+			}
+		case api.FrameAlternatives:
+			s.setAlternatives(senderId, frame.Alternatives)
+		default:
+			log.Warnf("unknown control frame %q from %s", frame.Type, senderId)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	eventSubscriberBufferSize = 64
+	eventsKeepAliveTimeout    = 15 * time.Second
+)
+
+// eventBus delivers the events published in this node to its subscribers. Subscribers that do not keep up
+// lose events instead of blocking the hierarchy code paths publishing them.
+type eventBus struct {
+	subscribers map[chan *api.EventDTO]struct{}
+	lock        sync.RWMutex
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subscribers: map[chan *api.EventDTO]struct{}{},
+	}
+}
+
+func (b *eventBus) subscribe() chan *api.EventDTO {
+	subscriber := make(chan *api.EventDTO, eventSubscriberBufferSize)
+
+	b.lock.Lock()
+	b.subscribers[subscriber] = struct{}{}
+	b.lock.Unlock()
+
+	return subscriber
+}
+
+func (b *eventBus) unsubscribe(subscriber chan *api.EventDTO) {
+	b.lock.Lock()
+	delete(b.subscribers, subscriber)
+	b.lock.Unlock()
+}
+
+func (b *eventBus) publish(event *api.EventDTO) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			log.Warnf("dropped event %s of %s for slow subscriber", event.Type, event.DeploymentId)
+		}
+	}
+}
+
+// emitEvent publishes an event of the deployment seen by this node
+func (s *Server) emitEvent(eventType, deploymentId string, node *utils.Node, details map[string]string) {
+	event := &api.EventDTO{
+		Type:         eventType,
+		DeploymentId: deploymentId,
+		Origin:       s.myself.Id,
+		Node:         node,
+		Timestamp:    time.Now(),
+		Details:      details,
+	}
+
+	log.Debugf("event %s of %s (node %s)", eventType, deploymentId, nodeToId(node))
+	s.events.publish(event)
+}
+
+func nodeToId(node *utils.Node) string {
+	if node == nil {
+		return ""
+	}
+
+	return node.Id
+}
+
+// forwardEventsUp sends every event published in this node to the parent of its deployment
+func (s *Server) forwardEventsUp() {
+	subscriber := s.events.subscribe()
+	defer s.events.unsubscribe(subscriber)
+
+	for {
+		var event *api.EventDTO
+		select {
+		case <-s.Stopped():
+			return
+		case event = <-subscriber:
+		}
+
+		parent := s.hTable.getParent(event.DeploymentId)
+		if parent == nil {
+			continue
+		}
+
+		depClient := s.getDeployerClient(parent.Addr)
+		status := depClient.ForwardEvent(event)
+		if status != http.StatusOK {
+			log.Debugf("got status %d forwarding event %s of %s to %s", status, event.Type, event.DeploymentId,
+				parent.Id)
+		}
+	}
+}
+
+// forwardEventHandler publishes an event a child forwarded, keeping the node it originated in
+func (s *Server) forwardEventHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+
+	if !s.hTable.hasDeployment(deploymentId) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if s.security.TLS.IsEnabled() {
+		childId, _ := utils.GetRequestIdentity(r)
+		if _, ok := s.hTable.getChildren(deploymentId)[childId]; !ok {
+			log.Warnf("refused event of %s from %s, that is not a child", deploymentId, childId)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	var reqBody api.ForwardEventRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.DeploymentId != deploymentId {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.events.publish(&reqBody)
+}
+
+// streamEventsHandler streams the events published in this node as server-sent events until the client goes
+// away, optionally only the ones of a deployment
+func (s *Server) streamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := r.URL.Query().Get(api.EventsDeploymentQueryParam)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	subscriber := s.events.subscribe()
+	defer s.events.unsubscribe(subscriber)
+
+	log.Debugf("streaming events of %q to %s", deploymentId, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAliveTicker := time.NewTicker(eventsKeepAliveTimeout)
+	defer keepAliveTicker.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAliveTicker.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-subscriber:
+			if deploymentId != "" && event.DeploymentId != deploymentId {
+				continue
+			}
+
+			var data []byte
+			data, err = json.Marshal(event)
+			if err != nil {
+				panic(err)
+			}
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+
+		if err != nil {
+			log.Debugf("stopped streaming events to %s: %s", r.RemoteAddr, err)
+			return
+		}
+
+		flusher.Flush()
+	}
+}
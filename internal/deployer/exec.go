@@ -0,0 +1,101 @@
+package deployer
+
+import (
+	"io"
+	"net/http"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	schedulerApi "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+type execTarget func(stdin io.Reader) (*http.Response, int)
+
+// execHandler runs a command in an instance of the deployment, forwarding the request to the local scheduler
+// if the instance runs in this node or down the hierarchy otherwise. As with the scheduler, the request body
+// is the command stdin and the response body its output, so it needs HTTP/2.
+func (s *Server) execHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+	instanceId := r.URL.Query().Get(api.InstanceQueryParam)
+	cmd := r.URL.Query()[schedulerApi.ExecCmdQueryParam]
+
+	if instanceId == "" || len(cmd) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !s.hTable.hasDeployment(deploymentId) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	log.Debugf("handling exec of %v in instance %s of %s", cmd, instanceId, deploymentId)
+
+	resp, stdin, status := startExec(s.getExecTargets(deploymentId, instanceId, cmd))
+	switch {
+	case status == http.StatusOK:
+	case status > 0:
+		w.WriteHeader(status)
+		return
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	go func() {
+		_, copyErr := io.Copy(stdin, r.Body)
+		_ = stdin.CloseWithError(copyErr)
+	}()
+
+	w.Header().Set("Trailer", schedulerApi.ExecExitCodeTrailer)
+
+	err := utils.SendStreamReplyOK(w, r, "application/octet-stream", resp.Body)
+	if err != nil {
+		log.Debugf("error streaming exec output of instance %s: %s", instanceId, err)
+	}
+
+	w.Header().Set(schedulerApi.ExecExitCodeTrailer, resp.Trailer.Get(schedulerApi.ExecExitCodeTrailer))
+}
+
+func (s *Server) getExecTargets(deploymentId, instanceId string, cmd []string) []execTarget {
+	if s.getLocalInstances()[instanceId] == deploymentId {
+		return []execTarget{
+			func(stdin io.Reader) (*http.Response, int) {
+				return s.schedulerClient.Exec(instanceId, cmd, stdin)
+			},
+		}
+	}
+
+	var targets []execTarget
+	for _, child := range s.hTable.getChildren(deploymentId) {
+		depClient := s.getDeployerClient(child.Addr)
+		targets = append(targets, func(stdin io.Reader) (*http.Response, int) {
+			return depClient.Exec(deploymentId, instanceId, cmd, stdin)
+		})
+	}
+
+	return targets
+}
+
+// startExec tries the targets in order until one does not reply with not found. Each attempt gets its own
+// stdin pipe, so nothing is written to stdin before the command is running.
+func startExec(targets []execTarget) (resp *http.Response, stdin *io.PipeWriter, status int) {
+	for _, target := range targets {
+		var stdinReader *io.PipeReader
+		stdinReader, stdin = io.Pipe()
+
+		resp, status = target(stdinReader)
+		if status == http.StatusOK {
+			return
+		}
+
+		_ = stdin.Close()
+
+		if status != http.StatusNotFound {
+			return nil, nil, status
+		}
+	}
+
+	return nil, nil, http.StatusNotFound
+}
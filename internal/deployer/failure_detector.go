@@ -0,0 +1,325 @@
+package deployer
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	phiWindowSize = 100
+)
+
+type (
+	// failureDetector tells, from the heartbeats of the nodes it watches, whether they are alive, suspected or
+	// dead. Nodes stay dead until heard from again.
+	failureDetector interface {
+		// watch makes the detector monitor exactly these nodes, new ones starting as just heard from
+		watch(nodes map[string]*utils.Node)
+		heartbeat(nodeId string)
+		// check updates and returns the status of every watched node
+		check() map[string]string
+		// status returns the last status of the node, empty if it is not watched
+		status(nodeId string) string
+	}
+
+	monitoredNode struct {
+		node          *utils.Node
+		lastHeartbeat time.Time
+		intervals     []time.Duration
+		status        string
+		suspectedAt   time.Time
+	}
+
+	detectorBase struct {
+		nodes map[string]*monitoredNode
+		lock  sync.Mutex
+	}
+)
+
+func newFailureDetector(detectorConfig *config.FailureDetectorConfig, server *Server) failureDetector {
+	switch detectorConfig.Detector {
+	case config.PhiAccrualDetectorName:
+		return &phiAccrualDetector{
+			detectorBase:     detectorBase{nodes: map[string]*monitoredNode{}},
+			expectedInterval: detectorConfig.HeartbeatInterval,
+			suspectThreshold: detectorConfig.PhiSuspectThreshold,
+			deadThreshold:    detectorConfig.PhiDeadThreshold,
+		}
+	case config.SwimDetectorName:
+		return &swimDetector{
+			detectorBase:     detectorBase{nodes: map[string]*monitoredNode{}},
+			probeTimeout:     detectorConfig.SwimProbeTimeout,
+			pingTimeout:      detectorConfig.SwimPingTimeout,
+			suspicionTimeout: detectorConfig.SwimSuspicionTimeout,
+			indirectProbes:   detectorConfig.SwimIndirectProbes,
+			server:           server,
+		}
+	default:
+		panic(errors.Errorf("unknown failure detector %q", detectorConfig.Detector))
+	}
+}
+
+func (d *detectorBase) watch(nodes map[string]*utils.Node) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for nodeId := range d.nodes {
+		if _, ok := nodes[nodeId]; !ok {
+			delete(d.nodes, nodeId)
+		}
+	}
+
+	for nodeId, node := range nodes {
+		if _, ok := d.nodes[nodeId]; !ok {
+			d.nodes[nodeId] = &monitoredNode{
+				node:          node,
+				lastHeartbeat: time.Now(),
+				status:        api.NodeAlive,
+			}
+		}
+	}
+}
+
+func (d *detectorBase) heartbeat(nodeId string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	n, ok := d.nodes[nodeId]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	n.intervals = append(n.intervals, now.Sub(n.lastHeartbeat))
+	if len(n.intervals) > phiWindowSize {
+		n.intervals = n.intervals[1:]
+	}
+
+	if n.status != api.NodeAlive {
+		log.Infof("%s is alive again", nodeId)
+	}
+
+	n.lastHeartbeat = now
+	n.status = api.NodeAlive
+}
+
+func (d *detectorBase) status(nodeId string) string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	n, ok := d.nodes[nodeId]
+	if !ok {
+		return ""
+	}
+
+	return n.status
+}
+
+// Must be called with the lock held
+func (d *detectorBase) statuses() map[string]string {
+	statuses := make(map[string]string, len(d.nodes))
+	for nodeId, n := range d.nodes {
+		statuses[nodeId] = n.status
+	}
+
+	return statuses
+}
+
+// phiAccrualDetector suspects nodes based on how unlikely it is, given the intervals between their last
+// heartbeats, to not have heard from them for so long. Phi is -log10 of that probability, assuming the
+// intervals are normally distributed.
+type phiAccrualDetector struct {
+	detectorBase
+
+	expectedInterval time.Duration
+	suspectThreshold float64
+	deadThreshold    float64
+}
+
+func (d *phiAccrualDetector) check() map[string]string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+	for nodeId, n := range d.nodes {
+		if n.status == api.NodeDead {
+			continue
+		}
+
+		phi := d.phi(n, now)
+
+		status := api.NodeAlive
+		if phi >= d.deadThreshold {
+			status = api.NodeDead
+		} else if phi >= d.suspectThreshold {
+			status = api.NodeSuspected
+		}
+
+		if status != n.status {
+			log.Infof("%s is now %s (phi %.2f)", nodeId, status, phi)
+		}
+
+		n.status = status
+	}
+
+	return d.statuses()
+}
+
+// phi uses the expected interval until there are enough samples. The deviation is kept from getting too small,
+// or the slightest delay of a very regular node would make it suspected.
+func (d *phiAccrualDetector) phi(n *monitoredNode, now time.Time) float64 {
+	mean := d.expectedInterval.Seconds()
+	minStdDev := mean / 4
+	stdDev := minStdDev
+
+	if len(n.intervals) > 1 {
+		var sum float64
+		for _, interval := range n.intervals {
+			sum += interval.Seconds()
+		}
+		mean = sum / float64(len(n.intervals))
+
+		var squaredSum float64
+		for _, interval := range n.intervals {
+			squaredSum += math.Pow(interval.Seconds()-mean, 2)
+		}
+		stdDev = math.Max(math.Sqrt(squaredSum/float64(len(n.intervals))), minStdDev)
+	}
+
+	y := (now.Sub(n.lastHeartbeat).Seconds() - mean) / stdDev
+	notYet := 0.5 * math.Erfc(y/math.Sqrt2)
+
+	return -math.Log10(math.Max(notYet, math.SmallestNonzeroFloat64))
+}
+
+// swimDetector probes nodes not heard from in a while, directly and then through other neighbours, and
+// suspects them if no probe succeeds. Suspected nodes are dead if not heard from during the suspicion timeout.
+type swimDetector struct {
+	detectorBase
+
+	probeTimeout     time.Duration
+	pingTimeout      time.Duration
+	suspicionTimeout time.Duration
+	indirectProbes   int
+	server           *Server
+}
+
+func (d *swimDetector) check() map[string]string {
+	d.lock.Lock()
+	now := time.Now()
+
+	var toProbe []*utils.Node
+	for nodeId, n := range d.nodes {
+		switch n.status {
+		case api.NodeAlive:
+			if now.Sub(n.lastHeartbeat) > d.probeTimeout {
+				toProbe = append(toProbe, n.node)
+			}
+		case api.NodeSuspected:
+			if now.Sub(n.suspectedAt) > d.suspicionTimeout {
+				log.Infof("%s is now %s", nodeId, api.NodeDead)
+				n.status = api.NodeDead
+			}
+		}
+	}
+	d.lock.Unlock()
+
+	if len(toProbe) == 0 {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+
+		return d.statuses()
+	}
+
+	helpers := d.server.getNeighbours()
+
+	results := make([]bool, len(toProbe))
+	var wg sync.WaitGroup
+	for i, node := range toProbe {
+		wg.Add(1)
+		go func(i int, node *utils.Node) {
+			defer wg.Done()
+			results[i] = d.probe(node, helpers)
+		}(i, node)
+	}
+	wg.Wait()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for i, node := range toProbe {
+		n, ok := d.nodes[node.Id]
+		if !ok || n.status != api.NodeAlive {
+			continue
+		}
+
+		if results[i] {
+			n.lastHeartbeat = now
+		} else {
+			log.Infof("%s is now %s, no probe succeeded", node.Id, api.NodeSuspected)
+			n.status = api.NodeSuspected
+			n.suspectedAt = now
+		}
+	}
+
+	return d.statuses()
+}
+
+// probe pings the node and, if it does not reply, asks some of the other neighbours to ping it
+func (d *swimDetector) probe(node *utils.Node, helpers map[string]*utils.Node) bool {
+	depClient := d.server.getDeployerClient(node.Addr)
+	if depClient.Ping(d.pingTimeout) == http.StatusOK {
+		return true
+	}
+
+	helperIds := make([]string, 0, len(helpers))
+	for helperId := range helpers {
+		if helperId != node.Id && helperId != d.server.myself.Id {
+			helperIds = append(helperIds, helperId)
+		}
+	}
+
+	rand.Shuffle(len(helperIds), func(i, j int) {
+		helperIds[i], helperIds[j] = helperIds[j], helperIds[i]
+	})
+
+	if len(helperIds) > d.indirectProbes {
+		helperIds = helperIds[:d.indirectProbes]
+	}
+
+	acks := make(chan bool, len(helperIds))
+	for _, helperId := range helperIds {
+		go func(helper *utils.Node) {
+			helperClient := d.server.getDeployerClient(helper.Addr)
+			acks <- helperClient.ProbeNode(node.Id, 2*d.pingTimeout) == http.StatusOK
+		}(helpers[helperId])
+	}
+
+	for range helperIds {
+		if <-acks {
+			log.Debugf("%s replied to an indirect probe", node.Id)
+			return true
+		}
+	}
+
+	return false
+}
+
+// probeHandler pings the node on behalf of a neighbour probing it
+func (s *Server) probeHandler(w http.ResponseWriter, r *http.Request) {
+	nodeId := utils.ExtractPathVar(r, nodeIdPathVar)
+
+	depClient := s.getDeployerClient(nodeId)
+	if depClient.Ping(s.fdConfig.SwimPingTimeout) != http.StatusOK {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,229 @@
+package deployer
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+)
+
+const (
+	testHeartbeatInterval = 100 * time.Millisecond
+)
+
+func newTestPhiDetector() *phiAccrualDetector {
+	return newFailureDetector(&config.FailureDetectorConfig{
+		Detector:            config.PhiAccrualDetectorName,
+		HeartbeatInterval:   testHeartbeatInterval,
+		PhiSuspectThreshold: 1,
+		PhiDeadThreshold:    8,
+	}, nil).(*phiAccrualDetector)
+}
+
+// setLastHeartbeat makes the detector have last heard from the node ago
+func setLastHeartbeat(d *detectorBase, nodeId string, ago time.Duration) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.nodes[nodeId].lastHeartbeat = time.Now().Add(-ago)
+}
+
+func TestDetectorWatch(t *testing.T) {
+	d := newTestPhiDetector()
+
+	d.watch(map[string]*utils.Node{
+		"n1": utils.NewNode("n1", "n1"),
+		"n2": utils.NewNode("n2", "n2"),
+	})
+
+	d.lock.Lock()
+	d.nodes["n2"].status = api.NodeSuspected
+	d.lock.Unlock()
+
+	d.watch(map[string]*utils.Node{
+		"n2": utils.NewNode("n2", "n2"),
+		"n3": utils.NewNode("n3", "n3"),
+	})
+
+	if status := d.status("n1"); status != "" {
+		t.Fatalf("expected n1 not to be watched, got %s", status)
+	}
+	if status := d.status("n2"); status != api.NodeSuspected {
+		t.Fatalf("expected n2 to keep its status, got %s", status)
+	}
+	if status := d.status("n3"); status != api.NodeAlive {
+		t.Fatalf("expected n3 to start alive, got %s", status)
+	}
+}
+
+func TestDetectorKeepsLastIntervals(t *testing.T) {
+	d := newTestPhiDetector()
+	d.watch(map[string]*utils.Node{"n1": utils.NewNode("n1", "n1")})
+
+	d.heartbeat("other")
+
+	for i := 0; i < 2*phiWindowSize; i++ {
+		d.heartbeat("n1")
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(d.nodes) != 1 {
+		t.Fatalf("expected heartbeats of nodes not watched to be ignored, got %d nodes", len(d.nodes))
+	}
+	if intervals := len(d.nodes["n1"].intervals); intervals != phiWindowSize {
+		t.Fatalf("expected the last %d intervals, got %d", phiWindowSize, intervals)
+	}
+}
+
+func TestPhi(t *testing.T) {
+	d := newTestPhiDetector()
+	now := time.Now()
+
+	n := &monitoredNode{lastHeartbeat: now}
+
+	// with no samples, a node heard from one expected interval ago is as likely as not to be late
+	if phi := d.phi(n, now.Add(testHeartbeatInterval)); phi < 0.29 || phi > 0.31 {
+		t.Fatalf("expected phi of -log10(0.5), got %.2f", phi)
+	}
+
+	var previous float64
+	for silence := testHeartbeatInterval; silence <= 6*testHeartbeatInterval; silence += testHeartbeatInterval {
+		phi := d.phi(n, now.Add(silence))
+		if phi <= previous {
+			t.Fatalf("expected phi to grow with the silence, got %.2f after %.2f", phi, previous)
+		}
+
+		previous = phi
+	}
+
+	// a node that takes longer between heartbeats is suspected later
+	for i := 0; i < 10; i++ {
+		n.intervals = append(n.intervals, 4*testHeartbeatInterval)
+	}
+
+	slow := d.phi(n, now.Add(4*testHeartbeatInterval))
+	regular := d.phi(&monitoredNode{lastHeartbeat: now}, now.Add(4*testHeartbeatInterval))
+	if slow >= regular {
+		t.Fatalf("expected phi of the slow node (%.2f) to be lower than the one of the regular node (%.2f)",
+			slow, regular)
+	}
+}
+
+func TestPhiAccrualCheck(t *testing.T) {
+	d := newTestPhiDetector()
+	d.watch(map[string]*utils.Node{"n1": utils.NewNode("n1", "n1")})
+
+	if statuses := d.check(); statuses["n1"] != api.NodeAlive {
+		t.Fatalf("expected n1 just heard from to be alive, got %s", statuses["n1"])
+	}
+
+	setLastHeartbeat(&d.detectorBase, "n1", 2*testHeartbeatInterval)
+	if statuses := d.check(); statuses["n1"] != api.NodeSuspected {
+		t.Fatalf("expected n1 to be suspected, got %s", statuses["n1"])
+	}
+
+	setLastHeartbeat(&d.detectorBase, "n1", 5*testHeartbeatInterval)
+	if statuses := d.check(); statuses["n1"] != api.NodeDead {
+		t.Fatalf("expected n1 to be dead, got %s", statuses["n1"])
+	}
+
+	setLastHeartbeat(&d.detectorBase, "n1", 0)
+	if statuses := d.check(); statuses["n1"] != api.NodeDead {
+		t.Fatalf("expected n1 to stay dead until heard from, got %s", statuses["n1"])
+	}
+
+	d.heartbeat("n1")
+	if status := d.status("n1"); status != api.NodeAlive {
+		t.Fatalf("expected n1 to be alive once heard from, got %s", status)
+	}
+}
+
+// newTestSwimDetector returns the swim detector of n0, which watches n1, among the deployers n0, n1 and n2
+func newTestSwimDetector(t *testing.T) (*swimDetector, map[string]*Server, *testNetwork) {
+	t.Helper()
+
+	servers, network := newTestDeployers(t, func(_ string, conf *config.Config) {
+		conf.Deployer.FailureDetector.SwimPingTimeout = testHeartbeatInterval
+	}, "n0", "n1", "n2")
+
+	d := newFailureDetector(&config.FailureDetectorConfig{
+		Detector:             config.SwimDetectorName,
+		SwimProbeTimeout:     2 * testHeartbeatInterval,
+		SwimPingTimeout:      testHeartbeatInterval,
+		SwimSuspicionTimeout: 3 * testHeartbeatInterval,
+		SwimIndirectProbes:   1,
+	}, servers["n0"]).(*swimDetector)
+
+	d.watch(map[string]*utils.Node{"n1": utils.NewNode("n1", "n1")})
+
+	return d, servers, network
+}
+
+func TestSwimProbesSilentNodes(t *testing.T) {
+	d, _, _ := newTestSwimDetector(t)
+
+	setLastHeartbeat(&d.detectorBase, "n1", time.Minute)
+
+	if statuses := d.check(); statuses["n1"] != api.NodeAlive {
+		t.Fatalf("expected n1 to reply to the probe, got %s", statuses["n1"])
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if time.Since(d.nodes["n1"].lastHeartbeat) > time.Minute {
+		t.Fatal("expected the probe to count as hearing from n1")
+	}
+}
+
+func TestSwimProbesThroughNeighbours(t *testing.T) {
+	d, servers, network := newTestSwimDetector(t)
+
+	network.block("n0", "n1")
+	servers["n0"].children.Store("n2", utils.NewNode("n2", "n2"))
+
+	setLastHeartbeat(&d.detectorBase, "n1", time.Minute)
+
+	if statuses := d.check(); statuses["n1"] != api.NodeAlive {
+		t.Fatalf("expected n1 to reply to the probe through n2, got %s", statuses["n1"])
+	}
+}
+
+func TestSwimSuspectsThenKills(t *testing.T) {
+	d, servers, network := newTestSwimDetector(t)
+
+	network.block("n0", "n1")
+	network.block("n2", "n1")
+	servers["n0"].children.Store("n2", utils.NewNode("n2", "n2"))
+
+	if statuses := d.check(); statuses["n1"] != api.NodeAlive {
+		t.Fatalf("expected n1 just heard from not to be probed, got %s", statuses["n1"])
+	}
+
+	setLastHeartbeat(&d.detectorBase, "n1", time.Minute)
+
+	if statuses := d.check(); statuses["n1"] != api.NodeSuspected {
+		t.Fatalf("expected n1 to be suspected when no probe succeeds, got %s", statuses["n1"])
+	}
+
+	if statuses := d.check(); statuses["n1"] != api.NodeSuspected {
+		t.Fatalf("expected n1 to be suspected during the suspicion timeout, got %s", statuses["n1"])
+	}
+
+	d.lock.Lock()
+	d.nodes["n1"].suspectedAt = time.Now().Add(-time.Minute)
+	d.lock.Unlock()
+
+	if statuses := d.check(); statuses["n1"] != api.NodeDead {
+		t.Fatalf("expected n1 to be dead after the suspicion timeout, got %s", statuses["n1"])
+	}
+
+	d.heartbeat("n1")
+	if status := d.status("n1"); status != api.NodeAlive {
+		t.Fatalf("expected n1 to be alive once heard from, got %s", status)
+	}
+}
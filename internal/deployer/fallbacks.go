@@ -0,0 +1,282 @@
+package deployer
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	fallbackHealthCheckInterval = 10 * time.Second
+)
+
+type (
+	fallbackEntry struct {
+		Priority    int
+		Alive       bool
+		LastChecked time.Time
+	}
+
+	// fallbackRegistry has the candidate fallbacks, the nodes orphans go to when there is no one else to take
+	// them. They are health checked periodically and the live one with the highest priority is picked.
+	fallbackRegistry struct {
+		entries map[string]*fallbackEntry
+		lock    sync.RWMutex
+		server  *Server
+	}
+)
+
+// loadFallbacks reads the candidate fallbacks from the file, one per line with an optional priority after the
+// node id, e.g. "cloud1 10". Without the file there are no fallbacks until some are added through the API.
+// Changes made through the API are not written back to the file.
+func (s *Server) loadFallbacks(filename string) *fallbackRegistry {
+	f := &fallbackRegistry{
+		entries: map[string]*fallbackEntry{},
+		server:  s,
+	}
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		log.Warnf("%s does not exist, starting without fallbacks", filename)
+		return f
+	} else if err != nil {
+		panic(errors.Wrap(err, "error opening fallbacks file"))
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		priority := 0
+		if len(fields) > 1 {
+			priority, err = strconv.Atoi(fields[1])
+			if err != nil {
+				panic(errors.Wrapf(err, "invalid priority of fallback %s", fields[0]))
+			}
+		}
+
+		f.entries[fields[0]] = &fallbackEntry{
+			Priority: priority,
+			Alive:    true,
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		panic(errors.Wrap(err, "error reading fallbacks file"))
+	}
+
+	log.Debugf("loaded fallbacks %+v", f.toDTOs())
+
+	return f
+}
+
+func (f *fallbackRegistry) set(nodeId string, priority int) {
+	f.lock.Lock()
+	entry, ok := f.entries[nodeId]
+	if ok {
+		entry.Priority = priority
+	} else {
+		f.entries[nodeId] = &fallbackEntry{
+			Priority: priority,
+			Alive:    true,
+		}
+	}
+	f.lock.Unlock()
+
+	if !ok {
+		go f.check(nodeId)
+	}
+}
+
+func (f *fallbackRegistry) delete(nodeId string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	_, ok := f.entries[nodeId]
+	delete(f.entries, nodeId)
+
+	return ok
+}
+
+// toDTOs returns the fallbacks in the order they are picked in
+func (f *fallbackRegistry) toDTOs() []*api.FallbackDTO {
+	f.lock.RLock()
+	dtos := make([]*api.FallbackDTO, 0, len(f.entries))
+	for nodeId, entry := range f.entries {
+		dtos = append(dtos, &api.FallbackDTO{
+			Id:          nodeId,
+			Priority:    entry.Priority,
+			Alive:       entry.Alive,
+			LastChecked: entry.LastChecked,
+		})
+	}
+	f.lock.RUnlock()
+
+	sort.Slice(dtos, func(i, j int) bool {
+		if dtos[i].Priority != dtos[j].Priority {
+			return dtos[i].Priority > dtos[j].Priority
+		}
+
+		return dtos[i].Id < dtos[j].Id
+	})
+
+	return dtos
+}
+
+// pick returns the live fallback with the highest priority other than the excluded node. If none is alive, the
+// one with the highest priority is returned anyway, since a fallback may be up without answering health checks.
+// It returns an empty id when there are no fallbacks.
+func (f *fallbackRegistry) pick(exclude string) string {
+	var best string
+	for _, dto := range f.toDTOs() {
+		if dto.Id == exclude {
+			continue
+		}
+
+		if dto.Alive {
+			return dto.Id
+		}
+
+		if best == "" {
+			best = dto.Id
+		}
+	}
+
+	if best != "" {
+		log.Warnf("no live fallback, picking %s", best)
+	}
+
+	return best
+}
+
+func (f *fallbackRegistry) checkPeriodically() {
+	ticker := time.NewTicker(fallbackHealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		f.lock.RLock()
+		nodeIds := make([]string, 0, len(f.entries))
+		for nodeId := range f.entries {
+			nodeIds = append(nodeIds, nodeId)
+		}
+		f.lock.RUnlock()
+
+		for _, nodeId := range nodeIds {
+			f.check(nodeId)
+		}
+
+		select {
+		case <-f.server.Stopped():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *fallbackRegistry) check(nodeId string) {
+	alive := nodeId == f.server.myself.Id
+	if !alive {
+		depClient := f.server.getDeployerClient(nodeId)
+		_, status := depClient.WhoAreYou()
+		alive = status == http.StatusOK
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	entry, ok := f.entries[nodeId]
+	if !ok {
+		return
+	}
+
+	if entry.Alive != alive {
+		log.Infof("fallback %s is now alive=%t", nodeId, alive)
+	}
+
+	entry.Alive = alive
+	entry.LastChecked = time.Now()
+}
+
+// fallBack asks the fallback of the orphan deployment to take it, returning whether it accepted
+func (s *Server) fallBack(deploymentId, deadParentId string) bool {
+	fallbackAddr := s.getFallbackAddr(deadParentId)
+	if fallbackAddr == "" {
+		log.Errorf("no fallback for orphan deployment %s", deploymentId)
+		return false
+	}
+
+	log.Debugf("falling back to %s", fallbackAddr)
+
+	deplClient := s.getDeployerClient(fallbackAddr)
+	status := deplClient.Fallback(deploymentId, s.myself.Id, s.location)
+	if status != http.StatusOK {
+		log.Debugf("tried to fallback to %s, got %d", fallbackAddr, status)
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) getFallbackHandler(w http.ResponseWriter, _ *http.Request) {
+	fallbackId := s.fallbacks.pick("")
+	if fallbackId == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var respBody api.GetFallbackResponseBody
+	respBody = fallbackId
+
+	utils.SendJSONReplyOK(w, respBody)
+}
+
+func (s *Server) getFallbacksHandler(w http.ResponseWriter, _ *http.Request) {
+	var resp api.GetFallbacksResponseBody
+	resp = s.fallbacks.toDTOs()
+
+	utils.SendJSONReplyOK(w, resp)
+}
+
+func (s *Server) setFallbackHandler(w http.ResponseWriter, r *http.Request) {
+	nodeId := utils.ExtractPathVar(r, nodeIdPathVar)
+
+	var reqBody api.SetFallbackRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	log.Infof("setting fallback %s with priority %d", nodeId, reqBody.Priority)
+	s.fallbacks.set(nodeId, reqBody.Priority)
+}
+
+func (s *Server) deleteFallbackHandler(w http.ResponseWriter, r *http.Request) {
+	nodeId := utils.ExtractPathVar(r, nodeIdPathVar)
+
+	if !s.fallbacks.delete(nodeId) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	log.Infof("deleted fallback %s", nodeId)
+}
@@ -4,22 +4,18 @@ import (
 	"encoding/json"
 	"net"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	archimedesApi "github.com/bruno-anjos/cloud-edge-deployment/api/archimedes"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/autonomic"
+	schedulerApi "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
 	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
 
 	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/archimedes"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/scheduler"
 	"github.com/docker/go-connections/nat"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"gopkg.in/yaml.v3"
@@ -39,169 +35,80 @@ type (
 	typeTerminalLocationValue = *publicUtils.Location
 )
 
-// Timeouts
 const (
-	sendAlternativesTimeout = 30
-	checkParentsTimeout     = 30
-	heartbeatTimeout        = 10
-	extendAttemptTimeout    = 5
-	waitForNewParentTimeout = 60
+	alternativesDir = "/alternatives/"
 )
 
-const (
-	alternativesDir  = "/alternatives/"
-	fallbackFilename = "fallback.txt"
-	maxHopsToLookFor = 5
-)
-
-var (
-	archimedesClient = archimedes.NewArchimedesClient(archimedes.DefaultHostPort)
-	schedulerClient  = scheduler.NewSchedulerClient(scheduler.DefaultHostPort)
-)
-
-var (
-	hostname string
-	location *publicUtils.Location
-	fallback string
-	myself   *utils.Node
-
-	myAlternatives       sync.Map
-	nodeAlternatives     map[string][]*utils.Node
-	nodeAlternativesLock sync.RWMutex
-
-	hTable *hierarchyTable
-	pTable *parentsTable
-
-	serviceLocations       sync.Map
-	addServiceLocationLock sync.Mutex
-
-	suspectedChild       sync.Map
-	suspectedDeployments sync.Map
-	children             sync.Map
-	childrenClient       = deployer.NewDeployerClient("")
-
-	exploring sync.Map
-
-	timer *time.Timer
-)
-
-func init() {
-	var err error
-	hostname, err = os.Hostname()
-	if err != nil {
-		panic(err)
-	}
-
-	myself = utils.NewNode(hostname, hostname)
-
-	myAlternatives = sync.Map{}
-	nodeAlternatives = map[string][]*utils.Node{}
-	nodeAlternativesLock = sync.RWMutex{}
-	hTable = newHierarchyTable()
-	pTable = newParentsTable()
-
-	suspectedChild = sync.Map{}
-	suspectedDeployments = sync.Map{}
-	children = sync.Map{}
-
-	serviceLocations = sync.Map{}
-	addServiceLocationLock = sync.Mutex{}
-
-	exploring = sync.Map{}
-
-	timer = time.NewTimer(sendAlternativesTimeout * time.Second)
-
-	// TODO change this for location from lower API
-	fallback = loadFallbackHostname(fallbackFilename)
-	log.Debugf("loaded fallback %s", fallback)
-
-	simulateAlternatives()
-
-	var status int
-	for status != http.StatusOK {
-		location, status = hTable.autonomicClient.GetLocation()
-	}
-
-	log.Debugf("got location %f", location)
-
-	go sendHeartbeatsPeriodically()
-	go sendAlternativesPeriodically()
-	go checkParentHeartbeatsPeriodically()
-}
-
-func migrateDeploymentHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) migrateDeploymentHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debugf("handling migrate request")
 
-	serviceId := utils.ExtractPathVar(r, deploymentIdPathVar)
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
 	var migrateDTO api.MigrateDTO
 	err := json.NewDecoder(r.Body).Decode(&migrateDTO)
 	if err != nil {
 		panic(err)
-		return
 	}
 
-	if !hTable.hasDeployment(serviceId) {
-		log.Debugf("deployment %s does not exist, ignoring migration request", serviceId)
+	if !s.hTable.hasDeployment(deploymentId) {
+		log.Debugf("deployment %s does not exist, ignoring migration request", deploymentId)
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	deploymentChildren := hTable.getChildren(serviceId)
+	deploymentChildren := s.hTable.getChildren(deploymentId)
 	origin, ok := deploymentChildren[migrateDTO.Origin]
 	if !ok {
-		log.Debugf("origin %s does not exist for service %s", migrateDTO.Origin, serviceId)
+		log.Debugf("origin %s does not exist for deployment %s", migrateDTO.Origin, deploymentId)
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	target, ok := deploymentChildren[migrateDTO.Target]
-	if !ok {
-		log.Debugf("target %s does not exist for service %s", migrateDTO.Target, serviceId)
+	if origin.Id == migrateDTO.Target {
+		log.Debugf("origin is the same as target (%s)", origin.Id)
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	if origin.Id == target.Id {
-		log.Debugf("origin is the same as target (%s)", origin.Id)
+	if _, ok = deploymentChildren[migrateDTO.Target]; ok {
+		log.Debugf("target %s already has deployment %s", migrateDTO.Target, deploymentId)
+		w.WriteHeader(http.StatusConflict)
 		return
 	}
 
-	client := deployer.NewDeployerClient(origin.Addr + ":" + strconv.Itoa(deployer.Port))
-	client.DeleteService(serviceId)
+	target := utils.NewNode(migrateDTO.Target, migrateDTO.Target)
 
-	client.SetHostPort(target.Addr)
-	config := hTable.getDeploymentConfig(serviceId)
-	isStatic := hTable.isStatic(serviceId)
-	parent := hTable.getParent(serviceId)
-	client.RegisterService(serviceId, isStatic, config, myself, parent)
+	go s.migrateDeployment(deploymentId, origin, target)
 }
 
-func extendDeploymentToHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) extendDeploymentToHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 	targetAddr := utils.ExtractPathVar(r, nodeIdPathVar)
 
 	log.Debugf("handling request to extend deployment %s to %s", deploymentId, targetAddr)
 
-	if !hTable.hasDeployment(deploymentId) {
+	if !s.hTable.hasDeployment(deploymentId) {
 		log.Debugf("deployment %s does not exist, ignoring extension request", deploymentId)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	go attemptToExtend(deploymentId, targetAddr, nil, nil, 0, nil)
+	go s.attemptToExtend(deploymentId, targetAddr, nil, nil, 0, nil)
 }
 
-func shortenDeploymentFromHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) shortenDeploymentFromHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 	targetId := utils.ExtractPathVar(r, nodeIdPathVar)
 
 	log.Debugf("handling shorten deployment %s from %s", deploymentId, targetId)
 
-	if !hTable.hasDeployment(deploymentId) {
+	if !s.hTable.hasDeployment(deploymentId) {
 		log.Debugf("deployment %s does not exist, ignoring shortening request", deploymentId)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	deploymentChildren := hTable.getChildren(deploymentId)
+	deploymentChildren := s.hTable.getChildren(deploymentId)
 	_, ok := deploymentChildren[targetId]
 	if !ok {
 		log.Debugf("deployment %s does not have %s as its child, ignoring shortening request", deploymentId,
@@ -210,24 +117,31 @@ func shortenDeploymentFromHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := deployer.NewDeployerClient(targetId)
-	client.DeleteService(deploymentId)
+	client := s.getDeployerClient(targetId)
+	status := client.DeleteService(deploymentId)
+	if status != http.StatusOK {
+		log.Errorf("got status %d while shortening deployment %s from %s", status, deploymentId, targetId)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	s.emitEvent(api.EventShortened, deploymentId, deploymentChildren[targetId], nil)
 }
 
-func childDeletedDeploymentHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) childDeletedDeploymentHandler(_ http.ResponseWriter, r *http.Request) {
 	log.Debugf("handling child deleted request")
 	serviceId := utils.ExtractPathVar(r, deploymentIdPathVar)
 	childId := utils.ExtractPathVar(r, nodeIdPathVar)
 
-	hTable.removeChild(serviceId, childId)
+	s.hTable.removeChild(serviceId, childId)
 }
 
-func getDeploymentsHandler(w http.ResponseWriter, _ *http.Request) {
-	deployments := hTable.getDeployments()
+func (s *Server) getDeploymentsHandler(w http.ResponseWriter, _ *http.Request) {
+	deployments := s.hTable.getDeployments()
 	utils.SendJSONReplyOK(w, deployments)
 }
 
-func registerDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) registerDeploymentHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("handling register deployment request")
 
 	var deploymentDTO api.DeploymentDTO
@@ -239,61 +153,132 @@ func registerDeploymentHandler(w http.ResponseWriter, r *http.Request) {
 	var deploymentYAML api.DeploymentYAML
 	err = yaml.Unmarshal(deploymentDTO.DeploymentYAMLBytes, &deploymentYAML)
 	if err != nil {
-		panic(err)
+		log.Debugf("invalid yaml for deployment %s: %s", deploymentDTO.DeploymentId, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	if hTable.hasDeployment(deploymentDTO.DeploymentId) {
+	// the deployment is validated before it is added, so an invalid one leaves nothing behind
+	deployment, err := deploymentYAMLToDeployment(&deploymentYAML, deploymentDTO.Static)
+	if err != nil {
+		log.Debugf("invalid deployment %s: %s", deploymentDTO.DeploymentId, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if s.hTable.hasDeployment(deploymentDTO.DeploymentId) {
 		w.WriteHeader(http.StatusConflict)
 		return
 	}
 
-	hTable.addDeployment(&deploymentDTO)
+	p := principalFromContext(r)
+	if !p.hasRole(roleAdmin) {
+		// only other nodes register deployments in the hierarchy of an existing one
+		if deploymentDTO.Parent != nil || deploymentDTO.MigratingFrom != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		deploymentDTO.Owner = p.User
+	} else if deploymentDTO.Owner == "" {
+		deploymentDTO.Owner = p.User
+	}
+
+	// deployments registered without a parent have their root in the leader of the root replicas
+	if deploymentDTO.Parent == nil && s.rootReplicas != nil && !s.rootReplicas.isLeader() {
+		s.registerDeploymentInRootLeader(w, &deploymentDTO)
+		return
+	}
+
+	// the root has the secrets, so it checks the owner may reference them before accepting the deployment
+	if deploymentDTO.Parent == nil && s.secrets != nil && !s.checkSecretRefs(deploymentDTO.Owner, deployment) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	s.hTable.addDeployment(&deploymentDTO)
 	if deploymentDTO.Parent != nil {
-		if !pTable.hasParent(deploymentDTO.Parent.Id) {
-			pTable.addParent(deploymentDTO.Parent)
+		if !s.pTable.hasParent(deploymentDTO.Parent.Id) {
+			s.pTable.addParent(deploymentDTO.Parent)
 		}
 	}
 
-	deployment := deploymentYAMLToDeployment(&deploymentYAML, deploymentDTO.Static)
+	if deploymentDTO.MigratingFrom != nil {
+		go s.takeOverDeploymentAsync(deployment, deploymentDTO.DeploymentId, deploymentDTO.MigratingFrom)
+	} else {
+		go s.addDeploymentAsync(deployment, deploymentDTO.DeploymentId)
+	}
+
+	if deploymentDTO.Parent == nil && s.rootReplicas != nil && !s.rootReplicas.replicate() {
+		log.Warnf("deployment %s is not replicated in a majority of the root replicas yet",
+			deploymentDTO.DeploymentId)
+	}
+}
+
+func (s *Server) registerDeploymentInRootLeader(w http.ResponseWriter, deploymentDTO *api.DeploymentDTO) {
+	leaderId := s.rootReplicas.findLeader("")
+	if leaderId == "" {
+		log.Warnf("no leader of the root replicas to register %s in", deploymentDTO.DeploymentId)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
 
-	go addDeploymentAsync(deployment, deploymentDTO.DeploymentId)
+	log.Debugf("registering deployment %s in root leader %s", deploymentDTO.DeploymentId, leaderId)
+
+	depClient := s.getDeployerClient(leaderId)
+	status := depClient.RegisterService(deploymentDTO.DeploymentId, deploymentDTO.Static,
+		deploymentDTO.DeploymentYAMLBytes, nil, nil, deploymentDTO.Owner)
+	if status <= 0 {
+		// the leader is unreachable, but replying with a gateway error would make this node look down
+		log.Warnf("could not reach root leader %s to register %s", leaderId, deploymentDTO.DeploymentId)
+		status = http.StatusConflict
+	}
+
+	w.WriteHeader(status)
 }
 
-func deleteDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) deleteDeploymentHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
-	parent := hTable.getParent(deploymentId)
+	parent := s.hTable.getParent(deploymentId)
 	if parent != nil {
-		client := deployer.NewDeployerClient(parent.Addr + ":" + strconv.Itoa(deployer.Port))
-		status := client.ChildDeletedDeployment(deploymentId, myself.Id)
+		client := s.getDeployerClient(parent.Addr)
+		status := client.ChildDeletedDeployment(deploymentId, s.myself.Id)
 		if status != http.StatusOK {
 			log.Errorf("got status %d from child deleted deployment", status)
 			w.WriteHeader(status)
 			return
 		}
-		pTable.decreaseParentCount(parent.Id)
+		s.pTable.decreaseParentCount(parent.Id)
 	}
 
-	hTable.removeDeployment(deploymentId)
+	// the origin of a migration keeps the deployment in archimedes, redirected to the node that took over
+	if migrated, _ := strconv.ParseBool(r.URL.Query().Get(api.MigratedQueryParam)); migrated {
+		s.hTable.removeMigratedDeployment(deploymentId)
+		go s.stopDeploymentInstances(deploymentId)
+		return
+	}
+
+	s.hTable.removeDeployment(deploymentId)
 
-	go deleteDeploymentAsync(deploymentId)
+	go s.deleteDeploymentAsync(deploymentId)
 }
 
-func addNodeHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) addNodeHandler(_ http.ResponseWriter, r *http.Request) {
 	var nodeAddr string
 	err := json.NewDecoder(r.Body).Decode(&nodeAddr)
 	if err != nil {
 		panic(err)
 	}
 
-	onNodeUp(nodeAddr)
+	s.onNodeUp(nodeAddr)
 }
 
-func whoAreYouHandler(w http.ResponseWriter, _ *http.Request) {
-	utils.SendJSONReplyOK(w, myself.Id)
+func (s *Server) whoAreYouHandler(w http.ResponseWriter, _ *http.Request) {
+	utils.SendJSONReplyOK(w, s.myself.Id)
 }
 
-func startResolveUpTheTreeHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) startResolveUpTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
 	var reqBody api.StartResolveUpTheTreeRequestBody
@@ -302,28 +287,28 @@ func startResolveUpTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	parent := hTable.getParent(deploymentId)
+	parent := s.hTable.getParent(deploymentId)
 	if parent == nil {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	log.Debugf("starting resolution (%s) %s", deploymentId, reqBody.Host, parent.Id)
+	log.Debugf("starting resolution (%s) %s through %s", deploymentId, reqBody.Host, parent.Id)
 
-	go resolveUp(parent.Id, deploymentId, hostname, &reqBody)
+	go s.resolveUp(parent.Id, deploymentId, s.hostname, &reqBody)
 }
 
-func resolveUp(parentId, deploymentId, origin string, toResolve *archimedesApi.ToResolveDTO) {
+func (s *Server) resolveUp(parentId, deploymentId, origin string, toResolve *archimedesApi.ToResolveDTO) {
 	log.Debugf("resolving (%s) %s through %s", deploymentId, toResolve.Host, parentId)
 
-	deplClient := deployer.NewDeployerClient(parentId + ":" + strconv.Itoa(deployer.Port))
+	deplClient := s.getDeployerClient(parentId)
 	status := deplClient.ResolveUpTheTree(deploymentId, origin, toResolve)
 	if status != http.StatusOK {
 		log.Debugf("got %d while attempting to resolve up the tree", status)
 	}
 }
 
-func resolveUpTheTreeHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) resolveUpTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
 	var reqBody api.ResolveUpTheTreeRequestBody
@@ -334,10 +319,10 @@ func resolveUpTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugf("resolving (%s) %s for %s", deploymentId, reqBody.ToResolve.Host, reqBody.Origin)
 
-	archClient := archimedes.NewArchimedesClient(publicUtils.ArchimedesServiceName + ":" + strconv.Itoa(archimedes.Port))
-	rHost, rPort, status := archClient.ResolveLocally(reqBody.ToResolve.Host, reqBody.ToResolve.Port)
+	localArchClient := s.archimedesClients.Get(s.config.Archimedes.HostPort())
+	rHost, rPort, status := localArchClient.ResolveLocally(reqBody.ToResolve.Host, reqBody.ToResolve.Port)
 
-	archClient.SetHostPort(reqBody.Origin + ":" + strconv.Itoa(archimedes.Port))
+	archClient := s.archimedesClients.Get(s.config.Archimedes.Addr(reqBody.Origin))
 	id := reqBody.ToResolve.Host + ":" + reqBody.ToResolve.Port.Port()
 
 	switch status {
@@ -349,11 +334,11 @@ func resolveUpTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 		archClient.SetResolvingAnswer(id, resolved)
 		log.Debugf("resolved (%s) %s locally to %s", deploymentId, reqBody.ToResolve.Host, resolved)
 	case http.StatusNotFound:
-		parent := hTable.getParent(deploymentId)
+		parent := s.hTable.getParent(deploymentId)
 		if parent == nil {
 			archClient.SetResolvingAnswer(id, nil)
 		} else {
-			go resolveUp(parent.Id, deploymentId, reqBody.Origin, reqBody.ToResolve)
+			go s.resolveUp(parent.Id, deploymentId, reqBody.Origin, reqBody.ToResolve)
 		}
 	default:
 		log.Debugf("got status %d while trying to resolve locally in archimedes", status)
@@ -362,7 +347,7 @@ func resolveUpTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func redirectClientDownTheTreeHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) redirectClientDownTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
 	var reqBody api.RedirectClientDownTheTreeRequestBody
@@ -373,14 +358,14 @@ func redirectClientDownTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 
 	clientLocation := reqBody
 
-	auxChildren := hTable.getChildren(deploymentId)
+	auxChildren := s.hTable.getChildren(deploymentId)
 	if len(auxChildren) == 0 {
 		log.Debugf("no children to redirect client to")
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	myLocation, status := hTable.autonomicClient.GetLocation()
+	myLocation, status := s.hTable.autonomicClient.GetLocation()
 	if status != http.StatusOK {
 		log.Error("could not get my location")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -389,13 +374,12 @@ func redirectClientDownTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 
 	var (
 		bestDiff    = myLocation.CalcDist(clientLocation)
-		bestNode    = myself.Id
+		bestNode    = s.myself.Id
 		auxLocation *publicUtils.Location
 	)
 
-	autoClient := autonomic.NewAutonomicClient("")
 	for id := range auxChildren {
-		autoClient.SetHostPort(id + ":" + strconv.Itoa(autonomic.Port))
+		autoClient := s.autonomicClients.Get(s.config.Autonomic.Addr(id))
 		auxLocation, status = autoClient.GetLocation()
 		if status != http.StatusOK {
 			log.Errorf("got %d while trying to get %s location", status, id)
@@ -411,7 +395,7 @@ func redirectClientDownTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugf("best node in vicinity to redirect client from %+v to is %s", clientLocation, bestNode)
 
-	value, ok := serviceLocations.Load(deploymentId)
+	value, ok := s.serviceLocations.Load(deploymentId)
 	if ok {
 		terminalLocations := value.(terminalServiceLocations)
 		terminalLocations.Range(func(key, value interface{}) bool {
@@ -428,18 +412,18 @@ func redirectClientDownTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	if bestNode != myself.Id {
+	if bestNode != s.myself.Id {
 		log.Debugf("will redirect client at %f to %s", clientLocation, bestNode)
 
 		id := deploymentId + "_" + bestNode
-		_, ok = exploring.Load(id)
+		_, ok = s.exploring.Load(id)
 		if ok {
-			childAutoClient := autonomic.NewAutonomicClient(bestNode + ":" + strconv.Itoa(autonomic.Port))
+			childAutoClient := s.autonomicClients.Get(s.config.Autonomic.Addr(bestNode))
 			status = childAutoClient.SetExploredSuccessfully(deploymentId, bestNode)
 			if status != http.StatusOK {
 				log.Errorf("got status %d when setting %s exploration as success", status, bestNode)
 			}
-			exploring.Delete(id)
+			s.exploring.Delete(id)
 		}
 
 		var respBody api.RedirectClientDownTheTreeResponseBody
@@ -451,21 +435,14 @@ func redirectClientDownTheTreeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func getFallbackHandler(w http.ResponseWriter, _ *http.Request) {
-	var respBody api.GetFallbackResponseBody
-	respBody = fallback
-
-	utils.SendJSONReplyOK(w, respBody)
-}
-
-func hasDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) hasDeploymentHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
-	if !hTable.hasDeployment(deploymentId) {
+	if !s.hTable.hasDeployment(deploymentId) {
 		w.WriteHeader(http.StatusNotFound)
 	}
 }
 
-func terminalLocationHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) terminalLocationHandler(_ http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
 	var reqBody api.TerminalLocationRequestBody
@@ -475,17 +452,17 @@ func terminalLocationHandler(_ http.ResponseWriter, r *http.Request) {
 	}
 
 	var terminalLocations terminalServiceLocations
-	value, ok := serviceLocations.Load(deploymentId)
+	value, ok := s.serviceLocations.Load(deploymentId)
 	if !ok {
-		addServiceLocationLock.Lock()
-		_, ok = serviceLocations.Load(deploymentId)
+		s.addServiceLocationLock.Lock()
+		_, ok = s.serviceLocations.Load(deploymentId)
 		if !ok {
 			terminalLocations = &sync.Map{}
-			serviceLocations.Store(deploymentId, terminalLocations)
+			s.serviceLocations.Store(deploymentId, terminalLocations)
 		} else {
 			terminalLocations = value.(typeServicesLocationsValue)
 		}
-		addServiceLocationLock.Unlock()
+		s.addServiceLocationLock.Unlock()
 	} else {
 		terminalLocations = value.(typeServicesLocationsValue)
 	}
@@ -493,132 +470,247 @@ func terminalLocationHandler(_ http.ResponseWriter, r *http.Request) {
 	terminalLocations.Store(reqBody.Child, reqBody.Location)
 }
 
-func setExploringHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) setExploringHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 	childId := utils.ExtractPathVar(r, nodeIdPathVar)
 
-	ok := hTable.hasDeployment(deploymentId)
+	ok := s.hTable.hasDeployment(deploymentId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
 	id := deploymentId + "_" + childId
-	exploring.Store(id, nil)
+	s.exploring.Store(id, nil)
+}
+
+func (s *Server) prePullImageHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody api.PrePullImageRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		panic(err)
+	}
+
+	log.Debugf("got hint to pre-pull image %s", reqBody.Name)
+
+	status := s.schedulerClient.PullImage(&reqBody)
+	if status != http.StatusOK {
+		log.Warnf("got status %d asking scheduler to pre-pull %s", status, reqBody.Name)
+		w.WriteHeader(status)
+	}
 }
 
 // TODO function simulating lower API
-func getNodeCloserTo(location *publicUtils.Location, maxHopsToLookFor int,
+func (s *Server) getNodeCloserTo(location *publicUtils.Location, maxHopsToLookFor int,
 	excludeNodes map[string]struct{}) (closest string, found bool) {
-	closest = hTable.autonomicClient.GetClosestNode(location, excludeNodes)
+	closest = s.hTable.autonomicClient.GetClosestNode(location, excludeNodes)
 	found = closest != ""
 	return
 }
 
-func addDeploymentAsync(deployment *Deployment, deploymentId string) {
+func (s *Server) addDeploymentAsync(deployment *Deployment, deploymentId string) {
 	log.Debugf("adding deployment %s", deploymentId)
 
-	status := archimedesClient.RegisterService(deploymentId, deployment.Ports)
+	envVars, ok := s.resolveEnvVars(deploymentId, deployment)
+	if !ok {
+		s.hTable.removeDeployment(deploymentId)
+		return
+	}
+
+	status := s.archimedesClient.RegisterService(deploymentId, deployment.Ports)
 	if status != http.StatusOK {
 		log.Errorf("got status code %d from archimedes", status)
 		return
 	}
 
 	for i := 0; i < deployment.NumberOfInstances; i++ {
-		status = schedulerClient.StartInstance(deploymentId, deployment.Image, deployment.Ports, deployment.Static,
-			deployment.EnvVars)
+		status = s.schedulerClient.StartInstance(deploymentId, deployment.Image, deployment.Ports, deployment.Static,
+			envVars, deployment.Volumes, deployment.ConfigMaps, nil, deployment.RestartPolicy)
 		if status != http.StatusOK {
 			log.Errorf("got status code %d from scheduler", status)
 
-			status = archimedesClient.DeleteService(deploymentId)
+			status = s.archimedesClient.DeleteService(deploymentId)
 			if status != http.StatusOK {
 				log.Error("error deleting service that failed initializing")
 			}
 
-			hTable.removeDeployment(deploymentId)
+			s.hTable.removeDeployment(deploymentId)
 			return
 		}
 	}
 
-	hTable.setLinkOnly(deploymentId, false)
+	s.hTable.setLinkOnly(deploymentId, false)
 }
 
-func deleteDeploymentAsync(deploymentId string) {
-	instances, status := archimedesClient.GetService(deploymentId)
-	if status != http.StatusOK {
-		log.Errorf("got status %d while requesting service %s instances", status, deploymentId)
-		return
-	}
-
-	status = archimedesClient.DeleteService(deploymentId)
+func (s *Server) deleteDeploymentAsync(deploymentId string) {
+	status := s.archimedesClient.DeleteService(deploymentId)
 	if status != http.StatusOK {
 		log.Warnf("got status code %d from archimedes", status)
-		return
 	}
 
-	for instanceId := range instances {
-		status = schedulerClient.StopInstance(instanceId)
-		if status != http.StatusOK {
-			log.Warnf("got status code %d from scheduler", status)
-			return
-		}
+	s.stopDeploymentInstances(deploymentId)
+}
+
+func (s *Server) stopDeploymentInstances(deploymentId string) {
+	status := s.schedulerClient.DeleteDeployment(deploymentId)
+	if status != http.StatusOK {
+		log.Warnf("got status code %d from scheduler while deleting %s", status, deploymentId)
 	}
 }
 
-func deploymentYAMLToDeployment(deploymentYAML *api.DeploymentYAML, static bool) *Deployment {
-	log.Debugf("%+v", deploymentYAML)
+// deploymentYAMLToDeployment builds the deployment from its YAML, returning why it is invalid if it is
+func deploymentYAMLToDeployment(deploymentYAML *api.DeploymentYAML, static bool) (*Deployment, error) {
+	// the YAML is not logged, since environment variables may have sensitive values
+	log.Debugf("parsing deployment %s", deploymentYAML.Spec.ServiceName)
 
 	numContainers := len(deploymentYAML.Spec.Template.Spec.Containers)
 	if numContainers > 1 {
-		panic("more than one container per service is not supported")
+		return nil, errors.New("more than one container per service is not supported")
 	} else if numContainers == 0 {
-		panic("no container provided")
+		return nil, errors.New("no container provided")
 	}
 
 	containerSpec := deploymentYAML.Spec.Template.Spec.Containers[0]
 
-	envVars := make([]string, len(containerSpec.Env))
-	for i, envVar := range containerSpec.Env {
-		envVars[i] = envVar.Name + "=" + envVar.Value
+	var (
+		envVars       []string
+		secretEnvVars []*SecretEnvVar
+	)
+	for _, envVar := range containerSpec.Env {
+		if envVar.ValueFrom == nil || envVar.ValueFrom.SecretKeyRef == nil {
+			envVars = append(envVars, envVar.Name+"="+envVar.Value)
+			continue
+		}
+
+		ref := envVar.ValueFrom.SecretKeyRef
+		if ref.Name == "" || ref.Key == "" {
+			return nil, errors.Errorf("secret reference of environment variable %s needs a name and a key",
+				envVar.Name)
+		}
+
+		secretEnvVars = append(secretEnvVars, &SecretEnvVar{
+			Name: envVar.Name,
+			Ref:  ref,
+		})
+	}
+
+	reclaimPolicies := map[string]string{}
+	for _, volume := range deploymentYAML.Spec.Template.Spec.Volumes {
+		switch volume.ReclaimPolicy {
+		case "":
+			reclaimPolicies[volume.Name] = schedulerApi.VolumeReclaimDelete
+		case schedulerApi.VolumeReclaimDelete, schedulerApi.VolumeReclaimRetain:
+			reclaimPolicies[volume.Name] = volume.ReclaimPolicy
+		default:
+			return nil, errors.Errorf("invalid reclaim policy %s for volume %s", volume.ReclaimPolicy, volume.Name)
+		}
+	}
+
+	var volumes []*schedulerApi.VolumeDTO
+	for _, volumeMount := range containerSpec.VolumeMounts {
+		reclaimPolicy, ok := reclaimPolicies[volumeMount.Name]
+		if !ok {
+			return nil, errors.Errorf("volume %s is mounted but not declared", volumeMount.Name)
+		}
+
+		volumes = append(volumes, &schedulerApi.VolumeDTO{
+			Name:          volumeMount.Name,
+			MountPath:     volumeMount.MountPath,
+			ReclaimPolicy: reclaimPolicy,
+		})
+	}
+
+	restartPolicy := deploymentYAML.Spec.Template.Spec.RestartPolicy
+	switch restartPolicy {
+	case "":
+		restartPolicy = schedulerApi.RestartAlways
+	case schedulerApi.RestartAlways, schedulerApi.RestartOnFailure, schedulerApi.RestartNever:
+	default:
+		return nil, errors.Errorf("invalid restart policy %s", restartPolicy)
+	}
+
+	pullPolicy := containerSpec.ImagePullPolicy
+	switch pullPolicy {
+	case "":
+		pullPolicy = defaultImagePullPolicy(containerSpec.Image)
+	case schedulerApi.ImagePullAlways, schedulerApi.ImagePullIfNotPresent, schedulerApi.ImagePullNever:
+	default:
+		return nil, errors.Errorf("invalid image pull policy %s", pullPolicy)
+	}
+
+	var pullSecrets []string
+	for _, pullSecret := range deploymentYAML.Spec.Template.Spec.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, pullSecret.Name)
+	}
+
+	image := &schedulerApi.ImageDTO{
+		Name:        containerSpec.Image,
+		PullPolicy:  pullPolicy,
+		PullSecrets: pullSecrets,
 	}
 
 	ports := nat.PortSet{}
 	for _, port := range containerSpec.Ports {
 		natPort, err := nat.NewPort(utils.TCP, port.ContainerPort)
 		if err != nil {
-			panic(err)
+			return nil, errors.Wrapf(err, "invalid port %s", port.ContainerPort)
 		}
 
 		ports[natPort] = struct{}{}
 	}
 
+	configMaps, err := configMapsYAMLToDTOs(deploymentYAML)
+	if err != nil {
+		return nil, err
+	}
+
 	deployment := Deployment{
 		DeploymentId:      deploymentYAML.Spec.ServiceName,
 		NumberOfInstances: deploymentYAML.Spec.Replicas,
-		Image:             containerSpec.Image,
+		Image:             image,
 		EnvVars:           envVars,
+		SecretEnvVars:     secretEnvVars,
+		ConfigMaps:        configMaps,
 		Ports:             ports,
 		Static:            static,
+		Volumes:           volumes,
+		RestartPolicy:     restartPolicy,
 		Lock:              &sync.RWMutex{},
 	}
 
 	log.Debugf("%+v", deployment)
 
-	return &deployment
+	return &deployment, nil
+}
+
+// defaultImagePullPolicy pulls images without a tag or with the latest tag every time, since they may have
+// changed, and images with any other tag or a digest only if they are not present
+func defaultImagePullPolicy(image string) string {
+	if strings.Contains(image, "@") {
+		return schedulerApi.ImagePullIfNotPresent
+	}
+
+	lastComponent := image[strings.LastIndex(image, "/")+1:]
+	tagIdx := strings.LastIndex(lastComponent, ":")
+	if tagIdx == -1 || lastComponent[tagIdx+1:] == "latest" {
+		return schedulerApi.ImagePullAlways
+	}
+
+	return schedulerApi.ImagePullIfNotPresent
 }
 
-func addNode(nodeDeployerId, addr string) bool {
+func (s *Server) addNode(nodeDeployerId, addr string) bool {
 	if nodeDeployerId == "" {
 		panic("error while adding node up")
 	}
 
-	if nodeDeployerId == myself.Id {
+	if nodeDeployerId == s.myself.Id {
 		return true
 	}
 
-	suspectedChild.Delete(nodeDeployerId)
+	s.suspectedChild.Delete(nodeDeployerId)
 
-	_, ok := myAlternatives.Load(nodeDeployerId)
+	_, ok := s.myAlternatives.Load(nodeDeployerId)
 	if ok {
 		return true
 	}
@@ -627,13 +719,13 @@ func addNode(nodeDeployerId, addr string) bool {
 
 	neighbor := utils.NewNode(nodeDeployerId, addr)
 
-	myAlternatives.Store(nodeDeployerId, neighbor)
+	s.myAlternatives.Store(nodeDeployerId, neighbor)
 	return true
 }
 
 // TODO function simulation lower API
 // Node up is only triggered for nodes that appeared one hop away
-func onNodeUp(addr string) {
+func (s *Server) onNodeUp(addr string) {
 	var (
 		id  string
 		err error
@@ -646,39 +738,45 @@ func onNodeUp(addr string) {
 	} else {
 		id = addr
 	}
-	addNode(id, id)
-	sendAlternatives()
-	if !timer.Stop() {
-		<-timer.C
+
+	nodeId := id
+	if s.security.TLS.IsEnabled() {
+		// the node is only trusted if it presents a certificate signed by the CA, which has its id
+		var status int
+		nodeId, status = s.getDeployerClient(id).WhoAreYou()
+		if status != http.StatusOK {
+			log.Errorf("got status %d verifying identity of node %s", status, addr)
+			return
+		}
 	}
-	timer.Reset(sendAlternativesTimeout * time.Second)
+
+	s.addNode(nodeId, id)
+	s.sendAlternatives()
+	s.resetAlternativesTimer()
 }
 
 // TODO function simulation lower API
 // Node down is only triggered for nodes that were one hop away
-func onNodeDown(id string) {
-	myAlternatives.Delete(id)
-	sendAlternatives()
-	if !timer.Stop() {
-		<-timer.C
-	}
-	timer.Reset(sendAlternativesTimeout * time.Second)
+func (s *Server) onNodeDown(id string) {
+	s.myAlternatives.Delete(id)
+	s.sendAlternatives()
+	s.resetAlternativesTimer()
 }
 
-func addPortToAddr(addr string) string {
+func (s *Server) addPortToAddr(addr string) string {
 	if !strings.Contains(addr, ":") {
-		return addr + ":" + strconv.Itoa(deployer.Port)
+		return s.config.Deployer.Addr(addr)
 	}
 	return addr
 }
 
-func getParentAlternatives(parentId string) (alternatives map[string]*utils.Node) {
-	nodeAlternativesLock.RLock()
-	defer nodeAlternativesLock.RUnlock()
+func (s *Server) getParentAlternatives(parentId string) (alternatives map[string]*utils.Node) {
+	s.nodeAlternativesLock.RLock()
+	defer s.nodeAlternativesLock.RUnlock()
 
 	alternatives = map[string]*utils.Node{}
 
-	for _, alternative := range nodeAlternatives[parentId] {
+	for _, alternative := range s.nodeAlternatives[parentId] {
 		alternatives[alternative.Id] = alternative
 	}
 
@@ -1,55 +1,268 @@
 package deployer
 
 import (
+	"encoding/json"
 	"net/http"
 	"os"
-	"strconv"
+	"sync"
 	"time"
 
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
 	log "github.com/sirupsen/logrus"
 )
 
-func sendHeartbeatsPeriodically() {
-	ticker := time.NewTicker(heartbeatTimeout * time.Second)
+// sendHeartbeatsPeriodically sends a single heartbeat to each neighbour, telling it this node is alive, so its
+// failure detector can monitor it, and summarizing the deployments they share
+func (s *Server) sendHeartbeatsPeriodically() {
+	ticker := time.NewTicker(s.fdConfig.HeartbeatInterval)
+	defer ticker.Stop()
 
 	for {
-		children.Range(func(key, value interface{}) bool {
-			childId := key.(string)
-			log.Debugf("sending heartbeat to %s", childId)
-			child := value.(typeChildrenMapValue)
-			childrenClient.SetHostPort(child.Addr + ":" + strconv.Itoa(deployer.Port))
-			status := childrenClient.SetParentAlive(myself.Id)
-			if status != http.StatusOK {
-				log.Errorf("got status %d while telling %s that i was alive", status, child.Id)
+		summaries := s.getDeploymentSummaries()
+
+		// each neighbour gets its heartbeat in parallel, so a slow one does not delay the heartbeats of the others
+		var wg sync.WaitGroup
+		for neighbourId, deploymentIds := range s.getSharedDeployments() {
+			heartbeat := &api.HeartbeatDTO{
+				Deployments: make(map[string]*api.DeploymentSummaryDTO, len(deploymentIds)),
+			}
+			for _, deploymentId := range deploymentIds {
+				if summary, ok := summaries[deploymentId]; ok {
+					heartbeat.Deployments[deploymentId] = summary
+				}
 			}
 
-			return true
-		})
+			wg.Add(1)
+			go func(neighbourId string) {
+				defer wg.Done()
+				s.sendHeartbeat(neighbourId, heartbeat)
+			}(neighbourId)
+		}
+		wg.Wait()
+
+		select {
+		case <-s.Stopped():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) sendHeartbeat(neighbourId string, heartbeat *api.HeartbeatDTO) {
+	log.Debugf("sending heartbeat to %s with %d deployments", neighbourId, len(heartbeat.Deployments))
+	frame := &api.ControlFrameDTO{
+		Type:      api.FrameHeartbeat,
+		Heartbeat: heartbeat,
+	}
+	if s.sendControlFrame(neighbourId, frame) {
+		return
+	}
+
+	status := s.getDeployerClient(neighbourId).SendHeartbeat(s.myself.Id, heartbeat)
+	if status != http.StatusOK {
+		log.Errorf("got status %d while sending heartbeat to %s", status, neighbourId)
+	}
+}
+
+// getSharedDeployments returns the deployments this node shares with each neighbour. Neighbours without
+// deployments in common, e.g. while one is being extended, still get heartbeats.
+func (s *Server) getSharedDeployments() map[string][]string {
+	shared := map[string][]string{}
+	for neighbourId := range s.getNeighbours() {
+		shared[neighbourId] = nil
+	}
+
+	for deploymentId, entry := range s.hTable.toDTO() {
+		if entry.Parent != nil {
+			shared[entry.Parent.Id] = append(shared[entry.Parent.Id], deploymentId)
+		}
 
-		<-ticker.C
+		for childId := range entry.Children {
+			shared[childId] = append(shared[childId], deploymentId)
+		}
 	}
+
+	return shared
 }
 
-func checkParentHeartbeatsPeriodically() {
-	ticker := time.NewTicker(checkParentsTimeout * time.Second)
+// getDeploymentSummaries returns the version of each deployment in this node, with the instances heartbeating
+// the node and the ones crash looping
+func (s *Server) getDeploymentSummaries() map[string]*api.DeploymentSummaryDTO {
+	summaries := map[string]*api.DeploymentSummaryDTO{}
+	for deploymentId, entry := range s.hTable.toDTO() {
+		summary := &api.DeploymentSummaryDTO{
+			Version: entry.Version,
+		}
+
+		if entry.Unhealthy {
+			summary.CrashLooping = s.hTable.getNumCrashLooping(deploymentId)
+		}
+
+		summaries[deploymentId] = summary
+	}
+
+	s.heartbeatsMap.Range(func(_, value interface{}) bool {
+		pairServiceStatus := value.(typeHeartbeatsMapValue)
+		if summary, ok := summaries[pairServiceStatus.ServiceId]; ok {
+			summary.Instances++
+		}
+
+		return true
+	})
+
+	return summaries
+}
+
+func (s *Server) checkParentHeartbeatsPeriodically() {
+	ticker := time.NewTicker(s.fdConfig.CheckInterval)
+	defer ticker.Stop()
+
 	for {
-		<-ticker.C
-		deadParents := pTable.checkDeadParents()
-		if len(deadParents) == 0 {
-			log.Debugf("all parents alive")
-			continue
+		select {
+		case <-s.Stopped():
+			return
+		case <-ticker.C:
 		}
 
-		for _, deadParent := range deadParents {
+		parents := s.pTable.getParents()
+		s.parentsDetector.watch(parents)
+
+		for parentId, status := range s.parentsDetector.check() {
+			if status != api.NodeDead {
+				continue
+			}
+
+			deadParent := parents[parentId]
 			log.Debugf("dead parent: %+v", deadParent)
-			pTable.removeParent(deadParent.Id)
+			s.pTable.removeParent(deadParent.Id)
+			s.neighbourHeartbeats.Delete(deadParent.Id)
+			s.closeControlStream(deadParent.Id)
 			filename := alternativesDir + deadParent.Addr
 			if _, err := os.Stat(filename); os.IsNotExist(err) {
 				err = os.Remove(filename)
 				log.Error(err)
 			}
-			renegotiateParent(deadParent, getParentAlternatives(deadParent.Id))
+			s.renegotiateParent(deadParent, s.getParentAlternatives(deadParent.Id))
 		}
 	}
 }
+
+// checkChildrenHeartbeatsPeriodically removes dead children from the deployments they are in. Their children,
+// if any, warn this node, as their grandparent, to extend the deployments again.
+func (s *Server) checkChildrenHeartbeatsPeriodically() {
+	ticker := time.NewTicker(s.fdConfig.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.Stopped():
+			return
+		case <-ticker.C:
+		}
+
+		nodeChildren := s.getChildrenNodes()
+		s.childrenDetector.watch(nodeChildren)
+
+		for childId, status := range s.childrenDetector.check() {
+			if status != api.NodeDead {
+				continue
+			}
+
+			deadChild := nodeChildren[childId]
+			log.Warnf("dead child: %+v", deadChild)
+			s.suspectedChild.Store(childId, nil)
+			s.children.Delete(childId)
+			s.neighbourHeartbeats.Delete(childId)
+			s.closeControlStream(childId)
+
+			for _, deploymentId := range s.hTable.getDeploymentsWithChild(childId) {
+				s.hTable.removeChild(deploymentId, childId)
+				s.emitEvent(api.EventDeadChild, deploymentId, deadChild, nil)
+			}
+		}
+	}
+}
+
+func (s *Server) getChildrenNodes() map[string]*utils.Node {
+	nodeChildren := map[string]*utils.Node{}
+
+	s.children.Range(func(key, value interface{}) bool {
+		nodeChildren[key.(string)] = value.(typeChildrenMapValue)
+		return true
+	})
+
+	return nodeChildren
+}
+
+// getNeighbours returns the parents and children of this node
+func (s *Server) getNeighbours() map[string]*utils.Node {
+	neighbours := s.getChildrenNodes()
+	for parentId, parent := range s.pTable.getParents() {
+		neighbours[parentId] = parent
+	}
+
+	return neighbours
+}
+
+// heartbeatHandler handles the heartbeat of a neighbour, that is either a parent or a child of this node, or both
+// in different deployments
+func (s *Server) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	senderId := utils.ExtractPathVar(r, nodeIdPathVar)
+
+	if !s.security.TLS.IsRequestFrom(r, senderId) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var reqBody api.HeartbeatRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.handleHeartbeat(senderId, &reqBody)
+}
+
+// handleHeartbeat handles the heartbeat of a neighbour, whether it came in a request or in its control stream
+func (s *Server) handleHeartbeat(senderId string, heartbeat *api.HeartbeatDTO) {
+	log.Debugf("%s is alive", senderId)
+	s.parentsDetector.heartbeat(senderId)
+	s.childrenDetector.heartbeat(senderId)
+
+	neighbour := &api.NeighbourDTO{
+		Id:            senderId,
+		LastHeartbeat: time.Now(),
+		Deployments:   heartbeat.Deployments,
+	}
+
+	value, ok := s.neighbourHeartbeats.Load(senderId)
+	s.neighbourHeartbeats.Store(senderId, neighbour)
+	if !ok {
+		return
+	}
+
+	previous := value.(*api.NeighbourDTO)
+	for deploymentId, summary := range neighbour.Deployments {
+		previousSummary, ok := previous.Deployments[deploymentId]
+		if ok && summary.Version != previousSummary.Version {
+			log.Debugf("deployment %s changed in %s to version %d", deploymentId, senderId, summary.Version)
+		}
+	}
+}
+
+// getNeighboursHandler replies with the last heartbeat of each current neighbour
+func (s *Server) getNeighboursHandler(w http.ResponseWriter, _ *http.Request) {
+	var resp api.GetNeighboursResponseBody
+	resp = map[string]*api.NeighbourDTO{}
+
+	for neighbourId := range s.getNeighbours() {
+		value, ok := s.neighbourHeartbeats.Load(neighbourId)
+		if ok {
+			resp[neighbourId] = value.(*api.NeighbourDTO)
+		}
+	}
+
+	utils.SendJSONReplyOK(w, resp)
+}
@@ -1,30 +1,37 @@
 package deployer
 
 import (
-	"io/ioutil"
 	"net/http"
-	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	schedulerApi "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/strategies"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
 	"github.com/bruno-anjos/cloud-edge-deployment/pkg/autonomic"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
 	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
 type (
 	hierarchyEntry struct {
+		// Version is bumped on every change to the entry, so neighbours can tell it changed from the
+		// heartbeats. It comes first to be 64-bit aligned for the atomic operations.
+		Version      uint64
+		Children     sync.Map
+		NumChildren  int32
+		Static       bool
+		CrashLooping sync.Map
+		Owner        string
+
+		// lock guards the fields below, which change while heartbeats are read from the entry
+		lock                sync.RWMutex
 		DeploymentYAMLBytes []byte
 		Parent              *utils.Node
 		Grandparent         *utils.Node
-		Children            sync.Map
-		NumChildren         int32
-		Static              bool
 		IsOrphan            bool
 		NewParentChan       chan<- string
 		LinkOnly            bool
@@ -44,13 +51,50 @@ func (e *hierarchyEntry) getChildren() map[string]*utils.Node {
 	return entryChildren
 }
 
+func (e *hierarchyEntry) isUnhealthy() bool {
+	unhealthy := false
+
+	e.CrashLooping.Range(func(_, _ interface{}) bool {
+		unhealthy = true
+		return false
+	})
+
+	return unhealthy
+}
+
+func (e *hierarchyEntry) setLinkOnly(linkOnly bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.LinkOnly = linkOnly
+	e.changed()
+}
+
+func (e *hierarchyEntry) isLinkOnly() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.LinkOnly
+}
+
+func (e *hierarchyEntry) changed() {
+	atomic.AddUint64(&e.Version, 1)
+}
+
 func (e *hierarchyEntry) toDTO() *api.HierarchyEntryDTO {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
 	return &api.HierarchyEntryDTO{
 		Parent:      e.Parent,
 		Grandparent: e.Grandparent,
 		Children:    e.getChildren(),
 		Static:      e.Static,
 		IsOrphan:    e.IsOrphan,
+		Unhealthy:   e.isUnhealthy(),
+		LinkOnly:    e.LinkOnly,
+		Owner:       e.Owner,
+		Version:     atomic.LoadUint64(&e.Version),
 	}
 }
 
@@ -61,16 +105,18 @@ type (
 	hierarchyTable struct {
 		hierarchyEntries sync.Map
 		autonomicClient  *autonomic.Client
+		server           *Server
 	}
 
 	typeHierarchyEntriesMapKey   = string
 	typeHierarchyEntriesMapValue = *hierarchyEntry
 )
 
-func newHierarchyTable() *hierarchyTable {
+func newHierarchyTable(server *Server) *hierarchyTable {
 	return &hierarchyTable{
 		hierarchyEntries: sync.Map{},
-		autonomicClient:  autonomic.NewAutonomicClient(autonomic.DefaultHostPort),
+		autonomicClient:  server.autonomicClients.Get(server.config.Autonomic.HostPort()),
+		server:           server,
 	}
 }
 
@@ -84,6 +130,7 @@ func (t *hierarchyTable) addDeployment(dto *api.DeploymentDTO) bool {
 		IsOrphan:            false,
 		NewParentChan:       nil,
 		LinkOnly:            true,
+		Owner:               dto.Owner,
 	}
 
 	_, loaded := t.hierarchyEntries.LoadOrStore(dto.DeploymentId, entry)
@@ -106,17 +153,35 @@ func (t *hierarchyTable) removeDeployment(deploymentId string) {
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
-	if entry.NumChildren > 0 {
+	if atomic.LoadInt32(&entry.NumChildren) > 0 {
 		log.Debugf("setting deployment %s as linkonly", deploymentId)
-		entry.LinkOnly = true
+		entry.setLinkOnly(true)
 		deploymentChildren := entry.getChildren()
 		for childId := range deploymentChildren {
 			log.Debugf("redirecting %s linkonly to %s", deploymentId, childId)
-			archimedesClient.Redirect(deploymentId, childId, -1)
+			t.server.archimedesClient.Redirect(deploymentId, childId, -1)
 			break
 		}
 	} else {
-		archimedesClient.DeleteService(deploymentId)
+		t.server.archimedesClient.DeleteService(deploymentId)
+		t.hierarchyEntries.Delete(deploymentId)
+		t.autonomicClient.DeleteService(deploymentId)
+	}
+}
+
+// removeMigratedDeployment removes the deployment the node migrated away from, leaving archimedes as it is, since it
+// already redirects to the node that took over
+func (t *hierarchyTable) removeMigratedDeployment(deploymentId string) {
+	value, ok := t.hierarchyEntries.Load(deploymentId)
+	if !ok {
+		return
+	}
+
+	entry := value.(typeHierarchyEntriesMapValue)
+	if atomic.LoadInt32(&entry.NumChildren) > 0 {
+		log.Debugf("setting migrated deployment %s as linkonly", deploymentId)
+		entry.setLinkOnly(true)
+	} else {
 		t.hierarchyEntries.Delete(deploymentId)
 		t.autonomicClient.DeleteService(deploymentId)
 	}
@@ -134,24 +199,50 @@ func (t *hierarchyTable) setDeploymentParent(deploymentId string, parent *utils.
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
-	entry.Parent = parent
 
+	entry.lock.Lock()
+	entry.Parent = parent
 	if entry.NewParentChan != nil {
 		entry.NewParentChan <- parent.Id
 		close(entry.NewParentChan)
 		entry.NewParentChan = nil
 	}
+	entry.IsOrphan = false
+	entry.changed()
+	entry.lock.Unlock()
 
 	auxChildren := t.getChildren(deploymentId)
 	if len(auxChildren) > 0 {
-		deplClient := deployer.NewDeployerClient("")
 		for childId := range auxChildren {
-			deplClient.SetHostPort(childId + ":" + strconv.Itoa(deployer.Port))
-			deplClient.SetGrandparent(deploymentId, parent)
+			t.server.getDeployerClient(childId).SetGrandparent(deploymentId, parent)
 		}
 	}
+}
+
+// setDeploymentAsRoot drops the parent and the grandparent of the deployment, returning the parent it had. If the
+// deployment is orphaned, the wait for a new parent ends, since the root needs none.
+func (t *hierarchyTable) setDeploymentAsRoot(deploymentId string) *utils.Node {
+	value, ok := t.hierarchyEntries.Load(deploymentId)
+	if !ok {
+		return nil
+	}
+
+	entry := value.(typeHierarchyEntriesMapValue)
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
 
+	parent := entry.Parent
+	entry.Parent = nil
+	entry.Grandparent = nil
+	if entry.NewParentChan != nil {
+		entry.NewParentChan <- t.server.myself.Id
+		close(entry.NewParentChan)
+		entry.NewParentChan = nil
+	}
 	entry.IsOrphan = false
+	entry.changed()
+
+	return parent
 }
 
 func (t *hierarchyTable) setDeploymentGrandparent(deploymentId string, grandparent *utils.Node) {
@@ -161,7 +252,11 @@ func (t *hierarchyTable) setDeploymentGrandparent(deploymentId string, grandpare
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+
 	entry.Grandparent = grandparent
+	entry.changed()
 }
 
 func (t *hierarchyTable) setDeploymentAsOrphan(deploymentId string) <-chan string {
@@ -171,9 +266,14 @@ func (t *hierarchyTable) setDeploymentAsOrphan(deploymentId string) <-chan strin
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+
 	entry.IsOrphan = true
-	newParentChan := make(chan string)
+	// buffered, so a new parent does not block on a wait that already timed out
+	newParentChan := make(chan string, 1)
 	entry.NewParentChan = newParentChan
+	entry.changed()
 
 	return newParentChan
 }
@@ -191,20 +291,21 @@ func (t *hierarchyTable) addChild(deploymentId string, child *utils.Node) {
 
 	entry.Children.Store(child.Id, child)
 	atomic.AddInt32(&entry.NumChildren, 1)
+	entry.changed()
 
 	t.autonomicClient.AddServiceChild(deploymentId, child.Id)
 
 	parent := t.getParent(deploymentId)
 	if parent != nil {
-		autoClient := autonomic.NewAutonomicClient(child.Addr + ":" + strconv.Itoa(autonomic.Port))
+		autoClient := t.server.autonomicClients.Get(t.server.config.Autonomic.Addr(child.Addr))
 		nodeLoc, status := autoClient.GetLocation()
 		if status != http.StatusOK {
 			log.Errorf("got status %d asking for %s location", status, child.Id)
 			return
 		}
 
-		deplClient := deployer.NewDeployerClient(parent.Addr + ":" + strconv.Itoa(deployer.Port))
-		status = deplClient.SetTerminalLocation(deploymentId, myself.Id, nodeLoc)
+		deplClient := t.server.getDeployerClient(parent.Addr)
+		status = deplClient.SetTerminalLocation(deploymentId, t.server.myself.Id, nodeLoc)
 		if status != http.StatusOK {
 			log.Errorf("got status %d setting terminal location in %s", status, parent.Id)
 			return
@@ -222,11 +323,12 @@ func (t *hierarchyTable) removeChild(deploymentId, childId string) {
 
 	entry := value.(typeHierarchyEntriesMapValue)
 	entry.Children.Delete(childId)
+	entry.changed()
 	t.autonomicClient.RemoveServiceChild(deploymentId, childId)
 
 	isZero := atomic.CompareAndSwapInt32(&entry.NumChildren, 1, 0)
 	if isZero {
-		if entry.LinkOnly {
+		if entry.isLinkOnly() {
 			t.removeDeployment(deploymentId)
 		}
 	} else {
@@ -253,6 +355,8 @@ func (t *hierarchyTable) getParent(deploymentId string) *utils.Node {
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
 
 	return entry.Parent
 }
@@ -264,6 +368,8 @@ func (t *hierarchyTable) deploymentToDTO(deploymentId string) (*api.DeploymentDT
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
 
 	return &api.DeploymentDTO{
 		Parent:              entry.Parent,
@@ -271,9 +377,44 @@ func (t *hierarchyTable) deploymentToDTO(deploymentId string) (*api.DeploymentDT
 		DeploymentId:        deploymentId,
 		Static:              entry.Static,
 		DeploymentYAMLBytes: entry.DeploymentYAMLBytes,
+		Owner:               entry.Owner,
 	}, true
 }
 
+func (t *hierarchyTable) getEntryDTO(deploymentId string) (*api.HierarchyEntryDTO, bool) {
+	value, ok := t.hierarchyEntries.Load(deploymentId)
+	if !ok {
+		return nil, false
+	}
+
+	entry := value.(typeHierarchyEntriesMapValue)
+	return entry.toDTO(), true
+}
+
+func (t *hierarchyTable) setDeploymentYAMLBytes(deploymentId string, deploymentYAMLBytes []byte) {
+	value, ok := t.hierarchyEntries.Load(deploymentId)
+	if !ok {
+		return
+	}
+
+	entry := value.(typeHierarchyEntriesMapValue)
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+
+	entry.DeploymentYAMLBytes = deploymentYAMLBytes
+	entry.changed()
+}
+
+func (t *hierarchyTable) getOwner(deploymentId string) (string, bool) {
+	value, ok := t.hierarchyEntries.Load(deploymentId)
+	if !ok {
+		return "", false
+	}
+
+	entry := value.(typeHierarchyEntriesMapValue)
+	return entry.Owner, true
+}
+
 func (t *hierarchyTable) isStatic(deploymentId string) bool {
 	value, ok := t.hierarchyEntries.Load(deploymentId)
 	if !ok {
@@ -291,7 +432,11 @@ func (t *hierarchyTable) removeParent(deploymentId string) bool {
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+
 	entry.Parent = nil
+	entry.changed()
 
 	return true
 }
@@ -303,6 +448,8 @@ func (t *hierarchyTable) getGrandparent(deploymentId string) *utils.Node {
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
 
 	return entry.Grandparent
 }
@@ -314,7 +461,43 @@ func (t *hierarchyTable) removeGrandparent(deploymentId string) {
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+
 	entry.Grandparent = nil
+	entry.changed()
+}
+
+// setInstanceCrashLooping marks the deployment as unhealthy while any of its instances is crash looping
+func (t *hierarchyTable) setInstanceCrashLooping(deploymentId, instanceId string, crashLooping bool) {
+	value, ok := t.hierarchyEntries.Load(deploymentId)
+	if !ok {
+		return
+	}
+
+	entry := value.(typeHierarchyEntriesMapValue)
+	if crashLooping {
+		entry.CrashLooping.Store(instanceId, nil)
+	} else {
+		entry.CrashLooping.Delete(instanceId)
+	}
+
+	entry.changed()
+}
+
+func (t *hierarchyTable) getNumCrashLooping(deploymentId string) (numCrashLooping int) {
+	value, ok := t.hierarchyEntries.Load(deploymentId)
+	if !ok {
+		return
+	}
+
+	entry := value.(typeHierarchyEntriesMapValue)
+	entry.CrashLooping.Range(func(_, _ interface{}) bool {
+		numCrashLooping++
+		return true
+	})
+
+	return
 }
 
 func (t *hierarchyTable) getDeployments() []string {
@@ -336,6 +519,9 @@ func (t *hierarchyTable) getDeploymentConfig(deploymentId string) []byte {
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
+
 	return entry.DeploymentYAMLBytes
 }
 
@@ -344,7 +530,26 @@ func (t *hierarchyTable) getDeploymentsWithParent(parentId string) (deploymentId
 		deploymentId := key.(typeHierarchyEntriesMapKey)
 		deployment := value.(typeHierarchyEntriesMapValue)
 
-		if deployment.Parent != nil && deployment.Parent.Id == parentId {
+		deployment.lock.RLock()
+		hasParent := deployment.Parent != nil && deployment.Parent.Id == parentId
+		deployment.lock.RUnlock()
+
+		if hasParent {
+			deploymentIds = append(deploymentIds, deploymentId)
+		}
+
+		return true
+	})
+
+	return
+}
+
+func (t *hierarchyTable) getDeploymentsWithChild(childId string) (deploymentIds []string) {
+	t.hierarchyEntries.Range(func(key, value interface{}) bool {
+		deploymentId := key.(typeHierarchyEntriesMapKey)
+		deployment := value.(typeHierarchyEntriesMapValue)
+
+		if _, ok := deployment.Children.Load(childId); ok {
 			deploymentIds = append(deploymentIds, deploymentId)
 		}
 
@@ -361,7 +566,7 @@ func (t *hierarchyTable) setLinkOnly(deploymentId string, linkOnly bool) {
 	}
 
 	entry := value.(typeHierarchyEntriesMapValue)
-	entry.LinkOnly = linkOnly
+	entry.setLinkOnly(linkOnly)
 }
 
 func (t *hierarchyTable) isLinkOnly(deploymentId string) (linkOnly bool) {
@@ -375,7 +580,7 @@ func (t *hierarchyTable) isLinkOnly(deploymentId string) (linkOnly bool) {
 	ok = true
 
 	entry := value.(typeHierarchyEntriesMapValue)
-	linkOnly = entry.LinkOnly
+	linkOnly = entry.isLinkOnly()
 	return
 }
 
@@ -392,16 +597,10 @@ func (t *hierarchyTable) toDTO() map[string]*api.HierarchyEntryDTO {
 	return entries
 }
 
-const (
-	alive     = 1
-	suspected = 0
-)
-
 type (
 	parentsEntry struct {
 		Parent           *utils.Node
 		NumOfDeployments int32
-		IsUp             int32
 	}
 
 	parentsTable struct {
@@ -421,7 +620,6 @@ func (t *parentsTable) addParent(parent *utils.Node) {
 	parentEntry := &parentsEntry{
 		Parent:           parent,
 		NumOfDeployments: 1,
-		IsUp:             alive,
 	}
 
 	t.parentEntries.Store(parent.Id, parentEntry)
@@ -453,81 +651,65 @@ func (t *parentsTable) removeParent(parentId string) {
 	t.parentEntries.Delete(parentId)
 }
 
-func (t *parentsTable) setParentUp(parentId string) {
-	value, ok := t.parentEntries.Load(parentId)
-	if !ok {
-		return
-	}
-
-	parentEntry := value.(typeParentEntriesMapValue)
-	atomic.StoreInt32(&parentEntry.IsUp, alive)
-}
+func (t *parentsTable) getParents() map[string]*utils.Node {
+	parents := map[string]*utils.Node{}
 
-func (t *parentsTable) checkDeadParents() (deadParents []*utils.Node) {
 	t.parentEntries.Range(func(key, value interface{}) bool {
 		parentEntry := value.(typeParentEntriesMapValue)
-
-		isAlive := atomic.CompareAndSwapInt32(&parentEntry.IsUp, alive, suspected)
-		log.Debugf("setting parent %s as suspected", parentEntry.Parent.Id)
-		if !isAlive {
-			deadParents = append(deadParents, parentEntry.Parent)
-		}
-
+		parents[parentEntry.Parent.Id] = parentEntry.Parent
 		return true
 	})
 
-	return
+	return parents
 }
 
 /*
 	HELPER METHODS
 */
 
-func renegotiateParent(deadParent *utils.Node, alternatives map[string]*utils.Node) {
-	deploymentIds := hTable.getDeploymentsWithParent(deadParent.Id)
+func (s *Server) renegotiateParent(deadParent *utils.Node, alternatives map[string]*utils.Node) {
+	deploymentIds := s.hTable.getDeploymentsWithParent(deadParent.Id)
 
 	log.Debugf("renegotiating deployments %+v with parent %s", deploymentIds, deadParent.Id)
 
 	for _, deploymentId := range deploymentIds {
-		grandparent := hTable.getGrandparent(deploymentId)
-		if grandparent == nil {
-			deplClient := deployer.NewDeployerClient(fallback + ":" + strconv.Itoa(deployer.Port))
-			status := deplClient.Fallback(deploymentId, myself.Id, location)
-			if status != http.StatusOK {
-				log.Debugf("tried to fallback to %s, got %d", fallback, status)
-				deleteDeploymentAsync(deploymentId)
+		grandparent := s.hTable.getGrandparent(deploymentId)
+		if grandparent == nil && s.rootReplicas != nil {
+			// the leader of the root replicas takes over and tells the orphan it is the new parent
+			newParentChan := s.hTable.setDeploymentAsOrphan(deploymentId)
+			s.emitEvent(api.EventOrphaned, deploymentId, deadParent, nil)
+			go s.waitForNewDeploymentParent(deploymentId, deadParent.Id, newParentChan)
+			continue
+		} else if grandparent == nil {
+			if !s.fallBack(deploymentId, deadParent.Id) {
+				s.deleteDeploymentAsync(deploymentId)
 			}
 			continue
 		}
 
-		newParentChan := hTable.setDeploymentAsOrphan(deploymentId)
+		newParentChan := s.hTable.setDeploymentAsOrphan(deploymentId)
+		s.emitEvent(api.EventOrphaned, deploymentId, deadParent, map[string]string{"grandparent": grandparent.Id})
 
-		deplClient := deployer.NewDeployerClient(grandparent.Addr + ":" + strconv.Itoa(deployer.Port))
-		status := deplClient.WarnOfDeadChild(deploymentId, deadParent.Id, myself, alternatives, location)
+		deplClient := s.getDeployerClient(grandparent.Addr)
+		status := deplClient.WarnOfDeadChild(deploymentId, deadParent.Id, s.myself, alternatives, s.location)
 		if status != http.StatusOK {
 			log.Errorf("got status %d while renegotiating parent %s with %s for deployment %s", status,
 				deadParent, grandparent.Id, deploymentId)
-			continue
 		}
 
-		go waitForNewDeploymentParent(deploymentId, newParentChan)
+		// without the grandparent no new parent comes, so the deployment falls back once the wait times out
+		go s.waitForNewDeploymentParent(deploymentId, deadParent.Id, newParentChan)
 	}
 }
 
-func waitForNewDeploymentParent(deploymentId string, newParentChan <-chan string) {
-	waitingTimer := time.NewTimer(waitForNewParentTimeout * time.Second)
+func (s *Server) waitForNewDeploymentParent(deploymentId, deadParentId string, newParentChan <-chan string) {
+	waitingTimer := time.NewTimer(s.deployerConfig.WaitForNewParentTimeout)
 
 	log.Debugf("waiting new parent for %s", deploymentId)
 
 	select {
 	case <-waitingTimer.C:
-		log.Debugf("falling back to %s", fallback)
-		deplClient := deployer.NewDeployerClient(fallback)
-		status := deplClient.Fallback(deploymentId, myself.Id, location)
-		if status != http.StatusOK {
-			log.Debugf("tried to fallback to %s, got %d", fallback, status)
-			return
-		}
+		s.fallBack(deploymentId, deadParentId)
 		return
 	case newParentId := <-newParentChan:
 		log.Debugf("got new parent %s for deployment %s", newParentId, deploymentId)
@@ -535,15 +717,15 @@ func waitForNewDeploymentParent(deploymentId string, newParentChan <-chan string
 	}
 }
 
-func attemptToExtend(deploymentId, target string, targetLocation *publicUtils.Location, grandchild *utils.Node,
+func (s *Server) attemptToExtend(deploymentId, target string, targetLocation *publicUtils.Location, grandchild *utils.Node,
 	maxHops int, alternatives map[string]*utils.Node) {
 	var extendTimer *time.Timer
 
-	toExclude := map[string]struct{}{myself.Id: {}}
+	toExclude := map[string]struct{}{s.myself.Id: {}}
 	if grandchild != nil {
 		toExclude[grandchild.Id] = struct{}{}
 	}
-	suspectedChild.Range(func(key, value interface{}) bool {
+	s.suspectedChild.Range(func(key, value interface{}) bool {
 		suspectedId := key.(typeSuspectedChildMapKey)
 		toExclude[suspectedId] = struct{}{}
 		return true
@@ -555,8 +737,15 @@ func attemptToExtend(deploymentId, target string, targetLocation *publicUtils.Lo
 		success      bool
 		newChildAddr = target
 		tries        = 0
+		hinted       = map[string]struct{}{}
 	)
 	for !success {
+		if newChildAddr != "" && s.transport.IsCircuitOpen(s.addPortToAddr(newChildAddr)) {
+			log.Debugf("%s is unreachable, looking for another node", newChildAddr)
+			toExclude[newChildAddr] = struct{}{}
+			newChildAddr = ""
+		}
+
 		if newChildAddr == "" {
 			if len(alternatives) > 0 {
 				for alternative := range alternatives {
@@ -566,7 +755,7 @@ func attemptToExtend(deploymentId, target string, targetLocation *publicUtils.Lo
 				delete(alternatives, newChildAddr)
 			} else {
 				var found bool
-				newChildAddr, found = getNodeCloserTo(targetLocation, maxHops, toExclude)
+				newChildAddr, found = s.getNodeCloserTo(targetLocation, maxHops, toExclude)
 				if found {
 					log.Debugf("trying %s", newChildAddr)
 				}
@@ -574,9 +763,15 @@ func attemptToExtend(deploymentId, target string, targetLocation *publicUtils.Lo
 		}
 
 		if newChildAddr != "" {
-			inVicinity := hTable.autonomicClient.IsNodeInVicinity(newChildAddr)
+			// the hint goes out as soon as the candidate is chosen, so the pull is ahead of the extension
+			if _, ok := hinted[newChildAddr]; !ok {
+				go s.sendPrePullHint(deploymentId, newChildAddr)
+				hinted[newChildAddr] = struct{}{}
+			}
+
+			inVicinity := s.hTable.autonomicClient.IsNodeInVicinity(newChildAddr)
 			if inVicinity {
-				success = extendDeployment(deploymentId, newChildAddr, grandchild)
+				success = s.extendDeployment(deploymentId, newChildAddr, grandchild)
 			} else {
 				toExclude[newChildAddr] = struct{}{}
 			}
@@ -584,33 +779,69 @@ func attemptToExtend(deploymentId, target string, targetLocation *publicUtils.Lo
 
 		if tries == 5 {
 			log.Errorf("failed to extend deployment %s", deploymentId)
-			newChildAddr = myself.Id
-			extendDeployment(deploymentId, newChildAddr, grandchild)
+			newChildAddr = s.myself.Id
+			s.extendDeployment(deploymentId, newChildAddr, grandchild)
 			return
 		}
 
 		tries++
-		extendTimer = time.NewTimer(extendAttemptTimeout * time.Second)
+		extendTimer = time.NewTimer(s.deployerConfig.ExtendAttemptInterval)
 		<-extendTimer.C
 	}
 }
 
-func extendDeployment(deploymentId, childAddr string, grandChild *utils.Node) bool {
-	dto, ok := hTable.deploymentToDTO(deploymentId)
+// sendPrePullHint tells the child to start pulling the deployment image, so it is already local, or at least
+// partially pulled, when the child starts the deployment instances
+func (s *Server) sendPrePullHint(deploymentId, childAddr string) {
+	if childAddr == s.myself.Id {
+		return
+	}
+
+	dto, ok := s.hTable.deploymentToDTO(deploymentId)
+	if !ok {
+		return
+	}
+
+	var deploymentYAML api.DeploymentYAML
+	err := yaml.Unmarshal(dto.DeploymentYAMLBytes, &deploymentYAML)
+	if err != nil {
+		log.Errorf("error reading deployment %s yaml: %s", deploymentId, err)
+		return
+	}
+
+	deployment, err := deploymentYAMLToDeployment(&deploymentYAML, dto.Static)
+	if err != nil {
+		log.Errorf("invalid deployment %s: %s", deploymentId, err)
+		return
+	}
+
+	if deployment.Image.PullPolicy == schedulerApi.ImagePullNever {
+		return
+	}
+
+	depClient := s.getDeployerClient(childAddr)
+	status := depClient.PrePullImage(deployment.Image)
+	if status != http.StatusOK {
+		log.Debugf("got status %d sending pre-pull hint for %s to %s", status, deploymentId, childAddr)
+	}
+}
+
+func (s *Server) extendDeployment(deploymentId, childAddr string, grandChild *utils.Node) bool {
+	dto, ok := s.hTable.deploymentToDTO(deploymentId)
 	if !ok {
 		log.Errorf("hierarchy table does not contain deployment %s", deploymentId)
 		return false
 	}
 
-	childGrandparent := hTable.getParent(deploymentId)
-	if childGrandparent != nil && childGrandparent.Id == myself.Id {
+	childGrandparent := s.hTable.getParent(deploymentId)
+	if childGrandparent != nil && childGrandparent.Id == s.myself.Id {
 		dto.Grandparent = nil
 	} else {
 		dto.Grandparent = childGrandparent
 	}
-	dto.Parent = myself
+	dto.Parent = s.myself
 
-	deployerHostPort := addPortToAddr(childAddr)
+	deployerHostPort := s.addPortToAddr(childAddr)
 
 	childId := childAddr
 
@@ -620,7 +851,7 @@ func extendDeployment(deploymentId, childAddr string, grandChild *utils.Node) bo
 
 	child := utils.NewNode(childId, childAddr)
 
-	depClient := deployer.NewDeployerClient(deployerHostPort)
+	depClient := s.getDeployerClient(deployerHostPort)
 	if grandChild != nil {
 		status := depClient.AskCanTakeChild(deploymentId, grandChild.Id)
 		if status == http.StatusConflict {
@@ -631,10 +862,10 @@ func extendDeployment(deploymentId, childAddr string, grandChild *utils.Node) bo
 		}
 	}
 
-	if childId != myself.Id {
-		status := depClient.AskCanTakeParent(deploymentId, myself.Id)
+	if childId != s.myself.Id {
+		status := depClient.AskCanTakeParent(deploymentId, s.myself.Id)
 		if status == http.StatusConflict {
-			log.Debugf("child %s, can not take me (%s) as new parent", childId, myself.Id)
+			log.Debugf("child %s, can not take me (%s) as new parent", childId, s.myself.Id)
 			return false
 		} else if status != http.StatusOK {
 			log.Debugf("got status code %d asking if %s could take me as parent", status, childId)
@@ -644,7 +875,8 @@ func extendDeployment(deploymentId, childAddr string, grandChild *utils.Node) bo
 	}
 
 	log.Debugf("extending deployment %s to %s", deploymentId, childId)
-	status := depClient.RegisterService(deploymentId, dto.Static, dto.DeploymentYAMLBytes, dto.Parent, dto.Grandparent)
+	status := depClient.RegisterService(deploymentId, dto.Static, dto.DeploymentYAMLBytes, dto.Parent, dto.Grandparent,
+		dto.Owner)
 	if status == http.StatusConflict {
 		log.Debugf("deployment %s is already present in %s", deploymentId, childId)
 	} else if status != http.StatusOK {
@@ -663,20 +895,13 @@ func extendDeployment(deploymentId, childAddr string, grandChild *utils.Node) bo
 	}
 
 	log.Debugf("extended %s to %s sucessfully", deploymentId, childId)
-	suspectedDeployments.Delete(deploymentId)
-	if child.Id != myself.Id {
-		hTable.addChild(deploymentId, child)
-		children.Store(childId, child)
+	s.suspectedDeployments.Delete(deploymentId)
+	if child.Id != s.myself.Id {
+		s.hTable.addChild(deploymentId, child)
+		s.children.Store(childId, child)
 	}
 
-	return true
-}
-
-func loadFallbackHostname(filename string) string {
-	fileBytes, err := ioutil.ReadFile(filename)
-	if err != nil {
-		panic(err)
-	}
+	s.emitEvent(api.EventExtended, deploymentId, child, nil)
 
-	return string(fileBytes)
+	return true
 }
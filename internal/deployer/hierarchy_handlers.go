@@ -3,21 +3,19 @@ package deployer
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
 	log "github.com/sirupsen/logrus"
 )
 
-func deadChildHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) deadChildHandler(_ http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 	deadChildId := utils.ExtractPathVar(r, nodeIdPathVar)
 
-	_, okChild := suspectedChild.Load(deadChildId)
+	_, okChild := s.suspectedChild.Load(deadChildId)
 	if okChild {
-		_, okDeployment := suspectedDeployments.Load(deploymentId)
+		_, okDeployment := s.suspectedDeployments.Load(deploymentId)
 		if okDeployment {
 			log.Debugf("%s deployment from %s reported as dead, but ignored, already negotiating", deploymentId,
 				deadChildId)
@@ -32,15 +30,18 @@ func deadChildHandler(_ http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Debugf("grandchild %s reported deployment %s from %s as dead", body.Grandchild.Id, deploymentId, deadChildId)
-	suspectedChild.Store(deadChildId, nil)
-	suspectedDeployments.Store(deploymentId, nil)
-	hTable.removeChild(deploymentId, deadChildId)
-	children.Delete(deadChildId)
+	s.suspectedChild.Store(deadChildId, nil)
+	s.suspectedDeployments.Store(deploymentId, nil)
+	s.hTable.removeChild(deploymentId, deadChildId)
+	s.children.Delete(deadChildId)
 
-	go attemptToExtend(deploymentId, "", body.Location, body.Grandchild, 0, body.Alternatives)
+	s.emitEvent(api.EventDeadChild, deploymentId, utils.NewNode(deadChildId, deadChildId),
+		map[string]string{"grandchild": body.Grandchild.Id})
+
+	go s.attemptToExtend(deploymentId, "", body.Location, body.Grandchild, 0, body.Alternatives)
 }
 
-func fallbackHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) fallbackHandler(_ http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
 	reqBody := api.FallbackRequestBody{}
@@ -52,14 +53,18 @@ func fallbackHandler(_ http.ResponseWriter, r *http.Request) {
 	log.Debugf("node %s is falling back from %f with deployment %s", reqBody.OrphanId, reqBody.OrphanLocation,
 		deploymentId)
 
-	go attemptToExtend(deploymentId, reqBody.OrphanId, reqBody.OrphanLocation, nil, maxHopsToLookFor, nil)
+	// the orphan keeps the deployment, so the node it is extended to takes it as a child, as with a dead child
+	orphan := utils.NewNode(reqBody.OrphanId, reqBody.OrphanId)
+	s.emitEvent(api.EventFallback, deploymentId, orphan, nil)
+
+	go s.attemptToExtend(deploymentId, "", reqBody.OrphanLocation, orphan, s.deployerConfig.MaxHopsToLookFor, nil)
 }
 
-func canTakeChildHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) canTakeChildHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 	possibleChild := utils.ExtractPathVar(r, nodeIdPathVar)
 
-	parent := hTable.getParent(deploymentId)
+	parent := s.hTable.getParent(deploymentId)
 	if parent == nil || possibleChild != parent.Id {
 		if parent == nil {
 			log.Debugf("can take child %s, parent is nil", possibleChild)
@@ -72,11 +77,19 @@ func canTakeChildHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func canTakeParentHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) canTakeParentHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 	possibleParent := utils.ExtractPathVar(r, nodeIdPathVar)
 
-	parent := hTable.getParent(deploymentId)
+	parent := s.hTable.getParent(deploymentId)
+
+	// the root has the deployment without a parent, and the nodes extending to it are below it in the tree
+	if parent == nil && s.hTable.hasDeployment(deploymentId) {
+		log.Debugf("rejecting parent %s, im the root", possibleParent)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
 	if parent == nil || parent.Id == possibleParent {
 		if parent == nil {
 			log.Debugf("can take %s as parent", possibleParent)
@@ -89,7 +102,7 @@ func canTakeParentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func takeChildHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) takeChildHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
 	child := &utils.Node{}
@@ -100,21 +113,21 @@ func takeChildHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugf("told to accept %s as child for deployment %s", child.Id, deploymentId)
 
-	parent := hTable.getParent(deploymentId)
+	parent := s.hTable.getParent(deploymentId)
 
-	depClient := deployer.NewDeployerClient(child.Addr + ":" + strconv.Itoa(deployer.Port))
-	status := depClient.WarnThatIAmParent(deploymentId, myself, parent)
+	depClient := s.getDeployerClient(child.Addr)
+	status := depClient.WarnThatIAmParent(deploymentId, s.myself, parent)
 	if status != http.StatusOK {
 		log.Errorf("got status %d while telling %s that im his parent", status, child.Id)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	hTable.addChild(deploymentId, child)
-	children.Store(child.Id, child)
+	s.hTable.addChild(deploymentId, child)
+	s.children.Store(child.Id, child)
 }
 
-func setGrandparentHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) setGrandparentHandler(_ http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
 	reqBody := api.SetGrandparentRequestBody{}
@@ -127,10 +140,10 @@ func setGrandparentHandler(_ http.ResponseWriter, r *http.Request) {
 
 	log.Debugf("setting %s as grandparent", grandparent.Id)
 
-	hTable.setDeploymentGrandparent(deploymentId, grandparent)
+	s.hTable.setDeploymentGrandparent(deploymentId, grandparent)
 }
 
-func iAmYourParentHandler(_ http.ResponseWriter, r *http.Request) {
+func (s *Server) iAmYourParentHandler(w http.ResponseWriter, r *http.Request) {
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
 	reqBody := api.IAmYourParentRequestBody{}
@@ -160,6 +173,11 @@ func iAmYourParentHandler(_ http.ResponseWriter, r *http.Request) {
 		panic("parent is nil")
 	}
 
+	if !s.security.TLS.IsRequestFrom(r, parent.Id) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
 	if grandparent != nil {
 		log.Debugf("told to accept %s as parent (%s grandparent) for deployment %s", parent.Id, grandparent.Id,
 			deploymentId)
@@ -168,16 +186,46 @@ func iAmYourParentHandler(_ http.ResponseWriter, r *http.Request) {
 		log.Debugf("told to accept %s as parent for deployment %s", parent.Id, deploymentId)
 	}
 
-	hTable.setDeploymentParent(deploymentId, parent)
-	hTable.setDeploymentGrandparent(deploymentId, grandparent)
-}
+	s.hTable.setDeploymentParent(deploymentId, parent)
+	s.hTable.setDeploymentGrandparent(deploymentId, grandparent)
+	if !s.pTable.hasParent(parent.Id) {
+		s.pTable.addParent(parent)
+	}
 
-func getHierarchyTableHandler(w http.ResponseWriter, _ *http.Request) {
-	utils.SendJSONReplyOK(w, hTable.toDTO())
+	s.emitEvent(api.EventReparented, deploymentId, parent, nil)
 }
 
-func parentAliveHandler(_ http.ResponseWriter, r *http.Request) {
-	parentId := utils.ExtractPathVar(r, nodeIdPathVar)
-	log.Debugf("parent %s is alive", parentId)
-	pTable.setParentUp(parentId)
+func (s *Server) getHierarchyTableHandler(w http.ResponseWriter, _ *http.Request) {
+	table := s.hTable.toDTO()
+
+	for _, deploymentId := range s.getLocalInstances() {
+		if entry, ok := table[deploymentId]; ok {
+			entry.NumInstances++
+		}
+	}
+
+	for deploymentId, entry := range table {
+		load, status := s.hTable.autonomicClient.GetLoadForService(deploymentId)
+		if status == http.StatusOK {
+			entry.Load = load
+		}
+
+		if entry.Parent != nil {
+			entry.ParentStatus = s.parentsDetector.status(entry.Parent.Id)
+		}
+
+		for childId := range entry.Children {
+			if childStatus := s.childrenDetector.status(childId); childStatus != "" {
+				if entry.ChildrenStatus == nil {
+					entry.ChildrenStatus = map[string]string{}
+				}
+				entry.ChildrenStatus[childId] = childStatus
+			}
+		}
+	}
+
+	var resp api.GetHierarchyTableResponseBody
+	resp = table
+
+	utils.SendJSONReplyOK(w, resp)
 }
@@ -0,0 +1,129 @@
+package deployer
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
+)
+
+const (
+	testDeploymentId = "dep"
+	testTimeout      = 5 * time.Second
+)
+
+var testDeploymentYAML = []byte(`
+spec:
+  serviceName: dep
+  template:
+    spec:
+      containers:
+        - image: dummy
+`)
+
+// addTestDeployment adds the deployment to the hierarchy table of the deployer, as the root if parent is nil
+func addTestDeployment(s *Server, parent *utils.Node) {
+	s.hTable.addDeployment(&api.DeploymentDTO{
+		DeploymentId:        testDeploymentId,
+		DeploymentYAMLBytes: testDeploymentYAML,
+		Parent:              parent,
+	})
+}
+
+// waitFor fails the test if the condition does not hold within testTimeout
+func waitFor(t *testing.T, condition func() bool, format string, args ...interface{}) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCanTakeParent(t *testing.T) {
+	servers, _ := newTestDeployers(t, nil, "n0", "n1", "n2")
+
+	addTestDeployment(servers["n0"], nil)
+	addTestDeployment(servers["n1"], servers["n0"].myself)
+
+	tests := []struct {
+		nodeId   string
+		parentId string
+		expected int
+	}{
+		{nodeId: "n0", parentId: "n1", expected: http.StatusConflict},
+		{nodeId: "n1", parentId: "n0", expected: http.StatusOK},
+		{nodeId: "n1", parentId: "n2", expected: http.StatusConflict},
+		{nodeId: "n2", parentId: "n1", expected: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		status := servers["n2"].getDeployerClient(test.nodeId).AskCanTakeParent(testDeploymentId, test.parentId)
+		if status != test.expected {
+			t.Errorf("expected %s to reply %d when asked to take %s as parent, got %d", test.nodeId, test.expected,
+				test.parentId, status)
+		}
+	}
+}
+
+func TestFallbackAdoptsOrphan(t *testing.T) {
+	servers, _ := newTestDeployers(t, func(_ string, conf *config.Config) {
+		conf.Deployer.ExtendAttemptInterval = 10 * time.Millisecond
+	}, "n0", "n2")
+
+	root, orphan := servers["n0"], servers["n2"]
+
+	addTestDeployment(root, nil)
+	addTestDeployment(orphan, utils.NewNode("n1", "n1"))
+	orphan.hTable.setDeploymentAsOrphan(testDeploymentId)
+
+	status := orphan.getDeployerClient("n0").Fallback(testDeploymentId, "n2", &publicUtils.Location{})
+	if status != http.StatusOK {
+		t.Fatalf("expected the fallback to be accepted, got %d", status)
+	}
+
+	// there is no other node to extend to, so the fallback ends up taking the orphan as a child itself
+	waitFor(t, func() bool {
+		_, ok := root.hTable.getChildren(testDeploymentId)["n2"]
+		return ok
+	}, "expected n0 to take n2 as a child")
+
+	parent := orphan.hTable.getParent(testDeploymentId)
+	if parent == nil || parent.Id != "n0" {
+		t.Fatalf("expected n2 to have n0 as parent, got %+v", parent)
+	}
+
+	entry, _ := orphan.hTable.getEntryDTO(testDeploymentId)
+	if entry.IsOrphan {
+		t.Fatal("expected n2 not to be an orphan anymore")
+	}
+}
+
+func TestNewParentArrivingLate(t *testing.T) {
+	servers, _ := newTestDeployers(t, nil, "n0")
+	s := servers["n0"]
+
+	addTestDeployment(s, utils.NewNode("n1", "n1"))
+	s.hTable.setDeploymentAsOrphan(testDeploymentId)
+
+	// nobody waits for the new parent anymore, as if the wait had timed out
+	done := make(chan struct{})
+	go func() {
+		s.hTable.setDeploymentParent(testDeploymentId, utils.NewNode("n2", "n2"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("expected setting the new parent not to block")
+	}
+}
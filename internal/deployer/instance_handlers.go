@@ -6,16 +6,17 @@ import (
 	"sync"
 
 	archimedes2 "github.com/bruno-anjos/cloud-edge-deployment/api/archimedes"
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
 	log "github.com/sirupsen/logrus"
 )
 
-func registerServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) registerServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("handling request in registerServiceInstance handler")
 
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
-	ok := hTable.hasDeployment(deploymentId)
+	ok := s.hTable.hasDeployment(deploymentId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -32,10 +33,10 @@ func registerServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 
 	if !instanceDTO.Static {
 		initChan := make(chan struct{})
-		initChansMap.Store(instanceId, initChan)
-		go cleanUnresponsiveInstance(deploymentId, instanceId, &instanceDTO, initChan)
+		s.initChansMap.Store(instanceId, initChan)
+		go s.cleanUnresponsiveInstance(deploymentId, instanceId, &instanceDTO, initChan)
 	} else {
-		status := archimedesClient.RegisterServiceInstance(deploymentId, instanceId, instanceDTO.Static,
+		status := s.archimedesClient.RegisterServiceInstance(deploymentId, instanceId, instanceDTO.Static,
 			instanceDTO.PortTranslation, instanceDTO.Local)
 		if status != http.StatusOK {
 			log.Debugf("got status %d while adding instance %s to archimedes", status, instanceId)
@@ -43,10 +44,36 @@ func registerServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		log.Debugf("warned archimedes that instance %s from service %s exists", instanceId, deploymentId)
+
+		s.instanceRegistered(deploymentId)
+	}
+}
+
+// deleteServiceInstanceHandler removes an instance the scheduler no longer has a container for, so it is not
+// expected anymore
+func (s *Server) deleteServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
+
+	ok := s.hTable.hasDeployment(deploymentId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	log.Debugf("removing instance %s from deployment %s", instanceId, deploymentId)
+
+	s.initChansMap.Delete(instanceId)
+	s.heartbeatsMap.Delete(instanceId)
+	s.hTable.setInstanceCrashLooping(deploymentId, instanceId, false)
+
+	status := s.archimedesClient.DeleteServiceInstance(deploymentId, instanceId)
+	if status != http.StatusOK && status != http.StatusNotFound {
+		log.Warnf("got status %d while removing instance %s from archimedes", status, instanceId)
 	}
 }
 
-func registerHeartbeatServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) registerHeartbeatServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 	serviceId := utils.ExtractPathVar(r, deploymentIdPathVar)
 	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
 
@@ -56,35 +83,117 @@ func registerHeartbeatServiceInstanceHandler(w http.ResponseWriter, r *http.Requ
 		Mutex:     &sync.Mutex{},
 	}
 
-	_, loaded := heartbeatsMap.LoadOrStore(instanceId, pairServiceStatus)
-	if loaded {
-		w.WriteHeader(http.StatusConflict)
-		return
-	}
-
-	value, initChanOk := initChansMap.Load(instanceId)
+	// checked before storing the heartbeat so unexpected instances (e.g. static ones) are not tracked
+	value, initChanOk := s.initChansMap.Load(instanceId)
 	if !initChanOk {
+		if _, ok := s.heartbeatsMap.Load(instanceId); ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
 		log.Warnf("ignoring heartbeat from instance %s since it didnt have an init channel", instanceId)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
+	_, loaded := s.heartbeatsMap.LoadOrStore(instanceId, pairServiceStatus)
+	if loaded {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
 	initChan := value.(typeInitChansMapValue)
 	close(initChan)
+	s.initChansMap.Delete(instanceId)
 
 	log.Debugf("registered service %s instance %s first heartbeat", serviceId, instanceId)
 }
 
-func heartbeatServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) instanceHealthHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
+
+	ok := s.hTable.hasDeployment(deploymentId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var reqBody api.InstanceHealthRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.Failed {
+		log.Warnf("instance %s from deployment %s failed to start: %s", instanceId, deploymentId, reqBody.Reason)
+
+		// the instance never comes up, so the deployment stays unhealthy in this node until it is removed
+		s.hTable.setInstanceCrashLooping(deploymentId, instanceId, true)
+		s.emitEvent(api.EventInstanceFailed, deploymentId, s.myself, map[string]string{
+			"instance": instanceId,
+			"reason":   reqBody.Reason,
+		})
+		s.instanceFailed(deploymentId)
+
+		return
+	}
+
+	if reqBody.CrashLooping {
+		log.Warnf("instance %s from deployment %s is crash looping", instanceId, deploymentId)
+	} else {
+		log.Debugf("instance %s from deployment %s recovered", instanceId, deploymentId)
+	}
+
+	s.hTable.setInstanceCrashLooping(deploymentId, instanceId, reqBody.CrashLooping)
+}
+
+func (s *Server) getInstancesHandler(w http.ResponseWriter, _ *http.Request) {
+	var instances api.GetInstancesResponseBody
+	instances = s.getLocalInstances()
+
+	utils.SendJSONReplyOK(w, instances)
+}
+
+// getLocalInstances returns the deployment of each instance running in this node
+func (s *Server) getLocalInstances() map[string]string {
+	instances := map[string]string{}
+
+	for _, deploymentId := range s.hTable.getDeployments() {
+		deploymentInstances, status := s.archimedesClient.GetService(deploymentId)
+		if status != http.StatusOK {
+			continue
+		}
+
+		for instanceId, instance := range deploymentInstances {
+			if instance.Local {
+				instances[instanceId] = deploymentId
+			}
+		}
+	}
+
+	// instances that are heartbeating but may not be registered in archimedes yet
+	s.heartbeatsMap.Range(func(key, value interface{}) bool {
+		instanceId := key.(typeHeartbeatsMapKey)
+		pairServiceStatus := value.(typeHeartbeatsMapValue)
+		instances[instanceId] = pairServiceStatus.ServiceId
+		return true
+	})
+
+	return instances
+}
+
+func (s *Server) heartbeatServiceInstanceHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("handling request in heartbeatService handler")
 
 	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
 
-	hTable.hasDeployment(deploymentId)
+	s.hTable.hasDeployment(deploymentId)
 
 	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
 
-	value, ok := heartbeatsMap.Load(instanceId)
+	value, ok := s.heartbeatsMap.Load(instanceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -2,7 +2,6 @@ package deployer
 
 import (
 	"net/http"
-	"sync"
 	"time"
 
 	archimedes2 "github.com/bruno-anjos/cloud-edge-deployment/api/archimedes"
@@ -21,46 +20,41 @@ const (
 	initInstanceTimeout = 30 * time.Second
 )
 
-var (
-	heartbeatsMap sync.Map
-	initChansMap  sync.Map
-)
-
-func init() {
-	heartbeatsMap = sync.Map{}
-	initChansMap = sync.Map{}
-
-	go instanceHeartbeatChecker()
-}
-
-func cleanUnresponsiveInstance(serviceId, instanceId string, instanceDTO *archimedes2.InstanceDTO,
+func (s *Server) cleanUnresponsiveInstance(serviceId, instanceId string, instanceDTO *archimedes2.InstanceDTO,
 	alive <-chan struct{}) {
 	unresponsiveTimer := time.NewTimer(initInstanceTimeout)
 
 	select {
 	case <-alive:
 		log.Debugf("instance %s is up", instanceId)
-		status := archimedesClient.RegisterServiceInstance(serviceId, instanceId, instanceDTO.Static,
+		status := s.archimedesClient.RegisterServiceInstance(serviceId, instanceId, instanceDTO.Static,
 			instanceDTO.PortTranslation, instanceDTO.Local)
 		if status != http.StatusOK {
 			log.Errorf("got status %d while registering service %s instance %s", status, serviceId, instanceId)
+			return
 		}
 
+		s.instanceRegistered(serviceId)
 		return
 	case <-unresponsiveTimer.C:
-		removeInstance(serviceId, instanceId)
+		s.removeInstance(serviceId, instanceId)
 	}
 }
 
-func instanceHeartbeatChecker() {
+func (s *Server) instanceHeartbeatChecker() {
 	heartbeatTimer := time.NewTimer(deployer.HeartbeatCheckerTimeout * time.Second)
 
 	var toDelete []string
 	for {
 		toDelete = []string{}
-		<-heartbeatTimer.C
+		select {
+		case <-s.Stopped():
+			return
+		case <-heartbeatTimer.C:
+		}
+
 		log.Debug("checking heartbeats")
-		heartbeatsMap.Range(func(key, value interface{}) bool {
+		s.heartbeatsMap.Range(func(key, value interface{}) bool {
 			instanceId := key.(typeHeartbeatsMapKey)
 			pairServiceStatus := value.(typeHeartbeatsMapValue)
 			pairServiceStatus.Mutex.Lock()
@@ -68,7 +62,7 @@ func instanceHeartbeatChecker() {
 			// case where instance didnt set online status since last status reset, so it has to be removed
 			if !pairServiceStatus.IsUp {
 				pairServiceStatus.Mutex.Unlock()
-				removeInstance(pairServiceStatus.ServiceId, instanceId)
+				s.removeInstance(pairServiceStatus.ServiceId, instanceId)
 
 				toDelete = append(toDelete, instanceId)
 				log.Debugf("removing instance %s", instanceId)
@@ -82,20 +76,22 @@ func instanceHeartbeatChecker() {
 
 		for _, instanceId := range toDelete {
 			log.Debugf("removing %s instance from expected hearbeats map", instanceId)
-			heartbeatsMap.Delete(instanceId)
+			s.heartbeatsMap.Delete(instanceId)
 		}
 		heartbeatTimer.Reset(deployer.HeartbeatCheckerTimeout * time.Second)
 	}
 }
 
-func removeInstance(serviceId, instanceId string) {
-	status := schedulerClient.StopInstance(instanceId)
+func (s *Server) removeInstance(serviceId, instanceId string) {
+	s.hTable.setInstanceCrashLooping(serviceId, instanceId, false)
+
+	status := s.schedulerClient.StopInstance(instanceId)
 	if status != http.StatusOK {
 		log.Warnf("while trying to remove instance %s after timeout, scheduler returned status %d",
 			instanceId, status)
 	}
 
-	status = archimedesClient.DeleteServiceInstance(serviceId, instanceId)
+	status = s.archimedesClient.DeleteServiceInstance(serviceId, instanceId)
 	if status != http.StatusOK {
 		log.Warnf("while trying to remove instance %s after timeout, archimedes returned status %d",
 			instanceId, status)
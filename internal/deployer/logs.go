@@ -0,0 +1,88 @@
+package deployer
+
+import (
+	"io"
+	"net/http"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	schedulerApi "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// getDeploymentLogsHandler streams the logs of an instance of the deployment. If the instance does not run
+// in this node, the request is proxied down the hierarchy to the children of the deployment, one at a time,
+// until one of them has it.
+func (s *Server) getDeploymentLogsHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+	instanceId := r.URL.Query().Get(api.InstanceQueryParam)
+
+	options, err := schedulerApi.LogsOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		log.Debug(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !s.hTable.hasDeployment(deploymentId) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	log.Debugf("handling logs of deployment %s (instance %q)", deploymentId, instanceId)
+
+	logs, status := s.getLocalInstanceLogs(deploymentId, instanceId, options)
+	if status == http.StatusNotFound {
+		logs, status = s.getChildrenInstanceLogs(deploymentId, instanceId, options)
+	}
+
+	switch {
+	case status == http.StatusOK:
+	case status > 0:
+		w.WriteHeader(status)
+		return
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = utils.SendStreamReplyOK(w, r, "text/plain", logs)
+	if err != nil {
+		log.Debugf("error streaming logs of deployment %s: %s", deploymentId, err)
+	}
+}
+
+func (s *Server) getLocalInstanceLogs(deploymentId, instanceId string, options *schedulerApi.LogsOptionsDTO) (
+	io.ReadCloser, int) {
+	if instanceId == "" {
+		for localInstanceId, localDeploymentId := range s.getLocalInstances() {
+			if localDeploymentId == deploymentId {
+				instanceId = localInstanceId
+				break
+			}
+		}
+
+		if instanceId == "" {
+			return nil, http.StatusNotFound
+		}
+	}
+
+	return s.schedulerClient.GetInstanceLogs(instanceId, options)
+}
+
+func (s *Server) getChildrenInstanceLogs(deploymentId, instanceId string, options *schedulerApi.LogsOptionsDTO) (
+	io.ReadCloser, int) {
+	for childId, child := range s.hTable.getChildren(deploymentId) {
+		depClient := s.getDeployerClient(child.Addr)
+		logs, status := depClient.GetDeploymentLogs(deploymentId, instanceId, options)
+		switch status {
+		case http.StatusOK:
+			return logs, status
+		case http.StatusNotFound:
+		default:
+			log.Debugf("got status %d asking %s for logs of %s", status, childId, deploymentId)
+		}
+	}
+
+	return nil, http.StatusNotFound
+}
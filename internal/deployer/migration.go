@@ -0,0 +1,218 @@
+package deployer
+
+import (
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	schedulerApi "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	typeMigrationsMapValue = *migration
+
+	migration struct {
+		Origin  *utils.Node
+		Pending int32
+		// done is set once the migration finishes or is aborted, whichever happens first
+		done     int32
+		deadline *time.Timer
+	}
+)
+
+// Ran by the parent of the origin. The target is registered as a new child which takes over the deployment
+// from the origin, only after its instances are up the origin is removed.
+func (s *Server) migrateDeployment(deploymentId string, origin, target *utils.Node) {
+	dto, ok := s.hTable.deploymentToDTO(deploymentId)
+	if !ok {
+		log.Errorf("hierarchy table does not contain deployment %s", deploymentId)
+		return
+	}
+
+	targetGrandparent := s.hTable.getParent(deploymentId)
+	if targetGrandparent != nil && targetGrandparent.Id == s.myself.Id {
+		targetGrandparent = nil
+	}
+
+	log.Debugf("migrating deployment %s from %s to %s", deploymentId, origin.Id, target.Id)
+
+	depClient := s.getDeployerClient(target.Addr)
+	status := depClient.RegisterMigratedService(deploymentId, dto.Static, dto.DeploymentYAMLBytes, s.myself,
+		targetGrandparent, origin, dto.Owner)
+	if status != http.StatusOK {
+		log.Errorf("got status %d while migrating deployment %s to %s", status, deploymentId, target.Id)
+		return
+	}
+
+	s.hTable.addChild(deploymentId, target)
+	s.children.Store(target.Id, target)
+
+	s.emitEvent(api.EventMigrated, deploymentId, target, map[string]string{"origin": origin.Id})
+}
+
+// Ran by the target of a migration. Instances are started with the volumes of the origin instances,
+// when all of them are registered in archimedes the origin is redirected and then stopped.
+func (s *Server) takeOverDeploymentAsync(deployment *Deployment, deploymentId string, origin *utils.Node) {
+	log.Debugf("taking over deployment %s from %s", deploymentId, origin.Id)
+
+	envVars, ok := s.resolveEnvVars(deploymentId, deployment)
+	if !ok {
+		s.leaveDeployment(deploymentId)
+		return
+	}
+
+	originArchimedesClient := s.archimedesClients.Get(s.config.Archimedes.Addr(origin.Addr))
+	originInstances, status := originArchimedesClient.GetService(deploymentId)
+	if status != http.StatusOK {
+		log.Errorf("got status %d while requesting %s instances from %s", status, deploymentId, origin.Id)
+		if len(deployment.Volumes) > 0 {
+			s.leaveDeployment(deploymentId)
+			return
+		}
+	}
+
+	var originInstanceIds []string
+	for instanceId, instance := range originInstances {
+		if instance.Local {
+			originInstanceIds = append(originInstanceIds, instanceId)
+		}
+	}
+	sort.Strings(originInstanceIds)
+
+	status = s.archimedesClient.RegisterService(deploymentId, deployment.Ports)
+	if status != http.StatusOK {
+		log.Errorf("got status code %d from archimedes", status)
+		s.leaveDeployment(deploymentId)
+		return
+	}
+
+	if deployment.NumberOfInstances == 0 {
+		s.hTable.setLinkOnly(deploymentId, false)
+		go s.finishMigration(deploymentId, origin)
+		return
+	}
+
+	m := &migration{
+		Origin:  origin,
+		Pending: int32(deployment.NumberOfInstances),
+	}
+	s.migrations.Store(deploymentId, m)
+
+	// instances start asynchronously, so the ones failing to pull or restore their volumes are never registered
+	m.deadline = time.AfterFunc(s.deployerConfig.MigrationTimeout, func() {
+		if m.end() {
+			log.Errorf("instances of %s did not come up in %s", deploymentId, s.deployerConfig.MigrationTimeout)
+			s.abortMigration(deploymentId, m)
+		}
+	})
+
+	originSchedulerAddr := s.config.Scheduler.Addr(origin.Addr)
+
+	for i := 0; i < deployment.NumberOfInstances; i++ {
+		var snapshot *schedulerApi.SnapshotDTO
+		if len(deployment.Volumes) > 0 && i < len(originInstanceIds) {
+			snapshot = &schedulerApi.SnapshotDTO{
+				SchedulerAddr: originSchedulerAddr,
+				InstanceId:    originInstanceIds[i],
+			}
+		}
+
+		status = s.schedulerClient.StartInstance(deploymentId, deployment.Image, deployment.Ports, deployment.Static,
+			envVars, deployment.Volumes, deployment.ConfigMaps, snapshot, deployment.RestartPolicy)
+		if status != http.StatusOK {
+			log.Errorf("got status code %d from scheduler", status)
+
+			if m.end() {
+				s.abortMigration(deploymentId, m)
+			}
+
+			return
+		}
+	}
+
+	s.hTable.setLinkOnly(deploymentId, false)
+}
+
+func (s *Server) instanceRegistered(deploymentId string) {
+	value, ok := s.migrations.Load(deploymentId)
+	if !ok {
+		return
+	}
+
+	m := value.(typeMigrationsMapValue)
+	if atomic.AddInt32(&m.Pending, -1) == 0 && m.end() {
+		s.migrations.Delete(deploymentId)
+		go s.finishMigration(deploymentId, m.Origin)
+	}
+}
+
+// instanceFailed aborts the migration of the deployment, if any, since one of its instances will never come up
+func (s *Server) instanceFailed(deploymentId string) {
+	value, ok := s.migrations.Load(deploymentId)
+	if !ok {
+		return
+	}
+
+	m := value.(typeMigrationsMapValue)
+	if m.end() {
+		go s.abortMigration(deploymentId, m)
+	}
+}
+
+// end ends the migration, returning whether it was still going on
+func (m *migration) end() bool {
+	if !atomic.CompareAndSwapInt32(&m.done, 0, 1) {
+		return false
+	}
+
+	if m.deadline != nil {
+		m.deadline.Stop()
+	}
+
+	return true
+}
+
+// abortMigration drops the deployment from the target, which leaves the parent and its instances, so the origin,
+// which was not redirected yet, keeps serving
+func (s *Server) abortMigration(deploymentId string, m *migration) {
+	log.Warnf("aborting migration of %s from %s", deploymentId, m.Origin.Id)
+
+	s.migrations.Delete(deploymentId)
+
+	s.leaveDeployment(deploymentId)
+	s.deleteDeploymentAsync(deploymentId)
+}
+
+// leaveDeployment undoes the registration of the deployment in the target, removing it from the hierarchy table and
+// from the children of its parent
+func (s *Server) leaveDeployment(deploymentId string) {
+	if parent := s.hTable.getParent(deploymentId); parent != nil {
+		status := s.getDeployerClient(parent.Addr).ChildDeletedDeployment(deploymentId, s.myself.Id)
+		if status != http.StatusOK {
+			log.Errorf("got status %d while leaving %s in %s", status, deploymentId, parent.Id)
+		}
+		s.pTable.decreaseParentCount(parent.Id)
+	}
+
+	s.hTable.removeDeployment(deploymentId)
+}
+
+func (s *Server) finishMigration(deploymentId string, origin *utils.Node) {
+	log.Debugf("instances for %s are up, switching from %s", deploymentId, origin.Id)
+
+	originArchimedesClient := s.archimedesClients.Get(s.config.Archimedes.Addr(origin.Addr))
+	status := originArchimedesClient.Redirect(deploymentId, s.myself.Id, -1)
+	if status != http.StatusOK {
+		log.Errorf("got status %d while redirecting %s from %s", status, deploymentId, origin.Id)
+	}
+
+	originClient := s.getDeployerClient(origin.Addr)
+	status = originClient.DeleteMigratedService(deploymentId)
+	if status != http.StatusOK {
+		log.Errorf("got status %d while deleting %s from %s", status, deploymentId, origin.Id)
+	}
+}
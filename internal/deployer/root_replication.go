@@ -0,0 +1,608 @@
+package deployer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Timeouts of the election of the leader of the root replicas
+const (
+	rootHeartbeatInterval  = 500 * time.Millisecond
+	rootElectionTimeoutMin = 2 * time.Second
+	rootElectionTimeoutMax = 4 * time.Second
+	rootElectionTick       = 100 * time.Millisecond
+	rootRPCTimeout         = 400 * time.Millisecond
+)
+
+// Roles of a root replica
+const (
+	rootFollower = iota
+	rootCandidate
+	rootLeader
+)
+
+// rootReplicationState is the state of a replica that survives restarts. LastTerm and Version identify the
+// roots it has, the same way the last log entry does in Raft, so only replicas with the latest roots are
+// elected.
+type rootReplicationState struct {
+	Term     uint64
+	VotedFor string
+	LastTerm uint64
+	Version  uint64
+	Roots    map[string]*api.ReplicatedRootDTO
+}
+
+// rootReplication elects a leader among the root replicas, Raft style, which is the root of every deployment
+// registered in any of them. The leader replicates the entries of its roots in its heartbeats and, when it
+// fails, the replica elected next takes the deployments over and tells their children it is their parent.
+type rootReplication struct {
+	rootReplicationState
+
+	filename        string
+	replicas        []string
+	isReplica       bool
+	role            int
+	leaderId        string
+	lastContact     time.Time
+	electionTimeout time.Duration
+	random          *rand.Rand
+	lock            sync.Mutex
+	server          *Server
+}
+
+func (s *Server) loadRootReplication(replicasValue, filename string) *rootReplication {
+	if replicasValue == "" {
+		log.Info("no root replicas, roots are not replicated")
+		return nil
+	}
+
+	r := &rootReplication{
+		filename:    filename,
+		lastContact: time.Now(),
+		random:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		server:      s,
+	}
+	r.electionTimeout = r.randomElectionTimeout()
+
+	for _, replicaId := range strings.Split(replicasValue, ",") {
+		replicaId = strings.TrimSpace(replicaId)
+		if replicaId == "" {
+			continue
+		}
+
+		r.replicas = append(r.replicas, replicaId)
+		if replicaId == s.myself.Id {
+			r.isReplica = true
+		}
+	}
+
+	if !r.isReplica {
+		log.Infof("root replicas are %+v", r.replicas)
+		return r
+	}
+
+	fileBytes, err := ioutil.ReadFile(filename)
+	if err == nil {
+		err = json.Unmarshal(fileBytes, &r.rootReplicationState)
+		if err != nil {
+			panic(errors.Wrap(err, "error decoding root replication state"))
+		}
+	} else if !os.IsNotExist(err) {
+		panic(errors.Wrap(err, "error reading root replication state"))
+	}
+
+	log.Infof("replica of the root among %+v, in term %d", r.replicas, r.Term)
+
+	return r
+}
+
+// randomElectionTimeout spreads the elections of the replicas so they do not keep splitting the votes. Must be
+// called with the lock held.
+func (r *rootReplication) randomElectionTimeout() time.Duration {
+	return rootElectionTimeoutMin + time.Duration(r.random.Int63n(int64(rootElectionTimeoutMax-rootElectionTimeoutMin)))
+}
+
+func (r *rootReplication) isLeader() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.isReplica && r.role == rootLeader
+}
+
+func (r *rootReplication) isMajority(numReplicas int) bool {
+	return numReplicas > len(r.replicas)/2
+}
+
+// run starts elections when the leader is not heard from and, while leading, sends the heartbeats
+func (r *rootReplication) run() {
+	for !r.server.IsStopped() {
+		r.lock.Lock()
+		role := r.role
+		electionDue := time.Since(r.lastContact) > r.electionTimeout
+		r.lock.Unlock()
+
+		switch {
+		case role == rootLeader:
+			r.replicate()
+			r.server.Sleep(rootHeartbeatInterval)
+		case electionDue:
+			r.startElection()
+		default:
+			r.server.Sleep(rootElectionTick)
+		}
+	}
+}
+
+func (r *rootReplication) startElection() {
+	r.lock.Lock()
+	r.Term++
+	r.role = rootCandidate
+	r.VotedFor = r.server.myself.Id
+	r.leaderId = ""
+	r.lastContact = time.Now()
+	r.electionTimeout = r.randomElectionTimeout()
+	r.save()
+
+	term, lastTerm, version := r.Term, r.LastTerm, r.Version
+	r.lock.Unlock()
+
+	log.Debugf("starting root election for term %d", term)
+
+	votes, maxTerm := r.broadcast(func(depClient *deployer.Client) (bool, uint64, int) {
+		return depClient.RequestRootVote(term, r.server.myself.Id, lastTerm, version, rootRPCTimeout)
+	})
+
+	r.lock.Lock()
+	if maxTerm > r.Term {
+		r.stepDown(maxTerm)
+		r.save()
+		r.lock.Unlock()
+		return
+	}
+
+	if r.role != rootCandidate || r.Term != term || !r.isMajority(votes+1) {
+		r.lock.Unlock()
+		return
+	}
+
+	r.role = rootLeader
+	r.leaderId = r.server.myself.Id
+	r.LastTerm = term
+	r.save()
+
+	roots := r.Roots
+	r.lock.Unlock()
+
+	log.Infof("leading root replicas in term %d", term)
+
+	r.server.adoptRoots(roots)
+	r.replicate()
+}
+
+// replicate sends the roots of this node, while leading, to the other replicas. It returns whether a majority
+// of the replicas has them.
+func (r *rootReplication) replicate() bool {
+	roots := r.server.getLocalRoots()
+
+	r.lock.Lock()
+	if r.role != rootLeader {
+		r.lock.Unlock()
+		return false
+	}
+
+	if !reflect.DeepEqual(roots, r.Roots) {
+		r.Version++
+		r.Roots = roots
+		r.save()
+	}
+
+	term, version := r.Term, r.Version
+	r.lock.Unlock()
+
+	acks, maxTerm := r.broadcast(func(depClient *deployer.Client) (bool, uint64, int) {
+		return depClient.AppendRoots(term, r.server.myself.Id, version, roots, rootRPCTimeout)
+	})
+
+	r.lock.Lock()
+	if maxTerm > r.Term {
+		wasLeader := r.stepDown(maxTerm)
+		r.save()
+		r.lock.Unlock()
+
+		if wasLeader {
+			r.server.demoteRoots()
+		}
+
+		return false
+	}
+	r.lock.Unlock()
+
+	return r.isMajority(acks + 1)
+}
+
+// broadcast calls every other replica in parallel, returning how many replied with success and the highest
+// term in the replies
+func (r *rootReplication) broadcast(call func(depClient *deployer.Client) (bool, uint64, int)) (int, uint64) {
+	var (
+		acks    int
+		maxTerm uint64
+		lock    sync.Mutex
+		wg      sync.WaitGroup
+	)
+
+	for _, replicaId := range r.replicas {
+		if replicaId == r.server.myself.Id {
+			continue
+		}
+
+		wg.Add(1)
+		go func(replicaId string) {
+			defer wg.Done()
+
+			ok, replyTerm, status := call(r.server.getDeployerClient(replicaId))
+			if status != http.StatusOK {
+				log.Debugf("got status %d from root replica %s", status, replicaId)
+				return
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if ok {
+				acks++
+			}
+
+			if replyTerm > maxTerm {
+				maxTerm = replyTerm
+			}
+		}(replicaId)
+	}
+
+	wg.Wait()
+
+	return acks, maxTerm
+}
+
+// stepDown makes the replica follow in the term, returning whether it was leading. Must be called with the
+// lock held.
+func (r *rootReplication) stepDown(term uint64) bool {
+	if term > r.Term {
+		r.Term = term
+		r.VotedFor = ""
+	}
+
+	wasLeader := r.role == rootLeader
+	r.role = rootFollower
+
+	if wasLeader {
+		log.Infof("stepping down from leading root replicas in term %d", r.Term)
+		r.leaderId = ""
+	}
+
+	return wasLeader
+}
+
+// save writes to a temporary file that then replaces the previous one. Must be called with the lock held.
+func (r *rootReplication) save() {
+	stateBytes, err := json.Marshal(r.rootReplicationState)
+	if err != nil {
+		panic(err)
+	}
+
+	tmpFilename := r.filename + ".tmp"
+	err = ioutil.WriteFile(tmpFilename, stateBytes, 0600)
+	if err == nil {
+		err = os.Rename(tmpFilename, r.filename)
+	}
+
+	if err != nil {
+		log.Errorf("error saving root replication state: %s", err)
+	}
+}
+
+// findLeader returns the replica leading, other than the excluded one, asking the replicas if this node does
+// not know it. It returns an empty id if there is no leader yet.
+func (r *rootReplication) findLeader(exclude string) string {
+	r.lock.Lock()
+	if r.role == rootLeader && r.isReplica {
+		r.lock.Unlock()
+		return r.server.myself.Id
+	}
+
+	if r.leaderId != "" && r.leaderId != exclude && time.Since(r.lastContact) < rootElectionTimeoutMax {
+		leaderId := r.leaderId
+		r.lock.Unlock()
+		return leaderId
+	}
+	r.lock.Unlock()
+
+	for _, replicaId := range r.replicas {
+		if replicaId == r.server.myself.Id || replicaId == exclude {
+			continue
+		}
+
+		depClient := r.server.getDeployerClient(replicaId)
+		leader, status := depClient.GetRootLeader(rootRPCTimeout)
+		if status == http.StatusOK && leader.LeaderId != "" && leader.LeaderId != exclude {
+			return leader.LeaderId
+		}
+	}
+
+	return ""
+}
+
+// getFallbackAddr returns where orphans of the root go, the leader of the root replicas if there is one and
+// a live fallback otherwise
+func (s *Server) getFallbackAddr(deadParentId string) string {
+	if s.rootReplicas != nil {
+		if leaderId := s.rootReplicas.findLeader(deadParentId); leaderId != "" {
+			return leaderId
+		}
+	}
+
+	return s.fallbacks.pick(deadParentId)
+}
+
+// getLocalRoots returns the entries of the deployments this node is the root of
+func (s *Server) getLocalRoots() map[string]*api.ReplicatedRootDTO {
+	roots := map[string]*api.ReplicatedRootDTO{}
+
+	for deploymentId, entry := range s.hTable.toDTO() {
+		if entry.Parent != nil {
+			continue
+		}
+
+		dto, ok := s.hTable.deploymentToDTO(deploymentId)
+		if !ok {
+			continue
+		}
+
+		roots[deploymentId] = &api.ReplicatedRootDTO{
+			Static:              dto.Static,
+			DeploymentYAMLBytes: dto.DeploymentYAMLBytes,
+			Owner:               dto.Owner,
+			Children:            entry.Children,
+		}
+	}
+
+	return roots
+}
+
+// adoptRoots makes this node, the new leader, the root of the replicated deployments, telling their children it
+// is their new parent. A deployment this node has below the old root is promoted, since its parent was the old
+// leader, while one it has deeper in the tree is left as it is.
+func (s *Server) adoptRoots(roots map[string]*api.ReplicatedRootDTO) {
+	for deploymentId, root := range roots {
+		if s.hTable.hasDeployment(deploymentId) {
+			if _, ok := root.Children[s.myself.Id]; ok && s.hTable.getParent(deploymentId) != nil {
+				s.promoteToRoot(deploymentId, root)
+			} else {
+				log.Debugf("already have replicated root %s", deploymentId)
+			}
+
+			continue
+		}
+
+		var deploymentYAML api.DeploymentYAML
+		err := yaml.Unmarshal(root.DeploymentYAMLBytes, &deploymentYAML)
+		if err != nil {
+			log.Errorf("error decoding replicated deployment %s: %s", deploymentId, err)
+			continue
+		}
+
+		deployment, err := deploymentYAMLToDeployment(&deploymentYAML, root.Static)
+		if err != nil {
+			log.Errorf("invalid replicated deployment %s: %s", deploymentId, err)
+			continue
+		}
+
+		log.Infof("taking over root of deployment %s", deploymentId)
+
+		s.hTable.addDeployment(&api.DeploymentDTO{
+			DeploymentId:        deploymentId,
+			Static:              root.Static,
+			DeploymentYAMLBytes: root.DeploymentYAMLBytes,
+			Owner:               root.Owner,
+		})
+
+		s.adoptRootChildren(deploymentId, root.Children)
+		s.emitEvent(api.EventRootTakeover, deploymentId, s.myself, nil)
+
+		go s.addDeploymentAsync(deployment, deploymentId)
+	}
+}
+
+// promoteToRoot makes this node, a child of the old root, the root of the deployment it already runs. Its own
+// children lose their grandparent, so they are told again this node is their parent.
+func (s *Server) promoteToRoot(deploymentId string, root *api.ReplicatedRootDTO) {
+	log.Infof("promoting deployment %s to root", deploymentId)
+
+	oldParent := s.hTable.setDeploymentAsRoot(deploymentId)
+	if oldParent != nil {
+		s.pTable.decreaseParentCount(oldParent.Id)
+	}
+
+	children := s.hTable.getChildren(deploymentId)
+	for childId, child := range root.Children {
+		if childId != s.myself.Id {
+			children[childId] = child
+		}
+	}
+
+	s.adoptRootChildren(deploymentId, children)
+	s.emitEvent(api.EventRootTakeover, deploymentId, s.myself, nil)
+}
+
+func (s *Server) adoptRootChildren(deploymentId string, children map[string]*utils.Node) {
+	for childId, child := range children {
+		if childId == s.myself.Id {
+			continue
+		}
+
+		s.hTable.addChild(deploymentId, child)
+		s.children.Store(childId, child)
+
+		depClient := s.getDeployerClient(child.Addr)
+		status := depClient.WarnThatIAmParent(deploymentId, s.myself, nil)
+		if status != http.StatusOK {
+			log.Errorf("got status %d while telling %s that im his parent", status, childId)
+		}
+	}
+}
+
+// demoteRoots drops the deployments this node was the root of when it stops leading, since the new leader
+// takes them over
+func (s *Server) demoteRoots() {
+	for deploymentId, root := range s.getLocalRoots() {
+		log.Warnf("no longer root of deployment %s", deploymentId)
+
+		for childId := range root.Children {
+			s.hTable.removeChild(deploymentId, childId)
+		}
+
+		s.hTable.removeDeployment(deploymentId)
+
+		go s.stopDeploymentInstances(deploymentId)
+	}
+}
+
+func (s *Server) rootVoteHandler(w http.ResponseWriter, r *http.Request) {
+	if s.rootReplicas == nil || !s.rootReplicas.isReplica {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var reqBody api.RootVoteRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !s.security.TLS.IsRequestFrom(r, reqBody.CandidateId) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	s.rootReplicas.lock.Lock()
+
+	var wasLeader bool
+	if reqBody.Term > s.rootReplicas.Term {
+		wasLeader = s.rootReplicas.stepDown(reqBody.Term)
+	}
+
+	upToDate := reqBody.LastTerm > s.rootReplicas.LastTerm ||
+		(reqBody.LastTerm == s.rootReplicas.LastTerm && reqBody.Version >= s.rootReplicas.Version)
+
+	var resp api.RootVoteResponseBody
+	if reqBody.Term == s.rootReplicas.Term && upToDate &&
+		(s.rootReplicas.VotedFor == "" || s.rootReplicas.VotedFor == reqBody.CandidateId) {
+		log.Debugf("voting for %s in term %d", reqBody.CandidateId, reqBody.Term)
+		s.rootReplicas.VotedFor = reqBody.CandidateId
+		s.rootReplicas.lastContact = time.Now()
+		resp.VoteGranted = true
+	}
+
+	resp.Term = s.rootReplicas.Term
+	s.rootReplicas.save()
+	s.rootReplicas.lock.Unlock()
+
+	if wasLeader {
+		s.demoteRoots()
+	}
+
+	utils.SendJSONReplyOK(w, resp)
+}
+
+func (s *Server) appendRootsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.rootReplicas == nil || !s.rootReplicas.isReplica {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var reqBody api.AppendRootsRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !s.security.TLS.IsRequestFrom(r, reqBody.LeaderId) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	s.rootReplicas.lock.Lock()
+
+	var resp api.AppendRootsResponseBody
+	if reqBody.Term < s.rootReplicas.Term {
+		resp.Term = s.rootReplicas.Term
+		s.rootReplicas.lock.Unlock()
+		utils.SendJSONReplyOK(w, resp)
+		return
+	}
+
+	var wasLeader bool
+	changed := reqBody.Term > s.rootReplicas.Term
+	if changed || s.rootReplicas.role != rootFollower {
+		wasLeader = s.rootReplicas.stepDown(reqBody.Term)
+	}
+
+	if s.rootReplicas.leaderId != reqBody.LeaderId {
+		log.Infof("following %s as leader of root replicas in term %d", reqBody.LeaderId, reqBody.Term)
+	}
+
+	s.rootReplicas.leaderId = reqBody.LeaderId
+	s.rootReplicas.lastContact = time.Now()
+
+	if reqBody.Term != s.rootReplicas.LastTerm || reqBody.Version != s.rootReplicas.Version {
+		s.rootReplicas.Roots = reqBody.Roots
+		s.rootReplicas.LastTerm = reqBody.Term
+		s.rootReplicas.Version = reqBody.Version
+		changed = true
+	}
+
+	if changed {
+		s.rootReplicas.save()
+	}
+
+	resp.Term = s.rootReplicas.Term
+	resp.Success = true
+	s.rootReplicas.lock.Unlock()
+
+	if wasLeader {
+		s.demoteRoots()
+	}
+
+	utils.SendJSONReplyOK(w, resp)
+}
+
+func (s *Server) getRootLeaderHandler(w http.ResponseWriter, _ *http.Request) {
+	if s.rootReplicas == nil || !s.rootReplicas.isReplica {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.rootReplicas.lock.Lock()
+	resp := api.GetRootLeaderResponseBody{
+		LeaderId: s.rootReplicas.leaderId,
+		Term:     s.rootReplicas.Term,
+	}
+	s.rootReplicas.lock.Unlock()
+
+	utils.SendJSONReplyOK(w, resp)
+}
@@ -0,0 +1,390 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+)
+
+// newTestReplicas returns a deployer for each id, all of them replicas of the root
+func newTestReplicas(t *testing.T, ids ...string) map[string]*Server {
+	t.Helper()
+
+	return newTestReplicasWith(t, ids, nil)
+}
+
+// newTestReplicasWith returns a deployer for each replica of the root and for each of the other ids
+func newTestReplicasWith(t *testing.T, replicaIds, otherIds []string) map[string]*Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	servers, _ := newTestDeployers(t, func(id string, conf *config.Config) {
+		conf.Deployer.RootReplicas = strings.Join(replicaIds, ",")
+		conf.Deployer.RootReplicationFile = filepath.Join(dir, id+".json")
+	}, append(replicaIds, otherIds...)...)
+
+	return servers
+}
+
+func requestRootVote(t *testing.T, s *Server, reqBody api.RootVoteRequestBody) api.RootVoteResponseBody {
+	t.Helper()
+
+	var resp api.RootVoteResponseBody
+	doReplicationRequest(t, s.rootVoteHandler, reqBody, &resp)
+
+	return resp
+}
+
+func appendRoots(t *testing.T, s *Server, reqBody api.AppendRootsRequestBody) api.AppendRootsResponseBody {
+	t.Helper()
+
+	var resp api.AppendRootsResponseBody
+	doReplicationRequest(t, s.appendRootsHandler, reqBody, &resp)
+
+	return resp
+}
+
+func doReplicationRequest(t *testing.T, handler http.HandlerFunc, reqBody, respBody interface{}) {
+	t.Helper()
+
+	reqBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(reqBytes)))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	err = json.NewDecoder(recorder.Body).Decode(respBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadRootReplication(t *testing.T) {
+	servers := newTestReplicas(t, "n0", "n1")
+	s := servers["n0"]
+
+	r := s.loadRootReplication(" n0, n1 ,,n2", s.rootReplicas.filename)
+	if len(r.replicas) != 3 || r.replicas[0] != "n0" || r.replicas[1] != "n1" || r.replicas[2] != "n2" {
+		t.Fatalf("expected replicas [n0 n1 n2], got %v", r.replicas)
+	}
+	if !r.isReplica {
+		t.Fatal("expected n0 to be a replica")
+	}
+
+	r = s.loadRootReplication("n1,n2", s.rootReplicas.filename)
+	if r.isReplica {
+		t.Fatal("expected n0 not to be a replica of n1,n2")
+	}
+
+	if s.loadRootReplication("", s.rootReplicas.filename) != nil {
+		t.Fatal("expected no replication without replicas")
+	}
+}
+
+func TestRootReplicationStateSurvivesRestart(t *testing.T) {
+	servers := newTestReplicas(t, "n0", "n1")
+	s := servers["n0"]
+
+	r := s.rootReplicas
+	r.lock.Lock()
+	r.Term = 3
+	r.VotedFor = "n1"
+	r.LastTerm = 2
+	r.Version = 7
+	r.Roots = map[string]*api.ReplicatedRootDTO{"dep": {Owner: "owner"}}
+	r.save()
+	r.lock.Unlock()
+
+	loaded := s.loadRootReplication("n0,n1", r.filename)
+	if loaded.Term != 3 || loaded.VotedFor != "n1" || loaded.LastTerm != 2 || loaded.Version != 7 {
+		t.Fatalf("expected the saved state, got %+v", loaded.rootReplicationState)
+	}
+	if root, ok := loaded.Roots["dep"]; !ok || root.Owner != "owner" {
+		t.Fatalf("expected the saved roots, got %+v", loaded.Roots)
+	}
+	if loaded.role != rootFollower {
+		t.Fatal("expected a restarted replica to follow")
+	}
+}
+
+func TestIsMajority(t *testing.T) {
+	tests := []struct {
+		replicas []string
+		votes    int
+		expected bool
+	}{
+		{replicas: []string{"n0"}, votes: 1, expected: true},
+		{replicas: []string{"n0", "n1", "n2"}, votes: 1, expected: false},
+		{replicas: []string{"n0", "n1", "n2"}, votes: 2, expected: true},
+		{replicas: []string{"n0", "n1", "n2", "n3"}, votes: 2, expected: false},
+		{replicas: []string{"n0", "n1", "n2", "n3"}, votes: 3, expected: true},
+	}
+
+	for _, test := range tests {
+		r := &rootReplication{replicas: test.replicas}
+		if actual := r.isMajority(test.votes); actual != test.expected {
+			t.Errorf("expected %d votes out of %d replicas to be a majority: %t", test.votes, len(test.replicas),
+				test.expected)
+		}
+	}
+}
+
+func TestRandomElectionTimeout(t *testing.T) {
+	servers := newTestReplicas(t, "n0")
+	r := servers["n0"].rootReplicas
+
+	for i := 0; i < 100; i++ {
+		timeout := r.randomElectionTimeout()
+		if timeout < rootElectionTimeoutMin || timeout >= rootElectionTimeoutMax {
+			t.Fatalf("expected a timeout in [%s, %s), got %s", rootElectionTimeoutMin, rootElectionTimeoutMax, timeout)
+		}
+	}
+}
+
+func TestStepDown(t *testing.T) {
+	r := &rootReplication{
+		rootReplicationState: rootReplicationState{Term: 2, VotedFor: "n0"},
+		role:                 rootLeader,
+		leaderId:             "n0",
+	}
+
+	if !r.stepDown(2) {
+		t.Fatal("expected stepping down to report the replica was leading")
+	}
+	if r.Term != 2 || r.VotedFor != "n0" {
+		t.Fatalf("expected the vote in the same term to be kept, got %+v", r.rootReplicationState)
+	}
+	if r.role != rootFollower || r.leaderId != "" {
+		t.Fatal("expected a follower without a leader")
+	}
+
+	if r.stepDown(3) {
+		t.Fatal("expected a follower not to report it was leading")
+	}
+	if r.Term != 3 || r.VotedFor != "" {
+		t.Fatalf("expected a new term without a vote, got %+v", r.rootReplicationState)
+	}
+}
+
+func TestRootVoteOncePerTerm(t *testing.T) {
+	servers := newTestReplicas(t, "n0", "n1", "n2")
+	s := servers["n0"]
+
+	resp := requestRootVote(t, s, api.RootVoteRequestBody{Term: 1, CandidateId: "n1"})
+	if !resp.VoteGranted || resp.Term != 1 {
+		t.Fatalf("expected the vote of term 1 for n1, got %+v", resp)
+	}
+
+	resp = requestRootVote(t, s, api.RootVoteRequestBody{Term: 1, CandidateId: "n1"})
+	if !resp.VoteGranted {
+		t.Fatal("expected the vote to be granted again to the same candidate")
+	}
+
+	resp = requestRootVote(t, s, api.RootVoteRequestBody{Term: 1, CandidateId: "n2"})
+	if resp.VoteGranted {
+		t.Fatal("expected no second vote in term 1")
+	}
+
+	resp = requestRootVote(t, s, api.RootVoteRequestBody{Term: 2, CandidateId: "n2"})
+	if !resp.VoteGranted || resp.Term != 2 {
+		t.Fatalf("expected the vote of term 2 for n2, got %+v", resp)
+	}
+
+	loaded := s.loadRootReplication("n0,n1,n2", s.rootReplicas.filename)
+	if loaded.Term != 2 || loaded.VotedFor != "n2" {
+		t.Fatalf("expected the vote to be saved, got %+v", loaded.rootReplicationState)
+	}
+}
+
+func TestRootVoteRefusesOutdatedCandidate(t *testing.T) {
+	servers := newTestReplicas(t, "n0", "n1", "n2")
+	s := servers["n0"]
+
+	s.rootReplicas.lock.Lock()
+	s.rootReplicas.Term = 2
+	s.rootReplicas.LastTerm = 2
+	s.rootReplicas.Version = 5
+	s.rootReplicas.lock.Unlock()
+
+	resp := requestRootVote(t, s, api.RootVoteRequestBody{Term: 1, CandidateId: "n1", LastTerm: 2, Version: 5})
+	if resp.VoteGranted || resp.Term != 2 {
+		t.Fatalf("expected no vote for an older term, got %+v", resp)
+	}
+
+	resp = requestRootVote(t, s, api.RootVoteRequestBody{Term: 3, CandidateId: "n1", LastTerm: 2, Version: 4})
+	if resp.VoteGranted {
+		t.Fatal("expected no vote for a candidate with older roots")
+	}
+	if resp.Term != 3 {
+		t.Fatalf("expected the newer term to be adopted anyway, got %d", resp.Term)
+	}
+
+	resp = requestRootVote(t, s, api.RootVoteRequestBody{Term: 3, CandidateId: "n2", LastTerm: 3})
+	if !resp.VoteGranted {
+		t.Fatal("expected the vote for a candidate with roots of a newer term")
+	}
+}
+
+func TestAppendRoots(t *testing.T) {
+	servers := newTestReplicas(t, "n0", "n1", "n2")
+	s := servers["n0"]
+
+	s.rootReplicas.lock.Lock()
+	s.rootReplicas.Term = 2
+	s.rootReplicas.role = rootCandidate
+	s.rootReplicas.lock.Unlock()
+
+	resp := appendRoots(t, s, api.AppendRootsRequestBody{Term: 1, LeaderId: "n1"})
+	if resp.Success || resp.Term != 2 {
+		t.Fatalf("expected roots of an older term to be refused, got %+v", resp)
+	}
+
+	roots := map[string]*api.ReplicatedRootDTO{"dep": {Owner: "owner"}}
+	resp = appendRoots(t, s, api.AppendRootsRequestBody{Term: 2, LeaderId: "n1", Version: 4, Roots: roots})
+	if !resp.Success || resp.Term != 2 {
+		t.Fatalf("expected the roots of the leader of term 2 to be taken, got %+v", resp)
+	}
+
+	r := s.rootReplicas
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.role != rootFollower || r.leaderId != "n1" {
+		t.Fatalf("expected the candidate to follow n1, got role %d following %q", r.role, r.leaderId)
+	}
+	if r.LastTerm != 2 || r.Version != 4 || r.Roots["dep"] == nil {
+		t.Fatalf("expected the roots of version 4 in term 2, got %+v", r.rootReplicationState)
+	}
+}
+
+func TestRootElection(t *testing.T) {
+	servers := newTestReplicas(t, "n0", "n1", "n2")
+
+	servers["n0"].rootReplicas.startElection()
+
+	if !servers["n0"].rootReplicas.isLeader() {
+		t.Fatal("expected n0 to win the election")
+	}
+
+	for _, id := range []string{"n1", "n2"} {
+		r := servers[id].rootReplicas
+
+		r.lock.Lock()
+		term, votedFor, leaderId := r.Term, r.VotedFor, r.leaderId
+		r.lock.Unlock()
+
+		if term != 1 || votedFor != "n0" || leaderId != "n0" {
+			t.Fatalf("expected %s to vote for and follow n0 in term 1, got term %d, vote %q and leader %q", id,
+				term, votedFor, leaderId)
+		}
+	}
+
+	if leaderId := servers["n2"].rootReplicas.findLeader(""); leaderId != "n0" {
+		t.Fatalf("expected n2 to know n0 leads, got %q", leaderId)
+	}
+
+	// a candidate that hears of a newer term follows it, even with a majority of the votes
+	servers["n2"].rootReplicas.lock.Lock()
+	servers["n2"].rootReplicas.Term = 5
+	servers["n2"].rootReplicas.lock.Unlock()
+
+	r := servers["n1"].rootReplicas
+	r.startElection()
+
+	if r.isLeader() {
+		t.Fatal("expected n1 not to lead in an outdated term")
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.Term != 5 || r.role != rootFollower {
+		t.Fatalf("expected n1 to follow in term 5, got term %d and role %d", r.Term, r.role)
+	}
+}
+
+func TestRootTakeover(t *testing.T) {
+	servers := newTestReplicasWith(t, []string{"n0", "n1", "n2"}, []string{"n3", "n4"})
+	oldRoot, newRoot := servers["n0"], servers["n1"]
+
+	// n0 is the root, with the replica n1 and n3 as children, and n4 is below n1
+	addTestDeployment(oldRoot, nil)
+	addTestDeployment(newRoot, oldRoot.myself)
+	addTestDeployment(servers["n3"], oldRoot.myself)
+	addTestDeployment(servers["n4"], newRoot.myself)
+	oldRoot.hTable.addChild(testDeploymentId, newRoot.myself)
+	oldRoot.hTable.addChild(testDeploymentId, servers["n3"].myself)
+	servers["n4"].hTable.setDeploymentGrandparent(testDeploymentId, oldRoot.myself)
+	newRoot.hTable.addChild(testDeploymentId, servers["n4"].myself)
+
+	oldRoot.rootReplicas.startElection()
+	if !oldRoot.rootReplicas.isLeader() {
+		t.Fatal("expected n0 to win the election")
+	}
+
+	err := oldRoot.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRoot.rootReplicas.startElection()
+	if !newRoot.rootReplicas.isLeader() {
+		t.Fatal("expected n1 to win the election once n0 is gone")
+	}
+
+	if parent := newRoot.hTable.getParent(testDeploymentId); parent != nil {
+		t.Fatalf("expected n1 to be the root, got parent %s", parent.Id)
+	}
+
+	children := newRoot.hTable.getChildren(testDeploymentId)
+	for _, childId := range []string{"n3", "n4"} {
+		if _, ok := children[childId]; !ok {
+			t.Errorf("expected n1 to have %s as child, got %+v", childId, children)
+		}
+
+		if parent := servers[childId].hTable.getParent(testDeploymentId); parent == nil || parent.Id != "n1" {
+			t.Errorf("expected %s to have n1 as parent, got %+v", childId, parent)
+		}
+	}
+
+	if grandparent := servers["n4"].hTable.getGrandparent(testDeploymentId); grandparent != nil {
+		t.Errorf("expected n4 not to have a grandparent below the root, got %s", grandparent.Id)
+	}
+}
+
+func TestAdoptRootsLeavesDeeperDeployments(t *testing.T) {
+	servers := newTestReplicas(t, "n0")
+	s := servers["n0"]
+
+	parent := utils.NewNode("n1", "n1")
+	addTestDeployment(s, parent)
+
+	s.adoptRoots(map[string]*api.ReplicatedRootDTO{
+		testDeploymentId: {
+			DeploymentYAMLBytes: testDeploymentYAML,
+			Children:            map[string]*utils.Node{"n2": utils.NewNode("n2", "n2")},
+		},
+	})
+
+	if actual := s.hTable.getParent(testDeploymentId); actual == nil || actual.Id != parent.Id {
+		t.Fatalf("expected n0 to keep n1 as parent, got %+v", actual)
+	}
+	if children := s.hTable.getChildren(testDeploymentId); len(children) != 0 {
+		t.Fatalf("expected n0 not to take the children of the root, got %+v", children)
+	}
+}
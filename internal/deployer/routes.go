@@ -13,6 +13,7 @@ const (
 	getDeploymentsName          = "GET_DEPLOYMENTS"
 	registerDeploymentName      = "REGISTER_DEPLOYMENT"
 	registerServiceInstanceName = "REGISTER_SERVICE_INSTANCE"
+	deleteServiceInstanceName   = "DELETE_SERVICE_INSTANCE"
 	deleteDeploymentName        = "DELETE_DEPLOYMENT"
 	whoAreYouName               = "WHO_ARE_YOU"
 	addNodeName                 = "ADD_NODE"
@@ -22,7 +23,7 @@ const (
 	deleteDeploymentChildName   = "DELETE_DEPLOYMENT_CHILD"
 	iAmYourParentName           = "I_AM_YOUR_PARENT"
 	getHierarchyTableName       = "GET_TABLE"
-	parentAliveName             = "PARENT_ALIVE"
+	heartbeatName               = "HEARTBEAT"
 	canTakeChildName            = "CAN_TAKE_CHILD"
 	migrateDeploymentName       = "MIGRATE_DEPLOYMENT"
 	extendDeploymentToName      = "EXTEND_DEPLOYMENT_TO"
@@ -37,23 +38,50 @@ const (
 	hasDeploymentName           = "HAS_DEPLOYMENT"
 	terminalLocationName        = "TERMINAL_LOCATION"
 	exploringName               = "EXPLORING"
+	prePullImageName            = "PRE_PULL_IMAGE"
+	getDeploymentLogsName       = "GET_DEPLOYMENT_LOGS"
+	execName                    = "EXEC"
+	setSecretName               = "SET_SECRET"
+	deleteSecretName            = "DELETE_SECRET"
+	getDeploymentSecretsName    = "GET_DEPLOYMENT_SECRETS"
+	updateConfigMapName         = "UPDATE_CONFIG_MAP"
+	getDeploymentTopologyName   = "GET_DEPLOYMENT_TOPOLOGY"
+	getChildTopologyName        = "GET_CHILD_TOPOLOGY"
+	streamEventsName            = "STREAM_EVENTS"
+	forwardEventName            = "FORWARD_EVENT"
+	rootVoteName                = "ROOT_VOTE"
+	appendRootsName             = "APPEND_ROOTS"
+	getRootLeaderName           = "GET_ROOT_LEADER"
+	getFallbacksName            = "GET_FALLBACKS"
+	setFallbackName             = "SET_FALLBACK"
+	deleteFallbackName          = "DELETE_FALLBACK"
+	getNeighboursName           = "GET_NEIGHBOURS"
+	controlStreamName           = "CONTROL_STREAM"
+	probeName                   = "PROBE"
+	getConfigName               = "GET_CONFIG"
 
 	// scheduler
 	heartbeatServiceInstanceName         = "HEARTBEAT_SERVICE_INSTANCE"
 	registerHeartbeatServiceInstanceName = "REGISTER_HEARTBEAT"
+	instanceHealthName                   = "INSTANCE_HEALTH"
+	getInstancesName                     = "GET_INSTANCES"
 )
 
 // Path variables
 const (
-	deploymentIdPathVar = "deploymentId"
-	nodeIdPathVar       = "nodeId"
-	instanceIdPathVar   = "instanceId"
+	deploymentIdPathVar  = "deploymentId"
+	nodeIdPathVar        = "nodeId"
+	instanceIdPathVar    = "instanceId"
+	secretNamePathVar    = "secretName"
+	configMapNamePathVar = "configMapName"
 )
 
 var (
-	_deploymentIdPathVarFormatted = fmt.Sprintf(utils.PathVarFormat, deploymentIdPathVar)
-	_instanceIdPathVarFormatted   = fmt.Sprintf(utils.PathVarFormat, instanceIdPathVar)
-	_deployerIdPathVarFormatted   = fmt.Sprintf(utils.PathVarFormat, nodeIdPathVar)
+	_deploymentIdPathVarFormatted  = fmt.Sprintf(utils.PathVarFormat, deploymentIdPathVar)
+	_instanceIdPathVarFormatted    = fmt.Sprintf(utils.PathVarFormat, instanceIdPathVar)
+	_deployerIdPathVarFormatted    = fmt.Sprintf(utils.PathVarFormat, nodeIdPathVar)
+	_secretNamePathVarFormatted    = fmt.Sprintf(utils.PathVarFormat, secretNamePathVar)
+	_configMapNamePathVarFormatted = fmt.Sprintf(utils.PathVarFormat, configMapNamePathVar)
 
 	deploymentsRoute           = deployer.DeploymentsPath
 	deploymentRoute            = fmt.Sprintf(deployer.DeploymentPath, _deploymentIdPathVarFormatted)
@@ -80,217 +108,433 @@ var (
 	hasDeploymentRoute         = fmt.Sprintf(deployer.HasDeploymentPath, _deploymentIdPathVarFormatted)
 	terminalLocationRoute      = fmt.Sprintf(deployer.TerminalLocationPath, _deploymentIdPathVarFormatted)
 	setExploringRoute          = fmt.Sprintf(deployer.SetExploringPath, _deploymentIdPathVarFormatted, _deployerIdPathVarFormatted)
+	prePullImageRoute          = deployer.PrePullImagePath
+	deploymentLogsRoute        = fmt.Sprintf(deployer.DeploymentLogsPath, _deploymentIdPathVarFormatted)
+	deploymentExecRoute        = fmt.Sprintf(deployer.DeploymentExecPath, _deploymentIdPathVarFormatted)
+	deploymentSecretsRoute     = fmt.Sprintf(deployer.DeploymentSecretsPath, _deploymentIdPathVarFormatted)
+	secretRoute                = fmt.Sprintf(deployer.SecretPath, _secretNamePathVarFormatted)
+	deploymentTopologyRoute    = fmt.Sprintf(deployer.DeploymentTopologyPath, _deploymentIdPathVarFormatted)
+	deploymentEventsRoute      = fmt.Sprintf(deployer.DeploymentEventsPath, _deploymentIdPathVarFormatted)
+	eventsRoute                = deployer.EventsPath
+	rootVoteRoute              = deployer.RootVotePath
+	rootAppendRoute            = deployer.RootAppendPath
+	rootLeaderRoute            = deployer.RootLeaderPath
+	fallbacksRoute             = deployer.FallbacksPath
+	fallbackNodeRoute          = fmt.Sprintf(deployer.FallbackNodePath, _deployerIdPathVarFormatted)
+	configMapRoute             = fmt.Sprintf(deployer.DeploymentConfigMapPath, _deploymentIdPathVarFormatted,
+		_configMapNamePathVarFormatted)
 
 	// scheduler
+	instancesRoute               = deployer.InstancesPath
 	deploymentInstanceAliveRoute = fmt.Sprintf(deployer.DeploymentInstanceAlivePath, _deploymentIdPathVarFormatted,
 		_instanceIdPathVarFormatted)
 	deploymentInstanceRoute = fmt.Sprintf(deployer.DeploymentInstancePath, _deploymentIdPathVarFormatted,
 		_instanceIdPathVarFormatted)
-	parentAliveRoute = fmt.Sprintf(deployer.ParentAlivePath, _deployerIdPathVarFormatted)
+	deploymentInstanceHealthRoute = fmt.Sprintf(deployer.DeploymentInstanceHealthPath, _deploymentIdPathVarFormatted,
+		_instanceIdPathVarFormatted)
+	heartbeatRoute     = fmt.Sprintf(deployer.HeartbeatPath, _deployerIdPathVarFormatted)
+	neighboursRoute    = deployer.NeighboursPath
+	controlStreamRoute = fmt.Sprintf(deployer.ControlStreamPath, _deployerIdPathVarFormatted)
+	probeRoute         = fmt.Sprintf(deployer.ProbePath, _deployerIdPathVarFormatted)
+	configRoute        = deployer.ConfigPath
 )
 
-var Routes = []utils.Route{
-
-	{
-		Name:        exploringName,
-		Method:      http.MethodPost,
-		Pattern:     setExploringRoute,
-		HandlerFunc: setExploringHandler,
-	},
-
-	{
-		Name:        terminalLocationName,
-		Method:      http.MethodPost,
-		Pattern:     terminalLocationRoute,
-		HandlerFunc: terminalLocationHandler,
-	},
-
-	{
-		Name:        hasDeploymentName,
-		Method:      http.MethodGet,
-		Pattern:     hasDeploymentRoute,
-		HandlerFunc: hasDeploymentHandler,
-	},
-
-	{
-		Name:        getFallbackIdName,
-		Method:      http.MethodGet,
-		Pattern:     getFallbackRoute,
-		HandlerFunc: getFallbackHandler,
-	},
-
-	{
-		Name:        redirectDownTheTreeName,
-		Method:      http.MethodGet,
-		Pattern:     redirectDownTheTreeRoute,
-		HandlerFunc: redirectClientDownTheTreeHandler,
-	},
-
-	{
-		Name:        startResolveUpTheTreeName,
-		Method:      http.MethodPost,
-		Pattern:     startResolveUpTheTreeRoute,
-		HandlerFunc: startResolveUpTheTreeHandler,
-	},
-
-	{
-		Name:        resolveUpTheTreeName,
-		Method:      http.MethodPost,
-		Pattern:     resolveUpTheTreeRoute,
-		HandlerFunc: resolveUpTheTreeHandler,
-	},
-
-	{
-		Name:        fallbackName,
-		Method:      http.MethodPost,
-		Pattern:     fallbackRoute,
-		HandlerFunc: fallbackHandler,
-	},
-
-	{
-		Name:        canTakeParentName,
-		Method:      http.MethodGet,
-		Pattern:     canTakeParentRoute,
-		HandlerFunc: canTakeParentHandler,
-	},
-
-	{
-		Name:        setGrandparentName,
-		Method:      http.MethodPost,
-		Pattern:     setGrandparentRoute,
-		HandlerFunc: setGrandparentHandler,
-	},
-
-	{
-		Name:        canTakeChildName,
-		Method:      http.MethodGet,
-		Pattern:     canTakeChildRoute,
-		HandlerFunc: canTakeChildHandler,
-	},
-
-	{
-		Name:        parentAliveName,
-		Method:      http.MethodPost,
-		Pattern:     parentAliveRoute,
-		HandlerFunc: parentAliveHandler,
-	},
-
-	{
-		Name:        shortenDeploymentFromName,
-		Method:      http.MethodPost,
-		Pattern:     shortenDeploymentFromRoute,
-		HandlerFunc: shortenDeploymentFromHandler,
-	},
-
-	{
-		Name:        extendDeploymentToName,
-		Method:      http.MethodPost,
-		Pattern:     extendDeploymentToRoute,
-		HandlerFunc: extendDeploymentToHandler,
-	},
-
-	{
-		Name:        deadChildName,
-		Method:      http.MethodPost,
-		Pattern:     deadChildRoute,
-		HandlerFunc: deadChildHandler,
-	},
-
-	{
-		Name:        migrateDeploymentName,
-		Method:      http.MethodPost,
-		Pattern:     migrateDeploymentRoute,
-		HandlerFunc: migrateDeploymentHandler,
-	},
-
-	{
-		Name:        takeChildName,
-		Method:      http.MethodPost,
-		Pattern:     deploymentChildRoute,
-		HandlerFunc: takeChildHandler,
-	},
-
-	{
-		Name:        deleteDeploymentChildName,
-		Method:      http.MethodDelete,
-		Pattern:     deploymentChildRoute,
-		HandlerFunc: childDeletedDeploymentHandler,
-	},
-
-	{
-		Name:        iAmYourParentName,
-		Method:      http.MethodPost,
-		Pattern:     iAmYourParentRoute,
-		HandlerFunc: iAmYourParentHandler,
-	},
-
-	{
-		Name:        getHierarchyTableName,
-		Method:      http.MethodGet,
-		Pattern:     hierarchyTableRoute,
-		HandlerFunc: getHierarchyTableHandler,
-	},
-
-	{
-		Name:        getDeploymentsName,
-		Method:      http.MethodGet,
-		Pattern:     deploymentsRoute,
-		HandlerFunc: getDeploymentsHandler,
-	},
-
-	{
-		Name:        registerDeploymentName,
-		Method:      http.MethodPost,
-		Pattern:     deploymentsRoute,
-		HandlerFunc: registerDeploymentHandler,
-	},
-
-	{
-		Name:        deleteDeploymentName,
-		Method:      http.MethodDelete,
-		Pattern:     deploymentRoute,
-		HandlerFunc: deleteDeploymentHandler,
-	},
-
-	{
-		Name:        addNodeName,
-		Method:      http.MethodPost,
-		Pattern:     addNodeRoute,
-		HandlerFunc: addNodeHandler,
-	},
-
-	{
-		Name:        whoAreYouName,
-		Method:      http.MethodGet,
-		Pattern:     whoAreYouRoute,
-		HandlerFunc: whoAreYouHandler,
-	},
-
-	{
-		Name:        setAlternativesName,
-		Method:      http.MethodPost,
-		Pattern:     setAlternativesRoute,
-		HandlerFunc: setAlternativesHandler,
-	},
-
-	{
-		Name:        heartbeatServiceInstanceName,
-		Method:      http.MethodPut,
-		Pattern:     deploymentInstanceAliveRoute,
-		HandlerFunc: heartbeatServiceInstanceHandler,
-	},
-
-	{
-		Name:        registerHeartbeatServiceInstanceName,
-		Method:      http.MethodPost,
-		Pattern:     deploymentInstanceAliveRoute,
-		HandlerFunc: registerHeartbeatServiceInstanceHandler,
-	},
-
-	{
-		Name:        registerServiceInstanceName,
-		Method:      http.MethodPost,
-		Pattern:     deploymentInstanceRoute,
-		HandlerFunc: registerServiceInstanceHandler,
-	},
+// Routes used by the deployer-cli are public, since it authenticates with a token, and check the role of the
+// user themselves
+func (s *Server) routes() []utils.Route {
+	return []utils.Route{
+
+		{
+			Name:        exploringName,
+			Method:      http.MethodPost,
+			Pattern:     setExploringRoute,
+			HandlerFunc: s.setExploringHandler,
+		},
+
+		{
+			Name:        prePullImageName,
+			Method:      http.MethodPost,
+			Pattern:     prePullImageRoute,
+			HandlerFunc: s.prePullImageHandler,
+		},
+
+		{
+			Name:        getDeploymentLogsName,
+			Method:      http.MethodGet,
+			Pattern:     deploymentLogsRoute,
+			HandlerFunc: s.authorize(roleViewer, s.getDeploymentLogsHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        execName,
+			Method:      http.MethodPost,
+			Pattern:     deploymentExecRoute,
+			HandlerFunc: s.authorizeOwner(roleOperator, s.execHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        setSecretName,
+			Method:      http.MethodPut,
+			Pattern:     secretRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.setSecretHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        deleteSecretName,
+			Method:      http.MethodDelete,
+			Pattern:     secretRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.deleteSecretHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        getDeploymentSecretsName,
+			Method:      http.MethodGet,
+			Pattern:     deploymentSecretsRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.getDeploymentSecretsHandler),
+		},
+
+		{
+			Name:        getDeploymentTopologyName,
+			Method:      http.MethodGet,
+			Pattern:     deploymentTopologyRoute,
+			HandlerFunc: s.authorize(roleViewer, s.getDeploymentTopologyHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        getChildTopologyName,
+			Method:      http.MethodGet,
+			Pattern:     deploymentChildRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.getChildTopologyHandler),
+		},
+
+		{
+			Name:        streamEventsName,
+			Method:      http.MethodGet,
+			Pattern:     eventsRoute,
+			HandlerFunc: s.authorize(roleViewer, s.streamEventsHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        forwardEventName,
+			Method:      http.MethodPost,
+			Pattern:     deploymentEventsRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.forwardEventHandler),
+		},
+
+		{
+			Name:        rootVoteName,
+			Method:      http.MethodPost,
+			Pattern:     rootVoteRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.rootVoteHandler),
+		},
+
+		{
+			Name:        appendRootsName,
+			Method:      http.MethodPost,
+			Pattern:     rootAppendRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.appendRootsHandler),
+		},
+
+		{
+			Name:        getRootLeaderName,
+			Method:      http.MethodGet,
+			Pattern:     rootLeaderRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.getRootLeaderHandler),
+		},
+
+		{
+			Name:        getFallbacksName,
+			Method:      http.MethodGet,
+			Pattern:     fallbacksRoute,
+			HandlerFunc: s.authorize(roleViewer, s.getFallbacksHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        setFallbackName,
+			Method:      http.MethodPut,
+			Pattern:     fallbackNodeRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.setFallbackHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        deleteFallbackName,
+			Method:      http.MethodDelete,
+			Pattern:     fallbackNodeRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.deleteFallbackHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        updateConfigMapName,
+			Method:      http.MethodPut,
+			Pattern:     configMapRoute,
+			HandlerFunc: s.authorizeOwner(roleOperator, s.updateConfigMapHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        terminalLocationName,
+			Method:      http.MethodPost,
+			Pattern:     terminalLocationRoute,
+			HandlerFunc: s.terminalLocationHandler,
+		},
+
+		{
+			Name:        hasDeploymentName,
+			Method:      http.MethodGet,
+			Pattern:     hasDeploymentRoute,
+			HandlerFunc: s.hasDeploymentHandler,
+		},
+
+		{
+			Name:        getFallbackIdName,
+			Method:      http.MethodGet,
+			Pattern:     getFallbackRoute,
+			HandlerFunc: s.getFallbackHandler,
+		},
+
+		{
+			Name:        redirectDownTheTreeName,
+			Method:      http.MethodGet,
+			Pattern:     redirectDownTheTreeRoute,
+			HandlerFunc: s.redirectClientDownTheTreeHandler,
+		},
+
+		{
+			Name:        startResolveUpTheTreeName,
+			Method:      http.MethodPost,
+			Pattern:     startResolveUpTheTreeRoute,
+			HandlerFunc: s.startResolveUpTheTreeHandler,
+		},
+
+		{
+			Name:        resolveUpTheTreeName,
+			Method:      http.MethodPost,
+			Pattern:     resolveUpTheTreeRoute,
+			HandlerFunc: s.resolveUpTheTreeHandler,
+		},
+
+		{
+			Name:        fallbackName,
+			Method:      http.MethodPost,
+			Pattern:     fallbackRoute,
+			HandlerFunc: s.fallbackHandler,
+		},
+
+		{
+			Name:        canTakeParentName,
+			Method:      http.MethodGet,
+			Pattern:     canTakeParentRoute,
+			HandlerFunc: s.canTakeParentHandler,
+		},
+
+		{
+			Name:        setGrandparentName,
+			Method:      http.MethodPost,
+			Pattern:     setGrandparentRoute,
+			HandlerFunc: s.setGrandparentHandler,
+		},
+
+		{
+			Name:        canTakeChildName,
+			Method:      http.MethodGet,
+			Pattern:     canTakeChildRoute,
+			HandlerFunc: s.canTakeChildHandler,
+		},
+
+		{
+			Name:        heartbeatName,
+			Method:      http.MethodPost,
+			Pattern:     heartbeatRoute,
+			HandlerFunc: s.heartbeatHandler,
+		},
+
+		{
+			Name:        controlStreamName,
+			Method:      http.MethodPost,
+			Pattern:     controlStreamRoute,
+			HandlerFunc: s.controlStreamHandler,
+		},
+
+		{
+			Name:        getNeighboursName,
+			Method:      http.MethodGet,
+			Pattern:     neighboursRoute,
+			HandlerFunc: s.authorize(roleViewer, s.getNeighboursHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        getConfigName,
+			Method:      http.MethodGet,
+			Pattern:     configRoute,
+			HandlerFunc: s.authorize(roleViewer, s.config.Handler),
+			Public:      true,
+		},
+
+		{
+			Name:        probeName,
+			Method:      http.MethodGet,
+			Pattern:     probeRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.probeHandler),
+		},
+
+		{
+			Name:        shortenDeploymentFromName,
+			Method:      http.MethodPost,
+			Pattern:     shortenDeploymentFromRoute,
+			HandlerFunc: s.authorizeOwner(roleOperator, s.shortenDeploymentFromHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        extendDeploymentToName,
+			Method:      http.MethodPost,
+			Pattern:     extendDeploymentToRoute,
+			HandlerFunc: s.authorizeOwner(roleOperator, s.extendDeploymentToHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        deadChildName,
+			Method:      http.MethodPost,
+			Pattern:     deadChildRoute,
+			HandlerFunc: s.deadChildHandler,
+		},
+
+		{
+			Name:        migrateDeploymentName,
+			Method:      http.MethodPost,
+			Pattern:     migrateDeploymentRoute,
+			HandlerFunc: s.authorizeOwner(roleOperator, s.migrateDeploymentHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        takeChildName,
+			Method:      http.MethodPost,
+			Pattern:     deploymentChildRoute,
+			HandlerFunc: s.takeChildHandler,
+		},
+
+		{
+			Name:        deleteDeploymentChildName,
+			Method:      http.MethodDelete,
+			Pattern:     deploymentChildRoute,
+			HandlerFunc: s.childDeletedDeploymentHandler,
+		},
+
+		{
+			Name:        iAmYourParentName,
+			Method:      http.MethodPost,
+			Pattern:     iAmYourParentRoute,
+			HandlerFunc: s.iAmYourParentHandler,
+		},
+
+		{
+			Name:        getHierarchyTableName,
+			Method:      http.MethodGet,
+			Pattern:     hierarchyTableRoute,
+			HandlerFunc: s.authorize(roleViewer, s.getHierarchyTableHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        getDeploymentsName,
+			Method:      http.MethodGet,
+			Pattern:     deploymentsRoute,
+			HandlerFunc: s.authorize(roleViewer, s.getDeploymentsHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        registerDeploymentName,
+			Method:      http.MethodPost,
+			Pattern:     deploymentsRoute,
+			HandlerFunc: s.authorize(roleOperator, s.registerDeploymentHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        deleteDeploymentName,
+			Method:      http.MethodDelete,
+			Pattern:     deploymentRoute,
+			HandlerFunc: s.authorizeOwner(roleOperator, s.deleteDeploymentHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        addNodeName,
+			Method:      http.MethodPost,
+			Pattern:     addNodeRoute,
+			HandlerFunc: s.authorize(roleAdmin, s.addNodeHandler),
+			Public:      true,
+		},
+
+		{
+			Name:        whoAreYouName,
+			Method:      http.MethodGet,
+			Pattern:     whoAreYouRoute,
+			HandlerFunc: s.whoAreYouHandler,
+		},
+
+		{
+			Name:        setAlternativesName,
+			Method:      http.MethodPost,
+			Pattern:     setAlternativesRoute,
+			HandlerFunc: s.setAlternativesHandler,
+		},
+
+		{
+			Name:        heartbeatServiceInstanceName,
+			Method:      http.MethodPut,
+			Pattern:     deploymentInstanceAliveRoute,
+			HandlerFunc: s.heartbeatServiceInstanceHandler,
+			Public:      true,
+		},
+
+		{
+			Name:        registerHeartbeatServiceInstanceName,
+			Method:      http.MethodPost,
+			Pattern:     deploymentInstanceAliveRoute,
+			HandlerFunc: s.registerHeartbeatServiceInstanceHandler,
+			Public:      true,
+		},
+
+		{
+			Name:        getInstancesName,
+			Method:      http.MethodGet,
+			Pattern:     instancesRoute,
+			HandlerFunc: s.getInstancesHandler,
+		},
+
+		{
+			Name:        instanceHealthName,
+			Method:      http.MethodPut,
+			Pattern:     deploymentInstanceHealthRoute,
+			HandlerFunc: s.instanceHealthHandler,
+		},
+
+		{
+			Name:        registerServiceInstanceName,
+			Method:      http.MethodPost,
+			Pattern:     deploymentInstanceRoute,
+			HandlerFunc: s.registerServiceInstanceHandler,
+		},
+
+		{
+			Name:        deleteServiceInstanceName,
+			Method:      http.MethodDelete,
+			Pattern:     deploymentInstanceRoute,
+			HandlerFunc: s.deleteServiceInstanceHandler,
+		},
+	}
 }
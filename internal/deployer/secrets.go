@@ -0,0 +1,400 @@
+package deployer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// secretsStore keeps the secrets in a file encrypted with AES-GCM, rewritten on every change
+	secretsStore struct {
+		filename string
+		aead     cipher.AEAD
+		secrets  map[string]*storedSecret
+		lock     sync.RWMutex
+	}
+
+	// storedSecret is a secret with the users whose deployments may reference it
+	storedSecret struct {
+		Values api.SecretDTO
+		Users  []string
+	}
+)
+
+func loadSecretsStore(keyFilename, filename string) *secretsStore {
+	if keyFilename == "" {
+		log.Info("no secrets key file, secrets store is disabled")
+		return nil
+	}
+
+	keyBytes, err := ioutil.ReadFile(keyFilename)
+	if err != nil {
+		panic(errors.Wrap(err, "error reading secrets key"))
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(keyBytes)))
+	if err != nil {
+		panic(errors.Wrap(err, "error decoding secrets key"))
+	} else if len(key) != 32 {
+		panic(errors.Errorf("secrets key has %d bytes instead of 32", len(key)))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+
+	store := &secretsStore{
+		filename: filename,
+		aead:     aead,
+		secrets:  map[string]*storedSecret{},
+	}
+
+	sealed, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return store
+	} else if err != nil {
+		panic(errors.Wrap(err, "error reading secrets file"))
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(sealed) < nonceSize {
+		panic(errors.Errorf("secrets file %s is corrupted", filename))
+	}
+
+	plain, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		panic(errors.Wrap(err, "error decrypting secrets file"))
+	}
+
+	store.secrets, err = parseSecrets(plain)
+	if err != nil {
+		panic(errors.Wrap(err, "error parsing secrets file"))
+	}
+
+	log.Infof("loaded %d secrets", len(store.secrets))
+
+	return store
+}
+
+// parseSecrets parses the secrets file. Secrets saved before they had users are only for deployments of admins.
+func parseSecrets(plain []byte) (map[string]*storedSecret, error) {
+	var rawSecrets map[string]json.RawMessage
+	err := json.Unmarshal(plain, &rawSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string]*storedSecret, len(rawSecrets))
+	for secretName, rawSecret := range rawSecrets {
+		secret := &storedSecret{}
+
+		decoder := json.NewDecoder(bytes.NewReader(rawSecret))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(secret); err != nil {
+			secret = &storedSecret{}
+			if err = json.Unmarshal(rawSecret, &secret.Values); err != nil {
+				return nil, errors.Wrapf(err, "error parsing secret %s", secretName)
+			}
+		}
+
+		secrets[secretName] = secret
+	}
+
+	return secrets, nil
+}
+
+func (s *secretsStore) get(secretName string) (*storedSecret, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	secret, ok := s.secrets[secretName]
+	return secret, ok
+}
+
+func (s *secretsStore) set(secretName string, secret *storedSecret) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.secrets[secretName] = secret
+
+	return s.save()
+}
+
+func (s *secretsStore) delete(secretName string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.secrets[secretName]; !ok {
+		return false, nil
+	}
+
+	delete(s.secrets, secretName)
+
+	return true, s.save()
+}
+
+// save writes to a temporary file that then replaces the previous one, so a failed write does not lose the
+// secrets. Must be called with the lock held.
+func (s *secretsStore) save() error {
+	plain, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+
+	tmpFilename := s.filename + ".tmp"
+	err = ioutil.WriteFile(tmpFilename, s.aead.Seal(nonce, nonce, plain, nil), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFilename, s.filename)
+}
+
+func (s *Server) setSecretHandler(w http.ResponseWriter, r *http.Request) {
+	secretName := utils.ExtractPathVar(r, secretNamePathVar)
+
+	if s.secrets == nil {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	var reqBody api.SetSecretRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil || len(reqBody.Values) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = s.secrets.set(secretName, &storedSecret{
+		Values: reqBody.Values,
+		Users:  reqBody.Users,
+	})
+	if err != nil {
+		log.Errorf("error saving secret %s: %s", secretName, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugf("set secret %s with %d keys for users %v", secretName, len(reqBody.Values), reqBody.Users)
+}
+
+func (s *Server) deleteSecretHandler(w http.ResponseWriter, r *http.Request) {
+	secretName := utils.ExtractPathVar(r, secretNamePathVar)
+
+	if s.secrets == nil {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	deleted, err := s.secrets.delete(secretName)
+	if err != nil {
+		log.Errorf("error deleting secret %s: %s", secretName, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if !deleted {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	log.Debugf("deleted secret %s", secretName)
+}
+
+// getDeploymentSecretsHandler replies to a child with the secrets the deployment references, so it can start
+// instances. When using TLS, only children of the deployment get them, and with node tokens only nodes do.
+// Without either, any caller would be trusted, so secrets are never served.
+func (s *Server) getDeploymentSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+
+	if !s.security.TLS.IsEnabled() && !s.authEnabled {
+		log.Warnf("refused secrets of %s to %s, callers can not be identified without TLS or auth tokens",
+			deploymentId, r.RemoteAddr)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if !s.hTable.hasDeployment(deploymentId) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if s.security.TLS.IsEnabled() {
+		childId, _ := utils.GetRequestIdentity(r)
+		if _, ok := s.hTable.getChildren(deploymentId)[childId]; !ok {
+			log.Warnf("refused secrets of %s to %s, that is not a child", deploymentId, childId)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	deploymentSecrets, status := s.resolveDeploymentSecrets(deploymentId)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	var resp api.GetDeploymentSecretsResponseBody
+	resp = deploymentSecrets
+
+	utils.SendJSONReplyOK(w, resp)
+}
+
+// resolveDeploymentSecrets gets the secrets referenced by the deployment from the secrets store if this node is
+// the root of the deployment or from the parent otherwise. Only the referenced keys are returned.
+func (s *Server) resolveDeploymentSecrets(deploymentId string) (map[string]api.SecretDTO, int) {
+	refs, ok := s.getDeploymentSecretRefs(deploymentId)
+	if !ok {
+		return nil, http.StatusNotFound
+	} else if len(refs) == 0 {
+		return map[string]api.SecretDTO{}, http.StatusOK
+	}
+
+	if parent := s.hTable.getParent(deploymentId); parent != nil {
+		depClient := s.getDeployerClient(parent.Addr)
+		return depClient.GetDeploymentSecrets(deploymentId)
+	}
+
+	if s.secrets == nil {
+		log.Errorf("deployment %s references secrets but the secrets store is disabled", deploymentId)
+		return nil, http.StatusConflict
+	}
+
+	// the secrets may have changed since the deployment was registered, so they are checked again
+	owner, _ := s.hTable.getOwner(deploymentId)
+
+	deploymentSecrets := map[string]api.SecretDTO{}
+	for _, ref := range refs {
+		secret, ok := s.secrets.get(ref.Name)
+		if !ok {
+			log.Errorf("deployment %s references missing secret %s", deploymentId, ref.Name)
+			return nil, http.StatusNotFound
+		}
+
+		if !s.canUseSecret(owner, secret) {
+			log.Warnf("deployment %s of %s references secret %s, that is not for it", deploymentId, owner, ref.Name)
+			return nil, http.StatusForbidden
+		}
+
+		value, ok := secret.Values[ref.Key]
+		if !ok {
+			log.Errorf("deployment %s references missing key %s of secret %s", deploymentId, ref.Key, ref.Name)
+			return nil, http.StatusNotFound
+		}
+
+		if deploymentSecrets[ref.Name] == nil {
+			deploymentSecrets[ref.Name] = api.SecretDTO{}
+		}
+
+		deploymentSecrets[ref.Name][ref.Key] = value
+	}
+
+	return deploymentSecrets, http.StatusOK
+}
+
+// checkSecretRefs checks if deployments of the owner may reference the secrets the deployment references. Secrets
+// that do not exist yet are checked once the deployment resolves them.
+func (s *Server) checkSecretRefs(owner string, deployment *Deployment) bool {
+	for _, envVar := range deployment.SecretEnvVars {
+		secret, ok := s.secrets.get(envVar.Ref.Name)
+		if ok && !s.canUseSecret(owner, secret) {
+			log.Debugf("%s can not reference secret %s in %s", owner, envVar.Ref.Name, deployment.DeploymentId)
+			return false
+		}
+	}
+
+	return true
+}
+
+// canUseSecret checks if deployments of the user may reference the secret. Their owners can read it through exec,
+// so only the users of the secret and admins may, unless requests are not authenticated.
+func (s *Server) canUseSecret(user string, secret *storedSecret) bool {
+	if !s.authEnabled || s.isAdmin(user) {
+		return true
+	}
+
+	for _, secretUser := range secret.Users {
+		if secretUser == user {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) getDeploymentSecretRefs(deploymentId string) ([]*api.SecretKeyRefYAML, bool) {
+	dto, ok := s.hTable.deploymentToDTO(deploymentId)
+	if !ok {
+		return nil, false
+	}
+
+	var deploymentYAML api.DeploymentYAML
+	err := yaml.Unmarshal(dto.DeploymentYAMLBytes, &deploymentYAML)
+	if err != nil {
+		panic(err)
+	}
+
+	var refs []*api.SecretKeyRefYAML
+	for _, container := range deploymentYAML.Spec.Template.Spec.Containers {
+		for _, envVar := range container.Env {
+			if envVar.ValueFrom != nil && envVar.ValueFrom.SecretKeyRef != nil {
+				refs = append(refs, envVar.ValueFrom.SecretKeyRef)
+			}
+		}
+	}
+
+	return refs, true
+}
+
+// resolveEnvVars returns the environment variables of the deployment with the secret ones resolved. They are
+// only handed to the local scheduler, so they must not be logged or stored.
+func (s *Server) resolveEnvVars(deploymentId string, deployment *Deployment) ([]string, bool) {
+	if len(deployment.SecretEnvVars) == 0 {
+		return deployment.EnvVars, true
+	}
+
+	deploymentSecrets, status := s.resolveDeploymentSecrets(deploymentId)
+	if status != http.StatusOK {
+		log.Errorf("got status %d resolving secrets of %s", status, deploymentId)
+		return nil, false
+	}
+
+	envVars := append([]string{}, deployment.EnvVars...)
+	for _, envVar := range deployment.SecretEnvVars {
+		value, ok := deploymentSecrets[envVar.Ref.Name][envVar.Ref.Key]
+		if !ok {
+			log.Errorf("missing key %s of secret %s for %s", envVar.Ref.Key, envVar.Ref.Name, deploymentId)
+			return nil, false
+		}
+
+		envVars = append(envVars, envVar.Name+"="+value)
+	}
+
+	return envVars, true
+}
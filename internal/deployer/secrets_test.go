@@ -0,0 +1,19 @@
+package deployer
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSecretsNeedIdentifiedCallers(t *testing.T) {
+	servers, _ := newTestDeployers(t, nil, "n0", "n1")
+
+	addTestDeployment(servers["n0"], nil)
+	servers["n0"].hTable.addChild(testDeploymentId, servers["n1"].myself)
+
+	// without TLS or auth tokens, the child can not be told apart from any other caller
+	_, status := servers["n1"].getDeployerClient("n0").GetDeploymentSecrets(testDeploymentId)
+	if status != http.StatusForbidden {
+		t.Fatalf("expected secrets to be refused, got %d", status)
+	}
+}
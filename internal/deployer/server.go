@@ -0,0 +1,263 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/archimedes"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/autonomic"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/scheduler"
+	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	serviceName = "DEPLOYER"
+
+	// the autonomic system may take a while to come up, so the location is asked with an increasing backoff
+	initialLocationBackoff = 100 * time.Millisecond
+	maxLocationBackoff     = 5 * time.Second
+)
+
+type (
+	// Server is the deployer of a node, which keeps its place in the deployment trees. Every piece of state lives
+	// in it, so several can run in the same process.
+	Server struct {
+		*utils.Server
+
+		config         *config.Config
+		deployerConfig *config.DeployerConfig
+		transport      *utils.Transport
+		security       *utils.Security
+		listener       net.Listener
+
+		hostname string
+		location *publicUtils.Location
+		myself   *utils.Node
+
+		authTokens  []*authToken
+		authEnabled bool
+
+		archimedesClient  *archimedes.Client
+		schedulerClient   *scheduler.Client
+		archimedesClients *archimedes.ClientPool
+		autonomicClients  *autonomic.ClientPool
+		// deployerClients has the clients of the other deployers. Every client of a node shares one HTTP/2
+		// connection to it.
+		deployerClients *deployer.ClientPool
+
+		// controlStreams has the open control stream to each neighbour, as a *deployer.ControlStream
+		controlStreams sync.Map
+		// controlStreamLocks has a *sync.Mutex per neighbour, so opening a stream to a neighbour that does not
+		// answer only holds back the frames to that neighbour
+		controlStreamLocks sync.Map
+		// neighbourHeartbeats has the last heartbeat of each neighbour, as a *api.NeighbourDTO
+		neighbourHeartbeats sync.Map
+
+		myAlternatives       sync.Map
+		nodeAlternatives     map[string][]*utils.Node
+		nodeAlternativesLock sync.RWMutex
+
+		hTable *hierarchyTable
+		pTable *parentsTable
+
+		serviceLocations       sync.Map
+		addServiceLocationLock sync.Mutex
+
+		suspectedChild       sync.Map
+		suspectedDeployments sync.Map
+		children             sync.Map
+
+		exploring  sync.Map
+		migrations sync.Map
+
+		heartbeatsMap sync.Map
+		initChansMap  sync.Map
+
+		// serializes config map updates, which rewrite the deployment YAML kept in the hierarchy table
+		configMapsLock sync.Mutex
+
+		events       *eventBus
+		fallbacks    *fallbackRegistry
+		rootReplicas *rootReplication
+		secrets      *secretsStore
+
+		fdConfig         *config.FailureDetectorConfig
+		parentsDetector  failureDetector
+		childrenDetector failureDetector
+
+		timer *time.Timer
+	}
+
+	Option func(s *Server)
+)
+
+// WithConfig sets the configuration of the deployer, instead of the one of the process
+func WithConfig(conf *config.Config) Option {
+	return func(s *Server) {
+		s.config = conf
+	}
+}
+
+// WithTransport sets the transport the clients of the deployer do their requests with
+func WithTransport(transport *utils.Transport) Option {
+	return func(s *Server) {
+		s.transport = transport
+	}
+}
+
+// WithListener makes the deployer serve on the listener, instead of listening on the configured port
+func WithListener(listener net.Listener) Option {
+	return func(s *Server) {
+		s.listener = listener
+	}
+}
+
+// WithHostname sets the hostname of the node, which is its id, instead of the one of the machine
+func WithHostname(hostname string) Option {
+	return func(s *Server) {
+		s.hostname = hostname
+	}
+}
+
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		nodeAlternatives: map[string][]*utils.Node{},
+		pTable:           newParentsTable(),
+		events:           newEventBus(),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.config == nil {
+		s.config = config.Get()
+	}
+
+	security, err := s.config.Server.Security()
+	if err != nil {
+		panic(err)
+	}
+	s.security = security
+
+	if s.transport == nil {
+		s.transport = utils.NewTransport(nil, s.security)
+	}
+
+	if s.hostname == "" {
+		s.hostname, err = os.Hostname()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	s.myself = utils.NewNode(s.hostname, s.hostname)
+	if id, ok := s.security.TLS.Identity(); ok {
+		if id != s.hostname {
+			log.Warnf("certificate identity %s does not match hostname %s", id, s.hostname)
+		}
+
+		s.myself = utils.NewNode(id, s.hostname)
+	}
+
+	s.deployerConfig = &s.config.Deployer
+	s.fdConfig = &s.deployerConfig.FailureDetector
+
+	s.archimedesClients = archimedes.NewClientPool(s.transport)
+	s.autonomicClients = autonomic.NewClientPool(s.transport)
+	s.deployerClients = deployer.NewClientPool(s.transport)
+	s.archimedesClient = s.archimedesClients.Get(s.config.Archimedes.HostPort())
+	s.schedulerClient = scheduler.NewClientPool(s.transport).Get(s.config.Scheduler.HostPort())
+
+	s.hTable = newHierarchyTable(s)
+
+	s.loadAuthTokens(s.deployerConfig.AuthTokensFile)
+	s.secrets = loadSecretsStore(s.deployerConfig.SecretsKeyFile, s.deployerConfig.SecretsFile)
+	if s.secrets != nil && !security.TLS.IsEnabled() && !s.authEnabled {
+		log.Warn("secrets are not served to children, since they can not be identified without TLS or auth tokens")
+	}
+	s.rootReplicas = s.loadRootReplication(s.deployerConfig.RootReplicas, s.deployerConfig.RootReplicationFile)
+	s.fallbacks = s.loadFallbacks(s.deployerConfig.FallbacksFile)
+
+	s.parentsDetector = newFailureDetector(s.fdConfig, s)
+	s.childrenDetector = newFailureDetector(s.fdConfig, s)
+
+	s.Server = utils.NewServer(serviceName, api.PrefixPath, s.routes(), security.TLS)
+
+	return s
+}
+
+// Start gets the location of the node from the autonomic system, waiting for it to come up unless the server is
+// stopped meanwhile, starts the background loops and starts serving
+func (s *Server) Start() error {
+	if s.listener == nil {
+		var err error
+		s.listener, err = utils.Listen(s.config.Server.ListenAddr, s.deployerConfig.Port)
+		if err != nil {
+			return errors.Wrap(err, "error listening")
+		}
+	}
+
+	s.timer = time.NewTimer(s.deployerConfig.SendAlternativesInterval)
+
+	s.simulateAlternatives()
+
+	var (
+		status  int
+		backoff = initialLocationBackoff
+	)
+	for {
+		s.location, status = s.hTable.autonomicClient.GetLocation()
+		if status == http.StatusOK {
+			break
+		}
+
+		log.Debugf("got status %d asking for the location, retrying in %s", status, backoff)
+
+		if !s.Sleep(backoff) {
+			return errors.New("stopped before getting the location of the node")
+		}
+
+		backoff *= 2
+		if backoff > maxLocationBackoff {
+			backoff = maxLocationBackoff
+		}
+	}
+
+	log.Debugf("got location %f", s.location)
+
+	if s.deployerConfig.EventsForwardUp {
+		s.Go(s.forwardEventsUp)
+	}
+
+	s.Go(s.instanceHeartbeatChecker)
+	s.Go(s.sendHeartbeatsPeriodically)
+	s.Go(s.sendAlternativesPeriodically)
+	s.Go(s.checkParentHeartbeatsPeriodically)
+	s.Go(s.checkChildrenHeartbeatsPeriodically)
+	s.Go(s.fallbacks.checkPeriodically)
+
+	if s.rootReplicas != nil && s.rootReplicas.isReplica {
+		s.Go(s.rootReplicas.run)
+	}
+
+	s.Serve(s.listener)
+
+	return nil
+}
+
+// Stop stops serving and the background loops. The deployments stay as they are, since the other nodes find out
+// the node is gone through their failure detectors.
+func (s *Server) Stop(ctx context.Context) error {
+	return s.Shutdown(ctx)
+}
@@ -0,0 +1,130 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/pkg/errors"
+)
+
+// testNetwork connects the deployers of a test by id, on loopback, and can cut the links between them
+type testNetwork struct {
+	addrs   map[string]string
+	blocked map[[2]string]bool
+	lock    sync.Mutex
+}
+
+func (n *testNetwork) block(fromId, toId string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.blocked[[2]string{fromId, toId}] = true
+}
+
+func (n *testNetwork) dialFrom(fromId string) utils.DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		toId, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		n.lock.Lock()
+		toAddr, ok := n.addrs[toId]
+		blocked := n.blocked[[2]string{fromId, toId}]
+		n.lock.Unlock()
+
+		if !ok || blocked {
+			return nil, errors.Errorf("%s can not reach %s", fromId, toId)
+		}
+
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, toAddr)
+	}
+}
+
+// newTestDeployers returns a deployer serving, but not started, for each id, configured by configure if given
+func newTestDeployers(t *testing.T, configure func(id string, conf *config.Config),
+	ids ...string) (map[string]*Server, *testNetwork) {
+	t.Helper()
+
+	network := &testNetwork{
+		addrs:   map[string]string{},
+		blocked: map[[2]string]bool{},
+	}
+
+	servers := map[string]*Server{}
+	for _, id := range ids {
+		conf := config.Default()
+		conf.Deployer.FallbacksFile = ""
+		if configure != nil {
+			configure(id, conf)
+		}
+
+		listener, err := net.Listen(utils.TCP, "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		transport := utils.NewTransport(network.dialFrom(id), nil)
+		t.Cleanup(transport.CloseIdleConnections)
+
+		s := NewServer(WithConfig(conf), WithHostname(id), WithTransport(transport))
+		s.Serve(listener)
+		t.Cleanup(func() {
+			_ = s.Shutdown(context.Background())
+		})
+
+		network.lock.Lock()
+		network.addrs[id] = listener.Addr().String()
+		network.lock.Unlock()
+
+		servers[id] = s
+	}
+
+	return servers, network
+}
+
+func TestStopInterruptsStart(t *testing.T) {
+	network := &testNetwork{addrs: map[string]string{}, blocked: map[[2]string]bool{}}
+
+	listener, err := net.Listen(utils.TCP, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	conf := config.Default()
+	conf.Deployer.FallbacksFile = ""
+
+	// the autonomic system is not in the network, so the location never comes
+	s := NewServer(WithConfig(conf), WithHostname("n0"), WithTransport(utils.NewTransport(network.dialFrom("n0"), nil)),
+		WithListener(listener))
+
+	started := make(chan error, 1)
+	go func() {
+		started <- s.Start()
+	}()
+
+	time.Sleep(2 * initialLocationBackoff)
+
+	err = s.Stop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-started:
+		if err == nil {
+			t.Fatal("expected starting without the location to fail")
+		}
+	case <-time.After(maxLocationBackoff):
+		t.Fatal("expected stopping to interrupt the start")
+	}
+}
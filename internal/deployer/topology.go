@@ -0,0 +1,141 @@
+package deployer
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// time the root has to gather the whole topology
+	topologyTimeout = 5 * time.Second
+	// time each node keeps to reply to its parent after its children time out
+	topologyHopMargin = 200 * time.Millisecond
+)
+
+// getDeploymentTopologyHandler replies with the whole tree of the deployment. Nodes other than the root ask
+// their parent for it, replying with their own subtree if the parent does not reply.
+func (s *Server) getDeploymentTopologyHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+
+	if !s.hTable.hasDeployment(deploymentId) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if parent := s.hTable.getParent(deploymentId); parent != nil {
+		depClient := s.getDeployerClient(parent.Addr)
+		topology, status := depClient.GetDeploymentTopology(deploymentId)
+		if status == http.StatusOK {
+			utils.SendJSONReplyOK(w, topology)
+			return
+		}
+
+		log.Warnf("got status %d getting topology of %s from parent %s, replying with my subtree", status,
+			deploymentId, parent.Id)
+	}
+
+	var resp api.GetTopologyResponseBody
+	resp = *s.getTopology(deploymentId, time.Now().Add(topologyTimeout))
+
+	utils.SendJSONReplyOK(w, resp)
+}
+
+// getChildTopologyHandler replies to the parent with the subtree of the deployment below this node
+func (s *Server) getChildTopologyHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+	childId := utils.ExtractPathVar(r, nodeIdPathVar)
+
+	if childId != s.myself.Id || !s.hTable.hasDeployment(deploymentId) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	timeout := topologyTimeout
+	if timeoutMillis, err := strconv.Atoi(r.URL.Query().Get(api.TopologyTimeoutQueryParam)); err == nil {
+		timeout = time.Duration(timeoutMillis) * time.Millisecond
+	}
+
+	var resp api.GetTopologyResponseBody
+	resp = *s.getTopology(deploymentId, time.Now().Add(timeout))
+
+	utils.SendJSONReplyOK(w, resp)
+}
+
+// getTopology builds the subtree of the deployment below this node, asking the children for theirs in parallel.
+// Children have until a margin before the deadline to reply, so this node can still reply in time.
+func (s *Server) getTopology(deploymentId string, deadline time.Time) *api.TopologyNodeDTO {
+	topology := &api.TopologyNodeDTO{
+		Node:     s.myself,
+		Location: s.location,
+	}
+
+	entry, ok := s.hTable.getEntryDTO(deploymentId)
+	if !ok {
+		return topology
+	}
+
+	topology.Static = entry.Static
+	topology.IsOrphan = entry.IsOrphan
+	topology.LinkOnly = entry.LinkOnly
+
+	for instanceId, instanceDeploymentId := range s.getLocalInstances() {
+		if instanceDeploymentId == deploymentId {
+			topology.Instances = append(topology.Instances, instanceId)
+		}
+	}
+	sort.Strings(topology.Instances)
+
+	load, status := s.hTable.autonomicClient.GetLoadForService(deploymentId)
+	if status == http.StatusOK {
+		topology.Load = load
+	}
+
+	entryChildren := entry.Children
+	childTimeout := time.Until(deadline) - topologyHopMargin
+
+	childIds := make([]string, 0, len(entryChildren))
+	for childId := range entryChildren {
+		childIds = append(childIds, childId)
+	}
+	sort.Strings(childIds)
+
+	topology.Children = make([]*api.TopologyNodeDTO, len(childIds))
+
+	var wg sync.WaitGroup
+	for i, childId := range childIds {
+		child := entryChildren[childId]
+		topology.Children[i] = &api.TopologyNodeDTO{
+			Node:        child,
+			Unreachable: true,
+		}
+
+		if childTimeout <= 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, child *utils.Node) {
+			defer wg.Done()
+
+			depClient := s.getDeployerClient(child.Addr)
+			childTopology, childStatus := depClient.GetChildTopology(deploymentId, child.Id, childTimeout)
+			if childStatus != http.StatusOK {
+				log.Debugf("got status %d getting topology of %s from %s", childStatus, deploymentId, child.Id)
+				return
+			}
+
+			topology.Children[i] = childTopology
+		}(i, child)
+	}
+
+	wg.Wait()
+
+	return topology
+}
@@ -3,19 +3,31 @@ package deployer
 import (
 	"sync"
 
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
 	"github.com/docker/go-connections/nat"
 )
 
 type Deployment struct {
 	DeploymentId      string
 	NumberOfInstances int
-	Image             string
+	Image             *scheduler.ImageDTO
 	EnvVars           []string
+	SecretEnvVars     []*SecretEnvVar
 	Ports             nat.PortSet
 	Static            bool
+	Volumes           []*scheduler.VolumeDTO
+	ConfigMaps        []*scheduler.ConfigMapDTO
+	RestartPolicy     string
 	Lock              *sync.RWMutex
 }
 
+// SecretEnvVar is an environment variable with its value in a secret, only resolved when starting instances
+type SecretEnvVar struct {
+	Name string
+	Ref  *api.SecretKeyRefYAML
+}
+
 type PairServiceIdStatus struct {
 	ServiceId string
 	IsUp      bool
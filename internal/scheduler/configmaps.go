@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/scheduler/runtime"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// configMapLabel is set on the volumes holding config maps, besides the deployment label
+const configMapLabel = "cloud-edge-deployment.config-map"
+
+// Config maps are kept in a volume per deployment and config map, shared by all the instances of the deployment
+// in this node, so updating it once changes the files every instance sees
+func getConfigMapVolumeName(deploymentId, configMapName string) string {
+	return deploymentId + "-config-" + configMapName
+}
+
+func generateConfigMapMounts(deploymentId string, configMaps []*api.ConfigMapDTO) (mounts []*runtime.VolumeMount) {
+	for _, configMap := range configMaps {
+		mounts = append(mounts, &runtime.VolumeMount{
+			Name:   getConfigMapVolumeName(deploymentId, configMap.Name),
+			Target: configMap.MountPath,
+			Labels: map[string]string{
+				deploymentLabel:    deploymentId,
+				configMapLabel:     configMap.Name,
+				reclaimPolicyLabel: api.VolumeReclaimDelete,
+			},
+		})
+	}
+
+	return
+}
+
+// configMapToTar returns a tar with the config map files in a directory named as the base of its mount path, as
+// ImportVolume expects. Files are added in order, so the tar is the same for the same data.
+func configMapToTar(configMap *api.ConfigMapDTO) (*bytes.Buffer, error) {
+	dir := path.Base(configMap.MountPath)
+
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+
+	err := tarWriter.WriteHeader(&tar.Header{
+		Name:     dir + "/",
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filenames := make([]string, 0, len(configMap.Data))
+	for filename := range configMap.Data {
+		if filename == "" || strings.Contains(filename, "/") || filename == "." || filename == ".." {
+			return nil, errors.Errorf("invalid file %q in config map %s", filename, configMap.Name)
+		}
+
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		content := configMap.Data[filename]
+
+		err = tarWriter.WriteHeader(&tar.Header{
+			Name:     dir + "/" + filename,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(content)),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tarWriter.Write([]byte(content))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
+
+// writeConfigMaps copies the config map files into their volumes through the container. Files no longer in
+// the config map are left in place, since the copy only adds and replaces files.
+func (s *Server) writeConfigMaps(contId string, configMaps []*api.ConfigMapDTO) error {
+	for _, configMap := range configMaps {
+		content, err := configMapToTar(configMap)
+		if err != nil {
+			return err
+		}
+
+		err = s.containerRuntime.ImportVolume(contId, configMap.MountPath, content)
+		if err != nil {
+			return errors.Wrapf(err, "error writing config map %s", configMap.Name)
+		}
+	}
+
+	return nil
+}
+
+// updateConfigMapHandler writes the new config map through one of the containers of the deployment and sends
+// the reload signal to the running ones. Deployments without containers in this node get the new config map
+// when their instances are started.
+func (s *Server) updateConfigMapHandler(w http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+	configMapName := utils.ExtractPathVar(r, configMapNamePathVar)
+
+	var reqBody api.UpdateConfigMapRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil || reqBody.Name != configMapName || reqBody.MountPath == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("updating config map %s of deployment %s", configMapName, deploymentId)
+
+	containers, err := s.containerRuntime.ListContainers(map[string]string{deploymentLabel: deploymentId})
+	if err != nil {
+		log.Errorf("error listing containers of deployment %s: %s", deploymentId, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(containers) == 0 {
+		return
+	}
+
+	// running containers go first, since copying into stopped ones is not supported by every runtime
+	sort.SliceStable(containers, func(i, j int) bool {
+		return containers[i].Running && !containers[j].Running
+	})
+
+	err = s.writeConfigMaps(containers[0].Id, []*api.ConfigMapDTO{&reqBody})
+	if err != nil {
+		log.Errorf("error updating config map %s of deployment %s: %s", configMapName, deploymentId, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if reqBody.ReloadSignal == "" {
+		return
+	}
+
+	for _, cont := range containers {
+		if !cont.Running {
+			continue
+		}
+
+		err = s.containerRuntime.SignalContainer(cont.Id, reqBody.ReloadSignal)
+		if err != nil {
+			log.Warnf("error sending %s to container %s: %s", reqBody.ReloadSignal, cont.Id, err)
+		}
+	}
+}
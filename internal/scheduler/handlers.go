@@ -1,22 +1,16 @@
 package scheduler
 
 import (
-	"context"
 	"encoding/json"
 	"io"
 	"net"
 	"net/http"
-	"os"
 	"strconv"
-	"sync"
 	"time"
 
 	api "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/scheduler/runtime"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
-	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -24,217 +18,421 @@ import (
 
 type (
 	typeInstanceToContainerMapKey   = string
-	typeInstanceToContainerMapValue = string
+	typeInstanceToContainerMapValue = *instance
+
+	instance struct {
+		ContainerId   string
+		DeploymentId  string
+		Slot          int
+		Volumes       []*api.VolumeDTO
+		RestartPolicy string
+	}
 )
 
+// Labels set on the containers created by the scheduler
 const (
-	stopContainerTimeout = 10
-
-	networkName = "scheduler-network"
+	deploymentLabel    = "cloud-edge-deployment.deployment"
+	instanceLabel      = "cloud-edge-deployment.instance"
+	slotLabel          = "cloud-edge-deployment.slot"
+	restartPolicyLabel = "cloud-edge-deployment.restart-policy"
 )
 
-var (
-	deployerClient      = deployer.NewDeployerClient(deployer.DefaultHostPort)
-	dockerClient        *client.Client
-	networkId           string
-	instanceToContainer sync.Map
-
-	stopContainerTimeoutVar = stopContainerTimeout * time.Second
+const (
+	stopContainerTimeout = 10 * time.Second
 )
 
-func InitHandlers() {
-
-	log.SetLevel(log.DebugLevel)
+func (s *Server) startInstanceHandler(w http.ResponseWriter, r *http.Request) {
+	log.Debug("handling start instance")
 
-	var err error
-	dockerClient, err = client.NewEnvClient()
+	var containerInstance api.ContainerInstanceDTO
+	err := json.NewDecoder(r.Body).Decode(&containerInstance)
 	if err != nil {
-		log.Error("unable to create docker client")
-		panic(err)
+		log.Error(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	instanceToContainer = sync.Map{}
+	if containerInstance.ServiceName == "" || containerInstance.Image == nil ||
+		containerInstance.Image.Name == "" {
+		// the instance is not logged, since its environment variables may have resolved secrets
+		log.Errorf("invalid container instance of %q", containerInstance.ServiceName)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	go s.startContainerAsync(&containerInstance)
+}
+
+func (s *Server) stopInstanceHandler(w http.ResponseWriter, r *http.Request) {
+	log.Debug("handling delete instance")
+
+	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
+
+	if instanceId == "" {
+		log.Error("no instance provided")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
-	networkConfig := types.NetworkCreate{
-		CheckDuplicate: false,
-		Attachable:     false,
+	value, ok := s.instanceToContainer.Load(instanceId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	networks, err := dockerClient.NetworkList(context.Background(), types.NetworkListOptions{})
+	go s.stopContainerAsync(instanceId, value.(typeInstanceToContainerMapValue))
+}
 
-	exists := false
-	for _, network := range networks {
-		if network.Name == networkName {
-			networkId = network.ID
-			exists = true
-			break
-		}
+func (s *Server) stopAllInstancesHandler(_ http.ResponseWriter, _ *http.Request) {
+	s.deleteAllInstances()
+}
+
+func (s *Server) deleteDeploymentHandler(_ http.ResponseWriter, r *http.Request) {
+	deploymentId := utils.ExtractPathVar(r, deploymentIdPathVar)
+
+	log.Debugf("handling delete deployment %s", deploymentId)
+
+	go s.deleteDeploymentAsync(deploymentId)
+}
+
+func (s *Server) getInstanceStatsHandler(w http.ResponseWriter, r *http.Request) {
+	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
+
+	value, ok := s.instanceToContainer.Load(instanceId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	if !exists {
-		var resp types.NetworkCreateResponse
-		resp, err = dockerClient.NetworkCreate(context.Background(), networkName, networkConfig)
-		if err != nil {
-			panic(err)
-		}
+	stats, err := s.containerRuntime.ContainerStats(value.(typeInstanceToContainerMapValue).ContainerId)
+	if err != nil {
+		log.Errorf("error getting stats for instance %s: %s", instanceId, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-		networkId = resp.ID
-		log.Debug("created network with id ", networkId)
-	} else {
-		log.Debug("network ", networkName, " already exists")
+	var resp api.GetInstanceStatsResponseBody
+	resp = api.InstanceStatsDTO{
+		CPUPercentage: stats.CPUPercentage,
+		MemoryUsage:   stats.MemoryUsage,
+		MemoryLimit:   stats.MemoryLimit,
 	}
 
-	log.SetLevel(log.InfoLevel)
+	utils.SendJSONReplyOK(w, resp)
 }
 
-func startInstanceHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debug("handling start instance")
+func (s *Server) getInstanceLogsHandler(w http.ResponseWriter, r *http.Request) {
+	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
 
-	var containerInstance api.ContainerInstanceDTO
-	err := json.NewDecoder(r.Body).Decode(&containerInstance)
+	options, err := api.LogsOptionsFromQuery(r.URL.Query())
 	if err != nil {
-		log.Error(err)
+		log.Debug(err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	if containerInstance.ServiceName == "" || containerInstance.ImageName == "" {
-		log.Errorf("invalid container instance: %v", containerInstance)
-		w.WriteHeader(http.StatusBadRequest)
+	value, ok := s.instanceToContainer.Load(instanceId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	go startContainerAsync(&containerInstance)
-}
+	logs, err := s.containerRuntime.ContainerLogs(value.(typeInstanceToContainerMapValue).ContainerId,
+		&runtime.LogsOptions{
+			Follow: options.Follow,
+			Tail:   options.Tail,
+			Since:  options.Since,
+		})
+	if err != nil {
+		log.Errorf("error getting logs for instance %s: %s", instanceId, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-func stopInstanceHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debug("handling delete instance")
+	err = utils.SendStreamReplyOK(w, r, "text/plain", logs)
+	if err != nil {
+		log.Debugf("error streaming logs of instance %s: %s", instanceId, err)
+	}
+}
 
+// execInstanceHandler runs a command in the instance, streaming its stdin from the request body and its output
+// to the response body. It needs HTTP/2, since the request body is read while the response is written.
+func (s *Server) execInstanceHandler(w http.ResponseWriter, r *http.Request) {
 	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
+	cmd := r.URL.Query()[api.ExecCmdQueryParam]
 
-	if instanceId == "" {
-		log.Errorf("no instance provided", instanceId)
+	// exec is only for the local deployer, which proves it with its certificate when using TLS or with the node
+	// token, shared with this scheduler, when not
+	if !s.security.TLS.IsEnabled() && !utils.IsAuthorized(r, s.security.AuthToken) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if len(cmd) == 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	value, ok := instanceToContainer.Load(instanceId)
+	value, ok := s.instanceToContainer.Load(instanceId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	contId := value.(typeInstanceToContainerMapValue)
-	go stopContainerAsync(instanceId, contId)
-}
+	log.Debugf("handling exec of %v in instance %s", cmd, instanceId)
+
+	session, err := s.containerRuntime.Exec(value.(typeInstanceToContainerMapValue).ContainerId, cmd)
+	if err != nil {
+		log.Errorf("error executing %v in instance %s: %s", cmd, instanceId, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	go func() {
+		_, copyErr := io.Copy(session, r.Body)
+		if copyErr != nil {
+			log.Debugf("error copying stdin to exec in instance %s: %s", instanceId, copyErr)
+		}
+
+		closeErr := session.CloseStdin()
+		if closeErr != nil {
+			log.Debugf("error closing stdin of exec in instance %s: %s", instanceId, closeErr)
+		}
+	}()
+
+	w.Header().Set("Trailer", api.ExecExitCodeTrailer)
+
+	err = utils.SendStreamReplyOK(w, r, "application/octet-stream", session)
+	if err != nil {
+		log.Debugf("error streaming exec output of instance %s: %s", instanceId, err)
+	}
+
+	exitCode, err := session.Wait()
+	if err != nil {
+		log.Errorf("error waiting for exec in instance %s: %s", instanceId, err)
+		return
+	}
 
-func stopAllInstancesHandler(_ http.ResponseWriter, _ *http.Request) {
-	deleteAllInstances()
+	w.Header().Set(api.ExecExitCodeTrailer, strconv.Itoa(exitCode))
 }
 
-func startContainerAsync(containerInstance *api.ContainerInstanceDTO) {
-	portBindings := generatePortBindings(containerInstance.Ports)
+// getVolumeSnapshotHandler streams the contents of a volume of the instance to the scheduler of the node taking it
+// over in a migration
+func (s *Server) getVolumeSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	instanceId := utils.ExtractPathVar(r, instanceIdPathVar)
+	volumeName := utils.ExtractPathVar(r, volumeNamePathVar)
 
-	//
-	// Create container and get containers id in response
-	//
-	instanceId := containerInstance.ServiceName + "-" + utils.RandomString(10)
+	// as with exec, only nodes get volumes, proving it with their certificate when using TLS or with the node
+	// token when not
+	if !s.security.TLS.IsEnabled() && !utils.IsAuthorized(r, s.security.AuthToken) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
 
-	log.Debugf("instance %s has following portBindings: %+v", instanceId, portBindings)
+	log.Debugf("handling snapshot of volume %s from instance %s", volumeName, instanceId)
 
-	serviceIdEnvVar := utils.ServiceEnvVarName + "=" + containerInstance.ServiceName
-	instanceIdEnvVar := utils.InstanceEnvVarName + "=" + instanceId
+	value, ok := s.instanceToContainer.Load(instanceId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 
-	envVars := []string{serviceIdEnvVar, instanceIdEnvVar}
-	envVars = append(envVars, containerInstance.EnvVars...)
+	inst := value.(typeInstanceToContainerMapValue)
+	mountPath, ok := getVolumeMountPath(inst.Volumes, volumeName)
+	if !ok {
+		log.Debugf("instance %s has no volume %s", instanceId, volumeName)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 
-	out, err := dockerClient.ImagePull(context.Background(), containerInstance.ImageName, types.ImagePullOptions{})
+	content, err := s.containerRuntime.ExportVolume(inst.ContainerId, mountPath)
 	if err != nil {
-		panic(err)
+		log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	defer func() {
-		err = out.Close()
+		err = content.Close()
 		if err != nil {
-			panic(err)
+			log.Error(err)
 		}
 	}()
 
-	_, err = io.Copy(os.Stdout, out)
+	w.Header().Set("Content-Type", "application/x-tar")
+	_, err = io.Copy(w, content)
 	if err != nil {
-		panic(err)
+		log.Errorf("error streaming volume %s from instance %s: %s", volumeName, instanceId, err)
 	}
+}
 
-	containerConfig := container.Config{
-		Env:   envVars,
-		Image: containerInstance.ImageName,
+func (s *Server) startContainerAsync(containerInstance *api.ContainerInstanceDTO) {
+	instanceId := containerInstance.ServiceName + "-" + utils.RandomString(10)
+
+	err := s.startContainer(instanceId, containerInstance)
+	if err != nil {
+		s.reportInstanceFailed(containerInstance.ServiceName, instanceId, err)
+	}
+}
+
+// startContainer creates and starts the container of the instance, undoing what it did if any step fails
+func (s *Server) startContainer(instanceId string, containerInstance *api.ContainerInstanceDTO) error {
+	portBindings := generatePortBindings(containerInstance.Ports)
+
+	log.Debugf("instance %s has following portBindings: %+v", instanceId, portBindings)
+
+	serviceIdEnvVar := utils.ServiceEnvVarName + "=" + containerInstance.ServiceName
+	instanceIdEnvVar := utils.InstanceEnvVarName + "=" + instanceId
+
+	envVars := []string{serviceIdEnvVar, instanceIdEnvVar}
+	envVars = append(envVars, containerInstance.EnvVars...)
+
+	err := s.pullImage(containerInstance.Image)
+	if err != nil {
+		return errors.Wrap(err, "error pulling image")
 	}
 
-	hostConfig := container.HostConfig{
-		NetworkMode:  "bridge",
+	//
+	// Create container and get containers id in response
+	//
+	slot := s.acquireSlot(containerInstance.ServiceName)
+
+	spec := &runtime.ContainerSpec{
+		Name:  instanceId,
+		Image: containerInstance.Image.Name,
+		Env:   envVars,
+		Labels: map[string]string{
+			deploymentLabel:    containerInstance.ServiceName,
+			instanceLabel:      instanceId,
+			slotLabel:          strconv.Itoa(slot),
+			restartPolicyLabel: containerInstance.RestartPolicy,
+		},
 		PortBindings: portBindings,
+		Mounts: append(generateVolumeMounts(containerInstance.ServiceName, slot, containerInstance.Volumes),
+			generateConfigMapMounts(containerInstance.ServiceName, containerInstance.ConfigMaps)...),
 	}
 
-	cont, err := dockerClient.ContainerCreate(context.Background(), &containerConfig, &hostConfig,
-		nil, instanceId)
+	contId, err := s.containerRuntime.CreateContainer(spec)
 	if err != nil {
-		log.Error(dockerClient.ClientVersion())
-		panic(err)
+		s.releaseSlot(containerInstance.ServiceName, slot)
+		return errors.Wrap(err, "error creating container")
+	}
+
+	removeContainer := func() {
+		removeErr := s.containerRuntime.RemoveContainer(contId)
+		if removeErr != nil {
+			log.Errorf("error removing container %s: %s", contId, removeErr)
+		}
+		s.releaseSlot(containerInstance.ServiceName, slot)
 	}
 
-	err = dockerClient.NetworkConnect(context.Background(), networkId, cont.ID, nil)
+	err = s.writeConfigMaps(contId, containerInstance.ConfigMaps)
 	if err != nil {
-		panic(err)
+		removeContainer()
+		return errors.Wrap(err, "error writing config maps")
+	}
+
+	if containerInstance.Snapshot != nil {
+		err = s.restoreVolumes(contId, containerInstance.Volumes, containerInstance.Snapshot)
+		if err != nil {
+			removeContainer()
+			return errors.Wrap(err, "error restoring volumes")
+		}
 	}
 
 	//
 	// Add container instance to archimedes
 	//
-	status := deployerClient.RegisterServiceInstance(containerInstance.ServiceName, instanceId,
+	status := s.deployerClient.RegisterServiceInstance(containerInstance.ServiceName, instanceId,
 		containerInstance.Static,
 		portBindings, true)
 
 	if status != http.StatusOK {
-		err = dockerClient.ContainerStop(context.Background(), cont.ID, &stopContainerTimeoutVar)
-		if err != nil {
-			log.Error(err)
-		}
-		log.Fatalf("got status code %d while adding instances to archimedes", status)
-		return
+		removeContainer()
+		return errors.Errorf("got status code %d while registering instance", status)
 	}
 
+	// stored before starting so an early exit of the container is already handled by the restart policy
+	s.instanceToContainer.Store(instanceId, &instance{
+		ContainerId:   contId,
+		DeploymentId:  containerInstance.ServiceName,
+		Slot:          slot,
+		Volumes:       containerInstance.Volumes,
+		RestartPolicy: containerInstance.RestartPolicy,
+	})
+
 	//
 	// Spin container up
 	//
-	err = dockerClient.ContainerStart(context.Background(), cont.ID, types.ContainerStartOptions{})
+	err = s.containerRuntime.StartContainer(contId)
 	if err != nil {
-		panic(err)
+		s.instanceToContainer.Delete(instanceId)
+		removeContainer()
+
+		status = s.deployerClient.DeleteServiceInstance(containerInstance.ServiceName, instanceId)
+		if status != http.StatusOK {
+			log.Errorf("got status %d deleting instance %s", status, instanceId)
+		}
+
+		return errors.Wrap(err, "error starting container")
 	}
 
-	instanceToContainer.Store(instanceId, cont.ID)
+	log.Debugf("container %s started for instance %s", contId, instanceId)
 
-	log.Debugf("container %s started for instance %s", cont.ID, instanceId)
+	return nil
 }
 
-func stopContainerAsync(instanceId, contId string) {
-	err := dockerClient.ContainerStop(context.Background(), contId, &stopContainerTimeoutVar)
+func (s *Server) stopContainerAsync(instanceId string, inst *instance) {
+	// removed before stopping so the container exit is not taken as a failure
+	s.instanceToContainer.Delete(instanceId)
+	s.clearRestartState(instanceId)
+
+	err := s.containerRuntime.StopContainer(inst.ContainerId, stopContainerTimeout)
 	if err != nil {
-		panic(err)
+		// the container may still be running, so its slot stays taken until the scheduler reconciles it
+		log.Errorf("error stopping container %s of instance %s: %s", inst.ContainerId, instanceId, err)
+		return
 	}
 
-	log.Debugf("deleted instance %s corresponding to container %s", instanceId, contId)
+	// the container is removed so its volumes can be reused by another instance or reclaimed
+	err = s.containerRuntime.RemoveContainer(inst.ContainerId)
+	if err != nil {
+		log.Errorf("error removing container %s: %s", inst.ContainerId, err)
+	}
+
+	s.releaseSlot(inst.DeploymentId, inst.Slot)
+
+	log.Debugf("deleted instance %s corresponding to container %s", instanceId, inst.ContainerId)
 }
 
-func deleteAllInstances() {
+func (s *Server) deleteDeploymentAsync(deploymentId string) {
+	s.instanceToContainer.Range(func(key, value interface{}) bool {
+		instanceId := key.(typeInstanceToContainerMapKey)
+		inst := value.(typeInstanceToContainerMapValue)
+
+		if inst.DeploymentId == deploymentId {
+			s.stopContainerAsync(instanceId, inst)
+		}
+
+		return true
+	})
+
+	s.reclaimVolumes(deploymentId)
+}
+
+func (s *Server) deleteAllInstances() {
 	log.Debugf("stopping all containers")
 
-	instanceToContainer.Range(func(key, value interface{}) bool {
-		instanceId := value.(typeInstanceToContainerMapKey)
-		contId := value.(typeInstanceToContainerMapValue)
+	s.instanceToContainer.Range(func(key, value interface{}) bool {
+		instanceId := key.(typeInstanceToContainerMapKey)
+		contId := value.(typeInstanceToContainerMapValue).ContainerId
+
+		s.instanceToContainer.Delete(instanceId)
+		s.clearRestartState(instanceId)
 
 		log.Debugf("stopping instance %s (container %s)", instanceId, contId)
 
-		err := dockerClient.ContainerStop(context.Background(), contId, &stopContainerTimeoutVar)
+		err := s.containerRuntime.StopContainer(contId, stopContainerTimeout)
 		if err != nil {
 			log.Warnf("error while stopping instance %s (container %s): %s", instanceId, contId, err)
 			return true
@@ -243,16 +441,22 @@ func deleteAllInstances() {
 		return true
 	})
 
-	containers, err := dockerClient.ContainerList(context.Background(), types.ContainerListOptions{})
+	// only containers created by a scheduler are considered, the rest of the host is left untouched
+	containers, err := s.containerRuntime.ListContainers(map[string]string{instanceLabel: ""})
 	if err != nil {
-		panic(err)
+		log.Errorf("error listing orphan containers: %s", err)
+		return
 	}
 
-	for _, containerListed := range containers {
-		log.Warnf("deleting orphan container %s", containerListed.ID)
-		err = dockerClient.ContainerStop(context.Background(), containerListed.ID, &stopContainerTimeoutVar)
+	for _, cont := range containers {
+		if !cont.Running {
+			continue
+		}
+
+		log.Warnf("deleting orphan container %s", cont.Id)
+		err = s.containerRuntime.StopContainer(cont.Id, stopContainerTimeout)
 		if err != nil {
-			log.Errorf("error stopping orphan container %s: %s", containerListed.ID, err)
+			log.Errorf("error stopping orphan container %s: %s", cont.Id, err)
 		}
 	}
 }
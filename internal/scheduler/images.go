@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/scheduler/runtime"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRegistry = "docker.io"
+)
+
+type (
+	typeImageLocksMapKey   = string
+	typeImageLocksMapValue = *sync.Mutex
+
+	// registryCredentials is an entry of the registry credentials file, which maps the names referenced by
+	// imagePullSecrets in the deployment YAML to the credentials for a registry
+	registryCredentials struct {
+		Server   string `json:"server"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+)
+
+func (s *Server) loadRegistryCredentials(credentialsFilePath string) error {
+	s.credentials = map[string]*registryCredentials{}
+
+	if credentialsFilePath == "" {
+		return nil
+	}
+
+	credentialsBytes, err := ioutil.ReadFile(credentialsFilePath)
+	if err != nil {
+		return errors.Wrap(err, "error reading registry credentials")
+	}
+
+	err = json.Unmarshal(credentialsBytes, &s.credentials)
+	if err != nil {
+		return errors.Wrap(err, "error parsing registry credentials")
+	}
+
+	log.Debugf("loaded %d registry credentials", len(s.credentials))
+
+	return nil
+}
+
+func (s *Server) pullImageHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody api.PullImageRequestBody
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("handling pre-pull of image %s", reqBody.Name)
+
+	go func() {
+		pullErr := s.pullImage(&reqBody)
+		if pullErr != nil {
+			log.Warnf("error pre-pulling image %s: %s", reqBody.Name, pullErr)
+		}
+	}()
+}
+
+// pullImage makes sure the image is present according to its pull policy. Pulls of the same image are
+// serialized, so an instance started while its image is being pre-pulled waits for that pull instead of
+// starting another one.
+func (s *Server) pullImage(image *api.ImageDTO) error {
+	value, _ := s.imageLocks.LoadOrStore(image.Name, &sync.Mutex{})
+	imageLock := value.(typeImageLocksMapValue)
+
+	imageLock.Lock()
+	defer imageLock.Unlock()
+
+	if image.PullPolicy != api.ImagePullAlways {
+		present, err := s.containerRuntime.HasImage(image.Name)
+		if err != nil {
+			return err
+		}
+
+		if present {
+			log.Debugf("image %s is already present", image.Name)
+			return nil
+		}
+
+		if image.PullPolicy == api.ImagePullNever {
+			return errors.Errorf("image %s is not present and its pull policy is %s", image.Name,
+				api.ImagePullNever)
+		}
+	}
+
+	auth, err := s.getRegistryAuth(image)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("pulling image %s", image.Name)
+
+	return s.containerRuntime.PullImage(image.Name, auth)
+}
+
+// getRegistryAuth returns the credentials, among the ones the image references, for the image registry
+func (s *Server) getRegistryAuth(image *api.ImageDTO) (*runtime.RegistryAuth, error) {
+	registry := getImageRegistry(image.Name)
+
+	for _, secretName := range image.PullSecrets {
+		creds, ok := s.credentials[secretName]
+		if !ok {
+			return nil, errors.Errorf("image %s references unknown registry credentials %s", image.Name,
+				secretName)
+		}
+
+		if normalizeRegistry(creds.Server) == registry {
+			return &runtime.RegistryAuth{
+				ServerAddress: creds.Server,
+				Username:      creds.Username,
+				Password:      creds.Password,
+			}, nil
+		}
+	}
+
+	if len(image.PullSecrets) > 0 {
+		log.Debugf("no registry credentials for %s among %+v, pulling %s anonymously", registry,
+			image.PullSecrets, image.Name)
+	}
+
+	return nil, nil
+}
+
+func getImageRegistry(imageName string) string {
+	slashIdx := strings.Index(imageName, "/")
+	if slashIdx == -1 {
+		return defaultRegistry
+	}
+
+	// the first component is only a registry if it looks like a host, as in docker references
+	domain := imageName[:slashIdx]
+	if !strings.ContainsAny(domain, ".:") && domain != "localhost" {
+		return defaultRegistry
+	}
+
+	return normalizeRegistry(domain)
+}
+
+func normalizeRegistry(server string) string {
+	server = strings.TrimPrefix(server, "https://")
+	server = strings.TrimPrefix(server, "http://")
+	server = strings.SplitN(server, "/", 2)[0]
+
+	if server == "index.docker.io" || server == "registry-1.docker.io" {
+		return defaultRegistry
+	}
+
+	return server
+}
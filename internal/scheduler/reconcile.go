@@ -0,0 +1,135 @@
+package scheduler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	reconcileAttempts     = 10
+	reconcileRetryTimeout = 5 * time.Second
+)
+
+// rebuildInstances fills the instance map with the containers created by a previous run of the scheduler and
+// returns the ones that are not running, with the code they exited with
+func (s *Server) rebuildInstances() (notRunning map[string]int, err error) {
+	notRunning = map[string]int{}
+
+	containers, err := s.containerRuntime.ListContainers(map[string]string{instanceLabel: ""})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing containers")
+	}
+
+	for _, cont := range containers {
+		instanceId := cont.Labels[instanceLabel]
+		deploymentId := cont.Labels[deploymentLabel]
+
+		slot, err := strconv.Atoi(cont.Labels[slotLabel])
+		if err != nil {
+			log.Errorf("container %s has an invalid slot label: %s", cont.Id, err)
+			continue
+		}
+
+		// volume names are prefixed by the deployment and suffixed by the slot
+		volumePrefix := deploymentId + "-"
+		volumeSuffix := "-" + strconv.Itoa(slot)
+
+		var volumes []*api.VolumeDTO
+		for _, volumeMount := range cont.Mounts {
+			if !strings.HasPrefix(volumeMount.Name, volumePrefix) {
+				continue
+			}
+
+			volumes = append(volumes, &api.VolumeDTO{
+				Name:      strings.TrimSuffix(strings.TrimPrefix(volumeMount.Name, volumePrefix), volumeSuffix),
+				MountPath: volumeMount.Target,
+			})
+		}
+
+		s.reserveSlot(deploymentId, slot)
+		s.instanceToContainer.Store(instanceId, &instance{
+			ContainerId:   cont.Id,
+			DeploymentId:  deploymentId,
+			Slot:          slot,
+			Volumes:       volumes,
+			RestartPolicy: cont.Labels[restartPolicyLabel],
+		})
+
+		if !cont.Running {
+			exitCode := 0
+			if inspected, err := s.containerRuntime.InspectContainer(cont.Id); err != nil {
+				log.Errorf("error inspecting container %s: %s", cont.Id, err)
+			} else {
+				exitCode = inspected.ExitCode
+			}
+
+			notRunning[instanceId] = exitCode
+		}
+
+		log.Debugf("found instance %s (container %s), running: %t", instanceId, cont.Id, cont.Running)
+	}
+
+	return
+}
+
+// reconcileInstances compares the instances found in docker with the ones the deployer expects in this node.
+// Instances the deployer does not know about are removed and expected ones that are not running are started
+// according to their restart policy. Expected instances without a container are removed from the deployer.
+func (s *Server) reconcileInstances(notRunning map[string]int) {
+	var (
+		expected map[string]string
+		status   int
+	)
+
+	for i := 0; i < reconcileAttempts; i++ {
+		expected, status = s.deployerClient.GetInstances()
+		if status == http.StatusOK {
+			break
+		}
+
+		if !s.Sleep(reconcileRetryTimeout) {
+			return
+		}
+	}
+
+	if status != http.StatusOK {
+		log.Warnf("got status %d while getting expected instances, skipping reconciliation", status)
+		return
+	}
+
+	s.instanceToContainer.Range(func(key, value interface{}) bool {
+		instanceId := key.(typeInstanceToContainerMapKey)
+		inst := value.(typeInstanceToContainerMapValue)
+
+		if _, ok := expected[instanceId]; !ok {
+			log.Debugf("deployer does not expect instance %s, removing it", instanceId)
+			s.stopContainerAsync(instanceId, inst)
+			return true
+		}
+
+		if exitCode, ok := notRunning[instanceId]; ok && shouldRestart(inst.RestartPolicy, exitCode) {
+			log.Debugf("instance %s is not running, starting it", instanceId)
+			s.restartContainer(instanceId)
+		}
+
+		return true
+	})
+
+	for instanceId, deploymentId := range expected {
+		if _, ok := s.instanceToContainer.Load(instanceId); !ok {
+			log.Warnf("deployer expects instance %s from deployment %s but it has no container, removing it",
+				instanceId, deploymentId)
+
+			status = s.deployerClient.DeleteServiceInstance(deploymentId, instanceId)
+			if status != http.StatusOK {
+				log.Errorf("got status %d removing instance %s from the deployer", status, instanceId)
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/scheduler/runtime"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	typeRestartStatesMapKey   = string
+	typeRestartStatesMapValue = *restartState
+
+	restartState struct {
+		Restarts     int
+		Backoff      time.Duration
+		CrashLooping bool
+		StableTimer  *time.Timer
+		sync.Mutex
+	}
+)
+
+const (
+	initialRestartBackoff = 1 * time.Second
+	// kept below the deployer heartbeat timeout, otherwise the deployer removes the instance while it waits
+	maxRestartBackoff = 30 * time.Second
+	// an instance that keeps running for this long has its backoff reset
+	stableRunningTime = 2 * time.Minute
+	// number of consecutive restarts after which an instance is reported as crash looping
+	crashLoopThreshold = 5
+)
+
+func (s *Server) watchContainerExits() {
+	exits := s.containerRuntime.ContainerExits()
+
+	for {
+		select {
+		case <-s.Stopped():
+			return
+		case exit, ok := <-exits:
+			if !ok {
+				return
+			}
+
+			s.onContainerExited(exit)
+		}
+	}
+}
+
+func (s *Server) onContainerExited(exit *runtime.ExitEvent) {
+	instanceId, inst, ok := s.getInstanceFromContainer(exit.ContainerId)
+	if !ok {
+		// either not ours or it was stopped by the scheduler
+		return
+	}
+
+	log.Debugf("container %s from instance %s exited with code %d", inst.ContainerId, instanceId, exit.ExitCode)
+
+	if !shouldRestart(inst.RestartPolicy, exit.ExitCode) {
+		return
+	}
+
+	value, _ := s.restartStates.LoadOrStore(instanceId, &restartState{})
+	state := value.(typeRestartStatesMapValue)
+
+	state.Lock()
+	defer state.Unlock()
+
+	if state.StableTimer != nil {
+		state.StableTimer.Stop()
+	}
+
+	if state.Backoff == 0 {
+		state.Backoff = initialRestartBackoff
+	} else if state.Backoff < maxRestartBackoff {
+		state.Backoff *= 2
+		if state.Backoff > maxRestartBackoff {
+			state.Backoff = maxRestartBackoff
+		}
+	}
+
+	state.Restarts++
+	if state.Restarts >= crashLoopThreshold && !state.CrashLooping {
+		state.CrashLooping = true
+		go s.reportInstanceHealth(inst.DeploymentId, instanceId, true)
+	}
+
+	log.Debugf("restarting instance %s in %s (restart %d)", instanceId, state.Backoff, state.Restarts)
+	time.AfterFunc(state.Backoff, func() {
+		s.restartContainer(instanceId)
+	})
+}
+
+// shouldRestart checks if a container that exited with the code is restarted according to the restart policy
+func shouldRestart(restartPolicy string, exitCode int) bool {
+	switch restartPolicy {
+	case api.RestartNever:
+		return false
+	case api.RestartOnFailure:
+		return exitCode != 0
+	default:
+		return true
+	}
+}
+
+func (s *Server) restartContainer(instanceId string) {
+	value, ok := s.instanceToContainer.Load(instanceId)
+	if !ok {
+		log.Debugf("instance %s was stopped while waiting to restart", instanceId)
+		return
+	}
+
+	inst := value.(typeInstanceToContainerMapValue)
+	err := s.containerRuntime.StartContainer(inst.ContainerId)
+	if err != nil {
+		log.Errorf("error restarting instance %s: %s", instanceId, err)
+		return
+	}
+
+	value, ok = s.restartStates.Load(instanceId)
+	if !ok {
+		return
+	}
+
+	state := value.(typeRestartStatesMapValue)
+	state.Lock()
+	state.StableTimer = time.AfterFunc(stableRunningTime, func() {
+		s.resetRestartState(instanceId, inst.DeploymentId)
+	})
+	state.Unlock()
+}
+
+func (s *Server) resetRestartState(instanceId, deploymentId string) {
+	value, ok := s.restartStates.Load(instanceId)
+	if !ok {
+		return
+	}
+
+	state := value.(typeRestartStatesMapValue)
+	state.Lock()
+	defer state.Unlock()
+
+	log.Debugf("instance %s is stable after %d restarts", instanceId, state.Restarts)
+
+	state.Restarts = 0
+	state.Backoff = 0
+	if state.CrashLooping {
+		state.CrashLooping = false
+		go s.reportInstanceHealth(deploymentId, instanceId, false)
+	}
+}
+
+func (s *Server) clearRestartState(instanceId string) {
+	value, ok := s.restartStates.Load(instanceId)
+	if !ok {
+		return
+	}
+
+	state := value.(typeRestartStatesMapValue)
+	state.Lock()
+	if state.StableTimer != nil {
+		state.StableTimer.Stop()
+	}
+	state.Unlock()
+
+	s.restartStates.Delete(instanceId)
+}
+
+func (s *Server) reportInstanceHealth(deploymentId, instanceId string, crashLooping bool) {
+	status := s.deployerClient.SetInstanceHealth(deploymentId, instanceId, crashLooping)
+	if status != http.StatusOK {
+		log.Errorf("got status %d while reporting instance %s health", status, instanceId)
+	}
+}
+
+// reportInstanceFailed tells the deployer the instance could not be started, since it will never heartbeat
+func (s *Server) reportInstanceFailed(deploymentId, instanceId string, err error) {
+	log.Errorf("instance %s failed to start: %s", instanceId, err)
+
+	status := s.deployerClient.ReportInstanceFailed(deploymentId, instanceId, err.Error())
+	if status != http.StatusOK {
+		log.Errorf("got status %d while reporting instance %s failed", status, instanceId)
+	}
+}
+
+func (s *Server) getInstanceFromContainer(contId string) (instanceId string, inst *instance, ok bool) {
+	s.instanceToContainer.Range(func(key, value interface{}) bool {
+		auxInstance := value.(typeInstanceToContainerMapValue)
+		if auxInstance.ContainerId == contId {
+			instanceId = key.(typeInstanceToContainerMapKey)
+			inst = auxInstance
+			ok = true
+			return false
+		}
+
+		return true
+	})
+
+	return
+}
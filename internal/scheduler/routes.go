@@ -10,64 +10,123 @@ import (
 
 // Route names
 const (
-	startInstanceName    = "START_INSTANCE"
-	stopInstanceName     = "STOP_INSTANCE"
-	stopAllInstancesName = "STOP_ALL_INSTANCES"
+	startInstanceName     = "START_INSTANCE"
+	stopInstanceName      = "STOP_INSTANCE"
+	stopAllInstancesName  = "STOP_ALL_INSTANCES"
+	getVolumeSnapshotName = "GET_VOLUME_SNAPSHOT"
+	deleteDeploymentName  = "DELETE_DEPLOYMENT"
+	getInstanceStatsName  = "GET_INSTANCE_STATS"
+	pullImageName         = "PULL_IMAGE"
+	getInstanceLogsName   = "GET_INSTANCE_LOGS"
+	execInstanceName      = "EXEC_INSTANCE"
+	updateConfigMapName   = "UPDATE_CONFIG_MAP"
+	getConfigName         = "GET_CONFIG"
 )
 
 const (
-	instanceIdPathVar = "instanceId"
+	instanceIdPathVar    = "instanceId"
+	volumeNamePathVar    = "volumeName"
+	deploymentIdPathVar  = "deploymentId"
+	configMapNamePathVar = "configMapName"
 )
 
 var (
-	_instanceIdPathVarFormatted = fmt.Sprintf(utils.PathVarFormat, instanceIdPathVar)
+	_instanceIdPathVarFormatted    = fmt.Sprintf(utils.PathVarFormat, instanceIdPathVar)
+	_volumeNamePathVarFormatted    = fmt.Sprintf(utils.PathVarFormat, volumeNamePathVar)
+	_deploymentIdPathVarFormatted  = fmt.Sprintf(utils.PathVarFormat, deploymentIdPathVar)
+	_configMapNamePathVarFormatted = fmt.Sprintf(utils.PathVarFormat, configMapNamePathVar)
 
-	instancesRoute = scheduler.InstancesPath
-	instanceRoute  = fmt.Sprintf(scheduler.InstancePath, _instanceIdPathVarFormatted)
+	instancesRoute      = scheduler.InstancesPath
+	instanceRoute       = fmt.Sprintf(scheduler.InstancePath, _instanceIdPathVarFormatted)
+	instanceVolumeRoute = fmt.Sprintf(scheduler.InstanceVolumePath, _instanceIdPathVarFormatted,
+		_volumeNamePathVarFormatted)
+	instanceStatsRoute = fmt.Sprintf(scheduler.InstanceStatsPath, _instanceIdPathVarFormatted)
+	instanceLogsRoute  = fmt.Sprintf(scheduler.InstanceLogsPath, _instanceIdPathVarFormatted)
+	instanceExecRoute  = fmt.Sprintf(scheduler.InstanceExecPath, _instanceIdPathVarFormatted)
+	deploymentRoute    = fmt.Sprintf(scheduler.DeploymentPath, _deploymentIdPathVarFormatted)
+	imagesRoute        = scheduler.ImagesPath
+	configMapRoute     = fmt.Sprintf(scheduler.DeploymentConfigMapPath, _deploymentIdPathVarFormatted,
+		_configMapNamePathVarFormatted)
+	configRoute = scheduler.ConfigPath
 )
 
-var Routes = []utils.Route{
-	{
-		Name:        startInstanceName,
-		Method:      http.MethodPost,
-		Pattern:     instancesRoute,
-		HandlerFunc: startInstanceHandler,
-	},
-
-	{
-		Name:        stopInstanceName,
-		Method:      http.MethodDelete,
-		Pattern:     instanceRoute,
-		HandlerFunc: stopInstanceHandler,
-	},
-
-	{
-		Name:        stopAllInstancesName,
-		Method:      http.MethodDelete,
-		Pattern:     instancesRoute,
-		HandlerFunc: stopAllInstancesHandler,
-	},
-}
+func (s *Server) routes() []utils.Route {
+	return []utils.Route{
+		{
+			Name:        startInstanceName,
+			Method:      http.MethodPost,
+			Pattern:     instancesRoute,
+			HandlerFunc: s.startInstanceHandler,
+		},
+
+		{
+			Name:        stopInstanceName,
+			Method:      http.MethodDelete,
+			Pattern:     instanceRoute,
+			HandlerFunc: s.stopInstanceHandler,
+		},
+
+		{
+			Name:        stopAllInstancesName,
+			Method:      http.MethodDelete,
+			Pattern:     instancesRoute,
+			HandlerFunc: s.stopAllInstancesHandler,
+		},
+
+		{
+			Name:        getVolumeSnapshotName,
+			Method:      http.MethodGet,
+			Pattern:     instanceVolumeRoute,
+			HandlerFunc: s.getVolumeSnapshotHandler,
+		},
+
+		{
+			Name:        deleteDeploymentName,
+			Method:      http.MethodDelete,
+			Pattern:     deploymentRoute,
+			HandlerFunc: s.deleteDeploymentHandler,
+		},
+
+		{
+			Name:        getInstanceStatsName,
+			Method:      http.MethodGet,
+			Pattern:     instanceStatsRoute,
+			HandlerFunc: s.getInstanceStatsHandler,
+		},
+
+		{
+			Name:        pullImageName,
+			Method:      http.MethodPost,
+			Pattern:     imagesRoute,
+			HandlerFunc: s.pullImageHandler,
+		},
+
+		{
+			Name:        getInstanceLogsName,
+			Method:      http.MethodGet,
+			Pattern:     instanceLogsRoute,
+			HandlerFunc: s.getInstanceLogsHandler,
+		},
+
+		{
+			Name:        execInstanceName,
+			Method:      http.MethodPost,
+			Pattern:     instanceExecRoute,
+			HandlerFunc: s.execInstanceHandler,
+		},
+
+		{
+			Name:        updateConfigMapName,
+			Method:      http.MethodPut,
+			Pattern:     configMapRoute,
+			HandlerFunc: s.updateConfigMapHandler,
+		},
 
-var DummyRoutes = []utils.Route{
-	{
-		Name:        startInstanceName,
-		Method:      http.MethodPost,
-		Pattern:     instancesRoute,
-		HandlerFunc: dummyStartInstanceHandler,
-	},
-
-	{
-		Name:        stopInstanceName,
-		Method:      http.MethodDelete,
-		Pattern:     instanceRoute,
-		HandlerFunc: dummyStopInstanceHandler,
-	},
-
-	{
-		Name:        stopAllInstancesName,
-		Method:      http.MethodDelete,
-		Pattern:     instancesRoute,
-		HandlerFunc: dummyStopAllInstancesHandler,
-	},
+		{
+			Name:        getConfigName,
+			Method:      http.MethodGet,
+			Pattern:     configRoute,
+			HandlerFunc: s.config.Handler,
+		},
+	}
 }
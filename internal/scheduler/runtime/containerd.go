@@ -0,0 +1,663 @@
+package runtime
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	nerdctlBinary = "nerdctl"
+
+	containerdNamespace   = "cloud-edge-deployment"
+	containerdNetworkName = "scheduler-network"
+
+	containerdExitTopic = "/tasks/exit"
+)
+
+// Containerd runs containers in containerd through nerdctl. Since nerdctl mirrors the docker command line and
+// inspect format, no containerd client library is needed and the behaviour matches the docker runtime.
+type Containerd struct {
+	exits chan *ExitEvent
+}
+
+type (
+	nerdctlContainer struct {
+		Id     string
+		Config struct {
+			Labels map[string]string
+		}
+		State struct {
+			Running  bool
+			ExitCode int
+		}
+		Mounts []struct {
+			Type        string
+			Name        string
+			Destination string
+		}
+	}
+
+	nerdctlVolume struct {
+		Name   string
+		Labels map[string]string
+	}
+
+	nerdctlStats struct {
+		CPUPerc  string
+		MemUsage string
+	}
+
+	nerdctlEvent struct {
+		Topic string
+		Event string
+	}
+
+	nerdctlExitEvent struct {
+		ContainerId string `json:"container_id"`
+		ExitStatus  int    `json:"exit_status"`
+	}
+)
+
+func NewContainerdRuntime() (*Containerd, error) {
+	_, err := exec.LookPath(nerdctlBinary)
+	if err != nil {
+		return nil, errors.Wrap(err, "containerd runtime requires nerdctl")
+	}
+
+	c := &Containerd{
+		exits: make(chan *ExitEvent),
+	}
+
+	_, err = c.run("network", "inspect", containerdNetworkName)
+	if err != nil {
+		_, err = c.run("network", "create", containerdNetworkName)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Debug("created network ", containerdNetworkName)
+	} else {
+		log.Debug("network ", containerdNetworkName, " already exists")
+	}
+
+	go c.watchEvents()
+
+	return c, nil
+}
+
+func (c *Containerd) command(args ...string) *exec.Cmd {
+	return exec.Command(nerdctlBinary, append([]string{"--namespace", containerdNamespace}, args...)...)
+}
+
+func (c *Containerd) run(args ...string) ([]byte, error) {
+	cmd := c.command(args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "nerdctl %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+func (c *Containerd) PullImage(image string, auth *RegistryAuth) error {
+	if auth != nil {
+		// nerdctl has no per pull credentials, so it logs in and keeps them in its credential store
+		cmd := c.command("login", "--username", auth.Username, "--password-stdin", auth.ServerAddress)
+		cmd.Stdin = strings.NewReader(auth.Password)
+
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return errors.Wrapf(err, "nerdctl login: %s", strings.TrimSpace(string(out)))
+		}
+	}
+
+	_, err := c.run("pull", "--quiet", image)
+	return err
+}
+
+func (c *Containerd) HasImage(image string) (bool, error) {
+	out, err := c.run("image", "ls", "--quiet", image)
+	if err != nil {
+		return false, err
+	}
+
+	return len(bytes.TrimSpace(out)) > 0, nil
+}
+
+func (c *Containerd) CreateContainer(spec *ContainerSpec) (containerId string, err error) {
+	args := []string{"create", "--name", spec.Name, "--network", containerdNetworkName}
+
+	for _, envVar := range spec.Env {
+		args = append(args, "--env", envVar)
+	}
+
+	for key, value := range spec.Labels {
+		args = append(args, "--label", key+"="+value)
+	}
+
+	for containerPort, bindings := range spec.PortBindings {
+		for _, binding := range bindings {
+			args = append(args, "--publish",
+				binding.HostIP+":"+binding.HostPort+":"+containerPort.Port()+"/"+containerPort.Proto())
+		}
+	}
+
+	for _, volumeMount := range spec.Mounts {
+		err = c.createVolume(volumeMount)
+		if err != nil {
+			return "", err
+		}
+
+		args = append(args, "--volume", volumeMount.Name+":"+volumeMount.Target)
+	}
+
+	args = append(args, spec.Image)
+
+	out, err := c.run(args...)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (c *Containerd) createVolume(volumeMount *VolumeMount) error {
+	_, err := c.run("volume", "inspect", volumeMount.Name)
+	if err == nil {
+		return nil
+	}
+
+	args := []string{"volume", "create"}
+	for key, value := range volumeMount.Labels {
+		args = append(args, "--label", key+"="+value)
+	}
+	args = append(args, volumeMount.Name)
+
+	_, err = c.run(args...)
+	return err
+}
+
+func (c *Containerd) StartContainer(containerId string) error {
+	_, err := c.run("start", containerId)
+	return err
+}
+
+func (c *Containerd) StopContainer(containerId string, timeout time.Duration) error {
+	_, err := c.run("stop", "--time", strconv.Itoa(int(timeout.Seconds())), containerId)
+	return err
+}
+
+func (c *Containerd) RemoveContainer(containerId string) error {
+	_, err := c.run("rm", containerId)
+	return err
+}
+
+func (c *Containerd) SignalContainer(containerId, signal string) error {
+	_, err := c.run("kill", "--signal", signal, containerId)
+	return err
+}
+
+func (c *Containerd) ListContainers(labels map[string]string) ([]*Container, error) {
+	out, err := c.run("ps", "--all", "--quiet", "--no-trunc")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Container
+	for _, containerId := range strings.Fields(string(out)) {
+		var cont *Container
+		cont, err = c.InspectContainer(containerId)
+		if err != nil {
+			log.Warnf("error inspecting container %s: %s", containerId, err)
+			continue
+		}
+
+		if hasLabels(cont.Labels, labels) {
+			result = append(result, cont)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *Containerd) InspectContainer(containerId string) (*Container, error) {
+	out, err := c.run("container", "inspect", "--mode", "dockercompat", containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	var inspected []*nerdctlContainer
+	err = json.Unmarshal(out, &inspected)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inspected) == 0 {
+		return nil, errors.Errorf("container %s not found", containerId)
+	}
+
+	cont := &Container{
+		Id:       inspected[0].Id,
+		Labels:   inspected[0].Config.Labels,
+		Running:  inspected[0].State.Running,
+		ExitCode: inspected[0].State.ExitCode,
+	}
+
+	for _, mountPoint := range inspected[0].Mounts {
+		if mountPoint.Type != "volume" {
+			continue
+		}
+
+		cont.Mounts = append(cont.Mounts, &VolumeMount{
+			Name:   mountPoint.Name,
+			Target: mountPoint.Destination,
+		})
+	}
+
+	return cont, nil
+}
+
+func (c *Containerd) ContainerLogs(containerId string, options *LogsOptions) (io.ReadCloser, error) {
+	args := []string{"logs"}
+	if options.Follow {
+		args = append(args, "--follow")
+	}
+	if options.Tail != "" {
+		args = append(args, "--tail", options.Tail)
+	}
+	if options.Since != "" {
+		args = append(args, "--since", options.Since)
+	}
+	args = append(args, containerId)
+
+	cmd := c.command(args...)
+
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		_ = writer.CloseWithError(cmd.Wait())
+	}()
+
+	return &pipeReadCloser{
+		PipeReader: reader,
+		onClose: func() {
+			_ = cmd.Process.Kill()
+		},
+	}, nil
+}
+
+func (c *Containerd) Exec(containerId string, cmd []string) (ExecSession, error) {
+	execCmd := c.command(append([]string{"exec", "--interactive", containerId}, cmd...)...)
+
+	stdin, err := execCmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	execCmd.Stdout = writer
+	execCmd.Stderr = writer
+
+	err = execCmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &containerdExecSession{
+		cmd:    execCmd,
+		stdin:  stdin,
+		output: reader,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		session.waitErr = execCmd.Wait()
+		_ = writer.Close()
+		close(session.done)
+	}()
+
+	return session, nil
+}
+
+func (c *Containerd) ContainerStats(containerId string) (*Stats, error) {
+	out, err := c.run("stats", "--no-stream", "--format", "{{json .}}", containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	var nStats nerdctlStats
+	err = json.Unmarshal(out, &nStats)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+
+	stats.CPUPercentage, err = strconv.ParseFloat(strings.TrimSuffix(nStats.CPUPerc, "%"), 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid cpu percentage %s", nStats.CPUPerc)
+	}
+
+	// memory usage comes as "usage / limit"
+	memUsage := strings.Split(nStats.MemUsage, "/")
+	if len(memUsage) == 2 {
+		var usage, limit int64
+		usage, err = units.RAMInBytes(strings.TrimSpace(memUsage[0]))
+		if err != nil {
+			return nil, err
+		}
+
+		limit, err = units.RAMInBytes(strings.TrimSpace(memUsage[1]))
+		if err != nil {
+			return nil, err
+		}
+
+		stats.MemoryUsage = uint64(usage)
+		stats.MemoryLimit = uint64(limit)
+	}
+
+	return stats, nil
+}
+
+func (c *Containerd) ContainerExits() <-chan *ExitEvent {
+	return c.exits
+}
+
+func (c *Containerd) watchEvents() {
+	for {
+		cmd := c.command("events", "--format", "{{json .}}")
+
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			panic(err)
+		}
+
+		err = cmd.Start()
+		if err != nil {
+			log.Errorf("error watching containerd events: %s", err)
+			time.Sleep(eventsReconnectTimeout)
+			continue
+		}
+
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			var event nerdctlEvent
+			err = json.Unmarshal(scanner.Bytes(), &event)
+			if err != nil || event.Topic != containerdExitTopic {
+				continue
+			}
+
+			var exitEvent nerdctlExitEvent
+			err = json.Unmarshal([]byte(event.Event), &exitEvent)
+			if err != nil {
+				log.Warnf("invalid exit event %s: %s", event.Event, err)
+				continue
+			}
+
+			c.exits <- &ExitEvent{
+				ContainerId: exitEvent.ContainerId,
+				ExitCode:    exitEvent.ExitStatus,
+			}
+		}
+
+		log.Errorf("containerd events stopped: %v", cmd.Wait())
+		time.Sleep(eventsReconnectTimeout)
+	}
+}
+
+func (c *Containerd) ExportVolume(containerId, mountPath string) (io.ReadCloser, error) {
+	tmpDir, err := ioutil.TempDir("", "volume")
+	if err != nil {
+		return nil, err
+	}
+
+	// pause the container so the files do not change while they are being copied
+	_, err = c.run("pause", containerId)
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	_, err = c.run("cp", containerId+":"+mountPath, tmpDir)
+
+	_, unpauseErr := c.run("unpause", containerId)
+	if unpauseErr != nil {
+		log.Error(unpauseErr)
+	}
+
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		tarErr := writeTar(writer, tmpDir)
+		_ = os.RemoveAll(tmpDir)
+		_ = writer.CloseWithError(tarErr)
+	}()
+
+	return reader, nil
+}
+
+func (c *Containerd) ImportVolume(containerId, mountPath string, content io.Reader) error {
+	tmpDir, err := ioutil.TempDir("", "volume")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	err = extractTar(content, tmpDir)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.run("cp", filepath.Join(tmpDir, path.Base(mountPath)), containerId+":"+path.Dir(mountPath))
+	return err
+}
+
+func (c *Containerd) ListVolumes(labels map[string]string) ([]*Volume, error) {
+	out, err := c.run("volume", "ls", "--quiet")
+	if err != nil {
+		return nil, err
+	}
+
+	names := strings.Fields(string(out))
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	out, err = c.run(append([]string{"volume", "inspect"}, names...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var inspected []*nerdctlVolume
+	err = json.Unmarshal(out, &inspected)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Volume
+	for _, volume := range inspected {
+		if hasLabels(volume.Labels, labels) {
+			result = append(result, &Volume{
+				Name:   volume.Name,
+				Labels: volume.Labels,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+func (c *Containerd) RemoveVolume(name string) error {
+	_, err := c.run("volume", "rm", name)
+	return err
+}
+
+// writeTar writes the contents of dir to w, with paths relative to dir
+func writeTar(w io.Writer, dir string) error {
+	tarWriter := tar.NewWriter(w)
+
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil || relPath == "." {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+
+		err = tarWriter.WriteHeader(header)
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(tarWriter, file)
+		closeErr := file.Close()
+		if err != nil {
+			return err
+		}
+
+		return closeErr
+	})
+	if err != nil {
+		return err
+	}
+
+	return tarWriter.Close()
+}
+
+func extractTar(r io.Reader, dir string) error {
+	tarReader := tar.NewReader(r)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.Clean("/"+header.Name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, os.FileMode(header.Mode))
+		case tar.TypeReg:
+			err = extractFile(tarReader, target, os.FileMode(header.Mode))
+		default:
+			log.Debugf("skipping %s from tar", header.Name)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, r)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+type containerdExecSession struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	output  *io.PipeReader
+	done    chan struct{}
+	waitErr error
+}
+
+func (e *containerdExecSession) Read(p []byte) (int, error) {
+	return e.output.Read(p)
+}
+
+func (e *containerdExecSession) Write(p []byte) (int, error) {
+	return e.stdin.Write(p)
+}
+
+func (e *containerdExecSession) CloseStdin() error {
+	return e.stdin.Close()
+}
+
+func (e *containerdExecSession) Close() error {
+	select {
+	case <-e.done:
+	default:
+		_ = e.cmd.Process.Kill()
+	}
+
+	return e.output.Close()
+}
+
+func (e *containerdExecSession) Wait() (int, error) {
+	<-e.done
+
+	if exitErr, ok := e.waitErr.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
+
+	if e.waitErr != nil {
+		return -1, e.waitErr
+	}
+
+	return 0, nil
+}
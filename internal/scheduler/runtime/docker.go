@@ -0,0 +1,496 @@
+package runtime
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	dockerNetworkName = "scheduler-network"
+
+	eventsReconnectTimeout = 5 * time.Second
+	execWaitInterval       = 100 * time.Millisecond
+)
+
+type Docker struct {
+	client    *client.Client
+	networkId string
+	exits     chan *ExitEvent
+}
+
+func NewDockerRuntime() (*Docker, error) {
+	dockerClient, err := client.NewEnvClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create docker client")
+	}
+
+	d := &Docker{
+		client: dockerClient,
+		exits:  make(chan *ExitEvent),
+	}
+
+	networks, err := dockerClient.NetworkList(context.Background(), types.NetworkListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, network := range networks {
+		if network.Name == dockerNetworkName {
+			d.networkId = network.ID
+			log.Debug("network ", dockerNetworkName, " already exists")
+			break
+		}
+	}
+
+	if d.networkId == "" {
+		networkConfig := types.NetworkCreate{
+			CheckDuplicate: false,
+			Attachable:     false,
+		}
+
+		var resp types.NetworkCreateResponse
+		resp, err = dockerClient.NetworkCreate(context.Background(), dockerNetworkName, networkConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		d.networkId = resp.ID
+		log.Debug("created network with id ", d.networkId)
+	}
+
+	go d.watchEvents()
+
+	return d, nil
+}
+
+func (d *Docker) PullImage(image string, auth *RegistryAuth) error {
+	var options types.ImagePullOptions
+	if auth != nil {
+		authJSON, err := json.Marshal(types.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: auth.ServerAddress,
+		})
+		if err != nil {
+			return err
+		}
+
+		options.RegistryAuth = base64.URLEncoding.EncodeToString(authJSON)
+	}
+
+	out, err := d.client.ImagePull(context.Background(), image, options)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(ioutil.Discard, out)
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+func (d *Docker) HasImage(image string) (bool, error) {
+	_, _, err := d.client.ImageInspectWithRaw(context.Background(), image)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (d *Docker) CreateContainer(spec *ContainerSpec) (containerId string, err error) {
+	containerConfig := container.Config{
+		Env:    spec.Env,
+		Image:  spec.Image,
+		Labels: spec.Labels,
+	}
+
+	var mounts []mount.Mount
+	for _, volumeMount := range spec.Mounts {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: volumeMount.Name,
+			Target: volumeMount.Target,
+			VolumeOptions: &mount.VolumeOptions{
+				Labels: volumeMount.Labels,
+			},
+		})
+	}
+
+	hostConfig := container.HostConfig{
+		NetworkMode:  "bridge",
+		PortBindings: spec.PortBindings,
+		Mounts:       mounts,
+	}
+
+	cont, err := d.client.ContainerCreate(context.Background(), &containerConfig, &hostConfig, nil, spec.Name)
+	if err != nil {
+		return "", err
+	}
+
+	err = d.client.NetworkConnect(context.Background(), d.networkId, cont.ID, nil)
+	if err != nil {
+		// the container is not handed out, so nobody else would remove it
+		removeErr := d.client.ContainerRemove(context.Background(), cont.ID, types.ContainerRemoveOptions{Force: true})
+		if removeErr != nil {
+			log.Errorf("error removing container %s that failed to connect to the network: %s", cont.ID, removeErr)
+		}
+
+		return "", err
+	}
+
+	return cont.ID, nil
+}
+
+func (d *Docker) StartContainer(containerId string) error {
+	return d.client.ContainerStart(context.Background(), containerId, types.ContainerStartOptions{})
+}
+
+func (d *Docker) StopContainer(containerId string, timeout time.Duration) error {
+	return d.client.ContainerStop(context.Background(), containerId, &timeout)
+}
+
+func (d *Docker) RemoveContainer(containerId string) error {
+	return d.client.ContainerRemove(context.Background(), containerId, types.ContainerRemoveOptions{})
+}
+
+func (d *Docker) SignalContainer(containerId, signal string) error {
+	return d.client.ContainerKill(context.Background(), containerId, signal)
+}
+
+func (d *Docker) ListContainers(labels map[string]string) ([]*Container, error) {
+	containers, err := d.client.ContainerList(context.Background(), types.ContainerListOptions{
+		All:     true,
+		Filters: toLabelFilters(labels),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Container
+	for _, containerListed := range containers {
+		cont := &Container{
+			Id:      containerListed.ID,
+			Labels:  containerListed.Labels,
+			Running: containerListed.State == "running",
+		}
+
+		for _, mountPoint := range containerListed.Mounts {
+			if mountPoint.Type != mount.TypeVolume {
+				continue
+			}
+
+			cont.Mounts = append(cont.Mounts, &VolumeMount{
+				Name:   mountPoint.Name,
+				Target: mountPoint.Destination,
+			})
+		}
+
+		result = append(result, cont)
+	}
+
+	return result, nil
+}
+
+func (d *Docker) InspectContainer(containerId string) (*Container, error) {
+	contJSON, err := d.client.ContainerInspect(context.Background(), containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	cont := &Container{
+		Id:       contJSON.ID,
+		Labels:   contJSON.Config.Labels,
+		Running:  contJSON.State.Running,
+		ExitCode: contJSON.State.ExitCode,
+	}
+
+	for _, mountPoint := range contJSON.Mounts {
+		if mountPoint.Type != mount.TypeVolume {
+			continue
+		}
+
+		cont.Mounts = append(cont.Mounts, &VolumeMount{
+			Name:   mountPoint.Name,
+			Target: mountPoint.Destination,
+		})
+	}
+
+	return cont, nil
+}
+
+func (d *Docker) ContainerLogs(containerId string, options *LogsOptions) (io.ReadCloser, error) {
+	logs, err := d.client.ContainerLogs(context.Background(), containerId, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     options.Follow,
+		Tail:       options.Tail,
+		Since:      options.Since,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// containers without a tty have stdout and stderr multiplexed in the same stream
+	reader, writer := io.Pipe()
+	go func() {
+		_, copyErr := stdcopy.StdCopy(writer, writer, logs)
+		_ = logs.Close()
+		_ = writer.CloseWithError(copyErr)
+	}()
+
+	return &pipeReadCloser{
+		PipeReader: reader,
+		onClose: func() {
+			_ = logs.Close()
+		},
+	}, nil
+}
+
+func (d *Docker) ContainerStats(containerId string) (*Stats, error) {
+	statsResp, err := d.client.ContainerStats(context.Background(), containerId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = statsResp.Body.Close()
+	}()
+
+	var statsJSON types.StatsJSON
+	err = json.NewDecoder(statsResp.Body).Decode(&statsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		MemoryUsage: statsJSON.MemoryStats.Usage,
+		MemoryLimit: statsJSON.MemoryStats.Limit,
+	}
+
+	cpuDelta := float64(statsJSON.CPUStats.CPUUsage.TotalUsage) -
+		float64(statsJSON.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(statsJSON.CPUStats.SystemUsage) - float64(statsJSON.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		numCPUs := float64(len(statsJSON.CPUStats.CPUUsage.PercpuUsage))
+		stats.CPUPercentage = cpuDelta / systemDelta * numCPUs * 100
+	}
+
+	return stats, nil
+}
+
+func (d *Docker) Exec(containerId string, cmd []string) (ExecSession, error) {
+	execConfig := types.ExecConfig{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	}
+
+	execResp, err := d.client.ContainerExecCreate(context.Background(), containerId, execConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	hijacked, err := d.client.ContainerExecAttach(context.Background(), execResp.ID, execConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, copyErr := stdcopy.StdCopy(writer, writer, hijacked.Reader)
+		_ = writer.CloseWithError(copyErr)
+	}()
+
+	return &dockerExecSession{
+		client:   d.client,
+		execId:   execResp.ID,
+		hijacked: hijacked,
+		output:   reader,
+	}, nil
+}
+
+func (d *Docker) ContainerExits() <-chan *ExitEvent {
+	return d.exits
+}
+
+func (d *Docker) watchEvents() {
+	eventFilters := filters.NewArgs()
+	eventFilters.Add("type", "container")
+	eventFilters.Add("event", "die")
+
+	for {
+		messages, errs := d.client.Events(context.Background(), types.EventsOptions{Filters: eventFilters})
+
+	watch:
+		for {
+			select {
+			case msg := <-messages:
+				exitCode, err := strconv.Atoi(msg.Actor.Attributes["exitCode"])
+				if err != nil {
+					log.Warnf("container %s died with invalid exit code: %s", msg.Actor.ID, err)
+				}
+
+				d.exits <- &ExitEvent{
+					ContainerId: msg.Actor.ID,
+					ExitCode:    exitCode,
+				}
+			case err := <-errs:
+				log.Errorf("error watching docker events: %s", err)
+				break watch
+			}
+		}
+
+		time.Sleep(eventsReconnectTimeout)
+	}
+}
+
+func (d *Docker) ExportVolume(containerId, mountPath string) (io.ReadCloser, error) {
+	// pause the container so the files do not change while they are being copied
+	err := d.client.ContainerPause(context.Background(), containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	unpause := func() {
+		unpauseErr := d.client.ContainerUnpause(context.Background(), containerId)
+		if unpauseErr != nil {
+			log.Error(unpauseErr)
+		}
+	}
+
+	content, _, err := d.client.CopyFromContainer(context.Background(), containerId, mountPath)
+	if err != nil {
+		unpause()
+		return nil, err
+	}
+
+	return &unpauseReadCloser{
+		ReadCloser: content,
+		unpause:    unpause,
+	}, nil
+}
+
+func (d *Docker) ImportVolume(containerId, mountPath string, content io.Reader) error {
+	// the tar has the mount path base directory at its root, so it is extracted to its parent
+	return d.client.CopyToContainer(context.Background(), containerId, path.Dir(mountPath), content,
+		types.CopyToContainerOptions{})
+}
+
+func (d *Docker) ListVolumes(labels map[string]string) ([]*Volume, error) {
+	volumes, err := d.client.VolumeList(context.Background(), toLabelFilters(labels))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Volume
+	for _, volume := range volumes.Volumes {
+		result = append(result, &Volume{
+			Name:   volume.Name,
+			Labels: volume.Labels,
+		})
+	}
+
+	return result, nil
+}
+
+func (d *Docker) RemoveVolume(name string) error {
+	return d.client.VolumeRemove(context.Background(), name, false)
+}
+
+func toLabelFilters(labels map[string]string) filters.Args {
+	labelFilters := filters.NewArgs()
+	for key, value := range labels {
+		if value == "" {
+			labelFilters.Add("label", key)
+		} else {
+			labelFilters.Add("label", key+"="+value)
+		}
+	}
+
+	return labelFilters
+}
+
+type (
+	pipeReadCloser struct {
+		*io.PipeReader
+		onClose func()
+	}
+
+	unpauseReadCloser struct {
+		io.ReadCloser
+		unpause func()
+	}
+
+	dockerExecSession struct {
+		client   *client.Client
+		execId   string
+		hijacked types.HijackedResponse
+		output   *io.PipeReader
+	}
+)
+
+func (p *pipeReadCloser) Close() error {
+	p.onClose()
+	return p.PipeReader.Close()
+}
+
+func (u *unpauseReadCloser) Close() error {
+	defer u.unpause()
+	return u.ReadCloser.Close()
+}
+
+func (e *dockerExecSession) Read(p []byte) (int, error) {
+	return e.output.Read(p)
+}
+
+func (e *dockerExecSession) Write(p []byte) (int, error) {
+	return e.hijacked.Conn.Write(p)
+}
+
+func (e *dockerExecSession) CloseStdin() error {
+	return e.hijacked.CloseWrite()
+}
+
+func (e *dockerExecSession) Close() error {
+	e.hijacked.Close()
+	return e.output.Close()
+}
+
+func (e *dockerExecSession) Wait() (int, error) {
+	for {
+		inspect, err := e.client.ContainerExecInspect(context.Background(), e.execId)
+		if err != nil {
+			return -1, err
+		}
+
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+
+		time.Sleep(execWaitInterval)
+	}
+}
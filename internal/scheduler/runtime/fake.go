@@ -0,0 +1,461 @@
+package runtime
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Fake runs instances in process, without a container engine. A running container replies with an empty
+// response on its host ports and heartbeats to the deployer, as an instance using the deployer client would,
+// so the whole deployment flow works without docker.
+type Fake struct {
+	containers sync.Map
+	volumes    sync.Map
+	images     sync.Map
+	exits      chan *ExitEvent
+
+	deployerClient *deployer.Client
+	listen         ListenFunc
+}
+
+// ListenFunc listens on the host port of a fake container
+type ListenFunc func(hostPort string) (net.Listener, error)
+
+type (
+	typeFakeContainersMapKey   = string
+	typeFakeContainersMapValue = *fakeContainer
+
+	typeFakeVolumesMapKey   = string
+	typeFakeVolumesMapValue = *fakeVolume
+
+	fakeContainer struct {
+		Spec     *ContainerSpec
+		Running  bool
+		ExitCode int
+		Stop     chan struct{}
+		Servers  []*http.Server
+		Logs     bytes.Buffer
+		sync.Mutex
+	}
+
+	fakeExecSession struct {
+		*io.PipeReader
+		*io.PipeWriter
+	}
+
+	fakeVolume struct {
+		Labels  map[string]string
+		Content []byte
+		sync.Mutex
+	}
+)
+
+// NewFakeRuntime returns a fake runtime whose instances heartbeat with the deployer client. Containers listen on
+// their host ports with the listen function, or on every interface of the machine if it is nil.
+func NewFakeRuntime(deployerClient *deployer.Client, listen ListenFunc) *Fake {
+	if listen == nil {
+		listen = func(hostPort string) (net.Listener, error) {
+			return net.Listen(utils.TCP, ":"+hostPort)
+		}
+	}
+
+	return &Fake{
+		exits:          make(chan *ExitEvent),
+		deployerClient: deployerClient,
+		listen:         listen,
+	}
+}
+
+func (f *Fake) PullImage(image string, _ *RegistryAuth) error {
+	log.Debugf("[FAKE] pulling image %s", image)
+	f.images.Store(image, struct{}{})
+	return nil
+}
+
+func (f *Fake) HasImage(image string) (bool, error) {
+	_, ok := f.images.Load(image)
+	return ok, nil
+}
+
+func (f *Fake) CreateContainer(spec *ContainerSpec) (containerId string, err error) {
+	containerId = utils.RandomString(12)
+
+	for _, volumeMount := range spec.Mounts {
+		f.volumes.LoadOrStore(volumeMount.Name, &fakeVolume{Labels: volumeMount.Labels})
+	}
+
+	f.containers.Store(containerId, &fakeContainer{Spec: spec})
+
+	log.Debugf("[FAKE] created container %s for %s", containerId, spec.Name)
+
+	return containerId, nil
+}
+
+func (f *Fake) getContainer(containerId string) (*fakeContainer, error) {
+	value, ok := f.containers.Load(containerId)
+	if !ok {
+		return nil, errors.Errorf("no such container: %s", containerId)
+	}
+
+	return value.(typeFakeContainersMapValue), nil
+}
+
+func (f *Fake) StartContainer(containerId string) error {
+	cont, err := f.getContainer(containerId)
+	if err != nil {
+		return err
+	}
+
+	cont.Lock()
+	defer cont.Unlock()
+
+	if cont.Running {
+		return nil
+	}
+
+	cont.Running = true
+	cont.Stop = make(chan struct{})
+	cont.Servers = nil
+
+	for _, bindings := range cont.Spec.PortBindings {
+		for _, binding := range bindings {
+			listener, listenErr := f.listen(binding.HostPort)
+			if listenErr != nil {
+				log.Errorf("[FAKE] container %s could not listen on %s: %s", containerId, binding.HostPort, listenErr)
+				continue
+			}
+
+			s := &http.Server{
+				Addr:    ":" + binding.HostPort,
+				Handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+			}
+			cont.Servers = append(cont.Servers, s)
+
+			go func() {
+				httpErr := s.Serve(listener)
+				if httpErr != nil && httpErr != http.ErrServerClosed {
+					log.Errorf("[FAKE] container %s stopped listening on %s: %s", containerId, s.Addr, httpErr)
+				}
+			}()
+		}
+	}
+
+	go f.sendFakeHeartbeats(cont.Spec.Env, cont.Stop)
+
+	_, _ = fmt.Fprintf(&cont.Logs, "%s started\n", time.Now().Format(time.RFC3339))
+	log.Debugf("[FAKE] started container %s", containerId)
+
+	return nil
+}
+
+// sendFakeHeartbeats heartbeats to the deployer using the ids the scheduler passes to every instance
+func (f *Fake) sendFakeHeartbeats(env []string, stop <-chan struct{}) {
+	var serviceId, instanceId string
+	for _, envVar := range env {
+		if strings.HasPrefix(envVar, utils.ServiceEnvVarName+"=") {
+			serviceId = strings.TrimPrefix(envVar, utils.ServiceEnvVarName+"=")
+		} else if strings.HasPrefix(envVar, utils.InstanceEnvVarName+"=") {
+			instanceId = strings.TrimPrefix(envVar, utils.InstanceEnvVarName+"=")
+		}
+	}
+
+	status := f.deployerClient.RegisterHearbeatServiceInstance(serviceId, instanceId)
+	if status != http.StatusOK && status != http.StatusConflict {
+		// e.g. static instances, which the deployer does not expect heartbeats from
+		log.Debugf("[FAKE] got status %d registering heartbeat for %s, not sending heartbeats", status,
+			instanceId)
+		return
+	}
+
+	ticker := time.NewTicker((deployer.HeartbeatCheckerTimeout / 3) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			status = f.deployerClient.SendHearbeatServiceInstance(serviceId, instanceId)
+			if status != http.StatusOK {
+				log.Warnf("[FAKE] got status %d sending heartbeat for %s", status, instanceId)
+			}
+		}
+	}
+}
+
+func (f *Fake) StopContainer(containerId string, _ time.Duration) error {
+	return f.Exit(containerId, 0)
+}
+
+// Exit stops the container as if its process had exited with the given code
+func (f *Fake) Exit(containerId string, exitCode int) error {
+	cont, err := f.getContainer(containerId)
+	if err != nil {
+		return err
+	}
+
+	cont.Lock()
+	if !cont.Running {
+		cont.Unlock()
+		return nil
+	}
+
+	cont.Running = false
+	cont.ExitCode = exitCode
+	close(cont.Stop)
+	for _, s := range cont.Servers {
+		_ = s.Shutdown(context.Background())
+	}
+
+	_, _ = fmt.Fprintf(&cont.Logs, "%s exited with code %d\n", time.Now().Format(time.RFC3339), exitCode)
+	cont.Unlock()
+
+	log.Debugf("[FAKE] container %s exited with code %d", containerId, exitCode)
+
+	go func() {
+		f.exits <- &ExitEvent{
+			ContainerId: containerId,
+			ExitCode:    exitCode,
+		}
+	}()
+
+	return nil
+}
+
+func (f *Fake) RemoveContainer(containerId string) error {
+	cont, err := f.getContainer(containerId)
+	if err != nil {
+		return err
+	}
+
+	cont.Lock()
+	defer cont.Unlock()
+
+	if cont.Running {
+		return errors.Errorf("container %s is running", containerId)
+	}
+
+	f.containers.Delete(containerId)
+
+	return nil
+}
+
+// SignalContainer only records the signal in the container logs, since there is no process to signal
+func (f *Fake) SignalContainer(containerId, signal string) error {
+	cont, err := f.getContainer(containerId)
+	if err != nil {
+		return err
+	}
+
+	cont.Lock()
+	defer cont.Unlock()
+
+	if !cont.Running {
+		return errors.Errorf("container %s is not running", containerId)
+	}
+
+	_, _ = fmt.Fprintf(&cont.Logs, "%s received signal %s\n", time.Now().Format(time.RFC3339), signal)
+
+	return nil
+}
+
+func (f *Fake) toContainer(containerId string, cont *fakeContainer) *Container {
+	return &Container{
+		Id:      containerId,
+		Labels:  cont.Spec.Labels,
+		Running: cont.Running,
+		Mounts:  cont.Spec.Mounts,
+	}
+}
+
+func (f *Fake) ListContainers(labels map[string]string) ([]*Container, error) {
+	var result []*Container
+
+	f.containers.Range(func(key, value interface{}) bool {
+		containerId := key.(typeFakeContainersMapKey)
+		cont := value.(typeFakeContainersMapValue)
+
+		cont.Lock()
+		if hasLabels(cont.Spec.Labels, labels) {
+			result = append(result, f.toContainer(containerId, cont))
+		}
+		cont.Unlock()
+
+		return true
+	})
+
+	return result, nil
+}
+
+func (f *Fake) InspectContainer(containerId string) (*Container, error) {
+	cont, err := f.getContainer(containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	cont.Lock()
+	defer cont.Unlock()
+
+	inspected := f.toContainer(containerId, cont)
+	inspected.ExitCode = cont.ExitCode
+
+	return inspected, nil
+}
+
+func (f *Fake) ContainerLogs(containerId string, _ *LogsOptions) (io.ReadCloser, error) {
+	cont, err := f.getContainer(containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	cont.Lock()
+	defer cont.Unlock()
+
+	return ioutil.NopCloser(bytes.NewReader(cont.Logs.Bytes())), nil
+}
+
+func (f *Fake) ContainerStats(containerId string) (*Stats, error) {
+	_, err := f.getContainer(containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stats{}, nil
+}
+
+// Exec runs no command, it echoes its stdin back as output and exits with 0 once stdin is closed
+func (f *Fake) Exec(containerId string, cmd []string) (ExecSession, error) {
+	cont, err := f.getContainer(containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	cont.Lock()
+	defer cont.Unlock()
+
+	if !cont.Running {
+		return nil, errors.Errorf("container %s is not running", containerId)
+	}
+
+	_, _ = fmt.Fprintf(&cont.Logs, "%s exec %s\n", time.Now().Format(time.RFC3339), strings.Join(cmd, " "))
+
+	reader, writer := io.Pipe()
+
+	return &fakeExecSession{
+		PipeReader: reader,
+		PipeWriter: writer,
+	}, nil
+}
+
+func (f *Fake) ContainerExits() <-chan *ExitEvent {
+	return f.exits
+}
+
+func (f *Fake) getMountedVolume(containerId, mountPath string) (*fakeVolume, error) {
+	cont, err := f.getContainer(containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, volumeMount := range cont.Spec.Mounts {
+		if volumeMount.Target == mountPath {
+			value, ok := f.volumes.Load(volumeMount.Name)
+			if !ok {
+				break
+			}
+
+			return value.(typeFakeVolumesMapValue), nil
+		}
+	}
+
+	return nil, errors.Errorf("container %s has no volume at %s", containerId, mountPath)
+}
+
+func (f *Fake) ExportVolume(containerId, mountPath string) (io.ReadCloser, error) {
+	volume, err := f.getMountedVolume(containerId, mountPath)
+	if err != nil {
+		return nil, err
+	}
+
+	volume.Lock()
+	defer volume.Unlock()
+
+	if volume.Content == nil {
+		// nothing was ever written to the volume, so it is exported as an empty tar
+		var emptyTar bytes.Buffer
+		err = tar.NewWriter(&emptyTar).Close()
+		if err != nil {
+			return nil, err
+		}
+
+		return ioutil.NopCloser(&emptyTar), nil
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(volume.Content)), nil
+}
+
+func (f *Fake) ImportVolume(containerId, mountPath string, content io.Reader) error {
+	volume, err := f.getMountedVolume(containerId, mountPath)
+	if err != nil {
+		return err
+	}
+
+	volume.Lock()
+	defer volume.Unlock()
+
+	volume.Content, err = ioutil.ReadAll(content)
+
+	return err
+}
+
+func (f *Fake) ListVolumes(labels map[string]string) ([]*Volume, error) {
+	var result []*Volume
+
+	f.volumes.Range(func(key, value interface{}) bool {
+		volumeName := key.(typeFakeVolumesMapKey)
+		volume := value.(typeFakeVolumesMapValue)
+
+		if hasLabels(volume.Labels, labels) {
+			result = append(result, &Volume{
+				Name:   volumeName,
+				Labels: volume.Labels,
+			})
+		}
+
+		return true
+	})
+
+	return result, nil
+}
+
+func (f *Fake) RemoveVolume(name string) error {
+	f.volumes.Delete(name)
+	return nil
+}
+
+func (e *fakeExecSession) CloseStdin() error {
+	return e.PipeWriter.Close()
+}
+
+func (e *fakeExecSession) Close() error {
+	_ = e.PipeWriter.Close()
+	return e.PipeReader.Close()
+}
+
+func (e *fakeExecSession) Wait() (int, error) {
+	return 0, nil
+}
@@ -0,0 +1,337 @@
+package runtime
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	"github.com/docker/go-connections/nat"
+)
+
+const (
+	exitEventTimeout = 5 * time.Second
+)
+
+// newTestFake returns a fake runtime whose containers listen on loopback ports, recorded in listened, and whose
+// instances get a 404 from the deployer, so they do not heartbeat
+func newTestFake(t *testing.T) (fake *Fake, listened func() []string) {
+	t.Helper()
+
+	deployerServer := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(deployerServer.Close)
+
+	transport := utils.NewTransport(nil, nil)
+	t.Cleanup(transport.CloseIdleConnections)
+	deployerClient := deployer.NewClientPool(transport).Get(deployerServer.Listener.Addr().String())
+
+	var (
+		addrs     []string
+		addrsLock sync.Mutex
+	)
+
+	fake = NewFakeRuntime(deployerClient, func(string) (net.Listener, error) {
+		listener, err := net.Listen(utils.TCP, "127.0.0.1:0")
+		if err == nil {
+			addrsLock.Lock()
+			addrs = append(addrs, listener.Addr().String())
+			addrsLock.Unlock()
+		}
+
+		return listener, err
+	})
+
+	listened = func() []string {
+		addrsLock.Lock()
+		defer addrsLock.Unlock()
+
+		return append([]string(nil), addrs...)
+	}
+
+	return fake, listened
+}
+
+func waitForExit(t *testing.T, fake *Fake) *ExitEvent {
+	t.Helper()
+
+	select {
+	case exit := <-fake.ContainerExits():
+		return exit
+	case <-time.After(exitEventTimeout):
+		t.Fatal("timed out waiting for the container exit")
+		return nil
+	}
+}
+
+func TestFakeContainerLifecycle(t *testing.T) {
+	fake, listened := newTestFake(t)
+
+	spec := &ContainerSpec{
+		Name:   "instance",
+		Image:  "image",
+		Labels: map[string]string{"deployment": "dep"},
+		PortBindings: nat.PortMap{
+			"8000/tcp": {{HostPort: "30000"}},
+		},
+	}
+
+	containerId, err := fake.CreateContainer(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containers, err := fake.ListContainers(map[string]string{"deployment": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Id != containerId || containers[0].Running {
+		t.Fatalf("expected a single stopped container %s, got %+v", containerId, containers)
+	}
+
+	containers, err = fake.ListContainers(map[string]string{"deployment": "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 0 {
+		t.Fatalf("expected no containers of another deployment, got %+v", containers)
+	}
+
+	err = fake.StartContainer(containerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := listened()
+	if len(addrs) != 1 {
+		t.Fatalf("expected the container to listen once, got %v", addrs)
+	}
+
+	resp, err := http.Get("http://" + addrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the container to reply with %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	err = fake.RemoveContainer(containerId)
+	if err == nil {
+		t.Fatal("expected removing a running container to fail")
+	}
+
+	err = fake.Exit(containerId, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exit := waitForExit(t, fake)
+	if exit.ContainerId != containerId || exit.ExitCode != 3 {
+		t.Fatalf("expected container %s to exit with 3, got %+v", containerId, exit)
+	}
+
+	inspected, err := fake.InspectContainer(containerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inspected.Running || inspected.ExitCode != 3 {
+		t.Fatalf("expected a stopped container that exited with 3, got %+v", inspected)
+	}
+
+	_, err = http.Get("http://" + addrs[0])
+	if err == nil {
+		t.Fatal("expected the exited container to stop listening")
+	}
+
+	err = fake.RemoveContainer(containerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fake.InspectContainer(containerId)
+	if err == nil {
+		t.Fatal("expected the removed container to be gone")
+	}
+}
+
+func TestFakeStopExitsWithZero(t *testing.T) {
+	fake, _ := newTestFake(t)
+
+	containerId, err := fake.CreateContainer(&ContainerSpec{Name: "instance"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = fake.StartContainer(containerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = fake.StopContainer(containerId, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exit := waitForExit(t, fake)
+	if exit.ExitCode != 0 {
+		t.Fatalf("expected a stopped container to exit with 0, got %d", exit.ExitCode)
+	}
+
+	// stopping it again does nothing, so there is no second exit
+	err = fake.StopContainer(containerId, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case exit = <-fake.ContainerExits():
+		t.Fatalf("expected a single exit, got another %+v", exit)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFakeVolumes(t *testing.T) {
+	fake, _ := newTestFake(t)
+
+	labels := map[string]string{"deployment": "dep"}
+	containerId, err := fake.CreateContainer(&ContainerSpec{
+		Name: "instance",
+		Mounts: []*VolumeMount{
+			{Name: "dep-data-0", Target: "/data", Labels: labels},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := fake.ExportVolume(containerId, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tar.NewReader(exported).Next()
+	if err != io.EOF {
+		t.Fatalf("expected an empty tar from a new volume, got %v", err)
+	}
+
+	content := []byte("snapshot")
+	err = fake.ImportVolume(containerId, "/data", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err = fake.ExportVolume(containerId, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exportedBytes, err := ioutil.ReadAll(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(exportedBytes, content) {
+		t.Fatalf("expected the imported content %q, got %q", content, exportedBytes)
+	}
+
+	_, err = fake.ExportVolume(containerId, "/other")
+	if err == nil {
+		t.Fatal("expected exporting a path without a volume to fail")
+	}
+
+	volumes, err := fake.ListVolumes(labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 1 || volumes[0].Name != "dep-data-0" {
+		t.Fatalf("expected the volume dep-data-0, got %+v", volumes)
+	}
+
+	err = fake.RemoveVolume("dep-data-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumes, err = fake.ListVolumes(labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 0 {
+		t.Fatalf("expected no volumes once removed, got %+v", volumes)
+	}
+}
+
+func TestFakeExecEchoesStdin(t *testing.T) {
+	fake, _ := newTestFake(t)
+
+	containerId, err := fake.CreateContainer(&ContainerSpec{Name: "instance"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fake.Exec(containerId, []string{"cat"})
+	if err == nil {
+		t.Fatal("expected exec in a stopped container to fail")
+	}
+
+	err = fake.StartContainer(containerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := fake.Exec(containerId, []string{"cat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_, _ = session.Write([]byte("hello"))
+		_ = session.CloseStdin()
+	}()
+
+	output, err := ioutil.ReadAll(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != "hello" {
+		t.Fatalf("expected the output to be the input, got %q", output)
+	}
+
+	exitCode, err := session.Wait()
+	if err != nil || exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d (%v)", exitCode, err)
+	}
+
+	_ = session.Close()
+	_ = fake.StopContainer(containerId, time.Second)
+	waitForExit(t, fake)
+}
+
+func TestHasLabels(t *testing.T) {
+	containerLabels := map[string]string{"deployment": "dep", "instance": "inst"}
+
+	tests := []struct {
+		labels   map[string]string
+		expected bool
+	}{
+		{labels: nil, expected: true},
+		{labels: map[string]string{"deployment": "dep"}, expected: true},
+		{labels: map[string]string{"deployment": ""}, expected: true},
+		{labels: map[string]string{"deployment": "other"}, expected: false},
+		{labels: map[string]string{"slot": ""}, expected: false},
+		{labels: map[string]string{"deployment": "dep", "instance": "inst"}, expected: true},
+	}
+
+	for _, test := range tests {
+		if actual := hasLabels(containerLabels, test.labels); actual != test.expected {
+			t.Errorf("expected hasLabels with %v to be %t", test.labels, test.expected)
+		}
+	}
+}
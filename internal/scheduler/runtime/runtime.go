@@ -0,0 +1,139 @@
+package runtime
+
+import (
+	"io"
+	"time"
+
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	"github.com/docker/go-connections/nat"
+	"github.com/pkg/errors"
+)
+
+// Runtime names
+const (
+	DockerRuntimeName     = "docker"
+	ContainerdRuntimeName = "containerd"
+	FakeRuntimeName       = "fake"
+)
+
+type (
+	// Runtime is the container engine the scheduler uses to run instances. Containers are created stopped,
+	// started once the deployer knows about them and listed by the labels set on creation.
+	Runtime interface {
+		// PullImage pulls the image from its registry, authenticating with auth if it is not nil
+		PullImage(image string, auth *RegistryAuth) error
+		HasImage(image string) (bool, error)
+		CreateContainer(spec *ContainerSpec) (containerId string, err error)
+		StartContainer(containerId string) error
+		StopContainer(containerId string, timeout time.Duration) error
+		RemoveContainer(containerId string) error
+		// SignalContainer sends the signal, by name or number, to the main process of a running container
+		SignalContainer(containerId, signal string) error
+		// ListContainers returns every container, running or not, with the given labels. A label with an empty
+		// value only has to be present.
+		ListContainers(labels map[string]string) ([]*Container, error)
+		InspectContainer(containerId string) (*Container, error)
+		ContainerLogs(containerId string, options *LogsOptions) (io.ReadCloser, error)
+		ContainerStats(containerId string) (*Stats, error)
+		// Exec runs the command in the container without a tty
+		Exec(containerId string, cmd []string) (ExecSession, error)
+		// ContainerExits returns a channel with the exits of all containers, including the ones stopped by the
+		// scheduler
+		ContainerExits() <-chan *ExitEvent
+
+		// ExportVolume returns a tar with the volume mounted at mountPath, whose root is the base of the path
+		ExportVolume(containerId, mountPath string) (io.ReadCloser, error)
+		// ImportVolume extracts a tar returned by ExportVolume into the volume mounted at mountPath
+		ImportVolume(containerId, mountPath string, content io.Reader) error
+		ListVolumes(labels map[string]string) ([]*Volume, error)
+		RemoveVolume(name string) error
+	}
+
+	RegistryAuth struct {
+		ServerAddress string
+		Username      string
+		Password      string
+	}
+
+	ContainerSpec struct {
+		Name         string
+		Image        string
+		Env          []string
+		Labels       map[string]string
+		PortBindings nat.PortMap
+		Mounts       []*VolumeMount
+	}
+
+	// ExecSession is a command running in a container. Reads return its stdout and stderr and writes go to its
+	// stdin.
+	ExecSession interface {
+		io.ReadWriteCloser
+		CloseStdin() error
+		// Wait waits for the command to exit, once its output has been read to the end
+		Wait() (exitCode int, err error)
+	}
+
+	// VolumeMount mounts a named volume, created with the given labels if it does not exist
+	VolumeMount struct {
+		Name   string
+		Target string
+		Labels map[string]string
+	}
+
+	Container struct {
+		Id      string
+		Labels  map[string]string
+		Running bool
+		Mounts  []*VolumeMount
+		// ExitCode is the code the last run of the container exited with, only set by InspectContainer
+		ExitCode int
+	}
+
+	Volume struct {
+		Name   string
+		Labels map[string]string
+	}
+
+	LogsOptions struct {
+		Follow bool
+		Tail   string
+		Since  string
+	}
+
+	Stats struct {
+		CPUPercentage float64
+		MemoryUsage   uint64
+		MemoryLimit   uint64
+	}
+
+	ExitEvent struct {
+		ContainerId string
+		ExitCode    int
+	}
+)
+
+// NewRuntime returns the runtime with the name. The deployer client is only used by the fake runtime, whose
+// instances heartbeat with it.
+func NewRuntime(name string, deployerClient *deployer.Client) (Runtime, error) {
+	switch name {
+	case DockerRuntimeName:
+		return NewDockerRuntime()
+	case ContainerdRuntimeName:
+		return NewContainerdRuntime()
+	case FakeRuntimeName:
+		return NewFakeRuntime(deployerClient, nil), nil
+	default:
+		return nil, errors.Errorf("invalid runtime: %s", name)
+	}
+}
+
+func hasLabels(containerLabels, labels map[string]string) bool {
+	for key, value := range labels {
+		containerValue, ok := containerLabels[key]
+		if !ok || (value != "" && containerValue != value) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/scheduler/runtime"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/scheduler"
+	"github.com/pkg/errors"
+)
+
+const (
+	serviceName = "SCHEDULER"
+)
+
+type (
+	// Server is the scheduler of a node, which runs the instances the deployer asks for in a container runtime.
+	// Every piece of state lives in it, so several can run in the same process.
+	Server struct {
+		*utils.Server
+
+		config    *config.Config
+		transport *utils.Transport
+		security  *utils.Security
+		listener  net.Listener
+
+		deployerClient      *deployer.Client
+		schedulerClients    *scheduler.ClientPool
+		containerRuntime    runtime.Runtime
+		instanceToContainer sync.Map
+		credentials         map[string]*registryCredentials
+		imageLocks          sync.Map
+		restartStates       sync.Map
+
+		// slots in use by the instances of each deployment, each slot owns a set of volumes
+		usedSlots     map[string]map[int]struct{}
+		usedSlotsLock sync.Mutex
+	}
+
+	Option func(s *Server)
+)
+
+// WithConfig sets the configuration of the scheduler, instead of the one of the process
+func WithConfig(conf *config.Config) Option {
+	return func(s *Server) {
+		s.config = conf
+	}
+}
+
+// WithTransport sets the transport the clients of the scheduler do their requests with
+func WithTransport(transport *utils.Transport) Option {
+	return func(s *Server) {
+		s.transport = transport
+	}
+}
+
+// WithListener makes the scheduler serve on the listener, instead of listening on the configured port
+func WithListener(listener net.Listener) Option {
+	return func(s *Server) {
+		s.listener = listener
+	}
+}
+
+// WithRuntime sets the runtime the instances run in, instead of the configured one
+func WithRuntime(containerRuntime runtime.Runtime) Option {
+	return func(s *Server) {
+		s.containerRuntime = containerRuntime
+	}
+}
+
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		usedSlots: map[string]map[int]struct{}{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.config == nil {
+		s.config = config.Get()
+	}
+
+	security, err := s.config.Server.Security()
+	if err != nil {
+		panic(err)
+	}
+	s.security = security
+
+	if s.transport == nil {
+		s.transport = utils.NewTransport(nil, s.security)
+	}
+
+	s.deployerClient = deployer.NewClientPool(s.transport).Get(s.config.Deployer.HostPort())
+	s.schedulerClients = scheduler.NewClientPool(s.transport)
+	s.Server = utils.NewServer(serviceName, api.PrefixPath, s.routes(), security.TLS)
+
+	return s
+}
+
+// Start takes over the instances left running by a previous scheduler and starts serving
+func (s *Server) Start() error {
+	var err error
+
+	if s.listener == nil {
+		s.listener, err = utils.Listen(s.config.Server.ListenAddr, s.config.Scheduler.Port)
+		if err != nil {
+			return errors.Wrap(err, "error listening")
+		}
+	}
+
+	if s.containerRuntime == nil {
+		s.containerRuntime, err = runtime.NewRuntime(s.config.Scheduler.Runtime, s.deployerClient)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.loadRegistryCredentials(s.config.Scheduler.RegistryCredentials)
+	if err != nil {
+		return err
+	}
+
+	notRunning, err := s.rebuildInstances()
+	if err != nil {
+		return err
+	}
+
+	s.Go(s.watchContainerExits)
+	s.Go(func() {
+		s.reconcileInstances(notRunning)
+	})
+
+	s.Serve(s.listener)
+
+	return nil
+}
+
+// Stop stops serving and watching the instances, which are left running for the next scheduler to take over
+func (s *Server) Stop(ctx context.Context) error {
+	return s.Shutdown(ctx)
+}
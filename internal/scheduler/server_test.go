@@ -0,0 +1,243 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	deployerApi "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/scheduler/runtime"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+type (
+	// testDeployer stands in for the deployer of the node, replying OK to every request and recording them
+	testDeployer struct {
+		requests []*testRequest
+		lock     sync.Mutex
+	}
+
+	testRequest struct {
+		method string
+		path   string
+		body   []byte
+	}
+
+	// failingStartRuntime is the fake runtime with containers that fail to start
+	failingStartRuntime struct {
+		*runtime.Fake
+	}
+)
+
+func (d *testDeployer) ServeHTTP(_ http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.requests = append(d.requests, &testRequest{method: r.Method, path: r.URL.Path, body: body})
+}
+
+func (d *testDeployer) requestsTo(method, pathPrefix string) (requests []*testRequest) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, request := range d.requests {
+		if request.method == method && strings.HasPrefix(request.path, pathPrefix) {
+			requests = append(requests, request)
+		}
+	}
+
+	return requests
+}
+
+func (r *failingStartRuntime) StartContainer(string) error {
+	return errors.New("failed to start")
+}
+
+// newTestScheduler returns a scheduler, not started, whose requests to the deployer of the node go to a
+// testDeployer. It runs instances in the fake runtime, unless wrap gives it another one.
+func newTestScheduler(t *testing.T, conf *config.Config,
+	wrap func(fake *runtime.Fake) runtime.Runtime) (*Server, *runtime.Fake, *testDeployer) {
+	t.Helper()
+
+	deployerListener, err := net.Listen(utils.TCP, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDep := &testDeployer{}
+	deployerServer := &http.Server{Handler: h2c.NewHandler(testDep, &http2.Server{})}
+	go func() {
+		_ = deployerServer.Serve(deployerListener)
+	}()
+	t.Cleanup(func() {
+		_ = deployerServer.Close()
+	})
+
+	transport := utils.NewTransport(func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, deployerListener.Addr().String())
+	}, nil)
+	t.Cleanup(transport.CloseIdleConnections)
+
+	fake := runtime.NewFakeRuntime(deployer.NewClientPool(transport).Get(conf.Deployer.HostPort()),
+		func(string) (net.Listener, error) {
+			return net.Listen(utils.TCP, "127.0.0.1:0")
+		})
+
+	var containerRuntime runtime.Runtime = fake
+	if wrap != nil {
+		containerRuntime = wrap(fake)
+	}
+
+	listener, err := net.Listen(utils.TCP, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(WithConfig(conf), WithTransport(transport), WithListener(listener),
+		WithRuntime(containerRuntime))
+
+	return s, fake, testDep
+}
+
+func TestStartReturnsErrors(t *testing.T) {
+	credentialsFile := filepath.Join(t.TempDir(), "credentials.json")
+	err := ioutil.WriteFile(credentialsFile, []byte("not json"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := config.Default()
+	conf.Scheduler.RegistryCredentials = credentialsFile
+
+	s, _, _ := newTestScheduler(t, conf, nil)
+
+	err = s.Start()
+	if err == nil {
+		_ = s.Stop(context.Background())
+		t.Fatal("expected starting with invalid registry credentials to fail")
+	}
+	if !strings.Contains(err.Error(), "registry credentials") {
+		t.Fatalf("expected an error about the registry credentials, got %s", err)
+	}
+}
+
+func TestSchedulersRunSideBySide(t *testing.T) {
+	var servers []*Server
+	for i := 0; i < 2; i++ {
+		s, _, _ := newTestScheduler(t, config.Default(), nil)
+
+		err := s.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		servers = append(servers, s)
+	}
+
+	for _, s := range servers {
+		err := s.Stop(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFailedStartIsUndoneAndReported(t *testing.T) {
+	s, fake, testDep := newTestScheduler(t, config.Default(), func(fake *runtime.Fake) runtime.Runtime {
+		return &failingStartRuntime{Fake: fake}
+	})
+
+	s.startContainerAsync(&api.ContainerInstanceDTO{
+		ServiceName: "dep",
+		Image:       &api.ImageDTO{Name: "image", PullPolicy: api.ImagePullIfNotPresent},
+	})
+
+	containers, err := fake.ListContainers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 0 {
+		t.Fatalf("expected the container to be removed, got %+v", containers)
+	}
+
+	s.usedSlotsLock.Lock()
+	slots := len(s.usedSlots)
+	s.usedSlotsLock.Unlock()
+	if slots != 0 {
+		t.Fatalf("expected the slot to be released, got %+v", s.usedSlots)
+	}
+
+	s.instanceToContainer.Range(func(key, _ interface{}) bool {
+		t.Fatalf("expected no instances, got %s", key)
+		return false
+	})
+
+	instancesPath := deployerApi.GetServiceInstancePath("dep", "")
+	registered := testDep.requestsTo(http.MethodPost, instancesPath)
+	deleted := testDep.requestsTo(http.MethodDelete, instancesPath)
+	if len(registered) != 1 || len(deleted) != 1 || registered[0].path != deleted[0].path {
+		t.Fatal("expected the instance to be registered in the deployer and then deleted")
+	}
+
+	instanceId := strings.TrimPrefix(registered[0].path, instancesPath)
+	reports := testDep.requestsTo(http.MethodPut, deployerApi.GetServiceInstanceHealthPath("dep", instanceId))
+	if len(reports) != 1 {
+		t.Fatalf("expected the failure of %s to be reported once, got %d reports", instanceId, len(reports))
+	}
+
+	var health deployerApi.InstanceHealthDTO
+	err = json.Unmarshal(reports[0].body, &health)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !health.Failed || !strings.Contains(health.Reason, "failed to start") {
+		t.Fatalf("expected the instance to be reported as failed to start, got %+v", health)
+	}
+}
+
+func TestVolumeSnapshotsNeedNodeToken(t *testing.T) {
+	conf := config.Default()
+	conf.Server.AuthToken = "token"
+
+	s, _, _ := newTestScheduler(t, conf, nil)
+
+	tests := []struct {
+		token    string
+		expected int
+	}{
+		{token: "", expected: http.StatusForbidden},
+		{token: "other", expected: http.StatusForbidden},
+		// the instance does not exist, but the request gets through
+		{token: "token", expected: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, api.GetInstanceVolumePath("instance", "volume"), nil)
+		if test.token != "" {
+			utils.SetAuthorization(req, test.token)
+		}
+
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, req)
+
+		if recorder.Code != test.expected {
+			t.Errorf("expected status %d with token %q, got %d", test.expected, test.token, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"net/http"
+	"strconv"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/scheduler/runtime"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Labels set on the volumes created by the scheduler, besides the deployment label
+const (
+	volumeLabel        = "cloud-edge-deployment.volume"
+	reclaimPolicyLabel = "cloud-edge-deployment.reclaim-policy"
+)
+
+// acquireSlot returns the lowest slot of the deployment not owned by any running instance. Since volume
+// names are derived from the slot, a new instance reuses the volumes left behind by a previous one.
+func (s *Server) acquireSlot(deploymentId string) int {
+	s.usedSlotsLock.Lock()
+	defer s.usedSlotsLock.Unlock()
+
+	deploymentSlots, ok := s.usedSlots[deploymentId]
+	if !ok {
+		deploymentSlots = map[int]struct{}{}
+		s.usedSlots[deploymentId] = deploymentSlots
+	}
+
+	slot := 0
+	for {
+		if _, ok = deploymentSlots[slot]; !ok {
+			break
+		}
+		slot++
+	}
+
+	deploymentSlots[slot] = struct{}{}
+
+	return slot
+}
+
+// reserveSlot marks a slot as used by an instance that is already running, e.g. one found in docker on startup
+func (s *Server) reserveSlot(deploymentId string, slot int) {
+	s.usedSlotsLock.Lock()
+	defer s.usedSlotsLock.Unlock()
+
+	deploymentSlots, ok := s.usedSlots[deploymentId]
+	if !ok {
+		deploymentSlots = map[int]struct{}{}
+		s.usedSlots[deploymentId] = deploymentSlots
+	}
+
+	deploymentSlots[slot] = struct{}{}
+}
+
+func (s *Server) releaseSlot(deploymentId string, slot int) {
+	s.usedSlotsLock.Lock()
+	defer s.usedSlotsLock.Unlock()
+
+	deploymentSlots, ok := s.usedSlots[deploymentId]
+	if !ok {
+		return
+	}
+
+	delete(deploymentSlots, slot)
+	if len(deploymentSlots) == 0 {
+		delete(s.usedSlots, deploymentId)
+	}
+}
+
+func getVolumeName(deploymentId, volumeName string, slot int) string {
+	return deploymentId + "-" + volumeName + "-" + strconv.Itoa(slot)
+}
+
+func generateVolumeMounts(deploymentId string, slot int, volumes []*api.VolumeDTO) (mounts []*runtime.VolumeMount) {
+	for _, volume := range volumes {
+		mounts = append(mounts, &runtime.VolumeMount{
+			Name:   getVolumeName(deploymentId, volume.Name, slot),
+			Target: volume.MountPath,
+			Labels: map[string]string{
+				deploymentLabel:    deploymentId,
+				volumeLabel:        volume.Name,
+				reclaimPolicyLabel: volume.ReclaimPolicy,
+			},
+		})
+	}
+
+	return
+}
+
+func getVolumeMountPath(volumes []*api.VolumeDTO, volumeName string) (mountPath string, ok bool) {
+	for _, volume := range volumes {
+		if volume.Name == volumeName {
+			return volume.MountPath, true
+		}
+	}
+
+	return "", false
+}
+
+// restoreVolumes copies the volumes of the instance referred to by the snapshot into the container. It has to be
+// called after the container is created and before it is started.
+func (s *Server) restoreVolumes(contId string, volumes []*api.VolumeDTO, snapshot *api.SnapshotDTO) error {
+	originClient := s.schedulerClients.Get(snapshot.SchedulerAddr)
+
+	for _, volume := range volumes {
+		log.Debugf("restoring volume %s from instance %s at %s", volume.Name, snapshot.InstanceId,
+			snapshot.SchedulerAddr)
+
+		content, status := originClient.GetVolumeSnapshot(snapshot.InstanceId, volume.Name)
+		if status != http.StatusOK {
+			return errors.Errorf("got status %d while getting snapshot of volume %s", status, volume.Name)
+		}
+
+		err := s.containerRuntime.ImportVolume(contId, volume.MountPath, content)
+		closeErr := content.Close()
+		if closeErr != nil {
+			log.Error(closeErr)
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "error copying snapshot of volume %s", volume.Name)
+		}
+	}
+
+	return nil
+}
+
+// reclaimVolumes removes the volumes of the deployment whose reclaim policy is delete. It should only be called
+// once no instance of the deployment is running in this node.
+func (s *Server) reclaimVolumes(deploymentId string) {
+	volumes, err := s.containerRuntime.ListVolumes(map[string]string{deploymentLabel: deploymentId})
+	if err != nil {
+		log.Errorf("error listing volumes for deployment %s: %s", deploymentId, err)
+		return
+	}
+
+	for _, volume := range volumes {
+		if volume.Labels[reclaimPolicyLabel] == api.VolumeReclaimRetain {
+			log.Debugf("retaining volume %s of deployment %s", volume.Name, deploymentId)
+			continue
+		}
+
+		log.Debugf("removing volume %s of deployment %s", volume.Name, deploymentId)
+		err = s.containerRuntime.RemoveVolume(volume.Name)
+		if err != nil {
+			log.Errorf("error removing volume %s: %s", volume.Name, err)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic/metrics"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/scheduler/runtime"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultNeighbours     = 3
+	defaultClientLatency  = 500
+	defaultProcessingTime = 5
+	defaultDummyPort      = 8001
+
+	dummyDeploymentYAMLFormat = `spec:
+  replicas: 1
+  serviceName: %s
+  template:
+    spec:
+      containers:
+        - image: brunoanjos/dummy-service:latest
+          ports:
+            - containerPort: "%d"
+`
+)
+
+type (
+	// NodeSpec describes a node of the cluster. Nodes without a vicinity have the closest ones in theirs.
+	NodeSpec struct {
+		Id       string
+		Location publicUtils.Location
+		Vicinity []string
+	}
+
+	// Config describes the cluster to simulate
+	Config struct {
+		Nodes []*NodeSpec
+		// Neighbours is how many of the closest nodes are in the vicinity of the nodes not given one
+		Neighbours int
+		// Latency is the one way latency of the links that are not given one in the network
+		Latency time.Duration
+		// Fallback is the node orphans go to, and where clients and deployments start by default. It defaults to
+		// the node closest to the middle of the cluster.
+		Fallback string
+		// NodeConfig is the configuration every node runs with, defaulting to DefaultNodeConfig
+		NodeConfig *config.Config
+	}
+
+	// DeploymentSpec describes a deployment added to the cluster and the metrics the nodes have of it
+	DeploymentSpec struct {
+		Id string
+		// Root is the node the deployment is added to, defaulting to the fallback
+		Root string
+		// YAML is the deployment, defaulting to a single dummy instance listening on DummyPort
+		YAML   []byte
+		Static bool
+		// ClientLocation is the average location of the clients of the deployment until a workload runs,
+		// defaulting to the location of the root
+		ClientLocation *publicUtils.Location
+		// ClientLatency and ProcessingTime are the latency clients see and how much of it is processing, in
+		// milliseconds
+		ClientLatency  float64
+		ProcessingTime float64
+	}
+
+	// Cluster runs several complete nodes in the same process, connected by an in memory network
+	Cluster struct {
+		network  *Network
+		nodes    map[string]*Node
+		nodeIds  []string
+		fallback string
+		config   *config.Config
+
+		// transport of the harness, which operates the nodes
+		transport       *utils.Transport
+		deployerClients *deployer.ClientPool
+
+		// workloads running per deployment, whose clients make up its average client location
+		workloads     map[string]map[*Workload]struct{}
+		workloadsLock sync.Mutex
+	}
+)
+
+// DummyPort is the port the instances of the default deployment listen on
+const DummyPort = defaultDummyPort
+
+// DefaultNodeConfig returns the configuration nodes run with by default. Instances run in the fake runtime, and
+// the intervals are shorter, so trees grow in seconds instead of minutes.
+func DefaultNodeConfig() *config.Config {
+	conf := config.Default()
+
+	conf.Scheduler.Runtime = runtime.FakeRuntimeName
+	// fallbacks are set through the API once the cluster is up
+	conf.Deployer.FallbacksFile = ""
+	conf.Deployer.SendAlternativesInterval = 2 * time.Second
+	conf.Deployer.ExtendAttemptInterval = 500 * time.Millisecond
+	conf.Deployer.WaitForNewParentTimeout = 5 * time.Second
+
+	fd := &conf.Deployer.FailureDetector
+	fd.HeartbeatInterval = 500 * time.Millisecond
+	fd.CheckInterval = 250 * time.Millisecond
+	fd.SwimPingTimeout = 250 * time.Millisecond
+	fd.SwimProbeTimeout = 1 * time.Second
+	fd.SwimSuspicionTimeout = 1500 * time.Millisecond
+
+	conf.Autonomic.Interval = 1 * time.Second
+
+	return conf
+}
+
+// DummyDeploymentYAML returns a deployment with a single instance of the dummy service
+func DummyDeploymentYAML(deploymentId string) []byte {
+	return []byte(fmt.Sprintf(dummyDeploymentYAMLFormat, deploymentId, DummyPort))
+}
+
+// NewCluster builds the nodes of the cluster and the network between them, without starting them
+func NewCluster(conf *Config) (*Cluster, error) {
+	if len(conf.Nodes) == 0 {
+		return nil, errors.New("the cluster has no nodes")
+	}
+
+	nodeConfig := conf.NodeConfig
+	if nodeConfig == nil {
+		nodeConfig = DefaultNodeConfig()
+	}
+
+	// every node runs with the same configuration, so they cannot have a certificate with their own id each
+	if nodeConfig.Server.TLSCAFile != "" {
+		return nil, errors.New("the simulation does not support TLS")
+	}
+
+	security, err := nodeConfig.Server.Security()
+	if err != nil {
+		return nil, err
+	}
+
+	neighbours := conf.Neighbours
+	if neighbours <= 0 {
+		neighbours = defaultNeighbours
+	}
+
+	network := NewNetwork(conf.Latency)
+	transport := utils.NewTransport(network.Dialer(harnessEndpoint), security)
+
+	c := &Cluster{
+		network:         network,
+		nodes:           map[string]*Node{},
+		config:          nodeConfig,
+		transport:       transport,
+		deployerClients: deployer.NewClientPool(transport),
+		workloads:       map[string]map[*Workload]struct{}{},
+	}
+
+	specs := map[string]*NodeSpec{}
+	for _, spec := range conf.Nodes {
+		if spec.Id == "" || spec.Id == harnessEndpoint {
+			return nil, errors.Errorf("invalid node id %q", spec.Id)
+		}
+
+		if _, ok := specs[spec.Id]; ok {
+			return nil, errors.Errorf("node %s is repeated", spec.Id)
+		}
+
+		specs[spec.Id] = spec
+		c.nodeIds = append(c.nodeIds, spec.Id)
+	}
+
+	for _, spec := range conf.Nodes {
+		vicinity := spec.Vicinity
+		if vicinity == nil {
+			vicinity = closestNodes(spec, conf.Nodes, neighbours)
+		}
+
+		for _, neighbour := range vicinity {
+			if _, ok := specs[neighbour]; !ok {
+				return nil, errors.Errorf("node %s has unknown node %s in its vicinity", spec.Id, neighbour)
+			}
+		}
+
+		// every node has a copy of the configuration, since nothing in it is shared
+		nodeConfigCopy := *nodeConfig
+		node := newNode(spec, vicinity, &nodeConfigCopy, network)
+		node.setNodeMetrics(specs)
+		c.nodes[spec.Id] = node
+	}
+
+	c.fallback = conf.Fallback
+	if c.fallback == "" {
+		c.fallback = middleNode(conf.Nodes)
+	} else if _, ok := specs[c.fallback]; !ok {
+		return nil, errors.Errorf("unknown fallback %s", c.fallback)
+	}
+
+	return c, nil
+}
+
+// closestNodes returns the ids of the nodes closest to the node
+func closestNodes(spec *NodeSpec, nodes []*NodeSpec, howMany int) []string {
+	var others []*NodeSpec
+	for _, other := range nodes {
+		if other.Id != spec.Id {
+			others = append(others, other)
+		}
+	}
+
+	sort.Slice(others, func(i, j int) bool {
+		return spec.Location.CalcDist(&others[i].Location) < spec.Location.CalcDist(&others[j].Location)
+	})
+
+	if len(others) > howMany {
+		others = others[:howMany]
+	}
+
+	closest := make([]string, 0, len(others))
+	for _, other := range others {
+		closest = append(closest, other.Id)
+	}
+
+	return closest
+}
+
+// middleNode returns the id of the node closest to the middle of the nodes
+func middleNode(nodes []*NodeSpec) string {
+	var middle publicUtils.Location
+	for _, node := range nodes {
+		middle.X += node.Location.X / float64(len(nodes))
+		middle.Y += node.Location.Y / float64(len(nodes))
+	}
+
+	return closestNodes(&NodeSpec{Location: middle}, nodes, 1)[0]
+}
+
+// locationMetric returns the location as the autonomic system has it, as if read from a metrics file
+func locationMetric(location *publicUtils.Location) map[string]interface{} {
+	return map[string]interface{}{
+		"X": location.X,
+		"Y": location.Y,
+	}
+}
+
+// setNodeMetrics sets the metrics of the node itself, its id, its location and the ones of its vicinity
+func (n *Node) setNodeMetrics(specs map[string]*NodeSpec) {
+	vicinity := map[string]interface{}{}
+	for _, neighbour := range n.Vicinity {
+		vicinity[neighbour] = locationMetric(&specs[neighbour].Location)
+	}
+
+	n.setMetric(metrics.MetricNodeAddr, n.Id)
+	n.setMetric(metrics.MetricLocation, locationMetric(n.Location))
+	n.setMetric(metrics.MetricLocationInVicinity, vicinity)
+}
+
+// setDeploymentMetrics sets the metrics the autonomic system of the node needs to optimize the deployment
+func (n *Node) setDeploymentMetrics(spec *DeploymentSpec) {
+	deploymentId := spec.Id
+
+	n.setMetric(metrics.GetLoadPerServiceInChildrenMetricId(deploymentId), map[string]interface{}{})
+	n.setMetric(metrics.GetAggLoadPerServiceInChildrenMetricId(deploymentId), 0.)
+	n.setMetric(metrics.GetClientLatencyPerServiceMetricId(deploymentId), spec.ClientLatency)
+	n.setMetric(metrics.GetProcessingTimePerServiceMetricId(deploymentId), spec.ProcessingTime)
+	n.setMetric(metrics.GetNumInstancesMetricId(deploymentId), 0.)
+	n.setMetric(metrics.GetLoadPerService(deploymentId), 0.)
+	n.setMetric(metrics.GetAverageClientLocationPerServiceMetricId(deploymentId),
+		locationMetric(spec.ClientLocation))
+
+	for _, neighbour := range n.Vicinity {
+		n.setMetric(metrics.GetLoadPerServiceInChildMetricId(deploymentId, neighbour), 0.)
+	}
+}
+
+// Network returns the network between the nodes, to change its latencies and partition it
+func (c *Cluster) Network() *Network {
+	return c.network
+}
+
+// Nodes returns the ids of the nodes, in the order they were given in
+func (c *Cluster) Nodes() []string {
+	return c.nodeIds
+}
+
+// Node returns the node with the id, or nil if there is none
+func (c *Cluster) Node(nodeId string) *Node {
+	return c.nodes[nodeId]
+}
+
+// Fallback returns the node orphans go to
+func (c *Cluster) Fallback() string {
+	return c.fallback
+}
+
+// DeployerClient returns a client of the deployer of the node, which reaches it whatever the partitions
+func (c *Cluster) DeployerClient(nodeId string) *deployer.Client {
+	return c.deployerClients.Get(c.config.Deployer.Addr(nodeId))
+}
+
+// Start starts every node, introduces each one to its vicinity and sets the fallback of all of them
+func (c *Cluster) Start() error {
+	for _, nodeId := range c.nodeIds {
+		log.Debugf("starting node %s", nodeId)
+
+		err := c.nodes[nodeId].start()
+		if err != nil {
+			stopCtx, cancel := context.WithTimeout(context.Background(), utils.StopTimeout)
+			defer cancel()
+
+			_ = c.stop(stopCtx)
+
+			return err
+		}
+	}
+
+	for _, nodeId := range c.nodeIds {
+		err := c.introduce(nodeId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// introduce tells the deployer of the node about its vicinity and the fallback
+func (c *Cluster) introduce(nodeId string) error {
+	depClient := c.DeployerClient(nodeId)
+
+	for _, neighbour := range c.nodes[nodeId].Vicinity {
+		status := depClient.AddNode(neighbour)
+		if status != http.StatusOK {
+			return errors.Errorf("got status %d adding %s to %s", status, neighbour, nodeId)
+		}
+	}
+
+	status := depClient.SetFallback(c.fallback, 0)
+	if status != http.StatusOK {
+		return errors.Errorf("got status %d setting the fallback of %s", status, nodeId)
+	}
+
+	return nil
+}
+
+// Stop stops every node, giving them StopTimeout to stop gracefully, and then the instances they left running
+func (c *Cluster) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), utils.StopTimeout)
+	defer cancel()
+
+	return c.stop(ctx)
+}
+
+func (c *Cluster) stop(ctx context.Context) error {
+	var firstErr error
+	for i := len(c.nodeIds) - 1; i >= 0; i-- {
+		node := c.nodes[c.nodeIds[i]]
+
+		err := node.stop(ctx, false)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		node.stopInstances()
+	}
+
+	c.transport.CloseIdleConnections()
+
+	return firstErr
+}
+
+// CrashNode stops the node after cutting it from the network, so the other nodes see it fail
+func (c *Cluster) CrashNode(nodeId string) error {
+	node, ok := c.nodes[nodeId]
+	if !ok {
+		return errors.Errorf("unknown node %s", nodeId)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), utils.StopTimeout)
+	defer cancel()
+
+	return node.stop(ctx, true)
+}
+
+// RestartNode starts the node again after it crashed. Its deployer starts empty, while its instances are still
+// running, as happens when a machine reboots.
+func (c *Cluster) RestartNode(nodeId string) error {
+	node, ok := c.nodes[nodeId]
+	if !ok {
+		return errors.Errorf("unknown node %s", nodeId)
+	}
+
+	if node.IsRunning() {
+		return errors.Errorf("node %s is running", nodeId)
+	}
+
+	err := node.start()
+	if err != nil {
+		return err
+	}
+
+	return c.introduce(nodeId)
+}
+
+// Deploy adds the deployment to its root, after giving every node the metrics of the deployment
+func (c *Cluster) Deploy(spec *DeploymentSpec) error {
+	deployment := *spec
+	if deployment.Root == "" {
+		deployment.Root = c.fallback
+	}
+
+	root, ok := c.nodes[deployment.Root]
+	if !ok {
+		return errors.Errorf("unknown root %s", deployment.Root)
+	}
+
+	if deployment.YAML == nil {
+		deployment.YAML = DummyDeploymentYAML(deployment.Id)
+	}
+
+	if deployment.ClientLocation == nil {
+		deployment.ClientLocation = root.Location
+	}
+
+	if deployment.ClientLatency == 0 {
+		deployment.ClientLatency = defaultClientLatency
+	}
+
+	if deployment.ProcessingTime == 0 {
+		deployment.ProcessingTime = defaultProcessingTime
+	}
+
+	for _, node := range c.nodes {
+		node.setDeploymentMetrics(&deployment)
+	}
+
+	status := c.DeployerClient(deployment.Root).RegisterService(deployment.Id, deployment.Static, deployment.YAML,
+		nil, nil, "")
+	if status != http.StatusOK {
+		return errors.Errorf("got status %d adding %s to %s", status, deployment.Id, deployment.Root)
+	}
+
+	return nil
+}
+
+// SetClientLocation sets the average location of the clients of the deployment in every node. It stands in for
+// the monitoring of the clients, which the nodes do not do by themselves.
+func (c *Cluster) SetClientLocation(deploymentId string, location *publicUtils.Location) {
+	for _, node := range c.nodes {
+		node.setMetric(metrics.GetAverageClientLocationPerServiceMetricId(deploymentId), locationMetric(location))
+	}
+}
@@ -0,0 +1,119 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	testDeploymentId = "dummy"
+	testTreeTimeout  = 60 * time.Second
+)
+
+// newTestCluster starts a line of four nodes, n0 to n3, with the clients of the deployment, rooted at n0, next to
+// n3. Each node has the two closest ones in its vicinity, so the deployment has to grow through the line to reach
+// the clients.
+func newTestCluster(t *testing.T) *Cluster {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("simulated clusters take too long for short mode")
+	}
+
+	log.SetLevel(log.FatalLevel)
+
+	c, err := NewCluster(&Config{
+		Nodes: []*NodeSpec{
+			{Id: "n0", Location: publicUtils.Location{X: 0}},
+			{Id: "n1", Location: publicUtils.Location{X: 10}},
+			{Id: "n2", Location: publicUtils.Location{X: 20}},
+			{Id: "n3", Location: publicUtils.Location{X: 30}},
+		},
+		Neighbours: 2,
+		Latency:    5 * time.Millisecond,
+		Fallback:   "n0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Start()
+	t.Cleanup(func() {
+		if err := c.Stop(); err != nil {
+			t.Errorf("error stopping the cluster: %s", err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Deploy(&DeploymentSpec{
+		Id:             testDeploymentId,
+		Static:         true,
+		ClientLocation: &publicUtils.Location{X: 30},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// lacksChild holds while the node does not have the child
+func lacksChild(nodeId, childId string) TreeCondition {
+	return func(tree *Tree) error {
+		if treeNode, ok := tree.Nodes[nodeId]; ok && contains(treeNode.Children, childId) {
+			return errors.Errorf("%s still has child %s in %s", nodeId, childId, tree.DeploymentId)
+		}
+
+		return nil
+	}
+}
+
+func TestTreeGrowsTowardsClients(t *testing.T) {
+	c := newTestCluster(t)
+
+	tree := c.RequireTree(t, testDeploymentId, testTreeTimeout, HasRoot("n0"), HasNodes("n3"), IsConsistent())
+
+	// n3 is not in the vicinity of n0, so the tree reaches it through a node in between
+	if path := tree.Path("n3"); len(path) < 3 {
+		t.Fatalf("expected n3 to be reached through another node, got %v\n%s", path, tree)
+	}
+}
+
+func TestTreeHealsAfterPartition(t *testing.T) {
+	c := newTestCluster(t)
+
+	tree := c.RequireTree(t, testDeploymentId, testTreeTimeout, HasNodes("n3"), IsConsistent())
+	parentId := tree.Nodes["n3"].Parent
+
+	c.Network().Partition("n3")
+	c.RequireTree(t, testDeploymentId, testTreeTimeout, lacksChild(parentId, "n3"))
+
+	c.Network().Heal()
+	c.RequireTree(t, testDeploymentId, testTreeTimeout, HasRoot("n0"), HasNodes("n3"), IsConsistent())
+}
+
+func TestCrashedNodeChildIsAdopted(t *testing.T) {
+	c := newTestCluster(t)
+
+	tree := c.RequireTree(t, testDeploymentId, testTreeTimeout, HasNodes("n3"), IsConsistent())
+	parentId := tree.Nodes["n3"].Parent
+	if parentId == "n0" {
+		t.Fatalf("expected n3 not to be a child of the root\n%s", tree)
+	}
+
+	err := c.CrashNode(parentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree = c.RequireTree(t, testDeploymentId, testTreeTimeout, HasRoot("n0"), HasNodes("n3"), IsConsistent())
+	if newParentId := tree.Nodes["n3"].Parent; newParentId == parentId {
+		t.Fatalf("expected n3 to leave its crashed parent %s\n%s", parentId, tree)
+	}
+}
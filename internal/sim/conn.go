@@ -0,0 +1,311 @@
+package sim
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+)
+
+type (
+	// addr is the address of an end of a connection, the id of the node and a port
+	addr string
+
+	chunk struct {
+		data      []byte
+		deliverAt time.Time
+	}
+
+	// pipe is one direction of a connection. What is written to it can only be read once the latency of the link
+	// passes, and in the order it was written.
+	pipe struct {
+		chunks        []*chunk
+		lastDeliverAt time.Time
+		closed        bool
+		// changed is closed and replaced whenever something is written or the pipe is closed
+		changed chan struct{}
+		lock    sync.Mutex
+	}
+
+	// deadline is closed once the time it is set to passes
+	deadline struct {
+		timer  *time.Timer
+		cancel chan struct{}
+		lock   sync.Mutex
+	}
+
+	// conn is an end of a connection between two nodes of the network
+	conn struct {
+		localAddr, remoteAddr addr
+		in, out               *pipe
+		latency               func() time.Duration
+
+		readDeadline  *deadline
+		writeDeadline *deadline
+
+		closed    chan struct{}
+		closeOnce sync.Once
+		onClose   func()
+	}
+)
+
+func (a addr) Network() string {
+	return utils.TCP
+}
+
+func (a addr) String() string {
+	return string(a)
+}
+
+func newPipe() *pipe {
+	return &pipe{
+		changed: make(chan struct{}),
+	}
+}
+
+// notify wakes up the reader waiting for the pipe. The lock must be held.
+func (p *pipe) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func (p *pipe) write(data []byte, latency time.Duration) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	// nothing overtakes what was written before, even if the latency went down meanwhile
+	deliverAt := time.Now().Add(latency)
+	if deliverAt.Before(p.lastDeliverAt) {
+		deliverAt = p.lastDeliverAt
+	}
+	p.lastDeliverAt = deliverAt
+
+	dataCopy := make([]byte, len(data))
+	copy(dataCopy, data)
+	p.chunks = append(p.chunks, &chunk{
+		data:      dataCopy,
+		deliverAt: deliverAt,
+	})
+	p.notify()
+
+	return len(data), nil
+}
+
+// read reads what was delivered already. Otherwise it returns how long until the next chunk is delivered, or a
+// channel that is closed once something changes if there is nothing to deliver.
+func (p *pipe) read(data []byte) (n int, wait time.Duration, changed <-chan struct{}, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.chunks) == 0 {
+		if p.closed {
+			return 0, 0, nil, io.EOF
+		}
+
+		return 0, 0, p.changed, nil
+	}
+
+	head := p.chunks[0]
+	wait = time.Until(head.deliverAt)
+	if wait > 0 {
+		return 0, wait, p.changed, nil
+	}
+
+	n = copy(data, head.data)
+	head.data = head.data[n:]
+	if len(head.data) == 0 {
+		p.chunks = p.chunks[1:]
+	}
+
+	return n, 0, nil, nil
+}
+
+func (p *pipe) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	p.closed = true
+	p.notify()
+}
+
+func newDeadline() *deadline {
+	return &deadline{
+		cancel: make(chan struct{}),
+	}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// the timer already fired, so wait for it to close the channel
+		<-d.cancel
+	}
+	d.timer = nil
+
+	passed := isClosed(d.cancel)
+	if t.IsZero() {
+		if passed {
+			d.cancel = make(chan struct{})
+		}
+
+		return
+	}
+
+	duration := time.Until(t)
+	if duration <= 0 {
+		if !passed {
+			close(d.cancel)
+		}
+
+		return
+	}
+
+	if passed {
+		d.cancel = make(chan struct{})
+	}
+
+	cancel := d.cancel
+	d.timer = time.AfterFunc(duration, func() {
+		close(cancel)
+	})
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.cancel
+}
+
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// newConnPair returns both ends of a connection whose writes take the latency of the link to be read on the other
+// end
+func newConnPair(clientAddr, serverAddr addr, latency func() time.Duration) (client, server *conn) {
+	toServer, toClient := newPipe(), newPipe()
+
+	client = newConn(clientAddr, serverAddr, toClient, toServer, latency)
+	server = newConn(serverAddr, clientAddr, toServer, toClient, latency)
+
+	return
+}
+
+func newConn(localAddr, remoteAddr addr, in, out *pipe, latency func() time.Duration) *conn {
+	return &conn{
+		localAddr:     localAddr,
+		remoteAddr:    remoteAddr,
+		in:            in,
+		out:           out,
+		latency:       latency,
+		readDeadline:  newDeadline(),
+		writeDeadline: newDeadline(),
+		closed:        make(chan struct{}),
+	}
+}
+
+func (c *conn) Read(data []byte) (int, error) {
+	for {
+		switch {
+		case isClosed(c.closed):
+			return 0, io.ErrClosedPipe
+		case isClosed(c.readDeadline.wait()):
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		n, wait, changed, err := c.in.read(data)
+		if n > 0 || err != nil {
+			return n, err
+		}
+
+		var (
+			timer     *time.Timer
+			delivered <-chan time.Time
+		)
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			delivered = timer.C
+		}
+
+		select {
+		case <-delivered:
+		case <-changed:
+		case <-c.readDeadline.wait():
+		case <-c.closed:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (c *conn) Write(data []byte) (int, error) {
+	switch {
+	case isClosed(c.closed):
+		return 0, io.ErrClosedPipe
+	case isClosed(c.writeDeadline.wait()):
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	return c.out.write(data, c.latency())
+}
+
+// Close closes both directions, so the other end reads what was written before and then EOF, and fails to write
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.in.close()
+		c.out.close()
+
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
@@ -0,0 +1,372 @@
+package sim
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	// range of the ports on the end of the node opening a connection
+	firstEphemeralPort = 32768
+	lastEphemeralPort  = 60999
+
+	// harnessEndpoint is where the simulation observes and operates the nodes from. It reaches every node that is
+	// up, without latency, whatever the partitions.
+	harnessEndpoint = "_harness"
+)
+
+var (
+	errRefused     = errors.New("connection refused")
+	errUnreachable = errors.New("network is unreachable")
+	errClosed      = errors.New("use of closed listener")
+)
+
+type (
+	// link is the link between two nodes, whichever opened the connection
+	link struct {
+		a, b string
+	}
+
+	// Network connects the nodes of a simulation in memory. Whatever is written to a connection takes the latency
+	// of its link to be read on the other end, and nodes that are cut from each other can not connect. Each
+	// endpoint is a node id, so clients that are not nodes are endpoints of the network as well.
+	Network struct {
+		defaultLatency time.Duration
+		latencies      map[link]time.Duration
+		partitions     []map[string]struct{}
+		disconnected   map[link]struct{}
+		down           map[string]struct{}
+
+		listeners map[string]*listener
+		conns     map[*conn]link
+		nextPort  int
+
+		lock sync.RWMutex
+	}
+
+	listener struct {
+		network   *Network
+		addr      addr
+		conns     chan net.Conn
+		closed    chan struct{}
+		closeOnce sync.Once
+	}
+)
+
+func newLink(a, b string) link {
+	if a > b {
+		a, b = b, a
+	}
+
+	return link{a: a, b: b}
+}
+
+// NewNetwork returns a network whose links have the default latency
+func NewNetwork(defaultLatency time.Duration) *Network {
+	return &Network{
+		defaultLatency: defaultLatency,
+		latencies:      map[link]time.Duration{},
+		disconnected:   map[link]struct{}{},
+		down:           map[string]struct{}{},
+		listeners:      map[string]*listener{},
+		conns:          map[*conn]link{},
+		nextPort:       firstEphemeralPort,
+	}
+}
+
+// SetDefaultLatency sets the one way latency of the links that were not given one
+func (n *Network) SetDefaultLatency(latency time.Duration) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.defaultLatency = latency
+}
+
+// SetLatency sets the one way latency of the link between the nodes, in both directions. The connections already
+// open see it in what is written from then on.
+func (n *Network) SetLatency(a, b string, latency time.Duration) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.latencies[newLink(a, b)] = latency
+}
+
+// Latency returns the one way latency of the link between the nodes. A node reaches itself without latency.
+func (n *Network) Latency(a, b string) time.Duration {
+	if a == b || a == harnessEndpoint || b == harnessEndpoint {
+		return 0
+	}
+
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	latency, ok := n.latencies[newLink(a, b)]
+	if !ok {
+		return n.defaultLatency
+	}
+
+	return latency
+}
+
+// Partition cuts the links between the nodes and every other node. The open connections across the partition are
+// closed and new ones fail, as long as the partition is not healed.
+func (n *Network) Partition(nodes ...string) {
+	partition := map[string]struct{}{}
+	for _, node := range nodes {
+		partition[node] = struct{}{}
+	}
+
+	n.lock.Lock()
+	n.partitions = append(n.partitions, partition)
+	toClose := n.cutConnsLocked()
+	n.lock.Unlock()
+
+	closeConns(toClose)
+}
+
+// Disconnect cuts the link between the two nodes, closing the connections between them
+func (n *Network) Disconnect(a, b string) {
+	n.lock.Lock()
+	n.disconnected[newLink(a, b)] = struct{}{}
+	toClose := n.cutConnsLocked()
+	n.lock.Unlock()
+
+	closeConns(toClose)
+}
+
+// Heal undoes every partition and disconnection
+func (n *Network) Heal() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.partitions = nil
+	n.disconnected = map[link]struct{}{}
+}
+
+// IsCut tells whether the nodes can not reach each other, because of a partition, a disconnection or because one
+// of them is down
+func (n *Network) IsCut(a, b string) bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	return n.isCutLocked(a, b)
+}
+
+func (n *Network) isCutLocked(a, b string) bool {
+	if a == b {
+		return false
+	}
+
+	if _, ok := n.down[a]; ok {
+		return true
+	}
+
+	if _, ok := n.down[b]; ok {
+		return true
+	}
+
+	if a == harnessEndpoint || b == harnessEndpoint {
+		return false
+	}
+
+	if _, ok := n.disconnected[newLink(a, b)]; ok {
+		return true
+	}
+
+	for _, partition := range n.partitions {
+		_, aInside := partition[a]
+		_, bInside := partition[b]
+		if aInside != bInside {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setDown cuts the node from every other node while it is down, as if it crashed
+func (n *Network) setDown(node string, down bool) {
+	n.lock.Lock()
+	if !down {
+		delete(n.down, node)
+		n.lock.Unlock()
+		return
+	}
+
+	n.down[node] = struct{}{}
+	toClose := n.cutConnsLocked()
+	n.lock.Unlock()
+
+	closeConns(toClose)
+}
+
+func (n *Network) cutConnsLocked() (toClose []*conn) {
+	for c, connLink := range n.conns {
+		if n.isCutLocked(connLink.a, connLink.b) {
+			toClose = append(toClose, c)
+		}
+	}
+
+	return
+}
+
+func closeConns(conns []*conn) {
+	for _, c := range conns {
+		_ = c.Close()
+	}
+}
+
+// Listen listens on the port of the node
+func (n *Network) Listen(node string, port int) (net.Listener, error) {
+	return n.listen(node, strconv.Itoa(port))
+}
+
+func (n *Network) listen(node, port string) (net.Listener, error) {
+	hostPort := net.JoinHostPort(node, port)
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if _, ok := n.listeners[hostPort]; ok {
+		return nil, &net.OpError{Op: "listen", Net: utils.TCP, Addr: addr(hostPort),
+			Err: errors.New("address already in use")}
+	}
+
+	l := &listener{
+		network: n,
+		addr:    addr(hostPort),
+		conns:   make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+	n.listeners[hostPort] = l
+
+	return l, nil
+}
+
+// Dialer returns the function the node opens its connections with. Hosts that are not nodes, such as localhost
+// or the names of the services, are the node itself.
+func (n *Network) Dialer(node string) utils.DialFunc {
+	return func(ctx context.Context, _, address string) (net.Conn, error) {
+		return n.dial(ctx, node, address)
+	}
+}
+
+func (n *Network) dial(ctx context.Context, from, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: utils.TCP, Err: err}
+	}
+
+	if isLocalHost(host) {
+		host = from
+	}
+
+	dialError := func(err error) error {
+		return &net.OpError{Op: "dial", Net: utils.TCP, Addr: addr(net.JoinHostPort(host, port)), Err: err}
+	}
+
+	// opening the connection takes a round trip
+	timer := time.NewTimer(2 * n.Latency(from, host))
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+		return nil, dialError(ctx.Err())
+	}
+
+	n.lock.Lock()
+	if n.isCutLocked(from, host) {
+		n.lock.Unlock()
+		return nil, dialError(errUnreachable)
+	}
+
+	l, ok := n.listeners[net.JoinHostPort(host, port)]
+	if !ok {
+		n.lock.Unlock()
+		return nil, dialError(errRefused)
+	}
+
+	localAddr := addr(net.JoinHostPort(from, strconv.Itoa(n.nextPort)))
+	n.nextPort++
+	if n.nextPort > lastEphemeralPort {
+		n.nextPort = firstEphemeralPort
+	}
+
+	connLink := newLink(from, host)
+	latency := func() time.Duration {
+		return n.Latency(connLink.a, connLink.b)
+	}
+
+	client, server := newConnPair(localAddr, l.addr, latency)
+	for _, c := range []*conn{client, server} {
+		untracked := c
+		untracked.onClose = func() {
+			n.untrack(untracked)
+		}
+		n.conns[c] = connLink
+	}
+	n.lock.Unlock()
+
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		err = errRefused
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	_ = client.Close()
+	_ = server.Close()
+
+	return nil, dialError(err)
+}
+
+// isLocalHost tells whether the host is the node dialing it
+func isLocalHost(host string) bool {
+	if host == "" || host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+func (n *Network) untrack(c *conn) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	delete(n.conns, c)
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, &net.OpError{Op: "accept", Net: utils.TCP, Addr: l.addr, Err: errClosed}
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+
+		l.network.lock.Lock()
+		delete(l.network.listeners, string(l.addr))
+		l.network.lock.Unlock()
+	})
+
+	return nil
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,219 @@
+package sim
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	internalArchimedes "github.com/bruno-anjos/cloud-edge-deployment/internal/archimedes"
+	internalAutonomic "github.com/bruno-anjos/cloud-edge-deployment/internal/autonomic"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/config"
+	internalDeployer "github.com/bruno-anjos/cloud-edge-deployment/internal/deployer"
+	internalScheduler "github.com/bruno-anjos/cloud-edge-deployment/internal/scheduler"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/scheduler/runtime"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/deployer"
+	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Node is a simulated node, running its archimedes, autonomic system, scheduler and deployer on the network of
+// the simulation. Its instances run in a fake runtime, which outlives the daemons when the node is restarted, as
+// containers do.
+type Node struct {
+	Id       string
+	Location *publicUtils.Location
+	Vicinity []string
+
+	config  *config.Config
+	network *Network
+	runtime *runtime.Fake
+
+	// metrics the autonomic system starts with, kept up to date so it starts with them again after a restart
+	metrics map[string]interface{}
+
+	transport *utils.Transport
+	autonomic *internalAutonomic.Server
+	daemons   []utils.Daemon
+	running   bool
+
+	// guards the metrics, the autonomic system they are set in and whether the node is running
+	lock sync.Mutex
+}
+
+func newNode(spec *NodeSpec, vicinity []string, conf *config.Config, network *Network) *Node {
+	return &Node{
+		Id:       spec.Id,
+		Location: &publicUtils.Location{X: spec.Location.X, Y: spec.Location.Y},
+		Vicinity: vicinity,
+		config:   conf,
+		network:  network,
+		metrics:  map[string]interface{}{},
+	}
+}
+
+// IsRunning tells whether the daemons of the node are up
+func (n *Node) IsRunning() bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return n.running
+}
+
+// start starts the daemons of the node, each only after the ones it depends on
+func (n *Node) start() error {
+	security, err := n.config.Server.Security()
+	if err != nil {
+		return err
+	}
+
+	n.network.setDown(n.Id, false)
+	n.transport = utils.NewTransport(n.network.Dialer(n.Id), security)
+
+	ports := []int{n.config.Archimedes.Port, n.config.Autonomic.Port, n.config.Scheduler.Port, n.config.Deployer.Port}
+	listeners := make([]net.Listener, len(ports))
+	for i, port := range ports {
+		listeners[i], err = n.network.Listen(n.Id, port)
+		if err != nil {
+			for _, listener := range listeners[:i] {
+				_ = listener.Close()
+			}
+
+			return errors.Wrapf(err, "error listening on %s", n.Id)
+		}
+	}
+
+	if n.runtime == nil {
+		deployerClient := deployer.NewClientPool(n.transport).Get(n.config.Deployer.HostPort())
+		n.runtime = runtime.NewFakeRuntime(deployerClient, func(hostPort string) (net.Listener, error) {
+			return n.network.listen(n.Id, hostPort)
+		})
+	}
+
+	n.lock.Lock()
+	initialMetrics := make(map[string]interface{}, len(n.metrics))
+	for metricId, value := range n.metrics {
+		initialMetrics[metricId] = value
+	}
+
+	n.autonomic = internalAutonomic.NewServer(
+		internalAutonomic.WithConfig(n.config),
+		internalAutonomic.WithTransport(n.transport),
+		internalAutonomic.WithListener(listeners[1]),
+		internalAutonomic.WithHostname(n.Id),
+		internalAutonomic.WithMetrics(initialMetrics),
+	)
+	n.lock.Unlock()
+
+	n.daemons = []utils.Daemon{
+		internalArchimedes.NewServer(
+			internalArchimedes.WithConfig(n.config),
+			internalArchimedes.WithTransport(n.transport),
+			internalArchimedes.WithListener(listeners[0]),
+			internalArchimedes.WithHostname(n.Id),
+		),
+		n.autonomic,
+		internalScheduler.NewServer(
+			internalScheduler.WithConfig(n.config),
+			internalScheduler.WithTransport(n.transport),
+			internalScheduler.WithListener(listeners[2]),
+			internalScheduler.WithRuntime(n.runtime),
+		),
+		internalDeployer.NewServer(
+			internalDeployer.WithConfig(n.config),
+			internalDeployer.WithTransport(n.transport),
+			internalDeployer.WithListener(listeners[3]),
+			internalDeployer.WithHostname(n.Id),
+		),
+	}
+
+	for i, daemon := range n.daemons {
+		err := daemon.Start()
+		if err != nil {
+			for _, started := range n.daemons[:i] {
+				_ = started.Stop(context.Background())
+			}
+
+			for _, listener := range listeners[i:] {
+				_ = listener.Close()
+			}
+
+			n.lock.Lock()
+			n.autonomic = nil
+			n.lock.Unlock()
+
+			return errors.Wrapf(err, "error starting %s", n.Id)
+		}
+	}
+
+	n.lock.Lock()
+	n.running = true
+	n.lock.Unlock()
+
+	return nil
+}
+
+// stop stops the daemons of the node in the reverse order they were started in, and then cuts it from the
+// network. If the node crashes, it is cut first, so the others see it disappear instead of leaving gracefully.
+func (n *Node) stop(ctx context.Context, crash bool) error {
+	n.lock.Lock()
+	running := n.running
+	n.running = false
+	n.autonomic = nil
+	n.lock.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	if crash {
+		n.network.setDown(n.Id, true)
+	}
+
+	var firstErr error
+	for i := len(n.daemons) - 1; i >= 0; i-- {
+		err := n.daemons[i].Stop(ctx)
+		if err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "error stopping %s", n.Id)
+		}
+	}
+
+	n.transport.CloseIdleConnections()
+
+	// whatever is left open, such as long-lived streams, goes away with the node
+	n.network.setDown(n.Id, true)
+
+	return firstErr
+}
+
+// setMetric sets the metric in the autonomic system of the node, and in the ones it starts with from then on
+func (n *Node) setMetric(metricId string, value interface{}) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.metrics[metricId] = value
+	if n.autonomic != nil {
+		n.autonomic.SetMetric(metricId, value)
+	}
+}
+
+// stopInstances stops the instances left in the runtime of the node, once it is stopped for good
+func (n *Node) stopInstances() {
+	if n.runtime == nil {
+		return
+	}
+
+	containers, err := n.runtime.ListContainers(nil)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, container := range containers {
+		err = n.runtime.StopContainer(container.Id, 0)
+		if err != nil {
+			log.Error(err)
+		}
+	}
+}
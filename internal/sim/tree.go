@@ -0,0 +1,330 @@
+package sim
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	treePollInterval = 250 * time.Millisecond
+)
+
+type (
+	// TreeNode is a node the deployment is in, as its deployer has it
+	TreeNode struct {
+		Id       string
+		Parent   string
+		Children []string
+		IsOrphan bool
+	}
+
+	// Tree is the deployment tree of a deployment, as the running nodes have it
+	Tree struct {
+		DeploymentId string
+		Nodes        map[string]*TreeNode
+	}
+
+	// TreeCondition checks a tree, returning why it does not hold
+	TreeCondition func(tree *Tree) error
+)
+
+// Tree gets the tree of the deployment from the hierarchy tables of the running nodes
+func (c *Cluster) Tree(deploymentId string) (*Tree, error) {
+	tree := &Tree{
+		DeploymentId: deploymentId,
+		Nodes:        map[string]*TreeNode{},
+	}
+
+	for _, nodeId := range c.nodeIds {
+		if !c.nodes[nodeId].IsRunning() {
+			continue
+		}
+
+		table, status := c.DeployerClient(nodeId).GetHierarchyTable()
+		if status != http.StatusOK {
+			return nil, errors.Errorf("got status %d getting the hierarchy table of %s", status, nodeId)
+		}
+
+		entry, ok := table[deploymentId]
+		if !ok {
+			continue
+		}
+
+		treeNode := &TreeNode{
+			Id:       nodeId,
+			IsOrphan: entry.IsOrphan,
+		}
+
+		if entry.Parent != nil {
+			treeNode.Parent = entry.Parent.Id
+		}
+
+		for childId := range entry.Children {
+			treeNode.Children = append(treeNode.Children, childId)
+		}
+		sort.Strings(treeNode.Children)
+
+		tree.Nodes[nodeId] = treeNode
+	}
+
+	return tree, nil
+}
+
+// WaitForTree waits for the tree of the deployment to hold every condition, returning the last tree it got if it
+// times out
+func (c *Cluster) WaitForTree(deploymentId string, timeout time.Duration, conditions ...TreeCondition) (*Tree,
+	error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		tree, err := c.Tree(deploymentId)
+		if err == nil {
+			err = tree.Check(conditions...)
+			if err == nil {
+				return tree, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return tree, errors.Wrapf(err, "timed out waiting for the tree of %s", deploymentId)
+		}
+
+		time.Sleep(treePollInterval)
+	}
+}
+
+// RequireTree waits for the tree of the deployment to hold every condition, failing the test if it does not
+// before the timeout
+func (c *Cluster) RequireTree(t testing.TB, deploymentId string, timeout time.Duration,
+	conditions ...TreeCondition) *Tree {
+	t.Helper()
+
+	tree, err := c.WaitForTree(deploymentId, timeout, conditions...)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, tree)
+	}
+
+	return tree
+}
+
+// Check returns why the first condition that does not hold fails
+func (t *Tree) Check(conditions ...TreeCondition) error {
+	for _, condition := range conditions {
+		err := condition(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Roots returns the nodes that have no parent, sorted
+func (t *Tree) Roots() (roots []string) {
+	for nodeId, treeNode := range t.Nodes {
+		if treeNode.Parent == "" {
+			roots = append(roots, nodeId)
+		}
+	}
+	sort.Strings(roots)
+
+	return
+}
+
+// Root returns the root of the tree, or an empty string if there is not exactly one
+func (t *Tree) Root() string {
+	roots := t.Roots()
+	if len(roots) != 1 {
+		return ""
+	}
+
+	return roots[0]
+}
+
+// Size returns how many nodes the deployment is in
+func (t *Tree) Size() int {
+	return len(t.Nodes)
+}
+
+// Has tells whether the deployment is in the node
+func (t *Tree) Has(nodeId string) bool {
+	_, ok := t.Nodes[nodeId]
+	return ok
+}
+
+// Path returns the nodes from the root of the tree to the node, or nil if the node does not reach a root
+func (t *Tree) Path(nodeId string) []string {
+	var path []string
+
+	visited := map[string]struct{}{}
+	for nodeId != "" {
+		treeNode, ok := t.Nodes[nodeId]
+		if !ok {
+			return nil
+		}
+
+		if _, ok = visited[nodeId]; ok {
+			return nil
+		}
+		visited[nodeId] = struct{}{}
+
+		path = append([]string{nodeId}, path...)
+		nodeId = treeNode.Parent
+	}
+
+	return path
+}
+
+// Depth returns how many levels the tree has below its roots
+func (t *Tree) Depth() (depth int) {
+	for nodeId := range t.Nodes {
+		if pathDepth := len(t.Path(nodeId)) - 1; pathDepth > depth {
+			depth = pathDepth
+		}
+	}
+
+	return
+}
+
+// String returns every path from a root to a leaf, one per line
+func (t *Tree) String() string {
+	if t == nil {
+		return "<no tree>"
+	}
+
+	var paths []string
+	for nodeId, treeNode := range t.Nodes {
+		if len(treeNode.Children) > 0 {
+			continue
+		}
+
+		path := t.Path(nodeId)
+		if path == nil {
+			path = []string{"?", nodeId}
+		}
+
+		paths = append(paths, strings.Join(path, " -> "))
+	}
+	sort.Strings(paths)
+
+	return t.DeploymentId + ":\n\t" + strings.Join(paths, "\n\t")
+}
+
+// HasNodes holds once the deployment is in every node
+func HasNodes(nodeIds ...string) TreeCondition {
+	return func(tree *Tree) error {
+		for _, nodeId := range nodeIds {
+			if !tree.Has(nodeId) {
+				return errors.Errorf("%s is not in %s", nodeId, tree.DeploymentId)
+			}
+		}
+
+		return nil
+	}
+}
+
+// LacksNodes holds while the deployment is in none of the nodes
+func LacksNodes(nodeIds ...string) TreeCondition {
+	return func(tree *Tree) error {
+		for _, nodeId := range nodeIds {
+			if tree.Has(nodeId) {
+				return errors.Errorf("%s is in %s", nodeId, tree.DeploymentId)
+			}
+		}
+
+		return nil
+	}
+}
+
+// HasRoot holds once the node is the only root of the tree
+func HasRoot(nodeId string) TreeCondition {
+	return func(tree *Tree) error {
+		if roots := tree.Roots(); len(roots) != 1 || roots[0] != nodeId {
+			return errors.Errorf("%s has roots %v instead of %s", tree.DeploymentId, roots, nodeId)
+		}
+
+		return nil
+	}
+}
+
+// HasPath holds once the nodes are a path down the tree, from the first to the last
+func HasPath(nodeIds ...string) TreeCondition {
+	return func(tree *Tree) error {
+		for i := 1; i < len(nodeIds); i++ {
+			treeNode, ok := tree.Nodes[nodeIds[i]]
+			if !ok || treeNode.Parent != nodeIds[i-1] {
+				return errors.Errorf("%s is not a child of %s in %s", nodeIds[i], nodeIds[i-1], tree.DeploymentId)
+			}
+		}
+
+		return nil
+	}
+}
+
+// HasSize holds once the deployment is in exactly that many nodes
+func HasSize(size int) TreeCondition {
+	return func(tree *Tree) error {
+		if tree.Size() != size {
+			return errors.Errorf("%s is in %d nodes instead of %d", tree.DeploymentId, tree.Size(), size)
+		}
+
+		return nil
+	}
+}
+
+// HasMinSize holds once the deployment is in at least that many nodes
+func HasMinSize(size int) TreeCondition {
+	return func(tree *Tree) error {
+		if tree.Size() < size {
+			return errors.Errorf("%s is in %d nodes instead of at least %d", tree.DeploymentId, tree.Size(), size)
+		}
+
+		return nil
+	}
+}
+
+// IsConsistent holds once every node agrees with its parent and children on the links between them, and every
+// node reaches a root
+func IsConsistent() TreeCondition {
+	return func(tree *Tree) error {
+		for nodeId, treeNode := range tree.Nodes {
+			if treeNode.IsOrphan {
+				return errors.Errorf("%s is an orphan in %s", nodeId, tree.DeploymentId)
+			}
+
+			if tree.Path(nodeId) == nil {
+				return errors.Errorf("%s does not reach a root in %s", nodeId, tree.DeploymentId)
+			}
+
+			if treeNode.Parent != "" && !contains(tree.Nodes[treeNode.Parent].Children, nodeId) {
+				return errors.Errorf("%s has parent %s, which does not have it as a child in %s", nodeId,
+					treeNode.Parent, tree.DeploymentId)
+			}
+
+			for _, childId := range treeNode.Children {
+				child, ok := tree.Nodes[childId]
+				if !ok || child.Parent != nodeId {
+					return errors.Errorf("%s has child %s, which does not have it as its parent in %s", nodeId,
+						childId, tree.DeploymentId)
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+func contains(ids []string, id string) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+
+	return false
+}
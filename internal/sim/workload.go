@@ -0,0 +1,198 @@
+package sim
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/bruno-anjos/cloud-edge-deployment/pkg/archimedes"
+	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
+	"github.com/docker/go-connections/nat"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWorkloadName = "client"
+)
+
+type (
+	// Workload is a group of clients of a deployment in the same location, as the dummy client runs them. Each
+	// client resolves the deployment through archimedes and then does its requests to the instance it got.
+	Workload struct {
+		DeploymentId string
+		// Name is the endpoint of the network the clients are at, so links to it can have their own latency
+		Name     string
+		Clients  int
+		Location publicUtils.Location
+		// Entry is the node the clients resolve the deployment in, defaulting to the fallback
+		Entry string
+		// Requests is how many requests each client does, Interval apart
+		Requests int
+		Interval time.Duration
+		// Port is the port the instances of the deployment listen on, defaulting to DummyPort
+		Port nat.Port
+	}
+
+	// WorkloadResult is what the clients of a workload saw
+	WorkloadResult struct {
+		Requests int
+		Failed   int
+		// ServedBy is how many requests each node served
+		ServedBy map[string]int
+		// Latency is the average latency of the requests that did not fail
+		Latency time.Duration
+	}
+
+	workloadClient struct {
+		workload   *Workload
+		archClient *archimedes.Client
+		transport  *utils.Transport
+	}
+)
+
+// Run runs the workload until every client did its requests. While it runs, the clients count towards the
+// average location of the clients of the deployment the nodes have.
+func (c *Cluster) Run(w *Workload) *WorkloadResult {
+	workload := *w
+	if workload.Name == "" {
+		workload.Name = defaultWorkloadName
+	}
+
+	if workload.Entry == "" {
+		workload.Entry = c.fallback
+	}
+
+	if workload.Port == "" {
+		workload.Port = nat.Port(fmt.Sprintf("%d/%s", DummyPort, utils.TCP))
+	}
+
+	c.addWorkload(w)
+	defer c.removeWorkload(w)
+
+	transport := utils.NewTransport(c.network.Dialer(workload.Name), nil)
+	defer transport.CloseIdleConnections()
+
+	client := &workloadClient{
+		workload:   &workload,
+		archClient: archimedes.NewClientPool(transport).Get(c.config.Archimedes.Addr(workload.Entry)),
+		transport:  transport,
+	}
+
+	var (
+		result = &WorkloadResult{
+			ServedBy: map[string]int{},
+		}
+		totalLatency time.Duration
+		resultLock   sync.Mutex
+		wg           sync.WaitGroup
+	)
+
+	log.Debugf("launching %d clients of %s", workload.Clients, workload.DeploymentId)
+
+	for i := 0; i < workload.Clients; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < workload.Requests; j++ {
+				if j > 0 {
+					time.Sleep(workload.Interval)
+				}
+
+				servedBy, latency, ok := client.doRequest()
+
+				resultLock.Lock()
+				result.Requests++
+				if ok {
+					result.ServedBy[servedBy]++
+					totalLatency += latency
+				} else {
+					result.Failed++
+				}
+				resultLock.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if served := result.Requests - result.Failed; served > 0 {
+		result.Latency = totalLatency / time.Duration(served)
+	}
+
+	return result
+}
+
+// doRequest resolves the deployment and does a request to the instance it resolved to, returning the node that
+// served it and how long both took
+func (w *workloadClient) doRequest() (servedBy string, latency time.Duration, ok bool) {
+	start := time.Now()
+
+	rHost, rPort, status := w.archClient.Resolve(w.workload.DeploymentId, w.workload.Port, w.workload.DeploymentId,
+		&w.workload.Location)
+	if status != http.StatusOK {
+		log.Debugf("got status %d resolving %s", status, w.workload.DeploymentId)
+		return "", 0, false
+	}
+
+	instanceClient := w.transport.NewGenericClient(net.JoinHostPort(rHost, rPort))
+	req := utils.BuildRequest(http.MethodGet, instanceClient.GetHostPort(), "/", nil)
+
+	status, _ = utils.DoRequest(instanceClient.Client, req, nil)
+	if status != http.StatusOK {
+		log.Debugf("got status %d from %s", status, instanceClient.GetHostPort())
+		return "", 0, false
+	}
+
+	return rHost, time.Since(start), true
+}
+
+func (c *Cluster) addWorkload(w *Workload) {
+	c.workloadsLock.Lock()
+	defer c.workloadsLock.Unlock()
+
+	workloads, ok := c.workloads[w.DeploymentId]
+	if !ok {
+		workloads = map[*Workload]struct{}{}
+		c.workloads[w.DeploymentId] = workloads
+	}
+
+	workloads[w] = struct{}{}
+	c.updateClientLocationLocked(w.DeploymentId)
+}
+
+func (c *Cluster) removeWorkload(w *Workload) {
+	c.workloadsLock.Lock()
+	defer c.workloadsLock.Unlock()
+
+	delete(c.workloads[w.DeploymentId], w)
+	c.updateClientLocationLocked(w.DeploymentId)
+}
+
+// updateClientLocationLocked sets the average location of the clients of the deployment to the one of the
+// workloads running, weighted by their clients. With none running, the nodes keep the last one.
+func (c *Cluster) updateClientLocationLocked(deploymentId string) {
+	var (
+		location publicUtils.Location
+		clients  int
+	)
+	for w := range c.workloads[deploymentId] {
+		location.X += w.Location.X * float64(w.Clients)
+		location.Y += w.Location.Y * float64(w.Clients)
+		clients += w.Clients
+	}
+
+	if clients == 0 {
+		return
+	}
+
+	location.X /= float64(clients)
+	location.Y /= float64(clients)
+
+	log.Debugf("clients of %s are at %+v", deploymentId, location)
+	c.SetClientLocation(deploymentId, &location)
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"os"
+)
+
+// Security is what a node authenticates with: the token its requests carry and its mutual TLS, if any. A nil
+// Security authenticates with nothing.
+type Security struct {
+	AuthToken string
+	TLS       *TLS
+}
+
+// LoadSecurityFromEnv loads the security of a process without a configuration, like an instance, from the
+// environment
+func LoadSecurityFromEnv() (*Security, error) {
+	tlsConfig, err := LoadTLSFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Security{
+		AuthToken: os.Getenv(AuthTokenEnvVarName),
+		TLS:       tlsConfig,
+	}, nil
+}
+
+// GetTLS returns the TLS of the security, which is nil if it is disabled
+func (s *Security) GetTLS() *TLS {
+	if s == nil {
+		return nil
+	}
+
+	return s.TLS
+}
+
+// GetAuthToken returns the token of the security, if any
+func (s *Security) GetAuthToken() string {
+	if s == nil {
+		return ""
+	}
+
+	return s.AuthToken
+}
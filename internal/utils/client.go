@@ -1,35 +1,225 @@
 package utils
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"sync"
 	"time"
+
+	"golang.org/x/net/http2"
 )
 
+// Client is the client of a single host. The host never changes, so the same client can be used by concurrent
+// requests.
 type Client interface {
-	SetHostPort(addr string)
 	GetHostPort() string
 }
 
 type GenericClient struct {
 	hostPort string
 	Client   *http.Client
+	// StreamClient has no timeout so it can be used for requests that stream big or long-lived bodies
+	StreamClient *http.Client
+	// H2CClient talks HTTP/2 without TLS, which allows streaming the request body while the response is read
+	H2CClient *http.Client
 }
 
 const (
-	defaultTimeout = 10 * time.Second
+	defaultTimeout      = 10 * time.Second
+	maxIdleConnsPerHost = 16
 )
 
+// DialFunc opens the connections of a transport to the hosts
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Transport has the connections of a node to every host. Clients made from the same transport share them, so the
+// connections to each host are kept alive and reused by whichever client does the next request to it, and share
+// the circuit breakers of the destinations as well. Both of its round trippers retry failed requests and stop
+// trying destinations that keep failing.
+type Transport struct {
+	security       *Security
+	transport      http.RoundTripper
+	http2Transport http.RoundTripper
+	breakers       *circuitBreakers
+	closers        []interface{ CloseIdleConnections() }
+}
+
+var (
+	defaultTransport     *Transport
+	defaultTransportOnce sync.Once
+)
+
+// DefaultTransport returns the transport shared by the clients of a process without a configuration, like an
+// instance, which authenticates with the security in its environment
+func DefaultTransport() *Transport {
+	defaultTransportOnce.Do(func() {
+		security, err := LoadSecurityFromEnv()
+		if err != nil {
+			panic(err)
+		}
+
+		defaultTransport = NewTransport(nil, security)
+	})
+
+	return defaultTransport
+}
+
+// NewTransport returns a transport opening its connections with the dial function, or over the network if it is
+// nil, and authenticating with the security
+func NewTransport(dial DialFunc, security *Security) *Transport {
+	baseTransport := http.DefaultTransport.(*http.Transport).Clone()
+	baseTransport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	if dial != nil {
+		baseTransport.DialContext = dial
+	} else {
+		dial = baseTransport.DialContext
+	}
+
+	var baseHTTP2Transport *http2.Transport
+	if security.GetTLS().IsEnabled() {
+		tlsConfig := security.GetTLS().ClientConfig()
+		baseTransport.TLSClientConfig = tlsConfig
+		// with TLS, HTTP/2 is negotiated in the handshake
+		baseHTTP2Transport = &http2.Transport{
+			TLSClientConfig: tlsConfig,
+			DialTLS: func(network, addr string, config *tls.Config) (net.Conn, error) {
+				conn, err := dial(context.Background(), network, addr)
+				if err != nil {
+					return nil, err
+				}
+
+				tlsConn := tls.Client(conn, config)
+				err = tlsConn.Handshake()
+				if err != nil {
+					_ = conn.Close()
+					return nil, err
+				}
+
+				return tlsConn, nil
+			},
+		}
+	} else {
+		baseHTTP2Transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(context.Background(), network, addr)
+			},
+		}
+	}
+
+	breakers := &circuitBreakers{}
+
+	return &Transport{
+		security:       security,
+		transport:      newSecuredTransport(newResilientTransport(baseTransport, breakers), security),
+		http2Transport: newSecuredTransport(newResilientTransport(baseHTTP2Transport, breakers), security),
+		breakers:       breakers,
+		closers:        []interface{ CloseIdleConnections() }{baseTransport, baseHTTP2Transport},
+	}
+}
+
 func NewGenericClient(addr string) *GenericClient {
+	return DefaultTransport().NewGenericClient(addr)
+}
+
+// NewHTTP2GenericClient returns a client doing every request over HTTP/2, so all of them are multiplexed in a
+// single long-lived connection per host
+func NewHTTP2GenericClient(addr string) *GenericClient {
+	return DefaultTransport().NewHTTP2GenericClient(addr)
+}
+
+func (t *Transport) NewGenericClient(addr string) *GenericClient {
+	return &GenericClient{
+		hostPort:     addr,
+		Client:       &http.Client{Timeout: defaultTimeout, Transport: t.transport},
+		StreamClient: &http.Client{Transport: t.transport},
+		H2CClient:    &http.Client{Transport: t.http2Transport},
+	}
+}
+
+// NewHTTP2GenericClient returns a client of the transport doing every request over HTTP/2
+func (t *Transport) NewHTTP2GenericClient(addr string) *GenericClient {
 	return &GenericClient{
-		hostPort: addr,
-		Client:   &http.Client{Timeout: defaultTimeout},
+		hostPort:     addr,
+		Client:       &http.Client{Timeout: defaultTimeout, Transport: t.http2Transport},
+		StreamClient: &http.Client{Transport: t.http2Transport},
+		H2CClient:    &http.Client{Transport: t.http2Transport},
 	}
 }
 
-func (c *GenericClient) SetHostPort(addr string) {
-	c.hostPort = addr
+// Security returns what the transport authenticates with
+func (t *Transport) Security() *Security {
+	return t.security
+}
+
+// IsCircuitOpen tells whether requests of the transport to the destination are currently failing without being
+// tried
+func (t *Transport) IsCircuitOpen(hostPort string) bool {
+	return t.breakers.isOpen(resolve(hostPort))
+}
+
+// CloseIdleConnections closes the connections of the transport that are not in use
+func (t *Transport) CloseIdleConnections() {
+	for _, closer := range t.closers {
+		closer.CloseIdleConnections()
+	}
 }
 
 func (c *GenericClient) GetHostPort() string {
 	return c.hostPort
 }
+
+// ClientPool has a client per host, created the first time the host is asked for
+type ClientPool struct {
+	newClient func(addr string) Client
+	clients   sync.Map
+}
+
+func NewClientPool(newClient func(addr string) Client) *ClientPool {
+	return &ClientPool{
+		newClient: newClient,
+	}
+}
+
+func (p *ClientPool) Get(addr string) Client {
+	value, ok := p.clients.Load(addr)
+	if !ok {
+		value, _ = p.clients.LoadOrStore(addr, p.newClient(addr))
+	}
+
+	return value.(Client)
+}
+
+// securedTransport does the requests over TLS, if the node uses it, with the token of the node, unless they carry
+// one already
+type securedTransport struct {
+	base     http.RoundTripper
+	security *Security
+}
+
+func newSecuredTransport(base http.RoundTripper, security *Security) http.RoundTripper {
+	if security.GetTLS() == nil && security.GetAuthToken() == "" {
+		return base
+	}
+
+	return &securedTransport{
+		base:     base,
+		security: security,
+	}
+}
+
+func (t *securedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+
+	if t.security.TLS.IsEnabled() {
+		req.URL.Scheme = "https"
+	}
+
+	if req.Header.Get("Authorization") == "" {
+		SetAuthorization(req, t.security.AuthToken)
+	}
+
+	return t.base.RoundTrip(req)
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 )
 
@@ -16,3 +17,51 @@ func SendJSONReplyOK(w http.ResponseWriter, replyContent interface{}) {
 		panic(err)
 	}
 }
+
+// SendStreamReplyOK copies the stream to the reply, flushing after every read so long-lived streams reach
+// the client as they are produced. The stream is closed when the copy ends or the client goes away.
+func SendStreamReplyOK(w http.ResponseWriter, r *http.Request, contentType string, stream io.ReadCloser) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+		_ = stream.Close()
+	}()
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, canFlush := w.(http.Flusher)
+	if canFlush {
+		flusher.Flush()
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := stream.Read(buf)
+		if n > 0 {
+			_, err := w.Write(buf[:n])
+			if err != nil {
+				return err
+			}
+
+			if canFlush {
+				flusher.Flush()
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		} else if readErr != nil {
+			if r.Context().Err() != nil {
+				return nil
+			}
+
+			return readErr
+		}
+	}
+}
@@ -2,10 +2,14 @@ package utils
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 
 	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
 	"github.com/gorilla/mux"
@@ -13,6 +17,12 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// maxDrainedBytes is how much of a reply nobody reads is drained before closing it. Longer replies are cut,
+	// losing the connection, which is cheaper than reading them.
+	maxDrainedBytes = 64 << 10
+)
+
 func resolve(toResolve string) (resolved string) {
 	host, port, err := net.SplitHostPort(toResolve)
 	if err != nil {
@@ -31,6 +41,7 @@ func resolve(toResolve string) (resolved string) {
 }
 
 func BuildRequest(method, host, path string, body interface{}) *http.Request {
+	// the transport switches to https if the node uses TLS
 	hostUrl := url.URL{
 		Scheme: "http",
 		Host:   host,
@@ -64,7 +75,35 @@ func BuildRequest(method, host, path string, body interface{}) *http.Request {
 	return request
 }
 
+// DoRequest does the request, decoding the reply into responseBody, if any. The body of the reply is drained and
+// closed, so the connection is reused, and the reply is only returned for its headers.
 func DoRequest(httpClient *http.Client, request *http.Request, responseBody interface{}) (int, *http.Response) {
+	status, resp := DoStreamRequest(httpClient, request)
+	if resp == nil {
+		return status, nil
+	}
+
+	defer func() {
+		_, _ = io.CopyN(ioutil.Discard, resp.Body, maxDrainedBytes)
+		_ = resp.Body.Close()
+	}()
+
+	// only successful replies have the body, errors may have none
+	if responseBody != nil && resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices &&
+		resp.StatusCode != http.StatusNoContent {
+		err := json.NewDecoder(resp.Body).Decode(responseBody)
+		if err != nil {
+			log.Errorf("error decoding reply to %s %s: %s", request.Method, request.URL.String(), err)
+			return http.StatusInternalServerError, resp
+		}
+	}
+
+	return resp.StatusCode, resp
+}
+
+// DoStreamRequest does the request, leaving the body of the reply to the caller, which has to close it. It is
+// meant for replies that stream, like logs or the output of a command.
+func DoStreamRequest(httpClient *http.Client, request *http.Request) (int, *http.Response) {
 	request.URL.Host = resolve(request.URL.Host)
 
 	log.Debugf("Doing request: %s %s", request.Method, request.URL.String())
@@ -75,16 +114,10 @@ func DoRequest(httpClient *http.Client, request *http.Request, responseBody inte
 
 	resp, err := httpClient.Do(request)
 	if err != nil {
+		log.Debugf("request %s %s failed: %s", request.Method, request.URL.String(), err)
 		return -1, nil
 	}
 
-	if responseBody != nil {
-		err = json.NewDecoder(resp.Body).Decode(responseBody)
-		if err != nil {
-			panic(err)
-		}
-	}
-
 	return resp.StatusCode, resp
 }
 
@@ -101,3 +134,41 @@ func ExtractPathVar(r *http.Request, varName string) (varValue string) {
 
 	return
 }
+
+// IsAuthorized checks that the request carries the token as a bearer token. An empty token authorizes nothing.
+func IsAuthorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(GetBearerToken(r)), []byte(token)) == 1
+}
+
+// GetBearerToken returns the bearer token in the request, if any
+func GetBearerToken(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimPrefix(authorization, "Bearer ")
+}
+
+func SetAuthorization(r *http.Request, token string) {
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// SetStreamBody makes the request stream the body as it is read, instead of sending it all at once
+func SetStreamBody(r *http.Request, body io.Reader) {
+	r.Header.Set("Content-Type", "application/octet-stream")
+	r.GetBody = nil
+	r.ContentLength = -1
+
+	if body == nil {
+		r.Body = http.NoBody
+	} else {
+		r.Body = ioutil.NopCloser(body)
+	}
+}
@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxRequestAttempts = 3
+	retryBaseBackoff   = 100 * time.Millisecond
+	retryMaxBackoff    = 2 * time.Second
+
+	// consecutive failures that open the circuit of a destination
+	circuitFailureThreshold = 5
+	// time an open circuit fails requests before letting one through to check the destination again
+	circuitOpenTimeout = 30 * time.Second
+)
+
+// Circuit states
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+var (
+	ErrCircuitOpen = errors.New("circuit open")
+)
+
+type (
+	// resilientTransport retries requests with idempotent methods that fail, backing off exponentially with
+	// jitter, and fails requests to destinations whose circuit is open without trying them
+	resilientTransport struct {
+		base     http.RoundTripper
+		breakers *circuitBreakers
+	}
+
+	// circuitBreakers has the circuit breaker of each destination
+	circuitBreakers struct {
+		breakers sync.Map
+	}
+
+	// circuitBreaker opens after consecutive failures to a destination. Once open, it fails every request for a
+	// while and then lets a single one through, closing again if it succeeds.
+	circuitBreaker struct {
+		state    int
+		failures int
+		openedAt time.Time
+		lock     sync.Mutex
+	}
+)
+
+func newResilientTransport(base http.RoundTripper, breakers *circuitBreakers) *resilientTransport {
+	return &resilientTransport{
+		base:     base,
+		breakers: breakers,
+	}
+}
+
+func (t *resilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	breaker := t.breakers.get(req.URL.Host)
+
+	canRetry := isIdempotent(req.Method) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+	for attempt := 1; ; attempt++ {
+		if !breaker.allow() {
+			return nil, errors.Wrap(ErrCircuitOpen, req.URL.Host)
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		failed := isFailure(resp, err)
+		if errors.Is(err, context.Canceled) {
+			breaker.release()
+		} else {
+			breaker.record(!failed)
+		}
+
+		if !failed || !canRetry || attempt == maxRequestAttempts || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		backoff := getBackoff(attempt)
+		log.Debugf("retrying %s %s in %s (attempt %d)", req.Method, req.URL, backoff, attempt)
+
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isFailure tells whether the destination failed to handle the request, as opposed to refusing it. The servers
+// never reply with gateway errors for states they expect, like a disabled feature or a missing leader, so these only
+// come from the destination being unreachable or overloaded.
+func isFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// getBackoff returns a random backoff up to the exponential one for the attempt, so clients retrying at the same
+// time spread out
+func getBackoff(attempt int) time.Duration {
+	backoff := retryBaseBackoff << uint(attempt-1)
+	if backoff > retryMaxBackoff {
+		backoff = retryMaxBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
+
+func (c *circuitBreakers) get(hostPort string) *circuitBreaker {
+	value, ok := c.breakers.Load(hostPort)
+	if !ok {
+		value, _ = c.breakers.LoadOrStore(hostPort, &circuitBreaker{})
+	}
+
+	return value.(*circuitBreaker)
+}
+
+func (c *circuitBreakers) isOpen(hostPort string) bool {
+	value, ok := c.breakers.Load(hostPort)
+	if !ok {
+		return false
+	}
+
+	breaker := value.(*circuitBreaker)
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	return breaker.state != circuitClosed && time.Since(breaker.openedAt) < circuitOpenTimeout
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < circuitOpenTimeout {
+			return false
+		}
+
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// only the request checking the destination goes through
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) record(success bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if success {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= circuitFailureThreshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release undoes letting a request through, for requests the client canceled, which tell nothing about the
+// destination
+func (b *circuitBreaker) release() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+	}
+}
@@ -20,22 +20,31 @@ type Route struct {
 	Pattern     string
 	QueryParams []string
 	HandlerFunc http.HandlerFunc
+	// Public routes are reachable without a client certificate when using TLS, for instances and their
+	// clients, and for the deployer-cli, which authenticates with a token instead
+	Public bool
 }
 
-// NewRouter Creates new router with prefix and handlers for routes specified
-func NewRouter(prefix string, routes []Route) (r *mux.Router) {
+// NewRouter Creates new router with prefix and handlers for routes specified. With TLS, the routes that are not
+// public require a client certificate.
+func NewRouter(prefix string, routes []Route, tlsConfig *TLS) (r *mux.Router) {
 	r = mux.NewRouter().StrictSlash(true)
 	s := r.PathPrefix(prefix).Subrouter()
 	for _, route := range routes {
+		handlerFunc := route.HandlerFunc
+		if tlsConfig.IsEnabled() && !route.Public {
+			handlerFunc = requireClientCertificate(handlerFunc)
+		}
+
 		if len(route.QueryParams) > 0 {
 			log.Debugf("registering route for %s with query params", route.Pattern)
-			s.HandleFunc(route.Pattern, route.HandlerFunc).
+			s.HandleFunc(route.Pattern, handlerFunc).
 				Methods(route.Method).
 				Queries(route.QueryParams...).
 				Name(route.Name)
 		} else {
 			log.Debugf("registering route for %s", route.Pattern)
-			s.HandleFunc(route.Pattern, route.HandlerFunc).
+			s.HandleFunc(route.Pattern, handlerFunc).
 				Methods(route.Method).
 				Name(route.Name)
 		}
@@ -43,3 +52,15 @@ func NewRouter(prefix string, routes []Route) (r *mux.Router) {
 
 	return
 }
+
+func requireClientCertificate(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetRequestIdentity(r); !ok {
+			log.Debugf("refused %s %s from %s without a client certificate", r.Method, r.URL.Path, r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		handlerFunc(w, r)
+	}
+}
@@ -1,65 +1,244 @@
 package utils
 
 import (
-	"flag"
+	"context"
 	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 const (
 	// LocalhostAddr contains the default interface address
 	LocalhostAddr = "0.0.0.0"
+
+	// StopTimeout is how long a daemon has to stop gracefully once it is signaled
+	StopTimeout = 30 * time.Second
 )
 
-// StartServer seeds the random generator and starts a server on the
-// specified host and port serving the routes passed with a specified prefix.
-func StartServer(serviceName, hostPort string, port int, prefixPath string, routes []Route) {
-	rand.Seed(time.Now().UnixNano())
+// Daemon is a node component that can be started and stopped, possibly alongside other daemons in the same
+// process
+type Daemon interface {
+	Start() error
+	Stop(ctx context.Context) error
+}
 
-	debug := flag.Bool("d", false, "add debug logs")
-	listenAddr := flag.String("l", LocalhostAddr, "address to listen on")
-	flag.Parse()
+// Server serves the routes of a daemon and keeps track of its background loops, so stopping it stops both
+type Server struct {
+	serviceName string
+	tls         *TLS
+	handler     http.Handler
+	httpServer  *http.Server
+	stopped     chan struct{}
+	stopOnce    sync.Once
+	loops       sync.WaitGroup
 
-	if *debug {
-		log.SetLevel(log.DebugLevel)
+	// the HTTP server hands h2c connections over to the HTTP/2 server, so they have to be closed here
+	hijackedConns     map[net.Conn]struct{}
+	hijackedConnsLock sync.Mutex
+}
+
+// NewServer returns a server for the routes passed with a specified prefix, using mutual TLS if it is given. It
+// does not serve until it is given a listener.
+func NewServer(serviceName, prefixPath string, routes []Route, tlsConfig *TLS) *Server {
+	return &Server{
+		serviceName:   serviceName,
+		tls:           tlsConfig,
+		handler:       NewRouter(prefixPath, routes, tlsConfig),
+		stopped:       make(chan struct{}),
+		hijackedConns: map[net.Conn]struct{}{},
 	}
+}
 
-	log.Debug("starting log in debug mode")
-	r := NewRouter(prefixPath, routes)
+// TLS returns the mutual TLS of the server, which is nil if it is disabled
+func (s *Server) TLS() *TLS {
+	return s.tls
+}
+
+// Handler returns the handler of the routes of the server
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Listen listens on the specified address and port, to serve there once started
+func Listen(listenAddr string, port int) (net.Listener, error) {
+	return net.Listen(TCP, listenAddr+":"+strconv.Itoa(port))
+}
+
+// Serve serves in the background on the listener, with mutual TLS if it is configured. Otherwise it serves h2c,
+// which lets clients that need full duplex streams, such as exec, talk HTTP/2 without TLS.
+func (s *Server) Serve(listener net.Listener) {
+	serve := func() error {
+		return s.httpServer.Serve(listener)
+	}
 
-	var listenAddrPort string
-	if *listenAddr != "" {
-		listenAddrPort = *listenAddr + ":" + strconv.Itoa(port)
+	if s.tls.IsEnabled() {
+		s.httpServer = &http.Server{
+			Handler:   s.handler,
+			TLSConfig: s.tls.ServerConfig(),
+		}
+		serve = func() error {
+			return s.httpServer.ServeTLS(listener, "", "")
+		}
 	} else {
-		listenAddrPort = hostPort
+		s.httpServer = &http.Server{
+			Handler: h2c.NewHandler(s.handler, &http2.Server{}),
+		}
 	}
 
-	log.Infof("%s server listening at %s...\n", serviceName, listenAddrPort)
-	log.Fatal(http.ListenAndServe(listenAddrPort, r))
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.stopped
+		cancel()
+	}()
+
+	// requests see the server stopping through their context, so the long-lived ones return
+	s.httpServer.BaseContext = func(net.Listener) context.Context {
+		return ctx
+	}
+	s.httpServer.ConnState = s.trackHijackedConn
+
+	log.Infof("%s server listening at %s...", s.serviceName, listener.Addr())
+
+	go func() {
+		err := serve()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("%s server stopped serving: %s", s.serviceName, err)
+		}
+	}()
+}
+
+func (s *Server) trackHijackedConn(conn net.Conn, state http.ConnState) {
+	if state != http.StateHijacked {
+		return
+	}
+
+	s.hijackedConnsLock.Lock()
+	s.hijackedConns[conn] = struct{}{}
+	s.hijackedConnsLock.Unlock()
 }
 
-func StartServerWithoutDefaultFlags(serviceName, hostPort string, port int, prefixPath string, routes []Route,
-	debug *bool, listenAddr *string) {
+func (s *Server) closeHijackedConns() {
+	s.hijackedConnsLock.Lock()
+	defer s.hijackedConnsLock.Unlock()
+
+	for conn := range s.hijackedConns {
+		_ = conn.Close()
+	}
+
+	s.hijackedConns = map[net.Conn]struct{}{}
+}
+
+// Go runs the loop in the background until the server is stopped. Loops must return once Stopped is closed.
+func (s *Server) Go(loop func()) {
+	s.loops.Add(1)
+
+	go func() {
+		defer s.loops.Done()
+		loop()
+	}()
+}
+
+// Stopped is closed once the server starts stopping
+func (s *Server) Stopped() <-chan struct{} {
+	return s.stopped
+}
+
+// IsStopped tells whether the server started stopping
+func (s *Server) IsStopped() bool {
+	select {
+	case <-s.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sleep waits for the duration, returning false if the server stopped meanwhile
+func (s *Server) Sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stopped:
+		return false
+	}
+}
+
+// Shutdown stops serving, letting the requests being handled finish, and waits for the background loops to
+// return. If the context ends first, the remaining connections are closed. Requests over h2c connections are not
+// waited for, since those connections are closed as soon as the rest are done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+	})
+
+	var err error
+	if s.httpServer != nil {
+		err = s.httpServer.Shutdown(ctx)
+		if err != nil {
+			_ = s.httpServer.Close()
+		}
+
+		s.closeHijackedConns()
+	}
+
+	loopsDone := make(chan struct{})
+	go func() {
+		s.loops.Wait()
+		close(loopsDone)
+	}()
+
+	select {
+	case <-loopsDone:
+	case <-ctx.Done():
+		if err == nil {
+			err = errors.Wrapf(ctx.Err(), "waiting for %s loops", s.serviceName)
+		}
+	}
+
+	log.Infof("%s server stopped", s.serviceName)
+
+	return err
+}
+
+// RunUntilSignaled seeds the random generator, starts the daemon and runs it until the process is interrupted or
+// terminated, giving it StopTimeout to stop gracefully
+func RunUntilSignaled(daemon Daemon, debug bool) {
 	rand.Seed(time.Now().UnixNano())
 
-	if *debug {
+	if debug {
 		log.SetLevel(log.DebugLevel)
+		log.Debug("starting log in debug mode")
 	}
 
-	log.Debug("starting log in debug mode")
-	r := NewRouter(prefixPath, routes)
-
-	var listenAddrPort string
-	if *listenAddr != "" {
-		listenAddrPort = *listenAddr + ":" + strconv.Itoa(port)
-	} else {
-		listenAddrPort = hostPort
+	err := daemon.Start()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	log.Infof("%s server listening at %s...\n", serviceName, listenAddrPort)
-	log.Fatal(http.ListenAndServe(listenAddrPort, r))
-}
\ No newline at end of file
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	log.Infof("got %s, stopping", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), StopTimeout)
+	defer cancel()
+
+	err = daemon.Stop(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Environment variables with the files mutual TLS is configured with, for the processes that have no
+// configuration of their own, like instances. Daemons take them from their server configuration.
+const (
+	TLSCertEnvVarName = "TLS_CERT_FILE"
+	TLSKeyEnvVarName  = "TLS_KEY_FILE"
+	TLSCAEnvVarName   = "TLS_CA_FILE"
+)
+
+// TLS is the mutual TLS of a node. The certificate is used both as server and client certificate and its common
+// name is the node id, so it must match the node hostname and, since local services are reached through
+// localhost, be valid for localhost as well. Instances only need the CA bundle, to talk to the deployer and
+// archimedes routes that do not require a client certificate. A nil TLS means TLS is disabled.
+type TLS struct {
+	certificate *tls.Certificate
+	caPool      *x509.CertPool
+	identity    string
+}
+
+// LoadTLS loads the TLS of a node from its files. Without a CA bundle TLS is disabled and it returns nil.
+func LoadTLS(certFile, keyFile, caFile string) (*TLS, error) {
+	if caFile == "" {
+		if certFile != "" || keyFile != "" {
+			return nil, errors.New("TLS needs a CA bundle")
+		}
+
+		return nil, nil
+	}
+
+	caBytes, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading TLS CA bundle")
+	}
+
+	t := &TLS{
+		caPool: x509.NewCertPool(),
+	}
+	if !t.caPool.AppendCertsFromPEM(caBytes) {
+		return nil, errors.Errorf("no certificates in CA bundle %s", caFile)
+	}
+
+	if certFile == "" && keyFile == "" {
+		log.Info("using TLS without a client certificate")
+		return t, nil
+	} else if certFile == "" || keyFile == "" {
+		return nil, errors.New("TLS needs both a certificate and a key")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading TLS certificate")
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing TLS certificate")
+	}
+
+	t.certificate = &cert
+	t.identity = cert.Leaf.Subject.CommonName
+
+	log.Infof("using mutual TLS as %s", t.identity)
+
+	return t, nil
+}
+
+// LoadTLSFromEnv loads the TLS of a process without a configuration from the files in the environment
+func LoadTLSFromEnv() (*TLS, error) {
+	return LoadTLS(os.Getenv(TLSCertEnvVarName), os.Getenv(TLSKeyEnvVarName), os.Getenv(TLSCAEnvVarName))
+}
+
+func (t *TLS) IsEnabled() bool {
+	return t != nil
+}
+
+// Identity returns the node id in the certificate
+func (t *TLS) Identity() (id string, ok bool) {
+	if t == nil || t.certificate == nil {
+		return "", false
+	}
+
+	return t.identity, true
+}
+
+// ServerConfig accepts clients without certificates, so instances and their clients can reach the routes they
+// need, but only verified certificates are accepted. Other routes then require one, as done by NewRouter.
+func (t *TLS) ServerConfig() *tls.Config {
+	if t == nil {
+		return nil
+	}
+
+	if t.certificate == nil {
+		panic(errors.New("serving TLS needs a certificate and a key"))
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{*t.certificate},
+		ClientCAs:    t.caPool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+func (t *TLS) ClientConfig() *tls.Config {
+	if t == nil {
+		return nil
+	}
+
+	config := &tls.Config{
+		RootCAs:    t.caPool,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if t.certificate != nil {
+		config.Certificates = []tls.Certificate{*t.certificate}
+	}
+
+	return config
+}
+
+// IsRequestFrom checks that, when using TLS, the request comes from the node with the given id. Without TLS
+// there is no way to check it, so any request is accepted.
+func (t *TLS) IsRequestFrom(r *http.Request, nodeId string) bool {
+	if t == nil {
+		return true
+	}
+
+	id, ok := GetRequestIdentity(r)
+	return ok && id == nodeId
+}
+
+// GetRequestIdentity returns the node id in the verified client certificate of the request
+func GetRequestIdentity(r *http.Request) (id string, ok bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", false
+	}
+
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+// GetResponseIdentity returns the node id in the verified server certificate of the response
+func GetResponseIdentity(resp *http.Response) (id string, ok bool) {
+	if resp == nil || resp.TLS == nil || len(resp.TLS.VerifiedChains) == 0 {
+		return "", false
+	}
+
+	return resp.TLS.VerifiedChains[0][0].Subject.CommonName, true
+}
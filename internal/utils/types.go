@@ -3,6 +3,11 @@ package utils
 const (
 	ServiceEnvVarName  = "SERVICE_ID"
 	InstanceEnvVarName = "INSTANCE_ID"
+
+	// AuthTokenEnvVarName holds the token a process without a configuration authenticates with, like the
+	// deployer-cli with the token of its user. Daemons take the node token, shared with the local scheduler, from
+	// their server configuration.
+	AuthTokenEnvVarName = "AUTH_TOKEN"
 )
 
 const (
@@ -15,7 +15,10 @@ type Client struct {
 }
 
 func NewArchimedesClient(addr string) *Client {
-	newClient := utils.NewGenericClient(addr)
+	return newArchimedesClient(utils.NewGenericClient(addr))
+}
+
+func newArchimedesClient(newClient *utils.GenericClient) *Client {
 	archClient := &Client{
 		GenericClient: newClient,
 	}
@@ -25,6 +28,24 @@ func NewArchimedesClient(addr string) *Client {
 	return archClient
 }
 
+// ClientPool has a client per archimedes node
+type ClientPool struct {
+	pool *utils.ClientPool
+}
+
+// NewClientPool returns a pool whose clients do their requests with the transport
+func NewClientPool(transport *utils.Transport) *ClientPool {
+	return &ClientPool{
+		pool: utils.NewClientPool(func(addr string) utils.Client {
+			return newArchimedesClient(transport.NewGenericClient(addr))
+		}),
+	}
+}
+
+func (p *ClientPool) Get(addr string) *Client {
+	return p.pool.Get(addr).(*Client)
+}
+
 func (c *Client) RegisterService(serviceId string, ports nat.PortSet) (status int) {
 	reqBody := api.RegisterServiceRequestBody{
 		Ports: ports,
@@ -190,8 +211,7 @@ func (c *Client) SetResolvingAnswer(id string, resolved *api.ResolvedDTO) (statu
 }
 
 func (c *Client) handleRedirect(req *http.Request, via []*http.Request) error {
-	log.Debugf("redirecting %s to %s", via[len(via)-1].URL.Host, req.URL.Host)
+	log.Debugf("%s redirected %s to %s", c.GetHostPort(), via[len(via)-1].URL.Host, req.URL.Host)
 
-	c.SetHostPort(req.URL.Host)
 	return nil
 }
@@ -1,7 +1,6 @@
 package autonomic
 
 import (
-	"encoding/json"
 	"net/http"
 
 	api "github.com/bruno-anjos/cloud-edge-deployment/api/autonomic"
@@ -19,6 +18,26 @@ func NewAutonomicClient(addr string) *Client {
 	}
 }
 
+// ClientPool has a client per autonomic node
+type ClientPool struct {
+	pool *utils.ClientPool
+}
+
+// NewClientPool returns a pool whose clients do their requests with the transport
+func NewClientPool(transport *utils.Transport) *ClientPool {
+	return &ClientPool{
+		pool: utils.NewClientPool(func(addr string) utils.Client {
+			return &Client{
+				GenericClient: transport.NewGenericClient(addr),
+			}
+		}),
+	}
+}
+
+func (p *ClientPool) Get(addr string) *Client {
+	return p.pool.Get(addr).(*Client)
+}
+
 func (c *Client) RegisterService(serviceId, strategyId string) (status int) {
 	reqBody := api.AddServiceRequestBody{
 		StrategyId: strategyId,
@@ -101,12 +120,8 @@ func (c *Client) GetClosestNode(location *publicUtils.Location, toExclude map[st
 	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, reqBody)
 
 	var respBody api.ClosestNodeResponseBody
-	status, resp := utils.DoRequest(c.Client, req, nil)
+	status, _ := utils.DoRequest(c.Client, req, &respBody)
 	if status == http.StatusOK {
-		err := json.NewDecoder(resp.Body).Decode(&respBody)
-		if err != nil {
-			panic(err)
-		}
 		closest = respBody
 	} else {
 		closest = ""
@@ -119,16 +134,9 @@ func (c *Client) GetVicinity() (vicinity map[string]interface{}, status int) {
 	path := api.GetVicinityPath()
 	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
 
-	var (
-		respBody api.GetVicinityResponseBody
-		resp     *http.Response
-	)
-	status, resp = utils.DoRequest(c.Client, req, nil)
+	var respBody api.GetVicinityResponseBody
+	status, _ = utils.DoRequest(c.Client, req, &respBody)
 	if status == http.StatusOK {
-		err := json.NewDecoder(resp.Body).Decode(&respBody)
-		if err != nil {
-			panic(err)
-		}
 		vicinity = respBody
 	} else {
 		vicinity = nil
@@ -141,16 +149,9 @@ func (c *Client) GetLocation() (location *publicUtils.Location, status int) {
 	path := api.GetMyLocationPath()
 	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
 
-	var (
-		respBody api.GetMyLocationResponseBody
-		resp     *http.Response
-	)
-	status, resp = utils.DoRequest(c.Client, req, nil)
+	var respBody api.GetMyLocationResponseBody
+	status, _ = utils.DoRequest(c.Client, req, &respBody)
 	if status == http.StatusOK {
-		err := json.NewDecoder(resp.Body).Decode(&respBody)
-		if err != nil {
-			panic(err)
-		}
 		location = respBody
 	} else {
 		location = nil
@@ -163,16 +164,9 @@ func (c *Client) GetLoadForService(serviceId string) (load float64, status int)
 	path := api.GetGetLoadForServicePath(serviceId)
 	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
 
-	var (
-		respBody api.GetLoadForServiceResponseBody
-		resp     *http.Response
-	)
-	status, resp = utils.DoRequest(c.Client, req, nil)
+	var respBody api.GetLoadForServiceResponseBody
+	status, _ = utils.DoRequest(c.Client, req, &respBody)
 	if status == http.StatusOK {
-		err := json.NewDecoder(resp.Body).Decode(&respBody)
-		if err != nil {
-			panic(err)
-		}
 		load = respBody
 	}
 
@@ -1,15 +1,22 @@
 package deployer
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/bruno-anjos/cloud-edge-deployment/api/archimedes"
 
 	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
 	publicUtils "github.com/bruno-anjos/cloud-edge-deployment/pkg/utils"
 	"github.com/docker/go-connections/nat"
@@ -54,14 +61,38 @@ func (c *Client) GetServices() (serviceIds []string, status int) {
 	return
 }
 
+// RegisterService registers the service in the node. The owner is only kept if this client authenticates as
+// an admin, otherwise the deployer makes the authenticated user the owner.
 func (c *Client) RegisterService(serviceId string, static bool,
-	deploymentYamlBytes []byte, parent, grandparent *utils.Node) (status int) {
+	deploymentYamlBytes []byte, parent, grandparent *utils.Node, owner string) (status int) {
 	reqBody := api.RegisterServiceRequestBody{
 		Parent:              parent,
 		Grandparent:         grandparent,
 		DeploymentId:        serviceId,
 		Static:              static,
 		DeploymentYAMLBytes: deploymentYamlBytes,
+		Owner:               owner,
+	}
+	path := api.GetDeploymentsPath()
+	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, reqBody)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
+// RegisterMigratedService registers the service in the node, telling it to take over the instances the service
+// has in origin
+func (c *Client) RegisterMigratedService(serviceId string, static bool, deploymentYamlBytes []byte,
+	parent, grandparent, origin *utils.Node, owner string) (status int) {
+	reqBody := api.RegisterServiceRequestBody{
+		Parent:              parent,
+		Grandparent:         grandparent,
+		DeploymentId:        serviceId,
+		Static:              static,
+		DeploymentYAMLBytes: deploymentYamlBytes,
+		MigratingFrom:       origin,
+		Owner:               owner,
 	}
 	path := api.GetDeploymentsPath()
 	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, reqBody)
@@ -98,6 +129,17 @@ func (c *Client) DeleteService(serviceId string) (status int) {
 	return
 }
 
+// DeleteMigratedService deletes the service from the node it was migrated away from
+func (c *Client) DeleteMigratedService(serviceId string) (status int) {
+	path := api.GetServicePath(serviceId)
+	req := utils.BuildRequest(http.MethodDelete, c.GetHostPort(), path, nil)
+	req.URL.RawQuery = url.Values{api.MigratedQueryParam: {strconv.FormatBool(true)}}.Encode()
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
 func (c *Client) RegisterServiceInstance(serviceId, instanceId string, static bool,
 	portTranslation nat.PortMap, local bool) (status int) {
 	reqBody := api.RegisterServiceInstanceRequestBody{
@@ -113,6 +155,16 @@ func (c *Client) RegisterServiceInstance(serviceId, instanceId string, static bo
 	return
 }
 
+// DeleteServiceInstance removes an instance that is gone, e.g. whose container was lost by the scheduler
+func (c *Client) DeleteServiceInstance(serviceId, instanceId string) (status int) {
+	path := api.GetServiceInstancePath(serviceId, instanceId)
+	req := utils.BuildRequest(http.MethodDelete, c.GetHostPort(), path, nil)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
 func (c *Client) RegisterHearbeatServiceInstance(serviceId, instanceId string) (status int) {
 	path := api.GetServiceInstanceAlivePath(serviceId, instanceId)
 	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, nil)
@@ -131,6 +183,93 @@ func (c *Client) SendHearbeatServiceInstance(serviceId, instanceId string) (stat
 	return
 }
 
+// GetDeploymentLogs returns a stream with the logs of an instance of the deployment running in the deployer
+// node or below it in the hierarchy. The caller is responsible for closing it.
+func (c *Client) GetDeploymentLogs(deploymentId, instanceId string, options *scheduler.LogsOptionsDTO) (
+	logs io.ReadCloser, status int) {
+	query := options.ToQuery()
+	if instanceId != "" {
+		query.Set(api.InstanceQueryParam, instanceId)
+	}
+
+	path := api.GetDeploymentLogsPath(deploymentId)
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+	req.URL.RawQuery = query.Encode()
+
+	var resp *http.Response
+	status, resp = utils.DoStreamRequest(c.StreamClient, req)
+	if status == http.StatusOK {
+		logs = resp.Body
+	} else if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	return
+}
+
+// Exec runs the command in an instance of the deployment running in the deployer node or below it in the
+// hierarchy, with stdin as its input. The response body streams the command output and, once it is read to the
+// end, the response trailer has the exit code.
+func (c *Client) Exec(deploymentId, instanceId string, cmd []string, stdin io.Reader) (
+	resp *http.Response, status int) {
+	query := url.Values{scheduler.ExecCmdQueryParam: cmd}
+	query.Set(api.InstanceQueryParam, instanceId)
+
+	path := api.GetDeploymentExecPath(deploymentId)
+	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, nil)
+	req.URL.RawQuery = query.Encode()
+	utils.SetStreamBody(req, stdin)
+
+	status, resp = utils.DoStreamRequest(c.H2CClient, req)
+	if status != http.StatusOK && resp != nil {
+		_ = resp.Body.Close()
+		resp = nil
+	}
+
+	return
+}
+
+// PrePullImage hints the deployer that a deployment with the given image is about to be extended to it
+func (c *Client) PrePullImage(image *scheduler.ImageDTO) (status int) {
+	var reqBody api.PrePullImageRequestBody
+	reqBody = *image
+
+	path := api.GetPrePullImagePath()
+	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, reqBody)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
+// ReportInstanceFailed tells the deployer the instance failed to start, so it will never heartbeat
+func (c *Client) ReportInstanceFailed(serviceId, instanceId, reason string) (status int) {
+	reqBody := api.InstanceHealthRequestBody{
+		Failed: true,
+		Reason: reason,
+	}
+
+	path := api.GetServiceInstanceHealthPath(serviceId, instanceId)
+	req := utils.BuildRequest(http.MethodPut, c.GetHostPort(), path, reqBody)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
+func (c *Client) SetInstanceHealth(serviceId, instanceId string, crashLooping bool) (status int) {
+	reqBody := api.InstanceHealthRequestBody{
+		CrashLooping: crashLooping,
+	}
+
+	path := api.GetServiceInstanceHealthPath(serviceId, instanceId)
+	req := utils.BuildRequest(http.MethodPut, c.GetHostPort(), path, reqBody)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
 func (c *Client) WarnOfDeadChild(serviceId, deadChildId string, grandChild *utils.Node,
 	alternatives map[string]*utils.Node, location *publicUtils.Location) (status int) {
 	var reqBody api.DeadChildRequestBody
@@ -235,15 +374,88 @@ func (c *Client) GetHierarchyTable() (table map[string]*api.HierarchyEntryDTO, s
 	return
 }
 
-func (c *Client) SetParentAlive(parentId string) (status int) {
-	path := api.GetParentAlivePath(parentId)
-	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, nil)
+// GetInstances returns the instances, mapped to their deployments, that are expected to be running in this node
+func (c *Client) GetInstances() (instances map[string]string, status int) {
+	path := api.GetInstancesPath()
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	var resp api.GetInstancesResponseBody
+	status, _ = utils.DoRequest(c.Client, req, &resp)
+
+	instances = resp
+
+	return
+}
+
+// SendHeartbeat tells the deployer node, a neighbour of the sender, that the sender is alive along with the
+// summary of the deployments they share
+func (c *Client) SendHeartbeat(senderId string, heartbeat *api.HeartbeatDTO) (status int) {
+	var reqBody api.HeartbeatRequestBody
+	reqBody = *heartbeat
+
+	path := api.GetHeartbeatPath(senderId)
+	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, reqBody)
 
 	status, _ = utils.DoRequest(c.Client, req, nil)
 
 	return
 }
 
+func (c *Client) GetNeighbours() (neighbours map[string]*api.NeighbourDTO, status int) {
+	path := api.GetNeighboursPath()
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	var resp api.GetNeighboursResponseBody
+	status, _ = utils.DoRequest(c.Client, req, &resp)
+	if status == http.StatusOK {
+		neighbours = resp
+	}
+
+	return
+}
+
+// Ping checks that the deployer node replies within the timeout
+func (c *Client) Ping(timeout time.Duration) (status int) {
+	path := api.GetWhoAreYouPath()
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	return c.doRequestWithTimeout(req, timeout, nil)
+}
+
+// ProbeNode asks the deployer node to ping the node on behalf of this one, replying within the timeout
+func (c *Client) ProbeNode(nodeId string, timeout time.Duration) (status int) {
+	path := api.GetProbePath(nodeId)
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	return c.doRequestWithTimeout(req, timeout, nil)
+}
+
+// WhoAreYou returns the deployer node id. When using TLS, the id is the one in the deployer certificate.
+func (c *Client) WhoAreYou() (id string, status int) {
+	path := api.GetWhoAreYouPath()
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	var respBody api.WhoAreYouResponseBody
+	status, resp := utils.DoRequest(c.Client, req, &respBody)
+	if status != http.StatusOK {
+		return
+	}
+
+	if resp.TLS != nil {
+		var ok bool
+		id, ok = utils.GetResponseIdentity(resp)
+		if !ok {
+			status = http.StatusUnauthorized
+		}
+
+		return
+	}
+
+	id = respBody
+
+	return
+}
+
 func (c *Client) AddNode(nodeAddr string) (status int) {
 	var reqBody api.AddNodeRequestBody
 	reqBody = nodeAddr
@@ -263,8 +475,8 @@ func (c *Client) SendInstanceHeartbeatToDeployerPeriodically() {
 	status := c.RegisterHearbeatServiceInstance(serviceId, instanceId)
 	switch status {
 	case http.StatusConflict:
-		log.Debugf("service %s instance %s already has a heartbeat sender", serviceId, instanceId)
-		return
+		// the deployer already knows this instance, which happens when its container was restarted
+		log.Debugf("service %s instance %s was already registered, resuming heartbeats", serviceId, instanceId)
 	case http.StatusOK:
 	default:
 		panic(errors.New(fmt.Sprintf("received unexpected status %d", status)))
@@ -342,32 +554,62 @@ func (c *Client) RedirectDownTheTree(deploymentId string, location *publicUtils.
 	path := api.GetRedirectDownTheTreePath(deploymentId)
 	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, reqBody)
 
-	var (
-		resp     *http.Response
-		respBody api.RedirectClientDownTheTreeResponseBody
-	)
-	status, resp = utils.DoRequest(c.Client, req, nil)
+	var respBody api.RedirectClientDownTheTreeResponseBody
+	status, _ = utils.DoRequest(c.Client, req, &respBody)
 	if status == http.StatusOK {
-		err := json.NewDecoder(resp.Body).Decode(&respBody)
-		if err != nil {
-			panic(err)
-		}
 		redirectTo = respBody
 	}
 
 	return
 }
 
+// GetFallback returns the live fallback the deployer node picks, with the highest priority
 func (c *Client) GetFallback() (fallback string, status int) {
 	path := api.GetGetFallbackIdPath()
 	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
 
-	var (
-		respBody api.GetFallbackResponseBody
-	)
+	var respBody api.GetFallbackResponseBody
 	status, _ = utils.DoRequest(c.Client, req, &respBody)
+	if status == http.StatusOK {
+		fallback = respBody
+	}
 
-	fallback = respBody
+	return
+}
+
+// GetFallbacks returns the candidate fallbacks of the deployer node, as last checked
+func (c *Client) GetFallbacks() (fallbacks []*api.FallbackDTO, status int) {
+	path := api.GetFallbacksPath()
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	var resp api.GetFallbacksResponseBody
+	status, _ = utils.DoRequest(c.Client, req, &resp)
+	if status == http.StatusOK {
+		fallbacks = resp
+	}
+
+	return
+}
+
+// SetFallback adds the node as a candidate fallback of the deployer node or changes its priority
+func (c *Client) SetFallback(nodeId string, priority int) (status int) {
+	reqBody := api.SetFallbackRequestBody{
+		Priority: priority,
+	}
+
+	path := api.GetFallbackNodePath(nodeId)
+	req := utils.BuildRequest(http.MethodPut, c.GetHostPort(), path, reqBody)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
+func (c *Client) DeleteFallback(nodeId string) (status int) {
+	path := api.GetFallbackNodePath(nodeId)
+	req := utils.BuildRequest(http.MethodDelete, c.GetHostPort(), path, nil)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
 
 	return
 }
@@ -404,3 +646,235 @@ func (c *Client) SetExploring(deploymentId, childId string) (status int) {
 
 	return
 }
+
+// SetSecret creates or replaces the secret in the secrets store of the deployer
+// SetSecret sets the secret, which only deployments of the users, or of admins, may reference
+func (c *Client) SetSecret(secretName string, secret api.SecretDTO, users []string) (status int) {
+	reqBody := api.SetSecretRequestBody{
+		Values: secret,
+		Users:  users,
+	}
+
+	path := api.GetSecretPath(secretName)
+	req := utils.BuildRequest(http.MethodPut, c.GetHostPort(), path, reqBody)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
+func (c *Client) DeleteSecret(secretName string) (status int) {
+	path := api.GetSecretPath(secretName)
+	req := utils.BuildRequest(http.MethodDelete, c.GetHostPort(), path, nil)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
+// GetDeploymentSecrets returns the secrets referenced by the deployment, resolved up the hierarchy from the
+// secrets store of its root. Only children of the deployment in the deployer node get them.
+func (c *Client) GetDeploymentSecrets(deploymentId string) (secrets map[string]api.SecretDTO, status int) {
+	path := api.GetDeploymentSecretsPath(deploymentId)
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	var resp api.GetDeploymentSecretsResponseBody
+	status, _ = utils.DoRequest(c.Client, req, &resp)
+	if status == http.StatusOK {
+		secrets = resp
+	}
+
+	return
+}
+
+// UpdateConfigMap replaces the files of the config map in the deployment, here and down the hierarchy
+func (c *Client) UpdateConfigMap(deploymentId, configMapName string, data map[string]string) (status int) {
+	var reqBody api.UpdateConfigMapRequestBody
+	reqBody = data
+
+	path := api.GetDeploymentConfigMapPath(deploymentId, configMapName)
+	req := utils.BuildRequest(http.MethodPut, c.GetHostPort(), path, reqBody)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
+// GetDeploymentTopology returns the whole tree of the deployment, from its root, as seen by the deployer node
+func (c *Client) GetDeploymentTopology(deploymentId string) (topology *api.TopologyNodeDTO, status int) {
+	path := api.GetDeploymentTopologyPath(deploymentId)
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	return c.doTopologyRequest(c.Client, req)
+}
+
+// GetChildTopology returns the subtree of the deployment below the child, which is the deployer node, replying
+// within the timeout
+func (c *Client) GetChildTopology(deploymentId, childId string, timeout time.Duration) (
+	topology *api.TopologyNodeDTO, status int) {
+	path := api.GetDeploymentChildPath(deploymentId, childId)
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+	req.URL.RawQuery = url.Values{
+		api.TopologyTimeoutQueryParam: {strconv.FormatInt(timeout.Milliseconds(), 10)},
+	}.Encode()
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	return c.doTopologyRequest(c.StreamClient, req.WithContext(ctx))
+}
+
+func (c *Client) doTopologyRequest(httpClient *http.Client, req *http.Request) (topology *api.TopologyNodeDTO,
+	status int) {
+	var resp api.GetTopologyResponseBody
+	status, _ = utils.DoRequest(httpClient, req, &resp)
+	if status == http.StatusOK {
+		topology = &resp
+	}
+
+	return
+}
+
+// ForwardEvent sends an event of the deployment to the deployer node, its parent, to be published there
+func (c *Client) ForwardEvent(event *api.EventDTO) (status int) {
+	var reqBody api.ForwardEventRequestBody
+	reqBody = *event
+
+	path := api.GetDeploymentEventsPath(event.DeploymentId)
+	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, reqBody)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
+// StreamEvents returns the stream of server-sent events of the deployer node, only with the events of the
+// deployment if one is given. The caller is responsible for closing it.
+func (c *Client) StreamEvents(deploymentId string) (events *EventReader, status int) {
+	path := api.GetEventsPath()
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+	if deploymentId != "" {
+		req.URL.RawQuery = url.Values{api.EventsDeploymentQueryParam: {deploymentId}}.Encode()
+	}
+
+	var resp *http.Response
+	status, resp = utils.DoStreamRequest(c.StreamClient, req)
+	if status == http.StatusOK {
+		events = NewEventReader(resp.Body)
+	} else if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	return
+}
+
+// EventReader reads events from a stream of server-sent events
+type EventReader struct {
+	stream  io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+func NewEventReader(stream io.ReadCloser) *EventReader {
+	return &EventReader{
+		stream:  stream,
+		scanner: bufio.NewScanner(stream),
+	}
+}
+
+// Next blocks until the next event arrives, skipping comments and fields other than data. It returns io.EOF
+// when the stream ends.
+func (e *EventReader) Next() (*api.EventDTO, error) {
+	var data []byte
+	for e.scanner.Scan() {
+		line := e.scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			if len(data) == 0 {
+				continue
+			}
+
+			event := &api.EventDTO{}
+			err := json.Unmarshal(data, event)
+			if err != nil {
+				return nil, errors.Wrap(err, "error decoding event")
+			}
+
+			return event, nil
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimSpace(line[len("data:"):])...)
+		}
+	}
+
+	if err := e.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+func (e *EventReader) Close() error {
+	return e.stream.Close()
+}
+
+// RequestRootVote asks the deployer node, a replica of the root, for its vote to lead the root replicas in
+// the term
+func (c *Client) RequestRootVote(term uint64, candidateId string, lastTerm, version uint64,
+	timeout time.Duration) (voteGranted bool, replyTerm uint64, status int) {
+	reqBody := api.RootVoteRequestBody{
+		Term:        term,
+		CandidateId: candidateId,
+		LastTerm:    lastTerm,
+		Version:     version,
+	}
+
+	path := api.GetRootVotePath()
+	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, reqBody)
+
+	var resp api.RootVoteResponseBody
+	status = c.doRequestWithTimeout(req, timeout, &resp)
+
+	return resp.VoteGranted, resp.Term, status
+}
+
+// AppendRoots replicates the root entries of the leader to the deployer node, a replica of the root. It also
+// works as the heartbeat of the leader.
+func (c *Client) AppendRoots(term uint64, leaderId string, version uint64,
+	roots map[string]*api.ReplicatedRootDTO, timeout time.Duration) (success bool, replyTerm uint64, status int) {
+	reqBody := api.AppendRootsRequestBody{
+		Term:     term,
+		LeaderId: leaderId,
+		Version:  version,
+		Roots:    roots,
+	}
+
+	path := api.GetRootAppendPath()
+	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, reqBody)
+
+	var resp api.AppendRootsResponseBody
+	status = c.doRequestWithTimeout(req, timeout, &resp)
+
+	return resp.Success, resp.Term, status
+}
+
+// GetRootLeader returns the replica of the root the deployer node knows to be leading
+func (c *Client) GetRootLeader(timeout time.Duration) (leader *api.RootLeaderDTO, status int) {
+	path := api.GetRootLeaderPath()
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	var resp api.GetRootLeaderResponseBody
+	status = c.doRequestWithTimeout(req, timeout, &resp)
+	if status == http.StatusOK {
+		leader = &resp
+	}
+
+	return
+}
+
+func (c *Client) doRequestWithTimeout(req *http.Request, timeout time.Duration, respBody interface{}) (status int) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	status, _ = utils.DoRequest(c.Client, req.WithContext(ctx), respBody)
+
+	return
+}
@@ -0,0 +1,124 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	api "github.com/bruno-anjos/cloud-edge-deployment/api/deployer"
+	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
+	"github.com/pkg/errors"
+)
+
+// ClientPool has a client per deployer node, all doing their requests over HTTP/2, so the requests to each node
+// are multiplexed in a long-lived connection instead of opening one per call
+type ClientPool struct {
+	pool *utils.ClientPool
+}
+
+func NewClientPool(transport *utils.Transport) *ClientPool {
+	return &ClientPool{
+		pool: utils.NewClientPool(func(addr string) utils.Client {
+			return &Client{
+				GenericClient: transport.NewHTTP2GenericClient(addr),
+			}
+		}),
+	}
+}
+
+// Get returns the client of the deployer node listening at the address
+func (p *ClientPool) Get(addr string) *Client {
+	return p.pool.Get(addr).(*Client)
+}
+
+// ControlStream is a long-lived stream of control frames to a deployer node, sent as newline delimited JSON in
+// the body of a single HTTP/2 request. It breaks when the node goes away and a new one has to be opened.
+type ControlStream struct {
+	writer *io.PipeWriter
+	body   io.ReadCloser
+	cancel context.CancelFunc
+	lock   sync.Mutex
+}
+
+var (
+	errControlStreamTimeout = errors.New("timed out sending control frame")
+)
+
+// OpenControlStream opens a control stream from the sender to the deployer node, giving up if the node does not
+// accept it within the timeout. The timeout only bounds the opening, not the stream.
+func (c *Client) OpenControlStream(senderId string, timeout time.Duration) (stream *ControlStream, status int) {
+	reader, writer := io.Pipe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	timer := time.AfterFunc(timeout, cancel)
+
+	path := api.GetControlStreamPath(senderId)
+	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, nil).WithContext(ctx)
+	utils.SetStreamBody(req, reader)
+
+	var resp *http.Response
+	status, resp = utils.DoStreamRequest(c.H2CClient, req)
+	if !timer.Stop() && status == http.StatusOK {
+		// the deadline went off as the node accepted the stream, which is cancelled already
+		status = -1
+	}
+
+	if status != http.StatusOK {
+		cancel()
+		_ = writer.Close()
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+
+		return
+	}
+
+	stream = &ControlStream{
+		writer: writer,
+		body:   resp.Body,
+		cancel: cancel,
+	}
+
+	// the node replies with nothing, so its body only ends when the stream does
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = writer.CloseWithError(io.ErrClosedPipe)
+	}()
+
+	return
+}
+
+// Send sends the frame, closing the stream if the node does not take it within the timeout
+func (s *ControlStream) Send(frame *api.ControlFrameDTO, timeout time.Duration) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return errors.Wrap(err, "error encoding control frame")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sent := make(chan error, 1)
+	go func() {
+		_, writeErr := s.writer.Write(append(data, '\n'))
+		sent <- writeErr
+	}()
+
+	select {
+	case err = <-sent:
+		return err
+	case <-time.After(timeout):
+		s.Close()
+		return errControlStreamTimeout
+	}
+}
+
+func (s *ControlStream) Close() {
+	_ = s.writer.Close()
+	_ = s.body.Close()
+	s.cancel()
+}
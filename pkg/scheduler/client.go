@@ -1,7 +1,9 @@
 package scheduler
 
 import (
+	"io"
 	"net/http"
+	"net/url"
 
 	api "github.com/bruno-anjos/cloud-edge-deployment/api/scheduler"
 	"github.com/bruno-anjos/cloud-edge-deployment/internal/utils"
@@ -18,14 +20,39 @@ func NewSchedulerClient(addr string) *Client {
 	}
 }
 
-func (c *Client) StartInstance(serviceName, imageName string, ports nat.PortSet, static bool,
-	envVars []string) (status int) {
+// ClientPool has a client per scheduler node
+type ClientPool struct {
+	pool *utils.ClientPool
+}
+
+// NewClientPool returns a pool whose clients do their requests with the transport
+func NewClientPool(transport *utils.Transport) *ClientPool {
+	return &ClientPool{
+		pool: utils.NewClientPool(func(addr string) utils.Client {
+			return &Client{
+				GenericClient: transport.NewGenericClient(addr),
+			}
+		}),
+	}
+}
+
+func (p *ClientPool) Get(addr string) *Client {
+	return p.pool.Get(addr).(*Client)
+}
+
+func (c *Client) StartInstance(serviceName string, image *api.ImageDTO, ports nat.PortSet, static bool,
+	envVars []string, volumes []*api.VolumeDTO, configMaps []*api.ConfigMapDTO, snapshot *api.SnapshotDTO,
+	restartPolicy string) (status int) {
 	reqBody := api.StartInstanceRequestBody{
-		ServiceName: serviceName,
-		ImageName:   imageName,
-		Ports:       ports,
-		Static:      static,
-		EnvVars:     envVars,
+		ServiceName:   serviceName,
+		Image:         image,
+		Ports:         ports,
+		Static:        static,
+		EnvVars:       envVars,
+		Volumes:       volumes,
+		Snapshot:      snapshot,
+		RestartPolicy: restartPolicy,
+		ConfigMaps:    configMaps,
 	}
 
 	path := api.GetInstancesPath()
@@ -36,6 +63,19 @@ func (c *Client) StartInstance(serviceName, imageName string, ports nat.PortSet,
 	return
 }
 
+// PullImage asks the scheduler to pull the image in the background, according to its pull policy
+func (c *Client) PullImage(image *api.ImageDTO) (status int) {
+	var reqBody api.PullImageRequestBody
+	reqBody = *image
+
+	path := api.GetImagesPath()
+	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, reqBody)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
 func (c *Client) StopInstance(instanceId string) (status int) {
 	path := api.GetInstancePath(instanceId)
 	req := utils.BuildRequest(http.MethodDelete, c.GetHostPort(), path, nil)
@@ -53,3 +93,92 @@ func (c *Client) StopAllInstances() (status int) {
 
 	return
 }
+
+func (c *Client) GetInstanceStats(instanceId string) (stats *api.InstanceStatsDTO, status int) {
+	path := api.GetInstanceStatsPath(instanceId)
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	var resp api.GetInstanceStatsResponseBody
+	status, _ = utils.DoRequest(c.Client, req, &resp)
+
+	stats = &resp
+
+	return
+}
+
+// DeleteDeployment stops every instance of the deployment in the node and applies the reclaim policy of
+// its volumes
+func (c *Client) DeleteDeployment(deploymentId string) (status int) {
+	path := api.GetDeploymentPath(deploymentId)
+	req := utils.BuildRequest(http.MethodDelete, c.GetHostPort(), path, nil)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
+// UpdateConfigMap changes the files of the config map in the instances of the deployment running in the scheduler
+func (c *Client) UpdateConfigMap(deploymentId string, configMap *api.ConfigMapDTO) (status int) {
+	var reqBody api.UpdateConfigMapRequestBody
+	reqBody = *configMap
+
+	path := api.GetDeploymentConfigMapPath(deploymentId, configMap.Name)
+	req := utils.BuildRequest(http.MethodPut, c.GetHostPort(), path, reqBody)
+
+	status, _ = utils.DoRequest(c.Client, req, nil)
+
+	return
+}
+
+// GetVolumeSnapshot returns a tar stream with the contents of the given instance volume. The caller is
+// responsible for closing it.
+func (c *Client) GetVolumeSnapshot(instanceId, volumeName string) (snapshot io.ReadCloser, status int) {
+	path := api.GetInstanceVolumePath(instanceId, volumeName)
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+
+	var resp *http.Response
+	status, resp = utils.DoStreamRequest(c.StreamClient, req)
+	if status == http.StatusOK {
+		snapshot = resp.Body
+	} else if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	return
+}
+
+// GetInstanceLogs returns a stream with the logs of the instance, which only ends when the instance stops if
+// the logs are followed. The caller is responsible for closing it.
+func (c *Client) GetInstanceLogs(instanceId string, options *api.LogsOptionsDTO) (logs io.ReadCloser,
+	status int) {
+	path := api.GetInstanceLogsPath(instanceId)
+	req := utils.BuildRequest(http.MethodGet, c.GetHostPort(), path, nil)
+	req.URL.RawQuery = options.ToQuery().Encode()
+
+	var resp *http.Response
+	status, resp = utils.DoStreamRequest(c.StreamClient, req)
+	if status == http.StatusOK {
+		logs = resp.Body
+	} else if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	return
+}
+
+// Exec runs the command in the instance with stdin as its input. The response body streams the command output
+// and, once it is read to the end, the response trailer has the exit code.
+func (c *Client) Exec(instanceId string, cmd []string, stdin io.Reader) (resp *http.Response, status int) {
+	path := api.GetInstanceExecPath(instanceId)
+	req := utils.BuildRequest(http.MethodPost, c.GetHostPort(), path, nil)
+	req.URL.RawQuery = url.Values{api.ExecCmdQueryParam: cmd}.Encode()
+	utils.SetStreamBody(req, stdin)
+
+	status, resp = utils.DoStreamRequest(c.H2CClient, req)
+	if status != http.StatusOK && resp != nil {
+		_ = resp.Body.Close()
+		resp = nil
+	}
+
+	return
+}
@@ -0,0 +1,35 @@
+#!/bin/bash
+
+# Generates a CA and a certificate for each node given, to run with mutual TLS. Each node certificate has the
+# node hostname as common name, which becomes the node id, and is valid for localhost as well.
+#
+# usage: gen_certs.sh out_dir hostname [hostname...]
+
+set -e
+
+if [ $# -lt 2 ]; then
+	echo "usage: gen_certs.sh out_dir hostname [hostname...]"
+	exit 1
+fi
+
+OUT_DIR=$1
+shift
+
+mkdir -p "$OUT_DIR"
+
+if [ ! -f "$OUT_DIR"/ca.pem ]; then
+	openssl req -x509 -newkey rsa:4096 -nodes -days 3650 -subj "/CN=cloud-edge-deployment-ca" \
+		-keyout "$OUT_DIR"/ca-key.pem -out "$OUT_DIR"/ca.pem
+fi
+
+for NODE in "$@"; do
+	openssl req -newkey rsa:2048 -nodes -subj "/CN=$NODE" \
+		-keyout "$OUT_DIR"/"$NODE"-key.pem -out "$OUT_DIR"/"$NODE".csr
+
+	openssl x509 -req -days 365 -in "$OUT_DIR"/"$NODE".csr \
+		-CA "$OUT_DIR"/ca.pem -CAkey "$OUT_DIR"/ca-key.pem -CAcreateserial -out "$OUT_DIR"/"$NODE".pem \
+		-extfile <(printf "subjectAltName=DNS:%s,DNS:localhost,IP:127.0.0.1\nextendedKeyUsage=serverAuth,clientAuth" \
+			"$NODE")
+
+	rm "$OUT_DIR"/"$NODE".csr
+done